@@ -8,8 +8,10 @@ import (
 	"log"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
+	"sync"
+
+	"github.com/soyeahso/hunter3/internal/logfile"
 )
 
 // MCP Protocol Types
@@ -94,23 +96,8 @@ type ListToolsResult struct {
 var logger *log.Logger
 
 func initLogger() {
-	// Create logs directory if it doesn't exist
-	logsDir := "/home/genoeg/.hunter3/logs"
-	if err := os.MkdirAll(logsDir, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create logs directory: %v\n", err)
-		return
-	}
-
-	// Open log file
-	logFile := filepath.Join(logsDir, "mcp-curl.log")
-	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to open log file: %v\n", err)
-		return
-	}
-
-	// Create logger that writes to both file and stderr
-	logger = log.New(io.MultiWriter(f, os.Stderr), "[mcp-curl] ", log.LstdFlags)
+	// Log to stderr and to a file rotated by size and readable only by the owner
+	logger = logfile.NewLogger("mcp-curl")
 	logger.Println("MCP Curl server starting...")
 }
 
@@ -526,6 +513,20 @@ func (s *MCPServer) executeCurl(id interface{}, args map[string]interface{}) {
 	s.sendResponse(id, result)
 }
 
+// stdoutMu serializes writes to stdoutWriter so that concurrent responses
+// can never interleave JSON-RPC lines on the protocol stream.
+var (
+	stdoutMu     sync.Mutex
+	stdoutWriter io.Writer = os.Stdout
+)
+
+// writeMessage writes a single newline-terminated JSON-RPC message to stdout.
+func writeMessage(data []byte) {
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+	stdoutWriter.Write(append(data, '\n'))
+}
+
 func (s *MCPServer) sendResponse(id interface{}, result interface{}) {
 	resp := JSONRPCResponse{
 		JSONRPC: "2.0",
@@ -540,7 +541,7 @@ func (s *MCPServer) sendResponse(id interface{}, result interface{}) {
 		return
 	}
 
-	fmt.Println(string(data))
+	writeMessage(data)
 	logger.Printf("Sent response for request ID: %v\n", id)
 }
 
@@ -564,5 +565,5 @@ func (s *MCPServer) sendError(id interface{}, code int, message string, data int
 		return
 	}
 
-	fmt.Println(string(jsonData))
+	writeMessage(jsonData)
 }
@@ -2,17 +2,25 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/digitalocean/godo"
+	"github.com/soyeahso/hunter3/internal/logfile"
 	"golang.org/x/oauth2"
 )
 
@@ -122,6 +130,14 @@ func stringArrayProp(desc string) Property {
 	return Property{Type: "array", Description: desc, Items: &ItemType{Type: "string"}}
 }
 
+func numberArrayProp(desc string) Property {
+	return Property{Type: "array", Description: desc, Items: &ItemType{Type: "number"}}
+}
+
+func objectArrayProp(desc string) Property {
+	return Property{Type: "array", Description: desc, Items: &ItemType{Type: "object"}}
+}
+
 func boolProp(desc string) Property {
 	return Property{Type: "boolean", Description: desc}
 }
@@ -132,29 +148,24 @@ func numberProp(desc string) Property {
 
 // MCPServer handles the JSON-RPC stdin/stdout protocol.
 type MCPServer struct {
-	client *godo.Client
+	client  *godo.Client
+	catalog catalogCache
+
+	// timeout bounds each tool call's API requests; zero disables it.
+	// callCtx is the context of the tool call in progress, consulted by
+	// sendToolError to explain deadline errors.
+	timeout time.Duration
+	callCtx context.Context
 }
 
+// defaultTimeout is used when HUNTER3_DO_TIMEOUT is unset.
+const defaultTimeout = 30 * time.Second
+
 var logger *log.Logger
 
 func initLogger() {
-	// Create logs directory if it doesn't exist
-	logsDir := filepath.Join(os.Getenv("HOME"), ".hunter3", "logs")
-	if err := os.MkdirAll(logsDir, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create logs directory: %v\n", err)
-		return
-	}
-
-	// Open log file
-	logFile := filepath.Join(logsDir, "mcp-digitalocean.log")
-	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to open log file: %v\n", err)
-		return
-	}
-
-	// Create logger that writes to both file and stderr
-	logger = log.New(io.MultiWriter(f, os.Stderr), "[mcp-digitalocean] ", log.LstdFlags)
+	// Log to stderr and to a file rotated by size and readable only by the owner
+	logger = logfile.NewLogger("mcp-digitalocean")
 	logger.Println("MCP DigitalOcean server starting...")
 }
 
@@ -167,18 +178,70 @@ func main() {
 		logger.Fatal("DIGITALOCEAN_TOKEN environment variable not set")
 	}
 
-	// Create OAuth2 token source
-	tokenSource := &TokenSource{AccessToken: token}
-	oauthClient := oauth2.NewClient(context.Background(), tokenSource)
+	client, err := newClient(token, os.Getenv("DIGITALOCEAN_API_URL"))
+	if err != nil {
+		logger.Fatalf("Failed to create DigitalOcean client: %v", err)
+	}
 
-	// Create DigitalOcean client
-	client := godo.NewClient(oauthClient)
+	timeout := defaultTimeout
+	if v := os.Getenv("HUNTER3_DO_TIMEOUT"); v != "" {
+		if timeout, err = parseTimeout(v); err != nil {
+			logger.Fatal(err)
+		}
+	}
 
-	s := &MCPServer{client: client}
+	s := &MCPServer{client: client, timeout: timeout}
 	logger.Println("Server initialized")
 	s.Run()
 }
 
+// parseTimeout reads HUNTER3_DO_TIMEOUT, given as a Go duration ("45s",
+// "2m") or a whole number of seconds. Zero disables the timeout.
+func parseTimeout(v string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, fmt.Errorf("invalid HUNTER3_DO_TIMEOUT %q: must not be negative", v)
+		}
+		return time.Duration(secs) * time.Second, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid HUNTER3_DO_TIMEOUT %q: use a duration like 45s or a number of seconds", v)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid HUNTER3_DO_TIMEOUT %q: must not be negative", v)
+	}
+	return d, nil
+}
+
+// newClient creates a godo client authenticated with token. A non-empty
+// apiURL (from DIGITALOCEAN_API_URL) replaces the default API endpoint, for
+// use behind a proxy or against a mock server.
+func newClient(token, apiURL string) (*godo.Client, error) {
+	tokenSource := &TokenSource{AccessToken: token}
+	oauthClient := oauth2.NewClient(context.Background(), tokenSource)
+
+	if apiURL == "" {
+		return godo.NewClient(oauthClient), nil
+	}
+
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DIGITALOCEAN_API_URL %q: %w", apiURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid DIGITALOCEAN_API_URL %q: must be an absolute http(s) URL", apiURL)
+	}
+	// godo resolves request paths like "v2/droplets" relative to the base
+	// URL, so it must end in a slash to keep any path prefix.
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+
+	logger.Printf("Using DigitalOcean API at %s\n", u)
+	return godo.New(oauthClient, godo.SetBaseURL(u.String()))
+}
+
 func (s *MCPServer) Run() {
 	scanner := bufio.NewScanner(os.Stdin)
 	buf := make([]byte, 0, 64*1024)
@@ -270,17 +333,20 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 			InputSchema: InputSchema{
 				Type: "object",
 				Properties: map[string]Property{
-					"name":       stringProp("Name for the Droplet"),
-					"region":     stringPropDefault("Region slug (e.g., 'nyc1', 'nyc3', 'sfo3', 'lon1', 'ams3')", "nyc3"),
-					"size":       stringPropDefault("Size slug (e.g., 's-1vcpu-1gb', 's-2vcpu-2gb')", "s-1vcpu-1gb"),
-					"image":      stringPropDefault("Image slug (e.g., 'ubuntu-24-04-x64', 'debian-12-x64')", "ubuntu-24-04-x64"),
-					"ssh_keys":   stringArrayProp("Array of SSH key IDs or fingerprints to add to the Droplet"),
-					"backups":    boolProp("Enable automated backups"),
-					"ipv6":       boolProp("Enable IPv6"),
-					"monitoring": boolProp("Enable monitoring"),
-					"tags":       stringArrayProp("Tags to apply to the Droplet"),
-					"user_data":  stringProp("User data (cloud-init script) to run on first boot"),
-					"vpc_uuid":   stringProp("UUID of the VPC to create the Droplet in"),
+					"name":          stringProp("Name for the Droplet"),
+					"region":        stringPropDefault("Region slug (e.g., 'nyc1', 'nyc3', 'sfo3', 'lon1', 'ams3')", "nyc3"),
+					"size":          stringPropDefault("Size slug (e.g., 's-1vcpu-1gb', 's-2vcpu-2gb')", "s-1vcpu-1gb"),
+					"image":         stringPropDefault("Image slug (e.g., 'ubuntu-24-04-x64', 'debian-12-x64')", "ubuntu-24-04-x64"),
+					"ssh_keys":      stringArrayProp("Array of SSH key IDs or fingerprints to add to the Droplet"),
+					"backups":       boolProp("Enable automated backups"),
+					"ipv6":          boolProp("Enable IPv6"),
+					"monitoring":    boolProp("Enable monitoring"),
+					"tags":          stringArrayProp("Tags to apply to the Droplet"),
+					"user_data":     stringProp("User data (cloud-init script) to run on first boot"),
+					"vpc_uuid":      stringProp("UUID of the VPC to create the Droplet in"),
+					"validate_only": boolProp("Only check that the region, size, and image slugs exist and are compatible; do not create the Droplet"),
+					"wait_for_ip":   boolProp("Wait until the Droplet has a public IPv4 address (and IPv6, if ipv6 is set) and return it as public_ipv4/public_ipv6"),
+					"wait_timeout":  numberProp(fmt.Sprintf("Seconds to wait for the IP when wait_for_ip is set (default %d, max %d)", int(defaultIPWaitTimeout/time.Second), int(maxIPWaitTimeout/time.Second))),
 				},
 				Required: []string{"name", "region", "size", "image"},
 			},
@@ -388,6 +454,28 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 				Required: []string{"droplet_id", "action_id"},
 			},
 		},
+		{
+			Name:        "get_droplet_neighbors",
+			Description: "List the Droplets that run on the same physical hardware as a Droplet",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"droplet_id": numberProp("The ID of the Droplet"),
+				},
+				Required: []string{"droplet_id"},
+			},
+		},
+		{
+			Name:        "list_droplet_kernels",
+			Description: "List the kernels available to a Droplet",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"droplet_id": numberProp("The ID of the Droplet"),
+				},
+				Required: []string{"droplet_id"},
+			},
+		},
 
 		// --- SSH Keys ---
 		{
@@ -510,6 +598,304 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 			},
 		},
 
+		// --- Projects ---
+		{
+			Name:        "list_projects",
+			Description: "List all projects in your DigitalOcean account",
+			InputSchema: InputSchema{
+				Type:       "object",
+				Properties: map[string]Property{},
+			},
+		},
+		{
+			Name:        "get_default_project",
+			Description: "Get the default project, which new resources are placed in unless assigned elsewhere",
+			InputSchema: InputSchema{
+				Type:       "object",
+				Properties: map[string]Property{},
+			},
+		},
+		{
+			Name:        "create_project",
+			Description: "Create a project to group related resources",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"name":        stringProp("Name for the project"),
+					"purpose":     stringProp("What the project is for (e.g., 'Web Application', 'Service or API')"),
+					"environment": {Type: "string", Description: "Deployment environment of the project's resources", Enum: projectEnvironments},
+					"description": stringProp("Description of the project"),
+				},
+				Required: []string{"name", "purpose"},
+			},
+		},
+		{
+			Name:        "assign_resources_to_project",
+			Description: "Move resources (Droplets, volumes, domains, etc.) into a project",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"project_id": stringProp("The ID of the project"),
+					"resources":  stringArrayProp("Array of resource URNs (e.g., 'do:droplet:12345')"),
+				},
+				Required: []string{"project_id", "resources"},
+			},
+		},
+
+		// --- Firewalls ---
+		{
+			Name:        "list_firewalls",
+			Description: "List all Cloud Firewalls",
+			InputSchema: InputSchema{
+				Type:       "object",
+				Properties: map[string]Property{},
+			},
+		},
+		{
+			Name:        "get_firewall",
+			Description: "Get detailed information about a Cloud Firewall by ID",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"firewall_id": stringProp("The ID of the firewall"),
+				},
+				Required: []string{"firewall_id"},
+			},
+		},
+		{
+			Name:        "create_firewall",
+			Description: "Create a Cloud Firewall. Each rule is an object with 'protocol' (tcp, udp, icmp), 'ports' (e.g. '22', '8000-9000', 'all'; omit for icmp), and for inbound rules 'sources' / for outbound rules 'destinations': an object with any of 'addresses' (IPs/CIDRs), 'droplet_ids', 'tags', 'load_balancer_uids'. Example inbound rule: {\"protocol\": \"tcp\", \"ports\": \"22\", \"sources\": {\"addresses\": [\"0.0.0.0/0\", \"::/0\"]}}",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"name":           stringProp("Name for the firewall"),
+					"inbound_rules":  objectArrayProp("Inbound rules: [{protocol, ports, sources: {addresses, droplet_ids, tags, load_balancer_uids}}]"),
+					"outbound_rules": objectArrayProp("Outbound rules: [{protocol, ports, destinations: {addresses, droplet_ids, tags, load_balancer_uids}}]"),
+					"droplet_ids":    numberArrayProp("IDs of Droplets to apply the firewall to"),
+					"tags":           stringArrayProp("Tags whose Droplets the firewall applies to"),
+				},
+				Required: []string{"name"},
+			},
+		},
+		{
+			Name:        "add_droplets_to_firewall",
+			Description: "Apply a Cloud Firewall to one or more Droplets",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"firewall_id": stringProp("The ID of the firewall"),
+					"droplet_ids": numberArrayProp("IDs of Droplets to add"),
+				},
+				Required: []string{"firewall_id", "droplet_ids"},
+			},
+		},
+		{
+			Name:        "remove_droplets_from_firewall",
+			Description: "Remove one or more Droplets from a Cloud Firewall",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"firewall_id": stringProp("The ID of the firewall"),
+					"droplet_ids": numberArrayProp("IDs of Droplets to remove"),
+				},
+				Required: []string{"firewall_id", "droplet_ids"},
+			},
+		},
+
+		// --- Snapshots ---
+		{
+			Name:        "list_snapshots",
+			Description: "List Droplet and volume snapshots, optionally filtered by resource type",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"resource_type": {Type: "string", Description: "Only list snapshots of this resource type", Enum: []string{"droplet", "volume"}},
+				},
+			},
+		},
+		{
+			Name:        "get_snapshot",
+			Description: "Get detailed information about a snapshot by ID",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"snapshot_id": stringProp("The ID of the snapshot"),
+				},
+				Required: []string{"snapshot_id"},
+			},
+		},
+		{
+			Name:        "delete_snapshot",
+			Description: "Permanently delete a snapshot",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"snapshot_id": stringProp("The ID of the snapshot to delete"),
+				},
+				Required: []string{"snapshot_id"},
+			},
+		},
+
+		// --- Domains ---
+		{
+			Name:        "list_domains",
+			Description: "List all domains managed by DigitalOcean DNS",
+			InputSchema: InputSchema{
+				Type:       "object",
+				Properties: map[string]Property{},
+			},
+		},
+		{
+			Name:        "list_dns_records",
+			Description: "List all DNS records for a domain",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"domain": stringProp("The domain name (e.g. 'example.com')"),
+				},
+				Required: []string{"domain"},
+			},
+		},
+		{
+			Name:        "create_dns_record",
+			Description: "Create a DNS record for a domain",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"domain":   stringProp("The domain name (e.g. 'example.com')"),
+					"type":     {Type: "string", Description: "Record type", Enum: dnsRecordTypes},
+					"name":     stringProp("Host name relative to the domain ('@' for the apex, e.g. 'www')"),
+					"data":     stringProp("Record value (IP address for A/AAAA, hostname for CNAME/MX/NS/SRV, text for TXT)"),
+					"ttl":      numberProp("Time to live in seconds (default 1800)"),
+					"priority": numberProp("Priority (required for MX and SRV records)"),
+					"port":     numberProp("Port (required for SRV records)"),
+					"weight":   numberProp("Weight (SRV records only)"),
+				},
+				Required: []string{"domain", "type", "name", "data"},
+			},
+		},
+		{
+			Name:        "update_dns_record",
+			Description: "Update a DNS record. Only the fields given are changed; the rest keep their current values.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"domain":    stringProp("The domain name (e.g. 'example.com')"),
+					"record_id": numberProp("The ID of the DNS record"),
+					"type":      {Type: "string", Description: "Record type", Enum: dnsRecordTypes},
+					"name":      stringProp("Host name relative to the domain ('@' for the apex, e.g. 'www')"),
+					"data":      stringProp("Record value (IP address for A/AAAA, hostname for CNAME/MX/NS/SRV, text for TXT)"),
+					"ttl":       numberProp("Time to live in seconds (default 1800)"),
+					"priority":  numberProp("Priority (required for MX and SRV records)"),
+					"port":      numberProp("Port (required for SRV records)"),
+					"weight":    numberProp("Weight (SRV records only)"),
+				},
+				Required: []string{"domain", "record_id"},
+			},
+		},
+		{
+			Name:        "delete_dns_record",
+			Description: "Delete a DNS record from a domain",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"domain":    stringProp("The domain name (e.g. 'example.com')"),
+					"record_id": numberProp("The ID of the DNS record"),
+				},
+				Required: []string{"domain", "record_id"},
+			},
+		},
+
+		// --- Kubernetes ---
+		{
+			Name:        "list_kubernetes_clusters",
+			Description: "List all DigitalOcean Kubernetes (DOKS) clusters with their region, version, status, and node pools",
+			InputSchema: InputSchema{
+				Type:       "object",
+				Properties: map[string]Property{},
+			},
+		},
+		{
+			Name:        "get_kubernetes_cluster",
+			Description: "Get detailed information about a Kubernetes cluster by ID",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"cluster_id": stringProp("The ID of the Kubernetes cluster"),
+				},
+				Required: []string{"cluster_id"},
+			},
+		},
+		{
+			Name:        "get_kubernetes_kubeconfig",
+			Description: "Get the kubeconfig for a Kubernetes cluster. The kubeconfig contains cluster credentials; treat it as a secret.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"cluster_id": stringProp("The ID of the Kubernetes cluster"),
+					"format":     {Type: "string", Description: "Return the kubeconfig as raw YAML or base64-encoded", Enum: []string{"raw", "base64"}, Default: "raw"},
+				},
+				Required: []string{"cluster_id"},
+			},
+		},
+
+		// --- App Platform ---
+		{
+			Name:        "list_apps",
+			Description: "List all App Platform apps",
+			InputSchema: InputSchema{
+				Type:       "object",
+				Properties: map[string]Property{},
+			},
+		},
+		{
+			Name:        "get_app",
+			Description: "Get detailed information about an App Platform app by ID, including its spec and active deployment",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"app_id": stringProp("The ID of the app"),
+				},
+				Required: []string{"app_id"},
+			},
+		},
+		{
+			Name:        "create_app",
+			Description: "Create an App Platform app from an app spec. Creating an app starts its first deployment.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"spec":       stringProp("The app spec as a JSON object (e.g., '{\"name\":\"web\",\"region\":\"nyc\",\"services\":[...]}')"),
+					"project_id": stringProp("The ID of the project to place the app in (default: the default project)"),
+				},
+				Required: []string{"spec"},
+			},
+		},
+		{
+			Name:        "create_deployment",
+			Description: "Start a new deployment of an App Platform app",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"app_id":      stringProp("The ID of the app"),
+					"force_build": boolProp("Rebuild from source even if nothing has changed"),
+				},
+				Required: []string{"app_id"},
+			},
+		},
+		{
+			Name:        "get_deployment",
+			Description: "Get the status and progress of an App Platform deployment",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"app_id":        stringProp("The ID of the app"),
+					"deployment_id": stringProp("The ID of the deployment"),
+				},
+				Required: []string{"app_id", "deployment_id"},
+			},
+		},
+
 		// --- Account ---
 		{
 			Name:        "get_account",
@@ -519,6 +905,22 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 				Properties: map[string]Property{},
 			},
 		},
+		{
+			Name:        "get_rate_limit",
+			Description: "Report the API rate limit: requests allowed per hour, requests remaining, and when the window resets. Check this before bulk operations to avoid 429 errors.",
+			InputSchema: InputSchema{
+				Type:       "object",
+				Properties: map[string]Property{},
+			},
+		},
+		{
+			Name:        "get_balance",
+			Description: "Get the account balance and month-to-date usage",
+			InputSchema: InputSchema{
+				Type:       "object",
+				Properties: map[string]Property{},
+			},
+		},
 	}
 
 	s.sendResponse(req.ID, ListToolsResult{Tools: tools})
@@ -536,7 +938,10 @@ func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
 
 	logger.Printf("Calling tool: %s\n", params.Name)
 	args := params.Arguments
-	ctx := context.Background()
+	ctx, cancel := s.callContext(params.Name, args)
+	defer cancel()
+	s.callCtx = ctx
+	defer func() { s.callCtx = nil }()
 
 	switch params.Name {
 	// Droplet commands
@@ -564,6 +969,10 @@ func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
 		s.snapshotDroplet(ctx, req.ID, args)
 	case "get_droplet_action":
 		s.getDropletAction(ctx, req.ID, args)
+	case "get_droplet_neighbors":
+		s.getDropletNeighbors(ctx, req.ID, args)
+	case "list_droplet_kernels":
+		s.listDropletKernels(ctx, req.ID, args)
 
 	// SSH key commands
 	case "list_ssh_keys":
@@ -597,15 +1006,95 @@ func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
 	case "untag_resources":
 		s.untagResources(ctx, req.ID, args)
 
+	// Project commands
+	case "list_projects":
+		s.listProjects(ctx, req.ID, args)
+	case "get_default_project":
+		s.getDefaultProject(ctx, req.ID, args)
+	case "create_project":
+		s.createProject(ctx, req.ID, args)
+	case "assign_resources_to_project":
+		s.assignResourcesToProject(ctx, req.ID, args)
+
+	// Firewall commands
+	case "list_firewalls":
+		s.listFirewalls(ctx, req.ID, args)
+	case "get_firewall":
+		s.getFirewall(ctx, req.ID, args)
+	case "create_firewall":
+		s.createFirewall(ctx, req.ID, args)
+	case "add_droplets_to_firewall":
+		s.firewallDroplets(ctx, req.ID, args, true)
+	case "remove_droplets_from_firewall":
+		s.firewallDroplets(ctx, req.ID, args, false)
+
+	// Snapshot commands
+	case "list_snapshots":
+		s.listSnapshots(ctx, req.ID, args)
+	case "get_snapshot":
+		s.getSnapshot(ctx, req.ID, args)
+	case "delete_snapshot":
+		s.deleteSnapshot(ctx, req.ID, args)
+
+	// Domain commands
+	case "list_domains":
+		s.listDomains(ctx, req.ID, args)
+	case "list_dns_records":
+		s.listDNSRecords(ctx, req.ID, args)
+	case "create_dns_record":
+		s.createDNSRecord(ctx, req.ID, args)
+	case "update_dns_record":
+		s.updateDNSRecord(ctx, req.ID, args)
+	case "delete_dns_record":
+		s.deleteDNSRecord(ctx, req.ID, args)
+
+	// Kubernetes commands
+	case "list_kubernetes_clusters":
+		s.listKubernetesClusters(ctx, req.ID, args)
+	case "get_kubernetes_cluster":
+		s.getKubernetesCluster(ctx, req.ID, args)
+	case "get_kubernetes_kubeconfig":
+		s.getKubernetesKubeconfig(ctx, req.ID, args)
+
+	// App Platform commands
+	case "list_apps":
+		s.listApps(ctx, req.ID, args)
+	case "get_app":
+		s.getApp(ctx, req.ID, args)
+	case "create_app":
+		s.createApp(ctx, req.ID, args)
+	case "create_deployment":
+		s.createDeployment(ctx, req.ID, args)
+	case "get_deployment":
+		s.getDeployment(ctx, req.ID, args)
+
 	// Account commands
 	case "get_account":
 		s.getAccount(ctx, req.ID, args)
+	case "get_rate_limit":
+		s.getRateLimit(ctx, req.ID, args)
+	case "get_balance":
+		s.getBalance(ctx, req.ID, args)
 
 	default:
 		s.sendToolError(req.ID, fmt.Sprintf("Unknown tool: %s", params.Name))
 	}
 }
 
+// callContext returns the context for one tool call, which expires after
+// s.timeout so that a hung API request cannot block the request loop.
+// create_droplet with wait_for_ip gets its wait timeout on top.
+func (s *MCPServer) callContext(name string, args map[string]interface{}) (context.Context, context.CancelFunc) {
+	if s.timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	timeout := s.timeout
+	if name == "create_droplet" && getBool(args, "wait_for_ip") {
+		timeout += ipWaitTimeout(args)
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
 // ---------- Droplet Tool Handlers ----------
 
 func (s *MCPServer) listDroplets(ctx context.Context, id interface{}, args map[string]interface{}) {
@@ -673,6 +1162,16 @@ func (s *MCPServer) createDroplet(ctx context.Context, id interface{}, args map[
 		return
 	}
 
+	if getBool(args, "validate_only") {
+		validation, err := s.validateDropletSlugs(ctx, region, size, image)
+		if err != nil {
+			s.sendToolError(id, fmt.Sprintf("Failed to validate droplet request: %v", err))
+			return
+		}
+		s.sendJSONResponse(id, validation)
+		return
+	}
+
 	createRequest := &godo.DropletCreateRequest{
 		Name:   name,
 		Region: region,
@@ -708,8 +1207,80 @@ func (s *MCPServer) createDroplet(ctx context.Context, id interface{}, args map[
 		return
 	}
 
-	s.sendJSONResponse(id, droplet)
-}
+	if !getBool(args, "wait_for_ip") {
+		s.sendJSONResponse(id, droplet)
+		return
+	}
+
+	withIP, err := s.waitForDropletIP(ctx, droplet.ID, createRequest.IPv6, ipWaitTimeout(args))
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Droplet %d was created, but %v", droplet.ID, err))
+		return
+	}
+
+	s.sendJSONResponse(id, withIP)
+}
+
+const (
+	defaultIPWaitTimeout = 3 * time.Minute
+	maxIPWaitTimeout     = 10 * time.Minute
+)
+
+// ipWaitTimeout returns create_droplet's wait_timeout, capped at
+// maxIPWaitTimeout.
+func ipWaitTimeout(args map[string]interface{}) time.Duration {
+	timeout := defaultIPWaitTimeout
+	if secs := getInt(args, "wait_timeout"); secs > 0 {
+		timeout = time.Duration(secs) * time.Second
+	}
+	if timeout > maxIPWaitTimeout {
+		timeout = maxIPWaitTimeout
+	}
+	return timeout
+}
+
+// dropletPollInterval is how often waitForDropletIP re-reads the Droplet.
+var dropletPollInterval = 5 * time.Second
+
+// DropletWithIP is a Droplet with its public addresses pulled out of the
+// networks list.
+type DropletWithIP struct {
+	*godo.Droplet
+	PublicIPv4 string `json:"public_ipv4"`
+	PublicIPv6 string `json:"public_ipv6,omitempty"`
+}
+
+// waitForDropletIP polls the Droplet until it has a public IPv4 address,
+// and a public IPv6 address too when wantIPv6 is set, or until timeout.
+func (s *MCPServer) waitForDropletIP(ctx context.Context, dropletID int, wantIPv6 bool, timeout time.Duration) (*DropletWithIP, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(dropletPollInterval)
+	defer ticker.Stop()
+
+	for {
+		droplet, _, err := s.client.Droplets.Get(ctx, dropletID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("no public IP was assigned within %s", timeout)
+			}
+			return nil, fmt.Errorf("failed to get droplet while waiting for its IP: %w", err)
+		}
+
+		ipv4, _ := droplet.PublicIPv4()
+		ipv6, _ := droplet.PublicIPv6()
+		if ipv4 != "" && (!wantIPv6 || ipv6 != "") {
+			return &DropletWithIP{Droplet: droplet, PublicIPv4: ipv4, PublicIPv6: ipv6}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("no public IP was assigned within %s", timeout)
+		case <-ticker.C:
+		}
+	}
+}
 
 func (s *MCPServer) deleteDroplet(ctx context.Context, id interface{}, args map[string]interface{}) {
 	dropletID := getInt(args, "droplet_id")
@@ -816,6 +1387,176 @@ func (s *MCPServer) getDropletAction(ctx context.Context, id interface{}, args m
 	s.sendJSONResponse(id, action)
 }
 
+func (s *MCPServer) getDropletNeighbors(ctx context.Context, id interface{}, args map[string]interface{}) {
+	dropletID := getInt(args, "droplet_id")
+	if dropletID == 0 {
+		s.sendToolError(id, "droplet_id is required")
+		return
+	}
+
+	neighbors, _, err := s.client.Droplets.Neighbors(ctx, dropletID)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to get droplet neighbors: %v", err))
+		return
+	}
+	if neighbors == nil {
+		neighbors = []godo.Droplet{}
+	}
+
+	s.sendJSONResponse(id, neighbors)
+}
+
+func (s *MCPServer) listDropletKernels(ctx context.Context, id interface{}, args map[string]interface{}) {
+	dropletID := getInt(args, "droplet_id")
+	if dropletID == 0 {
+		s.sendToolError(id, "droplet_id is required")
+		return
+	}
+
+	opt := &godo.ListOptions{PerPage: 200}
+	allKernels := []godo.Kernel{}
+
+	for {
+		kernels, resp, err := s.client.Droplets.Kernels(ctx, dropletID, opt)
+		if err != nil {
+			s.sendToolError(id, fmt.Sprintf("Failed to list droplet kernels: %v", err))
+			return
+		}
+
+		allKernels = append(allKernels, kernels...)
+
+		if resp.Links == nil || resp.Links.IsLastPage() {
+			break
+		}
+
+		page, err := resp.Links.CurrentPage()
+		if err != nil {
+			break
+		}
+		opt.Page = page + 1
+	}
+
+	s.sendJSONResponse(id, allKernels)
+}
+
+// ---------- Droplet Validation ----------
+
+// catalogTTL is how long the region and size catalogs are cached for
+// create_droplet validation.
+const catalogTTL = 10 * time.Minute
+
+// catalogCache holds the region and size catalogs so repeated validations
+// don't refetch them from the API.
+type catalogCache struct {
+	mu        sync.Mutex
+	regions   []godo.Region
+	sizes     []godo.Size
+	fetchedAt time.Time
+}
+
+// DropletValidation is the result of create_droplet with validate_only set.
+type DropletValidation struct {
+	Valid  bool     `json:"valid"`
+	Region string   `json:"region"`
+	Size   string   `json:"size"`
+	Image  string   `json:"image"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// catalogs returns the cached region and size catalogs, refreshing them
+// once they are older than catalogTTL.
+func (s *MCPServer) catalogs(ctx context.Context) ([]godo.Region, []godo.Size, error) {
+	s.catalog.mu.Lock()
+	defer s.catalog.mu.Unlock()
+
+	if s.catalog.regions != nil && s.catalog.sizes != nil && time.Since(s.catalog.fetchedAt) < catalogTTL {
+		return s.catalog.regions, s.catalog.sizes, nil
+	}
+
+	regions, err := s.fetchRegions(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list regions: %w", err)
+	}
+	sizes, err := s.fetchSizes(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list sizes: %w", err)
+	}
+
+	s.catalog.regions = regions
+	s.catalog.sizes = sizes
+	s.catalog.fetchedAt = time.Now()
+	return regions, sizes, nil
+}
+
+// validateDropletSlugs checks the region, size, and image slugs of a create
+// request against the API catalogs without creating anything.
+func (s *MCPServer) validateDropletSlugs(ctx context.Context, region, size, image string) (DropletValidation, error) {
+	v := DropletValidation{Region: region, Size: size, Image: image}
+
+	regions, sizes, err := s.catalogs(ctx)
+	if err != nil {
+		return v, err
+	}
+
+	var availableRegions []string
+	var foundRegion *godo.Region
+	for i := range regions {
+		if regions[i].Available {
+			availableRegions = append(availableRegions, regions[i].Slug)
+		}
+		if regions[i].Slug == region {
+			foundRegion = &regions[i]
+		}
+	}
+	sort.Strings(availableRegions)
+
+	switch {
+	case foundRegion == nil:
+		v.Errors = append(v.Errors, fmt.Sprintf("unknown region %q; available regions: %s", region, strings.Join(availableRegions, ", ")))
+	case !foundRegion.Available:
+		v.Errors = append(v.Errors, fmt.Sprintf("region %q is not accepting new Droplets; available regions: %s", region, strings.Join(availableRegions, ", ")))
+	}
+
+	// Only check region compatibility once the region itself is usable, so a
+	// bad region isn't reported again for the size and image.
+	regionOK := foundRegion != nil && foundRegion.Available
+
+	var foundSize *godo.Size
+	for i := range sizes {
+		if sizes[i].Slug == size {
+			foundSize = &sizes[i]
+			break
+		}
+	}
+
+	switch {
+	case foundSize == nil:
+		v.Errors = append(v.Errors, fmt.Sprintf("unknown size %q; use list_sizes to see valid size slugs", size))
+	case !foundSize.Available:
+		v.Errors = append(v.Errors, fmt.Sprintf("size %q is not currently available", size))
+	case regionOK && !containsString(foundSize.Regions, region):
+		v.Errors = append(v.Errors, fmt.Sprintf("size %q is not offered in region %q; it is offered in: %s", size, region, strings.Join(foundSize.Regions, ", ")))
+	}
+
+	img, resp, err := s.client.Images.GetBySlug(ctx, image)
+	switch {
+	case err != nil && resp != nil && resp.StatusCode == http.StatusNotFound:
+		v.Errors = append(v.Errors, fmt.Sprintf("unknown image %q; use list_images to see valid image slugs", image))
+	case err != nil:
+		return v, fmt.Errorf("failed to look up image: %w", err)
+	default:
+		if regionOK && len(img.Regions) > 0 && !containsString(img.Regions, region) {
+			v.Errors = append(v.Errors, fmt.Sprintf("image %q is not available in region %q; it is available in: %s", image, region, strings.Join(img.Regions, ", ")))
+		}
+		if foundSize != nil && img.MinDiskSize > foundSize.Disk {
+			v.Errors = append(v.Errors, fmt.Sprintf("image %q needs at least %d GB of disk but size %q has %d GB", image, img.MinDiskSize, size, foundSize.Disk))
+		}
+	}
+
+	v.Valid = len(v.Errors) == 0
+	return v, nil
+}
+
 // ---------- SSH Key Tool Handlers ----------
 
 func (s *MCPServer) listSSHKeys(ctx context.Context, id interface{}, args map[string]interface{}) {
@@ -891,14 +1632,23 @@ func (s *MCPServer) deleteSSHKey(ctx context.Context, id interface{}, args map[s
 // ---------- Region Tool Handlers ----------
 
 func (s *MCPServer) listRegions(ctx context.Context, id interface{}, args map[string]interface{}) {
+	allRegions, err := s.fetchRegions(ctx)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to list regions: %v", err))
+		return
+	}
+
+	s.sendJSONResponse(id, allRegions)
+}
+
+func (s *MCPServer) fetchRegions(ctx context.Context) ([]godo.Region, error) {
 	opt := &godo.ListOptions{PerPage: 200}
 	var allRegions []godo.Region
 
 	for {
 		regions, resp, err := s.client.Regions.List(ctx, opt)
 		if err != nil {
-			s.sendToolError(id, fmt.Sprintf("Failed to list regions: %v", err))
-			return
+			return nil, err
 		}
 
 		allRegions = append(allRegions, regions...)
@@ -914,20 +1664,29 @@ func (s *MCPServer) listRegions(ctx context.Context, id interface{}, args map[st
 		opt.Page = page + 1
 	}
 
-	s.sendJSONResponse(id, allRegions)
+	return allRegions, nil
 }
 
 // ---------- Size Tool Handlers ----------
 
 func (s *MCPServer) listSizes(ctx context.Context, id interface{}, args map[string]interface{}) {
+	allSizes, err := s.fetchSizes(ctx)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to list sizes: %v", err))
+		return
+	}
+
+	s.sendJSONResponse(id, allSizes)
+}
+
+func (s *MCPServer) fetchSizes(ctx context.Context) ([]godo.Size, error) {
 	opt := &godo.ListOptions{PerPage: 200}
 	var allSizes []godo.Size
 
 	for {
 		sizes, resp, err := s.client.Sizes.List(ctx, opt)
 		if err != nil {
-			s.sendToolError(id, fmt.Sprintf("Failed to list sizes: %v", err))
-			return
+			return nil, err
 		}
 
 		allSizes = append(allSizes, sizes...)
@@ -943,7 +1702,7 @@ func (s *MCPServer) listSizes(ctx context.Context, id interface{}, args map[stri
 		opt.Page = page + 1
 	}
 
-	s.sendJSONResponse(id, allSizes)
+	return allSizes, nil
 }
 
 // ---------- Image Tool Handlers ----------
@@ -1060,24 +1819,13 @@ func (s *MCPServer) tagResources(ctx context.Context, id interface{}, args map[s
 		return
 	}
 
-	tagRequest := &godo.TagResourcesRequest{
-		Resources: make([]godo.Resource, len(resources)),
-	}
-
-	for i, urn := range resources {
-		// Parse URN format: do:droplet:12345
-		parts := strings.Split(urn, ":")
-		if len(parts) != 3 {
-			s.sendToolError(id, fmt.Sprintf("Invalid resource URN format: %s (expected format: do:type:id)", urn))
-			return
-		}
-		tagRequest.Resources[i] = godo.Resource{
-			ID:   parts[2],
-			Type: godo.ResourceType(parts[1]),
-		}
+	parsed, err := parseResourceURNs(resources)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
 	}
 
-	_, err := s.client.Tags.TagResources(ctx, tagName, tagRequest)
+	_, err = s.client.Tags.TagResources(ctx, tagName, &godo.TagResourcesRequest{Resources: parsed})
 	if err != nil {
 		s.sendToolError(id, fmt.Sprintf("Failed to tag resources: %v", err))
 		return
@@ -1099,23 +1847,13 @@ func (s *MCPServer) untagResources(ctx context.Context, id interface{}, args map
 		return
 	}
 
-	untagRequest := &godo.UntagResourcesRequest{
-		Resources: make([]godo.Resource, len(resources)),
-	}
-
-	for i, urn := range resources {
-		parts := strings.Split(urn, ":")
-		if len(parts) != 3 {
-			s.sendToolError(id, fmt.Sprintf("Invalid resource URN format: %s", urn))
-			return
-		}
-		untagRequest.Resources[i] = godo.Resource{
-			ID:   parts[2],
-			Type: godo.ResourceType(parts[1]),
-		}
+	parsed, err := parseResourceURNs(resources)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
 	}
 
-	_, err := s.client.Tags.UntagResources(ctx, tagName, untagRequest)
+	_, err = s.client.Tags.UntagResources(ctx, tagName, &godo.UntagResourcesRequest{Resources: parsed})
 	if err != nil {
 		s.sendToolError(id, fmt.Sprintf("Failed to untag resources: %v", err))
 		return
@@ -1128,109 +1866,1066 @@ func (s *MCPServer) untagResources(ctx context.Context, id interface{}, args map
 	})
 }
 
-// ---------- Account Tool Handlers ----------
-
-func (s *MCPServer) getAccount(ctx context.Context, id interface{}, args map[string]interface{}) {
-	account, _, err := s.client.Account.Get(ctx)
-	if err != nil {
-		s.sendToolError(id, fmt.Sprintf("Failed to get account info: %v", err))
-		return
+// parseResourceURNs parses resource URNs of the form do:type:id, such as
+// do:droplet:12345.
+func parseResourceURNs(urns []string) ([]godo.Resource, error) {
+	resources := make([]godo.Resource, len(urns))
+	for i, urn := range urns {
+		parts := strings.Split(urn, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("Invalid resource URN format: %s (expected format: do:type:id)", urn)
+		}
+		resources[i] = godo.Resource{
+			ID:   parts[2],
+			Type: godo.ResourceType(parts[1]),
+		}
 	}
-
-	s.sendJSONResponse(id, account)
+	return resources, nil
 }
 
-// ---------- Helpers ----------
+// ---------- Project Tool Handlers ----------
 
-func getString(args map[string]interface{}, key string) string {
-	if val, ok := args[key].(string); ok {
-		return val
-	}
-	return ""
-}
+// projectEnvironments are the environments a project may be created with.
+var projectEnvironments = []string{"Development", "Staging", "Production"}
 
-func getBool(args map[string]interface{}, key string) bool {
-	if val, ok := args[key].(bool); ok {
-		return val
+func (s *MCPServer) listProjects(ctx context.Context, id interface{}, args map[string]interface{}) {
+	opt := &godo.ListOptions{PerPage: 200}
+	var allProjects []godo.Project
+
+	for {
+		projects, resp, err := s.client.Projects.List(ctx, opt)
+		if err != nil {
+			s.sendToolError(id, fmt.Sprintf("Failed to list projects: %v", err))
+			return
+		}
+
+		allProjects = append(allProjects, projects...)
+
+		if resp.Links == nil || resp.Links.IsLastPage() {
+			break
+		}
+
+		page, err := resp.Links.CurrentPage()
+		if err != nil {
+			break
+		}
+		opt.Page = page + 1
 	}
-	return false
+
+	s.sendJSONResponse(id, allProjects)
 }
 
-func getInt(args map[string]interface{}, key string) int {
-	if val, ok := args[key].(float64); ok {
-		return int(val)
+func (s *MCPServer) getDefaultProject(ctx context.Context, id interface{}, args map[string]interface{}) {
+	project, _, err := s.client.Projects.GetDefault(ctx)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to get default project: %v", err))
+		return
 	}
-	return 0
+
+	s.sendJSONResponse(id, project)
 }
 
-func getStringArray(args map[string]interface{}, key string) []string {
-	val, ok := args[key]
-	if !ok {
-		return nil
+func (s *MCPServer) createProject(ctx context.Context, id interface{}, args map[string]interface{}) {
+	name := getString(args, "name")
+	purpose := getString(args, "purpose")
+
+	if name == "" || purpose == "" {
+		s.sendToolError(id, "name and purpose are required")
+		return
 	}
 
-	arr, ok := val.([]interface{})
-	if !ok {
-		return nil
+	environment := getString(args, "environment")
+	if environment != "" && !containsString(projectEnvironments, environment) {
+		s.sendToolError(id, fmt.Sprintf("environment must be one of %s, got %q", strings.Join(projectEnvironments, ", "), environment))
+		return
 	}
 
-	result := make([]string, 0, len(arr))
-	for _, v := range arr {
-		if s, ok := v.(string); ok {
-			result = append(result, s)
-		}
+	project, _, err := s.client.Projects.Create(ctx, &godo.CreateProjectRequest{
+		Name:        name,
+		Purpose:     purpose,
+		Environment: environment,
+		Description: getString(args, "description"),
+	})
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to create project: %v", err))
+		return
 	}
-	return result
+
+	s.sendJSONResponse(id, project)
 }
 
-// ---------- JSON-RPC responses ----------
+func (s *MCPServer) assignResourcesToProject(ctx context.Context, id interface{}, args map[string]interface{}) {
+	projectID := getString(args, "project_id")
+	resources := getStringArray(args, "resources")
 
-func (s *MCPServer) sendResponse(id interface{}, result interface{}) {
-	resp := JSONRPCResponse{
-		JSONRPC: "2.0",
-		ID:      id,
-		Result:  result,
+	if projectID == "" || len(resources) == 0 {
+		s.sendToolError(id, "project_id and resources are required")
+		return
 	}
-	data, err := json.Marshal(resp)
-	if err != nil {
-		logger.Printf("Error marshaling response: %v\n", err)
-		fmt.Fprintf(os.Stderr, "Error marshaling response: %v\n", err)
+
+	if _, err := parseResourceURNs(resources); err != nil {
+		s.sendToolError(id, err.Error())
 		return
 	}
-	fmt.Println(string(data))
-	logger.Printf("Sent response for request ID: %v\n", id)
-}
+	urns := make([]interface{}, len(resources))
+	for i, urn := range resources {
+		urns[i] = urn
+	}
 
-func (s *MCPServer) sendJSONResponse(id interface{}, result interface{}) {
-	data, err := json.MarshalIndent(result, "", "  ")
+	assigned, _, err := s.client.Projects.AssignResources(ctx, projectID, urns...)
 	if err != nil {
-		s.sendToolError(id, fmt.Sprintf("Failed to marshal response: %v", err))
+		s.sendToolError(id, fmt.Sprintf("Failed to assign resources to project: %v", err))
 		return
 	}
 
-	s.sendResponse(id, ToolResult{
-		Content: []ContentItem{{Type: "text", Text: string(data)}},
-		IsError: false,
-	})
+	s.sendJSONResponse(id, assigned)
 }
 
-func (s *MCPServer) sendError(id interface{}, code int, message string, data interface{}) {
-	logger.Printf("Sending error response: code=%d, message=%s\n", code, message)
-	resp := JSONRPCResponse{
-		JSONRPC: "2.0",
-		ID:      id,
-		Error:   &RPCError{Code: code, Message: message, Data: data},
-	}
-	jsonData, err := json.Marshal(resp)
+// ---------- Firewall Tool Handlers ----------
+
+func (s *MCPServer) listFirewalls(ctx context.Context, id interface{}, args map[string]interface{}) {
+	opt := &godo.ListOptions{PerPage: 200}
+	var allFirewalls []godo.Firewall
+
+	for {
+		firewalls, resp, err := s.client.Firewalls.List(ctx, opt)
+		if err != nil {
+			s.sendToolError(id, fmt.Sprintf("Failed to list firewalls: %v", err))
+			return
+		}
+
+		allFirewalls = append(allFirewalls, firewalls...)
+
+		if resp.Links == nil || resp.Links.IsLastPage() {
+			break
+		}
+
+		page, err := resp.Links.CurrentPage()
+		if err != nil {
+			break
+		}
+		opt.Page = page + 1
+	}
+
+	s.sendJSONResponse(id, allFirewalls)
+}
+
+func (s *MCPServer) getFirewall(ctx context.Context, id interface{}, args map[string]interface{}) {
+	firewallID := getString(args, "firewall_id")
+	if firewallID == "" {
+		s.sendToolError(id, "firewall_id is required")
+		return
+	}
+
+	firewall, _, err := s.client.Firewalls.Get(ctx, firewallID)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to get firewall: %v", err))
+		return
+	}
+
+	s.sendJSONResponse(id, firewall)
+}
+
+func (s *MCPServer) createFirewall(ctx context.Context, id interface{}, args map[string]interface{}) {
+	createRequest, err := buildFirewallRequest(args)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+
+	firewall, _, err := s.client.Firewalls.Create(ctx, createRequest)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to create firewall: %v", err))
+		return
+	}
+
+	s.sendJSONResponse(id, firewall)
+}
+
+// firewallDroplets adds Droplets to, or removes them from, a firewall.
+func (s *MCPServer) firewallDroplets(ctx context.Context, id interface{}, args map[string]interface{}, add bool) {
+	firewallID := getString(args, "firewall_id")
+	dropletIDs := getIntArray(args, "droplet_ids")
+
+	if firewallID == "" || len(dropletIDs) == 0 {
+		s.sendToolError(id, "firewall_id and droplet_ids are required")
+		return
+	}
+
+	var err error
+	status := "added"
+	if add {
+		_, err = s.client.Firewalls.AddDroplets(ctx, firewallID, dropletIDs...)
+	} else {
+		status = "removed"
+		_, err = s.client.Firewalls.RemoveDroplets(ctx, firewallID, dropletIDs...)
+	}
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to update firewall droplets: %v", err))
+		return
+	}
+
+	s.sendJSONResponse(id, map[string]interface{}{
+		"status":      status,
+		"firewall_id": firewallID,
+		"droplet_ids": dropletIDs,
+	})
+}
+
+// buildFirewallRequest converts create_firewall arguments into a godo request.
+func buildFirewallRequest(args map[string]interface{}) (*godo.FirewallRequest, error) {
+	name := getString(args, "name")
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+
+	req := &godo.FirewallRequest{
+		Name:       name,
+		DropletIDs: getIntArray(args, "droplet_ids"),
+		Tags:       getStringArray(args, "tags"),
+	}
+
+	inbound, err := getObjectArray(args, "inbound_rules")
+	if err != nil {
+		return nil, err
+	}
+	for i, raw := range inbound {
+		protocol, ports, target, err := parseFirewallRule(raw, "sources")
+		if err != nil {
+			return nil, fmt.Errorf("inbound_rules[%d]: %w", i, err)
+		}
+		req.InboundRules = append(req.InboundRules, godo.InboundRule{
+			Protocol:  protocol,
+			PortRange: ports,
+			Sources: &godo.Sources{
+				Addresses:        target.Addresses,
+				Tags:             target.Tags,
+				DropletIDs:       target.DropletIDs,
+				LoadBalancerUIDs: target.LoadBalancerUIDs,
+			},
+		})
+	}
+
+	outbound, err := getObjectArray(args, "outbound_rules")
+	if err != nil {
+		return nil, err
+	}
+	for i, raw := range outbound {
+		protocol, ports, target, err := parseFirewallRule(raw, "destinations")
+		if err != nil {
+			return nil, fmt.Errorf("outbound_rules[%d]: %w", i, err)
+		}
+		req.OutboundRules = append(req.OutboundRules, godo.OutboundRule{
+			Protocol:  protocol,
+			PortRange: ports,
+			Destinations: &godo.Destinations{
+				Addresses:        target.Addresses,
+				Tags:             target.Tags,
+				DropletIDs:       target.DropletIDs,
+				LoadBalancerUIDs: target.LoadBalancerUIDs,
+			},
+		})
+	}
+
+	return req, nil
+}
+
+// firewallTarget is the set of endpoints a firewall rule applies to: the
+// sources of an inbound rule or the destinations of an outbound rule.
+type firewallTarget struct {
+	Addresses        []string
+	Tags             []string
+	DropletIDs       []int
+	LoadBalancerUIDs []string
+}
+
+// parseFirewallRule validates a single rule object and extracts its protocol,
+// port range, and the endpoints stored under targetKey.
+func parseFirewallRule(rule map[string]interface{}, targetKey string) (string, string, firewallTarget, error) {
+	protocol := strings.ToLower(getString(rule, "protocol"))
+	ports := getString(rule, "ports")
+
+	switch protocol {
+	case "tcp", "udp":
+		if ports == "" {
+			return "", "", firewallTarget{}, fmt.Errorf("ports is required for %s rules (e.g. '22', '8000-9000', 'all')", protocol)
+		}
+	case "icmp":
+		if ports != "" {
+			return "", "", firewallTarget{}, fmt.Errorf("ports must not be set for icmp rules")
+		}
+	default:
+		return "", "", firewallTarget{}, fmt.Errorf("protocol must be tcp, udp, or icmp, got %q", protocol)
+	}
+
+	raw, ok := rule[targetKey].(map[string]interface{})
+	if !ok {
+		return "", "", firewallTarget{}, fmt.Errorf("%s is required", targetKey)
+	}
+	target := firewallTarget{
+		Addresses:        getStringArray(raw, "addresses"),
+		Tags:             getStringArray(raw, "tags"),
+		DropletIDs:       getIntArray(raw, "droplet_ids"),
+		LoadBalancerUIDs: getStringArray(raw, "load_balancer_uids"),
+	}
+	if len(target.Addresses)+len(target.Tags)+len(target.DropletIDs)+len(target.LoadBalancerUIDs) == 0 {
+		return "", "", firewallTarget{}, fmt.Errorf("%s must include at least one of addresses, droplet_ids, tags, or load_balancer_uids", targetKey)
+	}
+
+	return protocol, ports, target, nil
+}
+
+// ---------- Snapshot Tool Handlers ----------
+
+func (s *MCPServer) listSnapshots(ctx context.Context, id interface{}, args map[string]interface{}) {
+	var list func(context.Context, *godo.ListOptions) ([]godo.Snapshot, *godo.Response, error)
+	switch resourceType := getString(args, "resource_type"); resourceType {
+	case "":
+		list = s.client.Snapshots.List
+	case "droplet":
+		list = s.client.Snapshots.ListDroplet
+	case "volume":
+		list = s.client.Snapshots.ListVolume
+	default:
+		s.sendToolError(id, fmt.Sprintf("resource_type must be droplet or volume, got %q", resourceType))
+		return
+	}
+
+	opt := &godo.ListOptions{PerPage: 200}
+	var allSnapshots []godo.Snapshot
+
+	for {
+		snapshots, resp, err := list(ctx, opt)
+		if err != nil {
+			s.sendToolError(id, fmt.Sprintf("Failed to list snapshots: %v", err))
+			return
+		}
+
+		allSnapshots = append(allSnapshots, snapshots...)
+
+		if resp.Links == nil || resp.Links.IsLastPage() {
+			break
+		}
+
+		page, err := resp.Links.CurrentPage()
+		if err != nil {
+			break
+		}
+		opt.Page = page + 1
+	}
+
+	s.sendJSONResponse(id, allSnapshots)
+}
+
+func (s *MCPServer) getSnapshot(ctx context.Context, id interface{}, args map[string]interface{}) {
+	snapshotID := getString(args, "snapshot_id")
+	if snapshotID == "" {
+		s.sendToolError(id, "snapshot_id is required")
+		return
+	}
+
+	snapshot, _, err := s.client.Snapshots.Get(ctx, snapshotID)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to get snapshot: %v", err))
+		return
+	}
+
+	s.sendJSONResponse(id, snapshot)
+}
+
+func (s *MCPServer) deleteSnapshot(ctx context.Context, id interface{}, args map[string]interface{}) {
+	snapshotID := getString(args, "snapshot_id")
+	if snapshotID == "" {
+		s.sendToolError(id, "snapshot_id is required")
+		return
+	}
+
+	_, err := s.client.Snapshots.Delete(ctx, snapshotID)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to delete snapshot: %v", err))
+		return
+	}
+
+	s.sendJSONResponse(id, map[string]interface{}{
+		"status":      "deleted",
+		"snapshot_id": snapshotID,
+	})
+}
+
+// ---------- Domain Tool Handlers ----------
+
+// dnsRecordTypes are the record types accepted by create/update_dns_record.
+var dnsRecordTypes = []string{"A", "AAAA", "CNAME", "MX", "TXT", "SRV", "NS"}
+
+func (s *MCPServer) listDomains(ctx context.Context, id interface{}, args map[string]interface{}) {
+	opt := &godo.ListOptions{PerPage: 200}
+	var allDomains []godo.Domain
+
+	for {
+		domains, resp, err := s.client.Domains.List(ctx, opt)
+		if err != nil {
+			s.sendToolError(id, fmt.Sprintf("Failed to list domains: %v", err))
+			return
+		}
+
+		allDomains = append(allDomains, domains...)
+
+		if resp.Links == nil || resp.Links.IsLastPage() {
+			break
+		}
+
+		page, err := resp.Links.CurrentPage()
+		if err != nil {
+			break
+		}
+		opt.Page = page + 1
+	}
+
+	s.sendJSONResponse(id, allDomains)
+}
+
+func (s *MCPServer) listDNSRecords(ctx context.Context, id interface{}, args map[string]interface{}) {
+	domain := getString(args, "domain")
+	if domain == "" {
+		s.sendToolError(id, "domain is required")
+		return
+	}
+
+	opt := &godo.ListOptions{PerPage: 200}
+	var allRecords []godo.DomainRecord
+
+	for {
+		records, resp, err := s.client.Domains.Records(ctx, domain, opt)
+		if err != nil {
+			s.sendToolError(id, fmt.Sprintf("Failed to list DNS records: %v", err))
+			return
+		}
+
+		allRecords = append(allRecords, records...)
+
+		if resp.Links == nil || resp.Links.IsLastPage() {
+			break
+		}
+
+		page, err := resp.Links.CurrentPage()
+		if err != nil {
+			break
+		}
+		opt.Page = page + 1
+	}
+
+	s.sendJSONResponse(id, allRecords)
+}
+
+func (s *MCPServer) createDNSRecord(ctx context.Context, id interface{}, args map[string]interface{}) {
+	domain := getString(args, "domain")
+	if domain == "" {
+		s.sendToolError(id, "domain is required")
+		return
+	}
+
+	editRequest, err := buildDomainRecordRequest(args, nil)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+
+	record, _, err := s.client.Domains.CreateRecord(ctx, domain, editRequest)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to create DNS record: %v", err))
+		return
+	}
+
+	s.sendJSONResponse(id, record)
+}
+
+func (s *MCPServer) updateDNSRecord(ctx context.Context, id interface{}, args map[string]interface{}) {
+	domain := getString(args, "domain")
+	recordID := getInt(args, "record_id")
+	if domain == "" || recordID == 0 {
+		s.sendToolError(id, "domain and record_id are required")
+		return
+	}
+
+	// The API replaces every field on update, so start from the current
+	// record to avoid resetting values the caller did not mention.
+	existing, _, err := s.client.Domains.Record(ctx, domain, recordID)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to get DNS record: %v", err))
+		return
+	}
+
+	editRequest, err := buildDomainRecordRequest(args, existing)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+
+	record, _, err := s.client.Domains.EditRecord(ctx, domain, recordID, editRequest)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to update DNS record: %v", err))
+		return
+	}
+
+	s.sendJSONResponse(id, record)
+}
+
+func (s *MCPServer) deleteDNSRecord(ctx context.Context, id interface{}, args map[string]interface{}) {
+	domain := getString(args, "domain")
+	recordID := getInt(args, "record_id")
+	if domain == "" || recordID == 0 {
+		s.sendToolError(id, "domain and record_id are required")
+		return
+	}
+
+	_, err := s.client.Domains.DeleteRecord(ctx, domain, recordID)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to delete DNS record: %v", err))
+		return
+	}
+
+	s.sendJSONResponse(id, map[string]interface{}{
+		"status":    "deleted",
+		"domain":    domain,
+		"record_id": recordID,
+	})
+}
+
+// buildDomainRecordRequest converts DNS record arguments into a godo edit
+// request. When base is non-nil, fields absent from args keep base's values.
+func buildDomainRecordRequest(args map[string]interface{}, base *godo.DomainRecord) (*godo.DomainRecordEditRequest, error) {
+	req := &godo.DomainRecordEditRequest{}
+	if base != nil {
+		req.Type = base.Type
+		req.Name = base.Name
+		req.Data = base.Data
+		req.Priority = base.Priority
+		req.Port = base.Port
+		req.TTL = base.TTL
+		req.Weight = base.Weight
+		req.Flags = base.Flags
+		req.Tag = base.Tag
+	}
+
+	if v := getString(args, "type"); v != "" {
+		req.Type = strings.ToUpper(v)
+	}
+	if v := getString(args, "name"); v != "" {
+		req.Name = v
+	}
+	if v := getString(args, "data"); v != "" {
+		req.Data = v
+	}
+	if _, ok := args["ttl"]; ok {
+		req.TTL = getInt(args, "ttl")
+	}
+	if _, ok := args["priority"]; ok {
+		req.Priority = getInt(args, "priority")
+	}
+	if _, ok := args["port"]; ok {
+		req.Port = getInt(args, "port")
+	}
+	if _, ok := args["weight"]; ok {
+		req.Weight = getInt(args, "weight")
+	}
+
+	if !containsString(dnsRecordTypes, req.Type) {
+		return nil, fmt.Errorf("type must be one of %s, got %q", strings.Join(dnsRecordTypes, ", "), req.Type)
+	}
+	if req.Name == "" || req.Data == "" {
+		return nil, fmt.Errorf("name and data are required")
+	}
+
+	// A record that is becoming MX/SRV has no meaningful priority or port
+	// to inherit, so those must be given explicitly.
+	typeChanged := base == nil || base.Type != req.Type
+	if req.Type == "MX" || req.Type == "SRV" {
+		if _, ok := args["priority"]; !ok && typeChanged {
+			return nil, fmt.Errorf("priority is required for %s records", req.Type)
+		}
+	}
+	if req.Type == "SRV" {
+		if _, ok := args["port"]; !ok && typeChanged {
+			return nil, fmt.Errorf("port is required for SRV records")
+		}
+	}
+
+	return req, nil
+}
+
+// ---------- Kubernetes Tool Handlers ----------
+
+// KubernetesClusterSummary is the condensed view of a cluster returned by
+// list_kubernetes_clusters.
+type KubernetesClusterSummary struct {
+	ID        string                      `json:"id"`
+	Name      string                      `json:"name"`
+	Region    string                      `json:"region"`
+	Version   string                      `json:"version"`
+	Status    string                      `json:"status"`
+	Endpoint  string                      `json:"endpoint,omitempty"`
+	NodeCount int                         `json:"node_count"`
+	NodePools []KubernetesNodePoolSummary `json:"node_pools"`
+	CreatedAt time.Time                   `json:"created_at"`
+}
+
+// KubernetesNodePoolSummary is the condensed view of a node pool.
+type KubernetesNodePoolSummary struct {
+	Name      string `json:"name"`
+	Size      string `json:"size"`
+	Count     int    `json:"count"`
+	AutoScale bool   `json:"auto_scale"`
+	MinNodes  int    `json:"min_nodes,omitempty"`
+	MaxNodes  int    `json:"max_nodes,omitempty"`
+}
+
+func summarizeKubernetesCluster(cluster *godo.KubernetesCluster) KubernetesClusterSummary {
+	summary := KubernetesClusterSummary{
+		ID:        cluster.ID,
+		Name:      cluster.Name,
+		Region:    cluster.RegionSlug,
+		Version:   cluster.VersionSlug,
+		Endpoint:  cluster.Endpoint,
+		NodePools: []KubernetesNodePoolSummary{},
+		CreatedAt: cluster.CreatedAt,
+	}
+	if cluster.Status != nil {
+		summary.Status = string(cluster.Status.State)
+	}
+	for _, pool := range cluster.NodePools {
+		if pool == nil {
+			continue
+		}
+		summary.NodeCount += pool.Count
+		summary.NodePools = append(summary.NodePools, KubernetesNodePoolSummary{
+			Name:      pool.Name,
+			Size:      pool.Size,
+			Count:     pool.Count,
+			AutoScale: pool.AutoScale,
+			MinNodes:  pool.MinNodes,
+			MaxNodes:  pool.MaxNodes,
+		})
+	}
+	return summary
+}
+
+func (s *MCPServer) listKubernetesClusters(ctx context.Context, id interface{}, args map[string]interface{}) {
+	opt := &godo.ListOptions{PerPage: 200}
+	clusters := []KubernetesClusterSummary{}
+
+	for {
+		page, resp, err := s.client.Kubernetes.List(ctx, opt)
+		if err != nil {
+			s.sendToolError(id, fmt.Sprintf("Failed to list Kubernetes clusters: %v", err))
+			return
+		}
+
+		for _, cluster := range page {
+			clusters = append(clusters, summarizeKubernetesCluster(cluster))
+		}
+
+		if resp.Links == nil || resp.Links.IsLastPage() {
+			break
+		}
+
+		current, err := resp.Links.CurrentPage()
+		if err != nil {
+			break
+		}
+		opt.Page = current + 1
+	}
+
+	s.sendJSONResponse(id, clusters)
+}
+
+func (s *MCPServer) getKubernetesCluster(ctx context.Context, id interface{}, args map[string]interface{}) {
+	clusterID := getString(args, "cluster_id")
+	if clusterID == "" {
+		s.sendToolError(id, "cluster_id is required")
+		return
+	}
+
+	cluster, _, err := s.client.Kubernetes.Get(ctx, clusterID)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to get Kubernetes cluster: %v", err))
+		return
+	}
+
+	s.sendJSONResponse(id, cluster)
+}
+
+func (s *MCPServer) getKubernetesKubeconfig(ctx context.Context, id interface{}, args map[string]interface{}) {
+	clusterID := getString(args, "cluster_id")
+	if clusterID == "" {
+		s.sendToolError(id, "cluster_id is required")
+		return
+	}
+
+	format := getString(args, "format")
+	if format == "" {
+		format = "raw"
+	}
+	if format != "raw" && format != "base64" {
+		s.sendToolError(id, fmt.Sprintf("format must be raw or base64, got %q", format))
+		return
+	}
+
+	config, _, err := s.client.Kubernetes.GetKubeConfig(ctx, clusterID)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to get kubeconfig: %v", err))
+		return
+	}
+
+	text := string(config.KubeconfigYAML)
+	if format == "base64" {
+		text = base64.StdEncoding.EncodeToString(config.KubeconfigYAML)
+	}
+
+	s.sendResponse(id, ToolResult{
+		Content: []ContentItem{{Type: "text", Text: text}},
+	})
+}
+
+// ---------- App Platform Tool Handlers ----------
+
+func (s *MCPServer) listApps(ctx context.Context, id interface{}, args map[string]interface{}) {
+	opt := &godo.ListOptions{PerPage: 200}
+	var allApps []*godo.App
+
+	for {
+		apps, resp, err := s.client.Apps.List(ctx, opt)
+		if err != nil {
+			s.sendToolError(id, fmt.Sprintf("Failed to list apps: %v", err))
+			return
+		}
+
+		allApps = append(allApps, apps...)
+
+		if resp.Links == nil || resp.Links.IsLastPage() {
+			break
+		}
+
+		page, err := resp.Links.CurrentPage()
+		if err != nil {
+			break
+		}
+		opt.Page = page + 1
+	}
+
+	s.sendJSONResponse(id, allApps)
+}
+
+func (s *MCPServer) getApp(ctx context.Context, id interface{}, args map[string]interface{}) {
+	appID := getString(args, "app_id")
+	if appID == "" {
+		s.sendToolError(id, "app_id is required")
+		return
+	}
+
+	app, _, err := s.client.Apps.Get(ctx, appID)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to get app: %v", err))
+		return
+	}
+
+	s.sendJSONResponse(id, app)
+}
+
+func (s *MCPServer) createApp(ctx context.Context, id interface{}, args map[string]interface{}) {
+	spec, err := parseAppSpec(args["spec"])
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+
+	app, _, err := s.client.Apps.Create(ctx, &godo.AppCreateRequest{
+		Spec:      spec,
+		ProjectID: getString(args, "project_id"),
+	})
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to create app: %v", err))
+		return
+	}
+
+	s.sendJSONResponse(id, app)
+}
+
+// parseAppSpec decodes create_app's spec argument, a JSON string or an
+// already-decoded object, into an app spec. Unknown fields are rejected so
+// that a misspelled key fails here instead of being silently dropped.
+func parseAppSpec(raw interface{}) (*godo.AppSpec, error) {
+	var data []byte
+	switch v := raw.(type) {
+	case string:
+		data = []byte(v)
+	case map[string]interface{}:
+		data, _ = json.Marshal(v)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, fmt.Errorf("spec is required")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var spec godo.AppSpec
+	if err := dec.Decode(&spec); err != nil {
+		return nil, fmt.Errorf("Invalid app spec: %v", err)
+	}
+	if spec.Name == "" {
+		return nil, fmt.Errorf("Invalid app spec: name is required")
+	}
+	return &spec, nil
+}
+
+func (s *MCPServer) createDeployment(ctx context.Context, id interface{}, args map[string]interface{}) {
+	appID := getString(args, "app_id")
+	if appID == "" {
+		s.sendToolError(id, "app_id is required")
+		return
+	}
+
+	deployment, _, err := s.client.Apps.CreateDeployment(ctx, appID, &godo.DeploymentCreateRequest{
+		ForceBuild: getBool(args, "force_build"),
+	})
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to create deployment: %v", err))
+		return
+	}
+
+	s.sendJSONResponse(id, deployment)
+}
+
+func (s *MCPServer) getDeployment(ctx context.Context, id interface{}, args map[string]interface{}) {
+	appID := getString(args, "app_id")
+	deploymentID := getString(args, "deployment_id")
+
+	if appID == "" || deploymentID == "" {
+		s.sendToolError(id, "app_id and deployment_id are required")
+		return
+	}
+
+	deployment, _, err := s.client.Apps.GetDeployment(ctx, appID, deploymentID)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to get deployment: %v", err))
+		return
+	}
+
+	s.sendJSONResponse(id, deployment)
+}
+
+// ---------- Account Tool Handlers ----------
+
+func (s *MCPServer) getAccount(ctx context.Context, id interface{}, args map[string]interface{}) {
+	account, _, err := s.client.Account.Get(ctx)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to get account info: %v", err))
+		return
+	}
+
+	s.sendJSONResponse(id, account)
+}
+
+// RateLimitInfo is the API rate limit state reported by get_rate_limit.
+type RateLimitInfo struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Used      int       `json:"used"`
+	ResetAt   time.Time `json:"reset_at"`
+	ResetIn   string    `json:"reset_in"`
+}
+
+func rateLimitInfo(rate godo.Rate, now time.Time) RateLimitInfo {
+	info := RateLimitInfo{
+		Limit:     rate.Limit,
+		Remaining: rate.Remaining,
+		Used:      rate.Limit - rate.Remaining,
+		ResetAt:   rate.Reset.Time,
+	}
+	if wait := rate.Reset.Sub(now); wait > 0 {
+		info.ResetIn = wait.Round(time.Second).String()
+	} else {
+		info.ResetIn = "0s"
+	}
+	return info
+}
+
+func (s *MCPServer) getRateLimit(ctx context.Context, id interface{}, args map[string]interface{}) {
+	// Every API response carries the rate limit headers; the account
+	// endpoint is the cheapest call to get one.
+	_, resp, err := s.client.Account.Get(ctx)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to get rate limit: %v", err))
+		return
+	}
+
+	s.sendJSONResponse(id, rateLimitInfo(resp.Rate, time.Now()))
+}
+
+func (s *MCPServer) getBalance(ctx context.Context, id interface{}, args map[string]interface{}) {
+	balance, _, err := s.client.Balance.Get(ctx)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to get balance: %v", err))
+		return
+	}
+
+	s.sendJSONResponse(id, balance)
+}
+
+// ---------- Helpers ----------
+
+func getString(args map[string]interface{}, key string) string {
+	if val, ok := args[key].(string); ok {
+		return val
+	}
+	return ""
+}
+
+func getBool(args map[string]interface{}, key string) bool {
+	if val, ok := args[key].(bool); ok {
+		return val
+	}
+	return false
+}
+
+func getInt(args map[string]interface{}, key string) int {
+	if val, ok := args[key].(float64); ok {
+		return int(val)
+	}
+	return 0
+}
+
+func getIntArray(args map[string]interface{}, key string) []int {
+	arr, ok := args[key].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	result := make([]int, 0, len(arr))
+	for _, v := range arr {
+		if n, ok := v.(float64); ok {
+			result = append(result, int(n))
+		}
+	}
+	return result
+}
+
+// getObjectArray returns an array argument whose elements must all be objects.
+func getObjectArray(args map[string]interface{}, key string) ([]map[string]interface{}, error) {
+	val, ok := args[key]
+	if !ok || val == nil {
+		return nil, nil
+	}
+
+	arr, ok := val.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be an array of objects", key)
+	}
+
+	result := make([]map[string]interface{}, 0, len(arr))
+	for i, v := range arr {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s[%d] must be an object", key, i)
+		}
+		result = append(result, obj)
+	}
+	return result, nil
+}
+
+func containsString(list []string, val string) bool {
+	for _, item := range list {
+		if item == val {
+			return true
+		}
+	}
+	return false
+}
+
+func getStringArray(args map[string]interface{}, key string) []string {
+	val, ok := args[key]
+	if !ok {
+		return nil
+	}
+
+	arr, ok := val.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	result := make([]string, 0, len(arr))
+	for _, v := range arr {
+		if s, ok := v.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// ---------- JSON-RPC responses ----------
+
+// stdoutMu serializes writes to stdoutWriter so that concurrent responses
+// can never interleave JSON-RPC lines on the protocol stream.
+var (
+	stdoutMu     sync.Mutex
+	stdoutWriter io.Writer = os.Stdout
+)
+
+// writeMessage writes a single newline-terminated JSON-RPC message to stdout.
+func writeMessage(data []byte) {
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+	stdoutWriter.Write(append(data, '\n'))
+}
+
+func (s *MCPServer) sendResponse(id interface{}, result interface{}) {
+	resp := JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  result,
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		logger.Printf("Error marshaling response: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error marshaling response: %v\n", err)
+		return
+	}
+	writeMessage(data)
+	logger.Printf("Sent response for request ID: %v\n", id)
+}
+
+func (s *MCPServer) sendJSONResponse(id interface{}, result interface{}) {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to marshal response: %v", err))
+		return
+	}
+
+	s.sendResponse(id, ToolResult{
+		Content: []ContentItem{{Type: "text", Text: string(data)}},
+		IsError: false,
+	})
+}
+
+func (s *MCPServer) sendError(id interface{}, code int, message string, data interface{}) {
+	logger.Printf("Sending error response: code=%d, message=%s\n", code, message)
+	resp := JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error:   &RPCError{Code: code, Message: message, Data: data},
+	}
+	jsonData, err := json.Marshal(resp)
 	if err != nil {
 		logger.Printf("Error marshaling error response: %v\n", err)
 		fmt.Fprintf(os.Stderr, "Error marshaling error response: %v\n", err)
 		return
 	}
-	fmt.Println(string(jsonData))
+	writeMessage(jsonData)
 }
 
 func (s *MCPServer) sendToolError(id interface{}, msg string) {
+	if s.callCtx != nil && errors.Is(s.callCtx.Err(), context.DeadlineExceeded) {
+		msg += fmt.Sprintf(" (DigitalOcean API call timed out after %s; set HUNTER3_DO_TIMEOUT to change)", s.timeout)
+	}
 	logger.Printf("Tool error: %s\n", msg)
 	s.sendResponse(id, ToolResult{
 		Content: []ContentItem{{Type: "text", Text: msg}},
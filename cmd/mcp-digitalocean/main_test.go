@@ -0,0 +1,1165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+func TestMain(m *testing.M) {
+	logger = log.New(io.Discard, "", 0)
+	os.Exit(m.Run())
+}
+
+// fakeAPI is a minimal stand-in for the DigitalOcean API that records the
+// requests it receives.
+type fakeAPI struct {
+	mu       sync.Mutex
+	requests []string
+	handlers map[string]http.HandlerFunc
+}
+
+func (f *fakeAPI) count(key string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, r := range f.requests {
+		if r == key {
+			n++
+		}
+	}
+	return n
+}
+
+// newTestServer starts a fake API with the given "METHOD /path" handlers and
+// returns an MCPServer whose client talks to it.
+func newTestServer(t *testing.T, handlers map[string]http.HandlerFunc) (*MCPServer, *fakeAPI) {
+	t.Helper()
+
+	api := &fakeAPI{handlers: handlers}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Method + " " + r.URL.Path
+		api.mu.Lock()
+		api.requests = append(api.requests, key)
+		api.mu.Unlock()
+
+		h, ok := api.handlers[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"id":"not_found","message":"The resource you were accessing could not be found."}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		h(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := godo.New(http.DefaultClient, godo.SetBaseURL(srv.URL+"/"))
+	if err != nil {
+		t.Fatalf("godo.New: %v", err)
+	}
+	return &MCPServer{client: client}, api
+}
+
+// jsonHandler responds with body as a JSON document.
+func jsonHandler(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}
+}
+
+// callTool invokes a tool handler and returns the decoded tool result.
+func callTool(t *testing.T, s *MCPServer, name string, args map[string]interface{}) ToolResult {
+	t.Helper()
+
+	var buf bytes.Buffer
+	stdoutWriter = &buf
+	defer func() { stdoutWriter = os.Stdout }()
+
+	params, _ := json.Marshal(CallToolParams{Name: name, Arguments: args})
+	s.handleCallTool(JSONRPCRequest{JSONRPC: "2.0", ID: 1, Method: "tools/call", Params: params})
+
+	var resp struct {
+		Result ToolResult `json:"result"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &resp); err != nil {
+		t.Fatalf("Unmarshal response %q: %v", buf.String(), err)
+	}
+	return resp.Result
+}
+
+var catalogHandlers = map[string]http.HandlerFunc{
+	"GET /v2/regions": jsonHandler(`{"regions":[
+		{"slug":"nyc3","name":"New York 3","available":true},
+		{"slug":"sfo3","name":"San Francisco 3","available":true},
+		{"slug":"nyc2","name":"New York 2","available":false}
+	],"links":{},"meta":{"total":3}}`),
+	"GET /v2/sizes": jsonHandler(`{"sizes":[
+		{"slug":"s-1vcpu-1gb","disk":25,"available":true,"regions":["nyc3","sfo3"]},
+		{"slug":"g-2vcpu-8gb","disk":25,"available":true,"regions":["nyc3"]}
+	],"links":{},"meta":{"total":2}}`),
+	"GET /v2/images/ubuntu-24-04-x64": jsonHandler(`{"image":{"id":1,"slug":"ubuntu-24-04-x64","min_disk_size":7,"regions":["nyc3","sfo3"]}}`),
+	"GET /v2/images/big-image":        jsonHandler(`{"image":{"id":2,"slug":"big-image","min_disk_size":50,"regions":["nyc3","sfo3"]}}`),
+	"POST /v2/droplets":               jsonHandler(`{"droplet":{"id":123,"name":"web-1"}}`),
+}
+
+func TestCreateDropletValidateOnly(t *testing.T) {
+	tests := []struct {
+		name       string
+		region     string
+		size       string
+		image      string
+		wantValid  bool
+		wantErrors []string
+	}{
+		{
+			name:      "valid slugs",
+			region:    "nyc3",
+			size:      "s-1vcpu-1gb",
+			image:     "ubuntu-24-04-x64",
+			wantValid: true,
+		},
+		{
+			name:       "unknown region",
+			region:     "mars1",
+			size:       "s-1vcpu-1gb",
+			image:      "ubuntu-24-04-x64",
+			wantErrors: []string{`unknown region "mars1"; available regions: nyc3, sfo3`},
+		},
+		{
+			name:       "unavailable region",
+			region:     "nyc2",
+			size:       "s-1vcpu-1gb",
+			image:      "ubuntu-24-04-x64",
+			wantErrors: []string{`region "nyc2" is not accepting new Droplets`},
+		},
+		{
+			name:       "unknown size and image",
+			region:     "nyc3",
+			size:       "s-99vcpu",
+			image:      "windows-95",
+			wantErrors: []string{`unknown size "s-99vcpu"`, `unknown image "windows-95"`},
+		},
+		{
+			name:       "size not offered in region",
+			region:     "sfo3",
+			size:       "g-2vcpu-8gb",
+			image:      "ubuntu-24-04-x64",
+			wantErrors: []string{`size "g-2vcpu-8gb" is not offered in region "sfo3"`},
+		},
+		{
+			name:       "image too large for size",
+			region:     "nyc3",
+			size:       "s-1vcpu-1gb",
+			image:      "big-image",
+			wantErrors: []string{`image "big-image" needs at least 50 GB`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, api := newTestServer(t, catalogHandlers)
+
+			result := callTool(t, s, "create_droplet", map[string]interface{}{
+				"name":          "web-1",
+				"region":        tt.region,
+				"size":          tt.size,
+				"image":         tt.image,
+				"validate_only": true,
+			})
+			if result.IsError {
+				t.Fatalf("unexpected tool error: %s", result.Content[0].Text)
+			}
+
+			var v DropletValidation
+			if err := json.Unmarshal([]byte(result.Content[0].Text), &v); err != nil {
+				t.Fatalf("Unmarshal validation: %v", err)
+			}
+			if v.Valid != tt.wantValid {
+				t.Errorf("Valid = %v, want %v (errors: %v)", v.Valid, tt.wantValid, v.Errors)
+			}
+			if len(v.Errors) != len(tt.wantErrors) {
+				t.Fatalf("got errors %q, want %d errors", v.Errors, len(tt.wantErrors))
+			}
+			for i, want := range tt.wantErrors {
+				if !strings.Contains(v.Errors[i], want) {
+					t.Errorf("Errors[%d] = %q, want it to contain %q", i, v.Errors[i], want)
+				}
+			}
+
+			if n := api.count("POST /v2/droplets"); n != 0 {
+				t.Errorf("validate_only made %d create calls, want 0", n)
+			}
+		})
+	}
+}
+
+func TestCreateDropletWithoutValidateOnlyCreates(t *testing.T) {
+	s, api := newTestServer(t, catalogHandlers)
+
+	result := callTool(t, s, "create_droplet", map[string]interface{}{
+		"name":   "web-1",
+		"region": "nyc3",
+		"size":   "s-1vcpu-1gb",
+		"image":  "ubuntu-24-04-x64",
+	})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %s", result.Content[0].Text)
+	}
+	if n := api.count("POST /v2/droplets"); n != 1 {
+		t.Errorf("made %d create calls, want 1", n)
+	}
+}
+
+func TestCatalogsAreCached(t *testing.T) {
+	s, api := newTestServer(t, catalogHandlers)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.validateDropletSlugs(ctx, "nyc3", "s-1vcpu-1gb", "ubuntu-24-04-x64"); err != nil {
+			t.Fatalf("validateDropletSlugs: %v", err)
+		}
+	}
+
+	if n := api.count("GET /v2/regions"); n != 1 {
+		t.Errorf("fetched regions %d times, want 1", n)
+	}
+	if n := api.count("GET /v2/sizes"); n != 1 {
+		t.Errorf("fetched sizes %d times, want 1", n)
+	}
+}
+
+func TestBuildFirewallRequest(t *testing.T) {
+	args := map[string]interface{}{
+		"name": "web-fw",
+		"inbound_rules": []interface{}{
+			map[string]interface{}{
+				"protocol": "tcp",
+				"ports":    "8000-9000",
+				"sources": map[string]interface{}{
+					"addresses": []interface{}{"10.0.0.0/8", "192.168.1.5"},
+				},
+			},
+		},
+		"outbound_rules": []interface{}{
+			map[string]interface{}{
+				"protocol": "icmp",
+				"destinations": map[string]interface{}{
+					"addresses": []interface{}{"0.0.0.0/0", "::/0"},
+				},
+			},
+		},
+		"droplet_ids": []interface{}{float64(101), float64(102)},
+	}
+
+	req, err := buildFirewallRequest(args)
+	if err != nil {
+		t.Fatalf("buildFirewallRequest: %v", err)
+	}
+
+	if req.Name != "web-fw" {
+		t.Errorf("Name = %q, want %q", req.Name, "web-fw")
+	}
+	if len(req.DropletIDs) != 2 || req.DropletIDs[0] != 101 || req.DropletIDs[1] != 102 {
+		t.Errorf("DropletIDs = %v, want [101 102]", req.DropletIDs)
+	}
+
+	if len(req.InboundRules) != 1 {
+		t.Fatalf("got %d inbound rules, want 1", len(req.InboundRules))
+	}
+	in := req.InboundRules[0]
+	if in.Protocol != "tcp" || in.PortRange != "8000-9000" {
+		t.Errorf("inbound rule = %s %s, want tcp 8000-9000", in.Protocol, in.PortRange)
+	}
+	if in.Sources == nil || strings.Join(in.Sources.Addresses, ",") != "10.0.0.0/8,192.168.1.5" {
+		t.Errorf("inbound sources = %+v", in.Sources)
+	}
+
+	if len(req.OutboundRules) != 1 {
+		t.Fatalf("got %d outbound rules, want 1", len(req.OutboundRules))
+	}
+	out := req.OutboundRules[0]
+	if out.Protocol != "icmp" || out.PortRange != "" {
+		t.Errorf("outbound rule = %s %q, want icmp with no ports", out.Protocol, out.PortRange)
+	}
+	if out.Destinations == nil || len(out.Destinations.Addresses) != 2 {
+		t.Errorf("outbound destinations = %+v", out.Destinations)
+	}
+}
+
+func TestBuildFirewallRequestRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule map[string]interface{}
+		want string
+	}{
+		{
+			name: "unknown protocol",
+			rule: map[string]interface{}{"protocol": "sctp", "ports": "80", "sources": map[string]interface{}{"addresses": []interface{}{"0.0.0.0/0"}}},
+			want: "protocol must be tcp, udp, or icmp",
+		},
+		{
+			name: "tcp without ports",
+			rule: map[string]interface{}{"protocol": "tcp", "sources": map[string]interface{}{"addresses": []interface{}{"0.0.0.0/0"}}},
+			want: "ports is required",
+		},
+		{
+			name: "missing sources",
+			rule: map[string]interface{}{"protocol": "udp", "ports": "53"},
+			want: "sources is required",
+		},
+		{
+			name: "empty sources",
+			rule: map[string]interface{}{"protocol": "udp", "ports": "53", "sources": map[string]interface{}{}},
+			want: "at least one of",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := buildFirewallRequest(map[string]interface{}{
+				"name":          "fw",
+				"inbound_rules": []interface{}{tt.rule},
+			})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddDropletsToFirewall(t *testing.T) {
+	var body struct {
+		DropletIDs []int `json:"droplet_ids"`
+	}
+	s, api := newTestServer(t, map[string]http.HandlerFunc{
+		"POST /v2/firewalls/fw-1/droplets": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&body)
+			w.WriteHeader(http.StatusNoContent)
+		},
+	})
+
+	result := callTool(t, s, "add_droplets_to_firewall", map[string]interface{}{
+		"firewall_id": "fw-1",
+		"droplet_ids": []interface{}{float64(7), float64(8)},
+	})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %s", result.Content[0].Text)
+	}
+	if n := api.count("POST /v2/firewalls/fw-1/droplets"); n != 1 {
+		t.Errorf("made %d add calls, want 1", n)
+	}
+	if len(body.DropletIDs) != 2 || body.DropletIDs[0] != 7 || body.DropletIDs[1] != 8 {
+		t.Errorf("droplet_ids sent = %v, want [7 8]", body.DropletIDs)
+	}
+}
+
+func TestBuildDomainRecordRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want godo.DomainRecordEditRequest
+	}{
+		{
+			name: "A record",
+			args: map[string]interface{}{"type": "a", "name": "www", "data": "203.0.113.10", "ttl": float64(300)},
+			want: godo.DomainRecordEditRequest{Type: "A", Name: "www", Data: "203.0.113.10", TTL: 300},
+		},
+		{
+			name: "MX record with priority",
+			args: map[string]interface{}{"type": "MX", "name": "@", "data": "mail.example.com.", "priority": float64(10)},
+			want: godo.DomainRecordEditRequest{Type: "MX", Name: "@", Data: "mail.example.com.", Priority: 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildDomainRecordRequest(tt.args, nil)
+			if err != nil {
+				t.Fatalf("buildDomainRecordRequest: %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildDomainRecordRequestValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"unknown type", map[string]interface{}{"type": "PTR", "name": "x", "data": "y"}, "type must be one of"},
+		{"MX without priority", map[string]interface{}{"type": "MX", "name": "@", "data": "mail.example.com."}, "priority is required"},
+		{"SRV without port", map[string]interface{}{"type": "SRV", "name": "_sip._tcp", "data": "sip.example.com.", "priority": float64(10)}, "port is required"},
+		{"missing data", map[string]interface{}{"type": "A", "name": "www"}, "name and data are required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := buildDomainRecordRequest(tt.args, nil)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildDomainRecordRequestKeepsExistingFields(t *testing.T) {
+	base := &godo.DomainRecord{ID: 5, Type: "MX", Name: "@", Data: "mail.example.com.", Priority: 10, TTL: 1800}
+
+	got, err := buildDomainRecordRequest(map[string]interface{}{"data": "mx2.example.com."}, base)
+	if err != nil {
+		t.Fatalf("buildDomainRecordRequest: %v", err)
+	}
+	want := godo.DomainRecordEditRequest{Type: "MX", Name: "@", Data: "mx2.example.com.", Priority: 10, TTL: 1800}
+	if *got != want {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+}
+
+const testKubernetesCluster = `{
+	"id": "k8s-1",
+	"name": "prod",
+	"region": "nyc3",
+	"version": "1.30.1-do.0",
+	"endpoint": "https://k8s-1.k8s.ondigitalocean.com",
+	"status": {"state": "running"},
+	"created_at": "2024-05-01T12:00:00Z",
+	"node_pools": [
+		{"id": "p1", "name": "default", "size": "s-2vcpu-4gb", "count": 3},
+		{"id": "p2", "name": "burst", "size": "c-4", "count": 2, "auto_scale": true, "min_nodes": 1, "max_nodes": 5}
+	]
+}`
+
+func TestListKubernetesClusters(t *testing.T) {
+	s, api := newTestServer(t, map[string]http.HandlerFunc{
+		"GET /v2/kubernetes/clusters": jsonHandler(`{"kubernetes_clusters":[` + testKubernetesCluster + `],"links":{},"meta":{"total":1}}`),
+	})
+
+	result := callTool(t, s, "list_kubernetes_clusters", map[string]interface{}{})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %s", result.Content[0].Text)
+	}
+
+	var clusters []KubernetesClusterSummary
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &clusters); err != nil {
+		t.Fatalf("Unmarshal clusters: %v", err)
+	}
+	if len(clusters) != 1 {
+		t.Fatalf("got %d clusters, want 1", len(clusters))
+	}
+
+	c := clusters[0]
+	if c.ID != "k8s-1" || c.Name != "prod" || c.Region != "nyc3" || c.Version != "1.30.1-do.0" {
+		t.Errorf("cluster metadata = %+v", c)
+	}
+	if c.Status != "running" {
+		t.Errorf("Status = %q, want %q", c.Status, "running")
+	}
+	if c.NodeCount != 5 {
+		t.Errorf("NodeCount = %d, want 5", c.NodeCount)
+	}
+	if len(c.NodePools) != 2 || !c.NodePools[1].AutoScale || c.NodePools[1].MaxNodes != 5 {
+		t.Errorf("NodePools = %+v", c.NodePools)
+	}
+	if n := api.count("GET /v2/kubernetes/clusters"); n != 1 {
+		t.Errorf("made %d list calls, want 1", n)
+	}
+}
+
+func TestGetKubernetesCluster(t *testing.T) {
+	s, api := newTestServer(t, map[string]http.HandlerFunc{
+		"GET /v2/kubernetes/clusters/k8s-1": jsonHandler(`{"kubernetes_cluster":` + testKubernetesCluster + `}`),
+	})
+
+	result := callTool(t, s, "get_kubernetes_cluster", map[string]interface{}{"cluster_id": "k8s-1"})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %s", result.Content[0].Text)
+	}
+
+	var cluster godo.KubernetesCluster
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &cluster); err != nil {
+		t.Fatalf("Unmarshal cluster: %v", err)
+	}
+	if cluster.ID != "k8s-1" || len(cluster.NodePools) != 2 {
+		t.Errorf("cluster = %+v", cluster)
+	}
+	if n := api.count("GET /v2/kubernetes/clusters/k8s-1"); n != 1 {
+		t.Errorf("made %d get calls, want 1", n)
+	}
+}
+
+func TestGetKubernetesKubeconfig(t *testing.T) {
+	const kubeconfig = "apiVersion: v1\nkind: Config\n"
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"", kubeconfig},
+		{"raw", kubeconfig},
+		{"base64", "YXBpVmVyc2lvbjogdjEKa2luZDogQ29uZmlnCg=="},
+	}
+
+	for _, tt := range tests {
+		t.Run("format="+tt.format, func(t *testing.T) {
+			s, api := newTestServer(t, map[string]http.HandlerFunc{
+				"GET /v2/kubernetes/clusters/k8s-1/kubeconfig": func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/yaml")
+					io.WriteString(w, kubeconfig)
+				},
+			})
+
+			args := map[string]interface{}{"cluster_id": "k8s-1"}
+			if tt.format != "" {
+				args["format"] = tt.format
+			}
+			result := callTool(t, s, "get_kubernetes_kubeconfig", args)
+			if result.IsError {
+				t.Fatalf("unexpected tool error: %s", result.Content[0].Text)
+			}
+			if got := result.Content[0].Text; got != tt.want {
+				t.Errorf("kubeconfig = %q, want %q", got, tt.want)
+			}
+			if n := api.count("GET /v2/kubernetes/clusters/k8s-1/kubeconfig"); n != 1 {
+				t.Errorf("made %d kubeconfig calls, want 1", n)
+			}
+		})
+	}
+}
+
+func TestListSnapshotsFiltersByResourceType(t *testing.T) {
+	tests := []struct {
+		resourceType string
+		wantQuery    string
+	}{
+		{"", ""},
+		{"droplet", "droplet"},
+		{"volume", "volume"},
+	}
+
+	for _, tt := range tests {
+		t.Run("resource_type="+tt.resourceType, func(t *testing.T) {
+			var gotQuery string
+			s, _ := newTestServer(t, map[string]http.HandlerFunc{
+				"GET /v2/snapshots": func(w http.ResponseWriter, r *http.Request) {
+					gotQuery = r.URL.Query().Get("resource_type")
+					io.WriteString(w, `{"snapshots":[{"id":"s1","name":"nightly","resource_type":"droplet"}],"links":{},"meta":{"total":1}}`)
+				},
+			})
+
+			args := map[string]interface{}{}
+			if tt.resourceType != "" {
+				args["resource_type"] = tt.resourceType
+			}
+			result := callTool(t, s, "list_snapshots", args)
+			if result.IsError {
+				t.Fatalf("unexpected tool error: %s", result.Content[0].Text)
+			}
+			if gotQuery != tt.wantQuery {
+				t.Errorf("resource_type query = %q, want %q", gotQuery, tt.wantQuery)
+			}
+
+			var snapshots []godo.Snapshot
+			if err := json.Unmarshal([]byte(result.Content[0].Text), &snapshots); err != nil {
+				t.Fatalf("Unmarshal snapshots: %v", err)
+			}
+			if len(snapshots) != 1 || snapshots[0].ID != "s1" {
+				t.Errorf("snapshots = %+v", snapshots)
+			}
+		})
+	}
+}
+
+func TestListSnapshotsRejectsUnknownResourceType(t *testing.T) {
+	s, api := newTestServer(t, nil)
+
+	result := callTool(t, s, "list_snapshots", map[string]interface{}{"resource_type": "image"})
+	if !result.IsError {
+		t.Fatal("expected a tool error")
+	}
+	if n := api.count("GET /v2/snapshots"); n != 0 {
+		t.Errorf("made %d list calls, want 0", n)
+	}
+}
+
+func TestDeleteSnapshot(t *testing.T) {
+	s, api := newTestServer(t, map[string]http.HandlerFunc{
+		"DELETE /v2/snapshots/s1": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		},
+	})
+
+	result := callTool(t, s, "delete_snapshot", map[string]interface{}{"snapshot_id": "s1"})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %s", result.Content[0].Text)
+	}
+	if n := api.count("DELETE /v2/snapshots/s1"); n != 1 {
+		t.Errorf("made %d delete calls, want 1", n)
+	}
+
+	result = callTool(t, s, "delete_snapshot", map[string]interface{}{})
+	if !result.IsError {
+		t.Error("expected a tool error without snapshot_id")
+	}
+}
+
+func TestGetDropletNeighbors(t *testing.T) {
+	s, _ := newTestServer(t, map[string]http.HandlerFunc{
+		"GET /v2/droplets/1/neighbors": jsonHandler(`{"droplets":[{"id":2,"name":"db-1"},{"id":3,"name":"db-2"}]}`),
+		"GET /v2/droplets/4/neighbors": jsonHandler(`{"droplets":[]}`),
+	})
+
+	result := callTool(t, s, "get_droplet_neighbors", map[string]interface{}{"droplet_id": float64(1)})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %s", result.Content[0].Text)
+	}
+	var neighbors []godo.Droplet
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &neighbors); err != nil {
+		t.Fatalf("Unmarshal neighbors: %v", err)
+	}
+	if len(neighbors) != 2 || neighbors[0].Name != "db-1" {
+		t.Errorf("neighbors = %+v", neighbors)
+	}
+
+	result = callTool(t, s, "get_droplet_neighbors", map[string]interface{}{"droplet_id": float64(4)})
+	if result.IsError || result.Content[0].Text != "[]" {
+		t.Errorf("result = %+v, want an empty list", result)
+	}
+
+	result = callTool(t, s, "get_droplet_neighbors", map[string]interface{}{})
+	if !result.IsError {
+		t.Error("expected a tool error without droplet_id")
+	}
+}
+
+func TestListDropletKernelsFollowsPages(t *testing.T) {
+	s, api := newTestServer(t, map[string]http.HandlerFunc{
+		"GET /v2/droplets/1/kernels": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("page") == "2" {
+				io.WriteString(w, `{"kernels":[{"id":3,"name":"kernel-3"}],"links":{"pages":{"prev":"http://`+r.Host+`/v2/droplets/1/kernels?page=1"}}}`)
+				return
+			}
+			io.WriteString(w, `{"kernels":[{"id":1,"name":"kernel-1"},{"id":2,"name":"kernel-2"}],"links":{"pages":{"next":"http://`+r.Host+`/v2/droplets/1/kernels?page=2"}}}`)
+		},
+	})
+
+	result := callTool(t, s, "list_droplet_kernels", map[string]interface{}{"droplet_id": float64(1)})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %s", result.Content[0].Text)
+	}
+	var kernels []godo.Kernel
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &kernels); err != nil {
+		t.Fatalf("Unmarshal kernels: %v", err)
+	}
+	if len(kernels) != 3 || kernels[2].Name != "kernel-3" {
+		t.Errorf("kernels = %+v", kernels)
+	}
+	if n := api.count("GET /v2/droplets/1/kernels"); n != 2 {
+		t.Errorf("made %d kernel list calls, want 2", n)
+	}
+}
+
+func TestListDropletKernelsEmpty(t *testing.T) {
+	s, _ := newTestServer(t, map[string]http.HandlerFunc{
+		"GET /v2/droplets/4/kernels": jsonHandler(`{"kernels":[]}`),
+	})
+
+	result := callTool(t, s, "list_droplet_kernels", map[string]interface{}{"droplet_id": float64(4)})
+	if result.IsError || result.Content[0].Text != "[]" {
+		t.Errorf("result = %+v, want an empty list", result)
+	}
+}
+
+func TestCreateProject(t *testing.T) {
+	var got godo.CreateProjectRequest
+	s, api := newTestServer(t, map[string]http.HandlerFunc{
+		"POST /v2/projects": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&got)
+			io.WriteString(w, `{"project":{"id":"p1","name":"shop","purpose":"Web Application","environment":"Production"}}`)
+		},
+	})
+
+	result := callTool(t, s, "create_project", map[string]interface{}{
+		"name":        "shop",
+		"purpose":     "Web Application",
+		"environment": "Production",
+	})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %s", result.Content[0].Text)
+	}
+	want := godo.CreateProjectRequest{Name: "shop", Purpose: "Web Application", Environment: "Production"}
+	if got != want {
+		t.Errorf("request = %+v, want %+v", got, want)
+	}
+
+	for _, args := range []map[string]interface{}{
+		{"name": "shop"},
+		{"name": "shop", "purpose": "Web Application", "environment": "QA"},
+	} {
+		if result := callTool(t, s, "create_project", args); !result.IsError {
+			t.Errorf("create_project(%v): expected a tool error", args)
+		}
+	}
+	if n := api.count("POST /v2/projects"); n != 1 {
+		t.Errorf("made %d create calls, want 1", n)
+	}
+}
+
+func TestAssignResourcesToProject(t *testing.T) {
+	var got struct {
+		Resources []string `json:"resources"`
+	}
+	s, api := newTestServer(t, map[string]http.HandlerFunc{
+		"POST /v2/projects/p1/resources": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&got)
+			io.WriteString(w, `{"resources":[{"urn":"do:droplet:123","status":"ok"},{"urn":"do:domain:example.com","status":"ok"}]}`)
+		},
+	})
+
+	urns := []interface{}{"do:droplet:123", "do:domain:example.com"}
+	result := callTool(t, s, "assign_resources_to_project", map[string]interface{}{"project_id": "p1", "resources": urns})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %s", result.Content[0].Text)
+	}
+	if strings.Join(got.Resources, " ") != "do:droplet:123 do:domain:example.com" {
+		t.Errorf("assigned %q", got.Resources)
+	}
+	var assigned []godo.ProjectResource
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &assigned); err != nil {
+		t.Fatalf("Unmarshal resources: %v", err)
+	}
+	if len(assigned) != 2 || assigned[0].Status != "ok" {
+		t.Errorf("resources = %+v", assigned)
+	}
+
+	result = callTool(t, s, "assign_resources_to_project", map[string]interface{}{"project_id": "p1", "resources": []interface{}{"droplet-123"}})
+	if !result.IsError {
+		t.Error("expected a tool error for a malformed URN")
+	}
+	if n := api.count("POST /v2/projects/p1/resources"); n != 1 {
+		t.Errorf("made %d assign calls, want 1", n)
+	}
+}
+
+func TestParseResourceURNs(t *testing.T) {
+	got, err := parseResourceURNs([]string{"do:droplet:123", "do:volume:abc"})
+	if err != nil {
+		t.Fatalf("parseResourceURNs: %v", err)
+	}
+	want := []godo.Resource{{ID: "123", Type: godo.DropletResourceType}, {ID: "abc", Type: godo.VolumeResourceType}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("parseResourceURNs = %+v, want %+v", got, want)
+	}
+
+	for _, urn := range []string{"droplet:123", "do:droplet:123:extra"} {
+		if _, err := parseResourceURNs([]string{urn}); err == nil {
+			t.Errorf("parseResourceURNs(%q) expected error", urn)
+		}
+	}
+}
+
+func TestParseAppSpec(t *testing.T) {
+	specJSON := `{"name":"web","region":"nyc","services":[{"name":"api","image":{"registry_type":"DOCR","repository":"api","tag":"v1"},"http_port":8080}]}`
+
+	spec, err := parseAppSpec(specJSON)
+	if err != nil {
+		t.Fatalf("parseAppSpec: %v", err)
+	}
+	if spec.Name != "web" || len(spec.Services) != 1 || spec.Services[0].HTTPPort != 8080 {
+		t.Errorf("spec = %+v", spec)
+	}
+
+	var obj map[string]interface{}
+	json.Unmarshal([]byte(specJSON), &obj)
+	if spec, err := parseAppSpec(obj); err != nil || spec.Name != "web" {
+		t.Errorf("parseAppSpec(object) = %+v, %v", spec, err)
+	}
+
+	tests := []struct {
+		name string
+		raw  interface{}
+		want string
+	}{
+		{"missing", nil, "spec is required"},
+		{"blank", "  ", "spec is required"},
+		{"malformed", `{"name":`, "Invalid app spec"},
+		{"unknown field", `{"name":"web","servces":[]}`, "unknown field"},
+		{"no name", `{"region":"nyc"}`, "name is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseAppSpec(tt.raw); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateApp(t *testing.T) {
+	var got godo.AppCreateRequest
+	s, api := newTestServer(t, map[string]http.HandlerFunc{
+		"POST /v2/apps": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&got)
+			io.WriteString(w, `{"app":{"id":"a1","spec":{"name":"web"}}}`)
+		},
+	})
+
+	result := callTool(t, s, "create_app", map[string]interface{}{
+		"spec":       `{"name":"web","region":"nyc"}`,
+		"project_id": "p1",
+	})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %s", result.Content[0].Text)
+	}
+	if got.Spec == nil || got.Spec.Name != "web" || got.Spec.Region != "nyc" || got.ProjectID != "p1" {
+		t.Errorf("request = %+v", got)
+	}
+
+	result = callTool(t, s, "create_app", map[string]interface{}{"spec": `{"nme":"web"}`})
+	if !result.IsError {
+		t.Error("expected a tool error for an invalid spec")
+	}
+	if n := api.count("POST /v2/apps"); n != 1 {
+		t.Errorf("made %d create calls, want 1", n)
+	}
+}
+
+func TestCreateAndGetDeployment(t *testing.T) {
+	var got godo.DeploymentCreateRequest
+	s, _ := newTestServer(t, map[string]http.HandlerFunc{
+		"POST /v2/apps/a1/deployments": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&got)
+			io.WriteString(w, `{"deployment":{"id":"d1","phase":"PENDING_BUILD"}}`)
+		},
+		"GET /v2/apps/a1/deployments/d1": jsonHandler(`{"deployment":{"id":"d1","phase":"ACTIVE"}}`),
+	})
+
+	result := callTool(t, s, "create_deployment", map[string]interface{}{"app_id": "a1", "force_build": true})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %s", result.Content[0].Text)
+	}
+	if !got.ForceBuild {
+		t.Error("force_build was not sent")
+	}
+
+	result = callTool(t, s, "get_deployment", map[string]interface{}{"app_id": "a1", "deployment_id": "d1"})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %s", result.Content[0].Text)
+	}
+	var deployment godo.Deployment
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &deployment); err != nil {
+		t.Fatalf("Unmarshal deployment: %v", err)
+	}
+	if deployment.Phase != godo.DeploymentPhase_Active {
+		t.Errorf("phase = %q, want ACTIVE", deployment.Phase)
+	}
+
+	result = callTool(t, s, "get_deployment", map[string]interface{}{"app_id": "a1"})
+	if !result.IsError {
+		t.Error("expected a tool error without deployment_id")
+	}
+}
+
+func TestGetRateLimit(t *testing.T) {
+	reset := time.Now().Add(30 * time.Minute).Unix()
+	s, api := newTestServer(t, map[string]http.HandlerFunc{
+		"GET /v2/account": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("RateLimit-Limit", "5000")
+			w.Header().Set("RateLimit-Remaining", "4321")
+			w.Header().Set("RateLimit-Reset", strconv.FormatInt(reset, 10))
+			io.WriteString(w, `{"account":{"email":"ops@example.com","status":"active"}}`)
+		},
+	})
+
+	result := callTool(t, s, "get_rate_limit", map[string]interface{}{})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %s", result.Content[0].Text)
+	}
+
+	var info RateLimitInfo
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &info); err != nil {
+		t.Fatalf("Unmarshal rate limit: %v", err)
+	}
+	if info.Limit != 5000 || info.Remaining != 4321 || info.Used != 679 {
+		t.Errorf("info = %+v, want limit 5000, remaining 4321, used 679", info)
+	}
+	if info.ResetAt.Unix() != reset {
+		t.Errorf("ResetAt = %v, want unix %d", info.ResetAt, reset)
+	}
+	if info.ResetIn == "" || info.ResetIn == "0s" {
+		t.Errorf("ResetIn = %q, want a positive duration", info.ResetIn)
+	}
+	if n := api.count("GET /v2/account"); n != 1 {
+		t.Errorf("made %d account calls, want 1", n)
+	}
+}
+
+func TestRateLimitInfoAfterReset(t *testing.T) {
+	now := time.Now()
+	info := rateLimitInfo(godo.Rate{Limit: 5000, Remaining: 0, Reset: godo.Timestamp{Time: now.Add(-time.Minute)}}, now)
+	if info.ResetIn != "0s" {
+		t.Errorf("ResetIn = %q, want %q", info.ResetIn, "0s")
+	}
+}
+
+func TestGetBalance(t *testing.T) {
+	s, _ := newTestServer(t, map[string]http.HandlerFunc{
+		"GET /v2/customers/my/balance": jsonHandler(`{
+			"month_to_date_balance": "23.44",
+			"account_balance": "12.23",
+			"month_to_date_usage": "11.21",
+			"generated_at": "2024-06-01T12:00:00Z"
+		}`),
+	})
+
+	result := callTool(t, s, "get_balance", map[string]interface{}{})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %s", result.Content[0].Text)
+	}
+
+	var balance godo.Balance
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &balance); err != nil {
+		t.Fatalf("Unmarshal balance: %v", err)
+	}
+	if balance.MonthToDateBalance != "23.44" || balance.AccountBalance != "12.23" || balance.MonthToDateUsage != "11.21" {
+		t.Errorf("balance = %+v", balance)
+	}
+	if balance.GeneratedAt.IsZero() {
+		t.Error("GeneratedAt was not returned")
+	}
+}
+
+func TestNewClientBaseURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		apiURL string
+		want   string
+	}{
+		{"default", "", "https://api.digitalocean.com/"},
+		{"override", "http://localhost:8080/", "http://localhost:8080/"},
+		{"path prefix without trailing slash", "https://proxy.internal/do", "https://proxy.internal/do/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := newClient("token", tt.apiURL)
+			if err != nil {
+				t.Fatalf("newClient: %v", err)
+			}
+			if got := client.BaseURL.String(); got != tt.want {
+				t.Errorf("BaseURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewClientRejectsInvalidURL(t *testing.T) {
+	for _, apiURL := range []string{"://bad", "localhost:8080", "ftp://example.com/", "/v2"} {
+		if _, err := newClient("token", apiURL); err == nil {
+			t.Errorf("newClient(%q) succeeded, want error", apiURL)
+		}
+	}
+}
+
+func TestNewClientSendsRequestsToOverride(t *testing.T) {
+	var gotPath, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"account":{"email":"ops@example.com"}}`)
+	}))
+	defer srv.Close()
+
+	client, err := newClient("secret", srv.URL+"/proxy")
+	if err != nil {
+		t.Fatalf("newClient: %v", err)
+	}
+	if _, _, err := client.Account.Get(context.Background()); err != nil {
+		t.Fatalf("Account.Get: %v", err)
+	}
+	if gotPath != "/proxy/v2/account" {
+		t.Errorf("request path = %q, want %q", gotPath, "/proxy/v2/account")
+	}
+	if gotAuth != "Bearer secret" {
+		t.Errorf("Authorization = %q, want %q", gotAuth, "Bearer secret")
+	}
+}
+
+// dropletNetworksHandler serves GET /v2/droplets/123, returning no networks
+// until the given call number and populated networks from then on.
+func dropletNetworksHandler(readyOnCall int, networks string) (http.HandlerFunc, *int) {
+	calls := 0
+	return func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < readyOnCall {
+			io.WriteString(w, `{"droplet":{"id":123,"name":"web-1","status":"new","networks":{"v4":[],"v6":[]}}}`)
+			return
+		}
+		io.WriteString(w, `{"droplet":{"id":123,"name":"web-1","status":"active","networks":`+networks+`}}`)
+	}, &calls
+}
+
+func TestCreateDropletWaitForIP(t *testing.T) {
+	prev := dropletPollInterval
+	dropletPollInterval = time.Millisecond
+	defer func() { dropletPollInterval = prev }()
+
+	get, calls := dropletNetworksHandler(2, `{
+		"v4":[{"ip_address":"10.10.0.2","type":"private"},{"ip_address":"203.0.113.7","type":"public"}],
+		"v6":[]
+	}`)
+	s, api := newTestServer(t, map[string]http.HandlerFunc{
+		"POST /v2/droplets":    jsonHandler(`{"droplet":{"id":123,"name":"web-1","status":"new"}}`),
+		"GET /v2/droplets/123": get,
+	})
+
+	result := callTool(t, s, "create_droplet", map[string]interface{}{
+		"name":        "web-1",
+		"region":      "nyc3",
+		"size":        "s-1vcpu-1gb",
+		"image":       "ubuntu-24-04-x64",
+		"wait_for_ip": true,
+	})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %s", result.Content[0].Text)
+	}
+
+	var got struct {
+		ID         int    `json:"id"`
+		Status     string `json:"status"`
+		PublicIPv4 string `json:"public_ipv4"`
+	}
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &got); err != nil {
+		t.Fatalf("Unmarshal droplet: %v", err)
+	}
+	if got.PublicIPv4 != "203.0.113.7" {
+		t.Errorf("public_ipv4 = %q, want %q", got.PublicIPv4, "203.0.113.7")
+	}
+	if got.ID != 123 || got.Status != "active" {
+		t.Errorf("droplet = %+v, want the refreshed droplet", got)
+	}
+	if *calls != 2 {
+		t.Errorf("polled %d times, want 2", *calls)
+	}
+	if n := api.count("POST /v2/droplets"); n != 1 {
+		t.Errorf("made %d create calls, want 1", n)
+	}
+}
+
+func TestWaitForDropletIPWaitsForIPv6(t *testing.T) {
+	prev := dropletPollInterval
+	dropletPollInterval = time.Millisecond
+	defer func() { dropletPollInterval = prev }()
+
+	calls := 0
+	s, _ := newTestServer(t, map[string]http.HandlerFunc{
+		"GET /v2/droplets/123": func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			v6 := `[]`
+			if calls >= 3 {
+				v6 = `[{"ip_address":"2001:db8::7","type":"public"}]`
+			}
+			io.WriteString(w, `{"droplet":{"id":123,"networks":{"v4":[{"ip_address":"203.0.113.7","type":"public"}],"v6":`+v6+`}}}`)
+		},
+	})
+
+	got, err := s.waitForDropletIP(context.Background(), 123, true, time.Second)
+	if err != nil {
+		t.Fatalf("waitForDropletIP: %v", err)
+	}
+	if got.PublicIPv4 != "203.0.113.7" || got.PublicIPv6 != "2001:db8::7" {
+		t.Errorf("got IPv4 %q, IPv6 %q", got.PublicIPv4, got.PublicIPv6)
+	}
+	if calls != 3 {
+		t.Errorf("polled %d times, want 3", calls)
+	}
+}
+
+func TestWaitForDropletIPTimesOut(t *testing.T) {
+	prev := dropletPollInterval
+	dropletPollInterval = time.Millisecond
+	defer func() { dropletPollInterval = prev }()
+
+	get, _ := dropletNetworksHandler(1<<30, `{}`)
+	s, _ := newTestServer(t, map[string]http.HandlerFunc{"GET /v2/droplets/123": get})
+
+	_, err := s.waitForDropletIP(context.Background(), 123, false, 20*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "no public IP was assigned") {
+		t.Errorf("err = %v, want a timeout error", err)
+	}
+}
+
+// stallTransport never answers; it returns only when the request's context
+// is done, like a connection to an API that has stopped responding.
+type stallTransport struct{}
+
+func (stallTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	select {
+	case <-r.Context().Done():
+		return nil, r.Context().Err()
+	case <-time.After(10 * time.Second):
+		return nil, io.ErrUnexpectedEOF
+	}
+}
+
+func TestToolCallTimesOut(t *testing.T) {
+	client := godo.NewClient(&http.Client{Transport: stallTransport{}})
+	s := &MCPServer{client: client, timeout: 50 * time.Millisecond}
+
+	start := time.Now()
+	result := callTool(t, s, "list_droplets", nil)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("tool call took %s, want it cut off by the timeout", elapsed)
+	}
+	if !result.IsError {
+		t.Fatalf("result = %+v, want a tool error", result)
+	}
+	if text := result.Content[0].Text; !strings.Contains(text, "timed out after 50ms") {
+		t.Errorf("error = %q, want it to mention the timeout", text)
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"45", 45 * time.Second},
+		{"2m", 2 * time.Minute},
+		{"0", 0},
+	}
+	for _, tt := range tests {
+		got, err := parseTimeout(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseTimeout(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"-5", "soon", "-1s"} {
+		if _, err := parseTimeout(bad); err == nil {
+			t.Errorf("parseTimeout(%q): want error", bad)
+		}
+	}
+}
@@ -2,14 +2,23 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/soyeahso/hunter3/internal/logfile"
 )
 
 // JSON-RPC types
@@ -99,6 +108,21 @@ type DockerResult struct {
 	Stdout  string `json:"stdout,omitempty"`
 	Stderr  string `json:"stderr,omitempty"`
 	Error   string `json:"error,omitempty"`
+
+	// ContainerID is set by docker_run for detached containers.
+	ContainerID string `json:"container_id,omitempty"`
+
+	// ExitCodes is set by docker_wait, keyed by container as given.
+	ExitCodes map[string]int `json:"exit_codes,omitempty"`
+}
+
+// HealthReport is returned from docker_health as JSON.
+type HealthReport struct {
+	Ready           bool     `json:"ready"`
+	DockerPath      string   `json:"docker_path,omitempty"`
+	ServerVersion   string   `json:"server_version,omitempty"`
+	DaemonReachable bool     `json:"daemon_reachable"`
+	Problems        []string `json:"problems,omitempty"`
 }
 
 // Helper constructors for schema properties
@@ -115,38 +139,36 @@ func stringArrayProp(desc string) Property {
 	return Property{Type: "array", Description: desc, Items: &ItemType{Type: "string"}}
 }
 
+func integerProp(desc string) Property {
+	return Property{Type: "integer", Description: desc}
+}
+
 func boolProp(desc string) Property {
 	return Property{Type: "boolean", Description: desc}
 }
 
 // MCPServer handles the JSON-RPC stdin/stdout protocol.
-type MCPServer struct{}
+type MCPServer struct {
+	// outputLimit is the byte cap on command output for the tool call in
+	// progress; see maxOutputBytes.
+	outputLimit int
+}
 
 var logger *log.Logger
 
 func initLogger() {
-	// Create logs directory if it doesn't exist
-	logsDir := filepath.Join(os.Getenv("HOME"), ".hunter3", "logs")
-	if err := os.MkdirAll(logsDir, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create logs directory: %v\n", err)
-		return
-	}
-
-	// Open log file
-	logFile := filepath.Join(logsDir, "mcp-docker.log")
-	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to open log file: %v\n", err)
-		return
-	}
-
-	// Create logger that writes to both file and stderr
-	logger = log.New(io.MultiWriter(f, os.Stderr), "[mcp-docker] ", log.LstdFlags)
+	// Log to stderr and to a file rotated by size and readable only by the owner
+	logger = logfile.NewLogger("mcp-docker")
 	logger.Println("MCP Docker server starting...")
 }
 
 func main() {
 	initLogger()
+	initAllowedPaths()
+	initMaxOutputBytes()
+	if report := checkHealth(); !report.Ready {
+		logger.Printf("WARNING: docker is not ready: %s\n", strings.Join(report.Problems, "; "))
+	}
 	s := &MCPServer{}
 	logger.Println("Server initialized")
 	s.Run()
@@ -236,18 +258,26 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 			InputSchema: InputSchema{
 				Type: "object",
 				Properties: map[string]Property{
-					"image":       stringProp("Container image to use (e.g. 'nginx:latest', 'ubuntu:22.04')"),
-					"command":     stringArrayProp("Command to run in the container (e.g. ['sh', '-c', 'echo hello'])"),
-					"detach":      boolProp("Run container in background and print container ID"),
-					"name":        stringProp("Assign a name to the container"),
-					"ports":       stringArrayProp("Publish container ports (e.g. ['8080:80', '443:443'])"),
-					"volumes":     stringArrayProp("Bind mount volumes (e.g. ['/host/path:/container/path'])"),
-					"env":         stringArrayProp("Set environment variables (e.g. ['KEY=value', 'DEBUG=1'])"),
-					"network":     stringProp("Connect container to a network"),
-					"remove":      boolProp("Automatically remove the container when it exits"),
-					"interactive": boolProp("Keep STDIN open even if not attached"),
-					"tty":         boolProp("Allocate a pseudo-TTY"),
-					"flags":       stringArrayProp("Additional flags passed directly to docker run"),
+					"image":           stringProp("Container image to use (e.g. 'nginx:latest', 'ubuntu:22.04')"),
+					"command":         stringArrayProp("Command to run in the container (e.g. ['sh', '-c', 'echo hello'])"),
+					"detach":          boolProp("Run container in background and print container ID"),
+					"name":            stringProp("Assign a name to the container"),
+					"ports":           stringArrayProp("Publish container ports (e.g. ['8080:80', '443:443'])"),
+					"volumes":         stringArrayProp("Bind mount volumes (e.g. ['/host/path:/container/path'])"),
+					"env":             stringArrayProp("Set environment variables (e.g. ['KEY=value', 'DEBUG=1'])"),
+					"env_file":        stringProp("Read environment variables from a file of KEY=value lines (must be inside HUNTER3_DOCKER_ALLOWED_PATHS)"),
+					"workdir":         stringProp("Working directory inside the container"),
+					"entrypoint":      stringProp("Override the image's entrypoint; command becomes its arguments"),
+					"restart":         {Type: "string", Description: "Restart policy for when the container exits", Enum: restartPolicies},
+					"memory":          stringProp("Memory limit (e.g. '512m', '2g')"),
+					"cpus":            stringProp("Number of CPUs the container may use (e.g. '1.5')"),
+					"health_cmd":      stringProp("Command run inside the container to check its health (e.g. 'curl -f http://localhost/ || exit 1')"),
+					"health_interval": stringProp("Time between health checks (e.g. '30s', '1m')"),
+					"network":         stringProp("Connect container to a network"),
+					"remove":          boolProp("Automatically remove the container when it exits"),
+					"interactive":     boolProp("Keep STDIN open even if not attached"),
+					"tty":             boolProp("Allocate a pseudo-TTY"),
+					"flags":           stringArrayProp("Additional flags passed directly to docker run"),
 				},
 				Required: []string{"image"},
 			},
@@ -368,6 +398,53 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 				},
 			},
 		},
+		{
+			Name:        "docker_wait",
+			Description: "Block until one or more containers stop, then return their exit codes in exit_codes, keyed by container. Gives up after timeout seconds.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"containers": stringArrayProp("Container names or IDs to wait for"),
+					"timeout":    stringPropDefault("Seconds to wait before giving up (max 3600)", "300"),
+				},
+				Required: []string{"containers"},
+			},
+		},
+		{
+			Name:        "docker_port",
+			Description: "List the published port mappings of a container",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"container":    stringProp("Container name or ID"),
+					"private_port": stringProp("Only show the mapping for this container port (e.g. '80' or '80/tcp')"),
+				},
+				Required: []string{"container"},
+			},
+		},
+		{
+			Name:        "docker_top",
+			Description: "Display the running processes of a container",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"container":  stringProp("Container name or ID"),
+					"ps_options": stringArrayProp("Options passed to ps inside the container (e.g. ['-eo', 'pid,user,args'])"),
+				},
+				Required: []string{"container"},
+			},
+		},
+		{
+			Name:        "docker_diff",
+			Description: "Show files and directories changed in a container's filesystem since it was created (A = added, C = changed, D = deleted)",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"container": stringProp("Container name or ID"),
+				},
+				Required: []string{"container"},
+			},
+		},
 
 		// --- Image Management ---
 		{
@@ -398,6 +475,20 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 				Required: []string{"image"},
 			},
 		},
+		{
+			Name:        "docker_search",
+			Description: "Search Docker Hub for images",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"term":   stringProp("Search term (e.g. 'nginx', 'postgres')"),
+					"limit":  stringProp("Maximum number of results (e.g. '10')"),
+					"filter": stringArrayProp("Filter output based on conditions (e.g. ['is-official=true', 'stars=100'])"),
+					"flags":  stringArrayProp("Additional flags passed directly to docker search"),
+				},
+				Required: []string{"term"},
+			},
+		},
 		{
 			Name:        "docker_push",
 			Description: "Push an image or a repository to a registry",
@@ -458,6 +549,48 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 				Required: []string{"source", "target"},
 			},
 		},
+		{
+			Name:        "docker_commit",
+			Description: "Create a new image from a container's current state, e.g. to freeze it for debugging",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"container":  stringProp("Container name or ID"),
+					"repository": stringProp("Repository and optional tag for the new image (e.g. 'myapp:debug')"),
+					"message":    stringProp("Commit message"),
+					"author":     stringProp("Author (e.g. 'Jane Doe <jane@example.com>')"),
+					"change":     stringArrayProp("Dockerfile instructions to apply to the image (e.g. ['ENV DEBUG=1', 'CMD [\"sh\"]'])"),
+					"flags":      stringArrayProp("Additional flags passed directly to docker commit"),
+				},
+				Required: []string{"container"},
+			},
+		},
+		{
+			Name:        "docker_save",
+			Description: "Save one or more images to a tar archive, e.g. to move them to an air-gapped host. The output path must be within the allowed directories.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"images": stringArrayProp("Images to save (e.g. ['nginx:latest', 'myapp:v1'])"),
+					"output": stringProp("Path of the tar archive to write (its directory must exist)"),
+					"flags":  stringArrayProp("Additional flags passed directly to docker save"),
+				},
+				Required: []string{"images", "output"},
+			},
+		},
+		{
+			Name:        "docker_load",
+			Description: "Load images from a tar archive created by docker save. The input path must be within the allowed directories.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"input": stringProp("Path of the tar archive to read"),
+					"quiet": boolProp("Suppress the load output"),
+					"flags": stringArrayProp("Additional flags passed directly to docker load"),
+				},
+				Required: []string{"input"},
+			},
+		},
 
 		// --- Network Management ---
 		{
@@ -649,6 +782,14 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 		},
 
 		// --- System & Info ---
+		{
+			Name:        "docker_health",
+			Description: "Check that the docker CLI is installed and the Docker daemon is reachable. Returns the docker binary path, server version, and any problems. Call this first if other docker tools fail unexpectedly.",
+			InputSchema: InputSchema{
+				Type:       "object",
+				Properties: map[string]Property{},
+			},
+		},
 		{
 			Name:        "docker_info",
 			Description: "Display system-wide information",
@@ -699,6 +840,13 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 		},
 	}
 
+	for i := range tools {
+		if tools[i].InputSchema.Properties == nil {
+			tools[i].InputSchema.Properties = map[string]Property{}
+		}
+		tools[i].InputSchema.Properties["max_output_bytes"] = integerProp("Truncate stdout and stderr to this many bytes (defaults to HUNTER3_MAX_OUTPUT_BYTES, 1 MiB)")
+	}
+
 	s.sendResponse(req.ID, ListToolsResult{Tools: tools})
 }
 
@@ -715,6 +863,14 @@ func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
 	logger.Printf("Calling tool: %s\n", params.Name)
 	args := params.Arguments
 
+	limit, err := callOutputLimit(args)
+	if err != nil {
+		s.sendToolError(req.ID, err.Error())
+		return
+	}
+	s.outputLimit = limit
+	defer func() { s.outputLimit = 0 }()
+
 	switch params.Name {
 	// Container commands
 	case "docker_ps":
@@ -737,12 +893,22 @@ func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
 		s.dockerInspect(req.ID, args)
 	case "docker_stats":
 		s.dockerStats(req.ID, args)
+	case "docker_wait":
+		s.dockerWait(req.ID, args)
+	case "docker_port":
+		s.dockerPort(req.ID, args)
+	case "docker_top":
+		s.dockerTop(req.ID, args)
+	case "docker_diff":
+		s.dockerDiff(req.ID, args)
 
 	// Image commands
 	case "docker_images":
 		s.dockerImages(req.ID, args)
 	case "docker_pull":
 		s.dockerPull(req.ID, args)
+	case "docker_search":
+		s.dockerSearch(req.ID, args)
 	case "docker_push":
 		s.dockerPush(req.ID, args)
 	case "docker_rmi":
@@ -751,6 +917,12 @@ func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
 		s.dockerBuild(req.ID, args)
 	case "docker_tag":
 		s.dockerTag(req.ID, args)
+	case "docker_commit":
+		s.dockerCommit(req.ID, args)
+	case "docker_save":
+		s.dockerSave(req.ID, args)
+	case "docker_load":
+		s.dockerLoad(req.ID, args)
 
 	// Network commands
 	case "docker_network_ls":
@@ -785,6 +957,8 @@ func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
 		s.dockerComposeLogs(req.ID, args)
 
 	// System commands
+	case "docker_health":
+		s.dockerHealth(req.ID)
 	case "docker_info":
 		s.dockerInfo(req.ID, args)
 	case "docker_version":
@@ -861,12 +1035,89 @@ func (s *MCPServer) dockerRun(id interface{}, args map[string]interface{}) {
 	for _, env := range getStringArray(args, "env") {
 		cmdArgs = append(cmdArgs, "-e", env)
 	}
+	if envFile := getString(args, "env_file"); envFile != "" {
+		resolved, err := resolveInputPath(envFile)
+		if err != nil {
+			s.sendToolError(id, err.Error())
+			return
+		}
+		cmdArgs = append(cmdArgs, "--env-file", resolved)
+	}
+	if workdir := getString(args, "workdir"); workdir != "" {
+		cmdArgs = append(cmdArgs, "-w", workdir)
+	}
+	if entrypoint := getString(args, "entrypoint"); entrypoint != "" {
+		cmdArgs = append(cmdArgs, "--entrypoint", entrypoint)
+	}
+
+	limits, err := runLimitArgs(args)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	cmdArgs = append(cmdArgs, limits...)
 
 	cmdArgs = append(cmdArgs, getStringArray(args, "flags")...)
 	cmdArgs = append(cmdArgs, image)
 	cmdArgs = append(cmdArgs, getStringArray(args, "command")...)
 
-	s.runDocker(id, cmdArgs)
+	result := execDocker(cmdArgs, 0)
+	if result.Success && getBool(args, "detach") {
+		result.ContainerID = detachedContainerID(result.Stdout)
+	}
+	s.sendDockerResult(id, result)
+}
+
+// restartPolicies are the values docker_run accepts for restart.
+var restartPolicies = []string{"no", "on-failure", "always", "unless-stopped"}
+
+// runLimitArgs returns the docker run flags for docker_run's restart policy,
+// resource limits, and healthcheck.
+func runLimitArgs(args map[string]interface{}) ([]string, error) {
+	var cmdArgs []string
+
+	if restart := getString(args, "restart"); restart != "" {
+		if !slices.Contains(restartPolicies, restart) {
+			return nil, fmt.Errorf("restart must be one of %s, got %q", strings.Join(restartPolicies, ", "), restart)
+		}
+		cmdArgs = append(cmdArgs, "--restart", restart)
+	}
+	if memory := getString(args, "memory"); memory != "" {
+		cmdArgs = append(cmdArgs, "--memory", memory)
+	}
+	if _, set := args["cpus"]; set {
+		cpus, ok := getNumber(args, "cpus")
+		if !ok || cpus <= 0 {
+			return nil, fmt.Errorf("cpus must be a positive number")
+		}
+		cmdArgs = append(cmdArgs, "--cpus", strconv.FormatFloat(cpus, 'f', -1, 64))
+	}
+	if healthCmd := getString(args, "health_cmd"); healthCmd != "" {
+		cmdArgs = append(cmdArgs, "--health-cmd", healthCmd)
+	}
+	if interval := getString(args, "health_interval"); interval != "" {
+		if d, err := time.ParseDuration(interval); err != nil || d <= 0 {
+			return nil, fmt.Errorf("health_interval must be a positive duration such as 30s, got %q", interval)
+		}
+		cmdArgs = append(cmdArgs, "--health-interval", interval)
+	}
+	return cmdArgs, nil
+}
+
+// detachedContainerID returns the container ID that docker run -d prints as
+// its last line of output, or "" if that line is not a container ID.
+func detachedContainerID(stdout string) string {
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+	if len(last) < 12 || len(last) > 64 {
+		return ""
+	}
+	for _, c := range last {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return ""
+		}
+	}
+	return last
 }
 
 func (s *MCPServer) dockerContainerOp(id interface{}, args map[string]interface{}, op string) {
@@ -892,8 +1143,8 @@ func (s *MCPServer) dockerStopRestart(id interface{}, args map[string]interface{
 
 	cmdArgs := []string{op}
 
-	if time := getString(args, "time"); time != "" {
-		cmdArgs = append(cmdArgs, "-t", time)
+	if seconds, ok := getNumber(args, "time"); ok {
+		cmdArgs = append(cmdArgs, "-t", strconv.Itoa(int(seconds)))
 	}
 
 	cmdArgs = append(cmdArgs, getStringArray(args, "flags")...)
@@ -978,7 +1229,7 @@ func (s *MCPServer) dockerLogs(id interface{}, args map[string]interface{}) {
 		cmdArgs = append(cmdArgs, "-t")
 	}
 
-	if tail := getString(args, "tail"); tail != "" {
+	if tail := getTail(args); tail != "" {
 		cmdArgs = append(cmdArgs, "--tail", tail)
 	}
 	if since := getString(args, "since"); since != "" {
@@ -1036,6 +1287,91 @@ func (s *MCPServer) dockerStats(id interface{}, args map[string]interface{}) {
 	s.runDocker(id, cmdArgs)
 }
 
+// Bounds for docker_wait, which otherwise blocks for as long as the
+// containers keep running.
+const (
+	defaultWaitTimeout = 300 * time.Second
+	maxWaitTimeout     = time.Hour
+)
+
+func (s *MCPServer) dockerWait(id interface{}, args map[string]interface{}) {
+	containers := getStringArray(args, "containers")
+	if len(containers) == 0 {
+		s.sendToolError(id, "containers is required")
+		return
+	}
+
+	timeout := defaultWaitTimeout
+	if seconds, ok := getNumber(args, "timeout"); ok {
+		if seconds <= 0 {
+			s.sendToolError(id, "timeout must be a positive number of seconds")
+			return
+		}
+		timeout = min(time.Duration(seconds*float64(time.Second)), maxWaitTimeout)
+	}
+
+	result := execDocker(append([]string{"wait"}, containers...), timeout)
+	result.ExitCodes = waitExitCodes(containers, result.Stdout)
+	s.sendDockerResult(id, result)
+}
+
+// waitExitCodes pairs the exit codes docker wait prints, one per line, with
+// the containers they belong to. docker wait skips containers it cannot wait
+// for, so the codes are only paired when there is one for every container.
+func waitExitCodes(containers []string, stdout string) map[string]int {
+	lines := strings.Split(stdout, "\n")
+	if stdout == "" || len(lines) != len(containers) {
+		return nil
+	}
+	codes := make(map[string]int, len(containers))
+	for i, line := range lines {
+		code, err := strconv.Atoi(strings.TrimSpace(line))
+		if err != nil {
+			return nil
+		}
+		codes[containers[i]] = code
+	}
+	return codes
+}
+
+func (s *MCPServer) dockerPort(id interface{}, args map[string]interface{}) {
+	container := getString(args, "container")
+	if container == "" {
+		s.sendToolError(id, "container is required")
+		return
+	}
+
+	cmdArgs := []string{"port", container}
+	if port := getString(args, "private_port"); port != "" {
+		cmdArgs = append(cmdArgs, port)
+	}
+
+	s.runDocker(id, cmdArgs)
+}
+
+func (s *MCPServer) dockerTop(id interface{}, args map[string]interface{}) {
+	container := getString(args, "container")
+	if container == "" {
+		s.sendToolError(id, "container is required")
+		return
+	}
+
+	cmdArgs := []string{"top", container}
+	cmdArgs = append(cmdArgs, getStringArray(args, "ps_options")...)
+
+	s.runDocker(id, cmdArgs)
+}
+
+func (s *MCPServer) dockerDiff(id interface{}, args map[string]interface{}) {
+	container := getString(args, "container")
+	if container == "" {
+		s.sendToolError(id, "container is required")
+		return
+	}
+
+	s.runDocker(id, []string{"diff", container})
+}
+
 // ---------- Image Tool Handlers ----------
 
 func (s *MCPServer) dockerImages(id interface{}, args map[string]interface{}) {
@@ -1082,6 +1418,33 @@ func (s *MCPServer) dockerPull(id interface{}, args map[string]interface{}) {
 	s.runDocker(id, cmdArgs)
 }
 
+func (s *MCPServer) dockerSearch(id interface{}, args map[string]interface{}) {
+	term := getString(args, "term")
+	if term == "" {
+		s.sendToolError(id, "term is required")
+		return
+	}
+
+	cmdArgs := []string{"search"}
+
+	if _, set := args["limit"]; set {
+		limit, ok := getNumber(args, "limit")
+		if !ok || limit < 1 || limit != math.Trunc(limit) {
+			s.sendToolError(id, "limit must be a positive integer")
+			return
+		}
+		cmdArgs = append(cmdArgs, "--limit", strconv.Itoa(int(limit)))
+	}
+	for _, f := range getStringArray(args, "filter") {
+		cmdArgs = append(cmdArgs, "--filter", f)
+	}
+
+	cmdArgs = append(cmdArgs, getStringArray(args, "flags")...)
+	cmdArgs = append(cmdArgs, term)
+
+	s.runDocker(id, cmdArgs)
+}
+
 func (s *MCPServer) dockerPush(id interface{}, args map[string]interface{}) {
 	image := getString(args, "image")
 	if image == "" {
@@ -1183,6 +1546,87 @@ func (s *MCPServer) dockerTag(id interface{}, args map[string]interface{}) {
 	s.runDocker(id, cmdArgs)
 }
 
+func (s *MCPServer) dockerCommit(id interface{}, args map[string]interface{}) {
+	container := getString(args, "container")
+	if container == "" {
+		s.sendToolError(id, "container is required")
+		return
+	}
+
+	cmdArgs := []string{"commit"}
+
+	if message := getString(args, "message"); message != "" {
+		cmdArgs = append(cmdArgs, "--message", message)
+	}
+	if author := getString(args, "author"); author != "" {
+		cmdArgs = append(cmdArgs, "--author", author)
+	}
+	for _, change := range getStringArray(args, "change") {
+		cmdArgs = append(cmdArgs, "--change", change)
+	}
+
+	cmdArgs = append(cmdArgs, getStringArray(args, "flags")...)
+	cmdArgs = append(cmdArgs, container)
+	if repository := getString(args, "repository"); repository != "" {
+		cmdArgs = append(cmdArgs, repository)
+	}
+
+	s.runDocker(id, cmdArgs)
+}
+
+func (s *MCPServer) dockerSave(id interface{}, args map[string]interface{}) {
+	images := getStringArray(args, "images")
+	output := getString(args, "output")
+	if len(images) == 0 || output == "" {
+		s.sendToolError(id, "images and output are required")
+		return
+	}
+
+	flags := getStringArray(args, "flags")
+	if err := checkPathFlags(flags, 'o', "--output"); err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	path, err := resolveOutputPath(output)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+
+	cmdArgs := []string{"save", "-o", path}
+	cmdArgs = append(cmdArgs, flags...)
+	cmdArgs = append(cmdArgs, images...)
+
+	s.runDocker(id, cmdArgs)
+}
+
+func (s *MCPServer) dockerLoad(id interface{}, args map[string]interface{}) {
+	input := getString(args, "input")
+	if input == "" {
+		s.sendToolError(id, "input is required")
+		return
+	}
+
+	flags := getStringArray(args, "flags")
+	if err := checkPathFlags(flags, 'i', "--input"); err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	path, err := resolveInputPath(input)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+
+	cmdArgs := []string{"load", "-i", path}
+	if getBool(args, "quiet") {
+		cmdArgs = append(cmdArgs, "-q")
+	}
+	cmdArgs = append(cmdArgs, flags...)
+
+	s.runDocker(id, cmdArgs)
+}
+
 // ---------- Network Tool Handlers ----------
 
 func (s *MCPServer) dockerNetworkLs(id interface{}, args map[string]interface{}) {
@@ -1465,7 +1909,7 @@ func (s *MCPServer) dockerComposeLogs(id interface{}, args map[string]interface{
 	if getBool(args, "timestamps") {
 		cmdArgs = append(cmdArgs, "-t")
 	}
-	if tail := getString(args, "tail"); tail != "" {
+	if tail := getTail(args); tail != "" {
 		cmdArgs = append(cmdArgs, "--tail", tail)
 	}
 
@@ -1477,6 +1921,13 @@ func (s *MCPServer) dockerComposeLogs(id interface{}, args map[string]interface{
 
 // ---------- System Tool Handlers ----------
 
+func (s *MCPServer) dockerHealth(id interface{}) {
+	data, _ := json.MarshalIndent(checkHealth(), "", "  ")
+	s.sendResponse(id, ToolResult{
+		Content: []ContentItem{{Type: "text", Text: string(data)}},
+	})
+}
+
 func (s *MCPServer) dockerInfo(id interface{}, args map[string]interface{}) {
 	cmdArgs := []string{"info"}
 
@@ -1537,7 +1988,26 @@ func (s *MCPServer) dockerSystemPrune(id interface{}, args map[string]interface{
 // ---------- Docker execution ----------
 
 func (s *MCPServer) runDocker(id interface{}, dockerArgs []string) {
-	cmd := exec.Command("docker", dockerArgs...)
+	s.runDockerTimeout(id, dockerArgs, 0)
+}
+
+// runDockerTimeout is runDocker with the command killed after timeout.
+// A zero timeout means no limit.
+func (s *MCPServer) runDockerTimeout(id interface{}, dockerArgs []string, timeout time.Duration) {
+	s.sendDockerResult(id, execDocker(dockerArgs, timeout))
+}
+
+// execDocker runs docker with dockerArgs, killing it after timeout unless
+// timeout is zero.
+func execDocker(dockerArgs []string, timeout time.Duration) DockerResult {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, "docker", dockerArgs...)
+	cmd.WaitDelay = time.Second
 
 	commandStr := "docker " + strings.Join(dockerArgs, " ")
 	logger.Printf("Executing: %s\n", commandStr)
@@ -1556,10 +2026,64 @@ func (s *MCPServer) runDocker(id interface{}, dockerArgs []string) {
 			logger.Printf("Docker stderr: %s\n", result.Stderr)
 		}
 		result.Error = err.Error()
+		if ctx.Err() == context.DeadlineExceeded {
+			result.Error = fmt.Sprintf("timed out after %s", timeout)
+		}
 	} else {
 		logger.Printf("Docker command succeeded, stdout length: %d bytes\n", len(result.Stdout))
 	}
+	return result
+}
+
+// maxOutputBytes caps the stdout and stderr returned by each command, since
+// many MCP hosts reject responses of tens of megabytes, such as the full logs
+// of a long-running container. Zero disables it. Override via
+// HUNTER3_MAX_OUTPUT_BYTES, or per call with max_output_bytes.
+var maxOutputBytes = 1 << 20
+
+func initMaxOutputBytes() {
+	v := os.Getenv("HUNTER3_MAX_OUTPUT_BYTES")
+	if v == "" {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		logger.Printf("WARNING: invalid HUNTER3_MAX_OUTPUT_BYTES %q; using %d\n", v, maxOutputBytes)
+		return
+	}
+	maxOutputBytes = n
+}
+
+// callOutputLimit returns the call's max_output_bytes, or maxOutputBytes if
+// it has none.
+func callOutputLimit(args map[string]interface{}) (int, error) {
+	if _, ok := args["max_output_bytes"]; !ok {
+		return maxOutputBytes, nil
+	}
+	n, ok := getNumber(args, "max_output_bytes")
+	if !ok || n < 1 || n > math.MaxInt32 || n != math.Trunc(n) {
+		return 0, fmt.Errorf("max_output_bytes must be a positive integer")
+	}
+	return int(n), nil
+}
+
+// truncateOutput cuts out to at most limit bytes, backing up to a UTF-8
+// boundary, and appends a marker giving the original size. A limit of zero
+// leaves out unchanged.
+func truncateOutput(out string, limit int) string {
+	if limit <= 0 || len(out) <= limit {
+		return out
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(out[cut]) {
+		cut--
+	}
+	return out[:cut] + fmt.Sprintf("\n[output truncated: showing %d of %d bytes]", cut, len(out))
+}
 
+func (s *MCPServer) sendDockerResult(id interface{}, result DockerResult) {
+	result.Stdout = truncateOutput(result.Stdout, s.outputLimit)
+	result.Stderr = truncateOutput(result.Stderr, s.outputLimit)
 	data, _ := json.MarshalIndent(result, "", "  ")
 	s.sendResponse(id, ToolResult{
 		Content: []ContentItem{{Type: "text", Text: string(data)}},
@@ -1567,6 +2091,148 @@ func (s *MCPServer) runDocker(id interface{}, dockerArgs []string) {
 	})
 }
 
+// checkHealth verifies that docker resolves on PATH and can reach the daemon.
+func checkHealth() HealthReport {
+	var report HealthReport
+
+	path, err := exec.LookPath("docker")
+	if err != nil {
+		report.Problems = append(report.Problems, "docker not found on PATH; install Docker from https://docs.docker.com/get-docker/")
+		return report
+	}
+	report.DockerPath = path
+
+	// docker version prints the client section and then fails when the
+	// daemon is down, so only the exit status tells us it was reached.
+	var stderr strings.Builder
+	cmd := exec.Command(path, "version", "--format", "{{.Server.Version}}")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		switch {
+		case strings.Contains(msg, "Cannot connect to the Docker daemon"):
+			msg = "Docker daemon is not running or not reachable: " + msg
+		case strings.Contains(msg, "permission denied"):
+			msg = "permission denied talking to the Docker daemon; add the user to the docker group: " + msg
+		}
+		report.Problems = append(report.Problems, msg)
+		return report
+	}
+
+	report.DaemonReachable = true
+	report.ServerVersion = strings.TrimSpace(string(out))
+	report.Ready = true
+	return report
+}
+
+// ---------- Path policy ----------
+
+// allowedPaths restricts which files docker_save, docker_load, and
+// docker_run's env_file may touch. Defaults to $HOME. Override via
+// HUNTER3_DOCKER_ALLOWED_PATHS (comma-separated).
+var allowedPaths []string
+
+func initAllowedPaths() {
+	if envPaths := os.Getenv("HUNTER3_DOCKER_ALLOWED_PATHS"); envPaths != "" {
+		for _, p := range strings.Split(envPaths, ",") {
+			p = strings.TrimSpace(p)
+			if abs, err := filepath.Abs(p); err == nil {
+				allowedPaths = append(allowedPaths, filepath.Clean(abs))
+			}
+		}
+	}
+	if len(allowedPaths) == 0 {
+		if home := os.Getenv("HOME"); home != "" {
+			allowedPaths = []string{filepath.Clean(home)}
+		}
+	}
+}
+
+// checkAllowedPath rejects a resolved path outside allowedPaths.
+func checkAllowedPath(path, orig string) error {
+	if len(allowedPaths) == 0 {
+		return nil
+	}
+	for _, allowed := range allowedPaths {
+		if path == allowed || strings.HasPrefix(path, allowed+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("path %q is outside allowed directories", orig)
+}
+
+// resolveInputPath returns the absolute, symlink-free form of an existing
+// regular file within allowedPaths.
+func resolveInputPath(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", fmt.Errorf("invalid path: %w", err)
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("input file %q does not exist", p)
+		}
+		return "", fmt.Errorf("invalid path: %w", err)
+	}
+	if err := checkAllowedPath(resolved, p); err != nil {
+		return "", err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("input %q is not a regular file", p)
+	}
+	return resolved, nil
+}
+
+// resolveOutputPath returns the absolute form of a file to be written within
+// allowedPaths. Its directory must already exist; symlinks in the directory
+// are resolved so they cannot point outside the allowed directories. An
+// existing symlink at the path itself is refused rather than written through.
+func resolveOutputPath(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", fmt.Errorf("invalid path: %w", err)
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(abs))
+	if err != nil {
+		return "", fmt.Errorf("output directory for %q does not exist", p)
+	}
+	resolved := filepath.Join(dir, filepath.Base(abs))
+	if err := checkAllowedPath(resolved, p); err != nil {
+		return "", err
+	}
+	if info, err := os.Lstat(resolved); err == nil {
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			return "", fmt.Errorf("output %q is a symlink", p)
+		case info.IsDir():
+			return "", fmt.Errorf("output %q is a directory", p)
+		}
+	}
+	return resolved, nil
+}
+
+// checkPathFlags rejects flags that would name a file in place of the
+// validated path argument: the long flag, with or without =value, or a
+// shorthand group containing short, such as -o, -o/x, or -qi.
+func checkPathFlags(flags []string, short byte, long string) error {
+	for _, f := range flags {
+		isShort := len(f) > 1 && f[0] == '-' && f[1] != '-' && strings.IndexByte(f, short) >= 0
+		if f == long || strings.HasPrefix(f, long+"=") || isShort {
+			return fmt.Errorf("flag %q is not allowed; pass the path as an argument", f)
+		}
+	}
+	return nil
+}
+
 // ---------- Helpers ----------
 
 func getString(args map[string]interface{}, key string) string {
@@ -1583,6 +2249,38 @@ func getBool(args map[string]interface{}, key string) bool {
 	return false
 }
 
+// getNumber reads a numeric argument sent either as a JSON number or as a
+// numeric string such as "50", since MCP hosts often send the latter. ok is
+// false when the key is absent or the value is not a finite number.
+func getNumber(args map[string]interface{}, key string) (float64, bool) {
+	switch v := args[key].(type) {
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			if v != "" {
+				logger.Printf("Ignoring non-numeric %s: %q\n", key, v)
+			}
+			return 0, false
+		}
+		return n, true
+	}
+	return 0, false
+}
+
+// getTail returns the tail argument for logs commands: "all" or a line count
+// sent as a number or numeric string.
+func getTail(args map[string]interface{}) string {
+	if getString(args, "tail") == "all" {
+		return "all"
+	}
+	if n, ok := getNumber(args, "tail"); ok {
+		return strconv.Itoa(int(n))
+	}
+	return ""
+}
+
 func getStringArray(args map[string]interface{}, key string) []string {
 	val, ok := args[key]
 	if !ok {
@@ -1605,6 +2303,20 @@ func getStringArray(args map[string]interface{}, key string) []string {
 
 // ---------- JSON-RPC responses ----------
 
+// stdoutMu serializes writes to stdoutWriter so that concurrent responses
+// can never interleave JSON-RPC lines on the protocol stream.
+var (
+	stdoutMu     sync.Mutex
+	stdoutWriter io.Writer = os.Stdout
+)
+
+// writeMessage writes a single newline-terminated JSON-RPC message to stdout.
+func writeMessage(data []byte) {
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+	stdoutWriter.Write(append(data, '\n'))
+}
+
 func (s *MCPServer) sendResponse(id interface{}, result interface{}) {
 	resp := JSONRPCResponse{
 		JSONRPC: "2.0",
@@ -1617,7 +2329,7 @@ func (s *MCPServer) sendResponse(id interface{}, result interface{}) {
 		fmt.Fprintf(os.Stderr, "Error marshaling response: %v\n", err)
 		return
 	}
-	fmt.Println(string(data))
+	writeMessage(data)
 	logger.Printf("Sent response for request ID: %v\n", id)
 }
 
@@ -1634,7 +2346,7 @@ func (s *MCPServer) sendError(id interface{}, code int, message string, data int
 		fmt.Fprintf(os.Stderr, "Error marshaling error response: %v\n", err)
 		return
 	}
-	fmt.Println(string(jsonData))
+	writeMessage(jsonData)
 }
 
 func (s *MCPServer) sendToolError(id interface{}, msg string) {
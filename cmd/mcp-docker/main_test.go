@@ -1,10 +1,24 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
+func TestMain(m *testing.M) {
+	logger = log.New(io.Discard, "", 0)
+	os.Exit(m.Run())
+}
+
 func TestJSONRPCRequestParsing(t *testing.T) {
 	testCases := []struct {
 		name    string
@@ -204,3 +218,669 @@ func TestPropertyConstructors(t *testing.T) {
 		t.Errorf("boolProp failed: got %+v", boolProperty)
 	}
 }
+
+func TestConcurrentResponsesAreNotInterleaved(t *testing.T) {
+	var buf bytes.Buffer
+	stdoutWriter = &buf
+	defer func() { stdoutWriter = os.Stdout }()
+
+	s := &MCPServer{}
+	payload := strings.Repeat("x", 4096)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				s.sendResponse(i, ToolResult{Content: []ContentItem{{Type: "text", Text: payload}}})
+			} else {
+				s.sendError(i, -32603, "Internal error", payload)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 50 {
+		t.Fatalf("expected 50 lines, got %d", len(lines))
+	}
+	for i, line := range lines {
+		var resp JSONRPCResponse
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatalf("line %d is not valid JSON: %v", i, err)
+		}
+	}
+}
+
+// fakeDocker installs a shell script named docker as the only entry on PATH.
+func fakeDocker(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake docker script requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "docker")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	t.Setenv("PATH", dir)
+	return path
+}
+
+func TestCheckHealthReady(t *testing.T) {
+	path := fakeDocker(t, `echo "24.0.7"`)
+
+	report := checkHealth()
+	if !report.Ready || !report.DaemonReachable {
+		t.Fatalf("report = %+v, want ready", report)
+	}
+	if report.DockerPath != path {
+		t.Errorf("docker_path = %q, want %q", report.DockerPath, path)
+	}
+	if report.ServerVersion != "24.0.7" {
+		t.Errorf("server_version = %q, want 24.0.7", report.ServerVersion)
+	}
+	if len(report.Problems) != 0 {
+		t.Errorf("problems = %q, want none", report.Problems)
+	}
+}
+
+func TestCheckHealthDaemonUnreachable(t *testing.T) {
+	fakeDocker(t, `echo "Cannot connect to the Docker daemon at unix:///var/run/docker.sock. Is the docker daemon running?" >&2
+exit 1
+`)
+
+	report := checkHealth()
+	if report.Ready || report.DaemonReachable {
+		t.Fatalf("report = %+v, want daemon unreachable", report)
+	}
+	if report.DockerPath == "" {
+		t.Error("expected docker_path to be reported")
+	}
+	if len(report.Problems) != 1 || !strings.Contains(report.Problems[0], "Docker daemon is not running") {
+		t.Errorf("problems = %q", report.Problems)
+	}
+}
+
+func TestCheckHealthMissingDocker(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	report := checkHealth()
+	if report.Ready || report.DockerPath != "" {
+		t.Errorf("report = %+v, want not ready without a docker path", report)
+	}
+	if len(report.Problems) != 1 || !strings.Contains(report.Problems[0], "docker not found") {
+		t.Errorf("problems = %q, want docker not found", report.Problems)
+	}
+}
+
+func TestGetNumber(t *testing.T) {
+	args := map[string]interface{}{
+		"float":   float64(10),
+		"string":  "30",
+		"invalid": "soon",
+		"inf":     "Inf",
+		"bool":    true,
+	}
+
+	tests := []struct {
+		key    string
+		want   float64
+		wantOK bool
+	}{
+		{"float", 10, true},
+		{"string", 30, true},
+		{"invalid", 0, false},
+		{"inf", 0, false},
+		{"bool", 0, false},
+		{"missing", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := getNumber(args, tt.key)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("getNumber(%q) = %v, %v; want %v, %v", tt.key, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestNumericArgsReachDocker(t *testing.T) {
+	fakeDocker(t, `echo "$@"`)
+
+	tests := []struct {
+		name string
+		tool string
+		args map[string]interface{}
+		want string
+	}{
+		{"tail as number", "docker_logs", map[string]interface{}{"container": "web", "tail": float64(100)}, "logs --tail 100 web"},
+		{"tail as string", "docker_logs", map[string]interface{}{"container": "web", "tail": "100"}, "logs --tail 100 web"},
+		{"tail all", "docker_logs", map[string]interface{}{"container": "web", "tail": "all"}, "logs --tail all web"},
+		{"tail invalid", "docker_logs", map[string]interface{}{"container": "web", "tail": "lots"}, "logs web"},
+		{"stop time as number", "docker_stop", map[string]interface{}{"containers": []interface{}{"web"}, "time": float64(5)}, "stop -t 5 web"},
+		{"stop time as string", "docker_stop", map[string]interface{}{"containers": []interface{}{"web"}, "time": "5"}, "stop -t 5 web"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			stdoutWriter = &buf
+			defer func() { stdoutWriter = os.Stdout }()
+
+			params, _ := json.Marshal(CallToolParams{Name: tt.tool, Arguments: tt.args})
+			s := &MCPServer{}
+			s.handleCallTool(JSONRPCRequest{JSONRPC: "2.0", ID: 1, Method: "tools/call", Params: params})
+
+			var resp struct {
+				Result ToolResult `json:"result"`
+			}
+			if err := json.Unmarshal(buf.Bytes(), &resp); err != nil {
+				t.Fatalf("Unmarshal response %q: %v", buf.String(), err)
+			}
+			var result DockerResult
+			if err := json.Unmarshal([]byte(resp.Result.Content[0].Text), &result); err != nil {
+				t.Fatalf("Unmarshal DockerResult: %v", err)
+			}
+			if result.Stdout != tt.want {
+				t.Errorf("docker called with %q, want %q", result.Stdout, tt.want)
+			}
+		})
+	}
+}
+
+// callDocker runs a tool through handleCallTool and decodes its DockerResult.
+func callDocker(t *testing.T, tool string, args map[string]interface{}) (ToolResult, DockerResult) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	stdoutWriter = &buf
+	defer func() { stdoutWriter = os.Stdout }()
+
+	params, _ := json.Marshal(CallToolParams{Name: tool, Arguments: args})
+	s := &MCPServer{}
+	s.handleCallTool(JSONRPCRequest{JSONRPC: "2.0", ID: 1, Method: "tools/call", Params: params})
+
+	var resp struct {
+		Result ToolResult `json:"result"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &resp); err != nil {
+		t.Fatalf("Unmarshal response %q: %v", buf.String(), err)
+	}
+	var result DockerResult
+	json.Unmarshal([]byte(resp.Result.Content[0].Text), &result)
+	return resp.Result, result
+}
+
+func TestContainerDebugToolArgs(t *testing.T) {
+	fakeDocker(t, `echo "$@"`)
+
+	tests := []struct {
+		name string
+		tool string
+		args map[string]interface{}
+		want string
+	}{
+		{"wait", "docker_wait", map[string]interface{}{"containers": []interface{}{"web", "worker"}}, "wait web worker"},
+		{"port", "docker_port", map[string]interface{}{"container": "web"}, "port web"},
+		{"port with private port", "docker_port", map[string]interface{}{"container": "web", "private_port": "80/tcp"}, "port web 80/tcp"},
+		{"top", "docker_top", map[string]interface{}{"container": "web"}, "top web"},
+		{"top with ps options", "docker_top", map[string]interface{}{"container": "web", "ps_options": []interface{}{"-eo", "pid,args"}}, "top web -eo pid,args"},
+		{"diff", "docker_diff", map[string]interface{}{"container": "web"}, "diff web"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, result := callDocker(t, tt.tool, tt.args)
+			if result.Stdout != tt.want {
+				t.Errorf("docker called with %q, want %q", result.Stdout, tt.want)
+			}
+		})
+	}
+}
+
+func TestDockerRunReturnsContainerID(t *testing.T) {
+	const id = "3f4e1c2b9a8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f"
+	fakeDocker(t, `echo "`+id+`"`)
+
+	_, result := callDocker(t, "docker_run", map[string]interface{}{"image": "nginx", "detach": true})
+	if result.ContainerID != id {
+		t.Errorf("container_id = %q, want %q", result.ContainerID, id)
+	}
+
+	_, result = callDocker(t, "docker_run", map[string]interface{}{"image": "nginx"})
+	if result.ContainerID != "" {
+		t.Errorf("container_id = %q for an attached run, want none", result.ContainerID)
+	}
+}
+
+func TestDetachedContainerID(t *testing.T) {
+	tests := []struct {
+		stdout string
+		want   string
+	}{
+		{"3f4e1c2b9a8d\n", "3f4e1c2b9a8d"},
+		{"some warning\n3f4e1c2b9a8d7e6f", "3f4e1c2b9a8d7e6f"},
+		{"hello world", ""},
+		{"abc", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := detachedContainerID(tt.stdout); got != tt.want {
+			t.Errorf("detachedContainerID(%q) = %q, want %q", tt.stdout, got, tt.want)
+		}
+	}
+}
+
+func TestDockerWaitTimesOut(t *testing.T) {
+	fakeDocker(t, `exec /bin/sleep 10`)
+
+	start := time.Now()
+	toolResult, result := callDocker(t, "docker_wait", map[string]interface{}{"containers": []interface{}{"web"}, "timeout": "0.2"})
+	if !toolResult.IsError || result.Error != "timed out after 200ms" {
+		t.Errorf("result = %+v, want a timeout error", result)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("docker_wait took %s, want it killed at the timeout", elapsed)
+	}
+}
+
+func TestDockerWaitRejectsBadTimeout(t *testing.T) {
+	toolResult, _ := callDocker(t, "docker_wait", map[string]interface{}{"containers": []interface{}{"web"}, "timeout": float64(-1)})
+	if !toolResult.IsError || !strings.Contains(toolResult.Content[0].Text, "timeout must be") {
+		t.Errorf("result = %+v, want a timeout validation error", toolResult)
+	}
+}
+
+// allowTempDir makes a temporary directory the only allowed path.
+func allowTempDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("EvalSymlinks: %v", err)
+	}
+	prev := allowedPaths
+	allowedPaths = []string{dir}
+	t.Cleanup(func() { allowedPaths = prev })
+	return dir
+}
+
+func TestDockerCommitArgs(t *testing.T) {
+	fakeDocker(t, `for a in "$@"; do printf '[%s]' "$a"; done`)
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"container only", map[string]interface{}{"container": "web"}, "[commit][web]"},
+		{"repeated changes and tag", map[string]interface{}{
+			"container":  "web",
+			"repository": "myapp:debug",
+			"message":    "before upgrade",
+			"author":     "Jane <jane@example.com>",
+			"change":     []interface{}{"ENV DEBUG=1", "EXPOSE 8080"},
+		}, "[commit][--message][before upgrade][--author][Jane <jane@example.com>][--change][ENV DEBUG=1][--change][EXPOSE 8080][web][myapp:debug]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, result := callDocker(t, "docker_commit", tt.args)
+			if result.Stdout != tt.want {
+				t.Errorf("docker called with %s, want %s", result.Stdout, tt.want)
+			}
+		})
+	}
+
+	if toolResult, _ := callDocker(t, "docker_commit", map[string]interface{}{"repository": "myapp:debug"}); !toolResult.IsError {
+		t.Error("docker_commit without container: want error")
+	}
+}
+
+func TestDockerRunEnvFileWorkdirEntrypointArgs(t *testing.T) {
+	dir := allowTempDir(t)
+	envFile := filepath.Join(dir, "app.env")
+	if err := os.WriteFile(envFile, []byte("DEBUG=1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fakeDocker(t, `for a in "$@"; do printf '[%s]' "$a"; done`)
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"env file after env", map[string]interface{}{
+			"image":    "alpine",
+			"env":      []interface{}{"A=1"},
+			"env_file": envFile,
+		}, "[run][-e][A=1][--env-file][" + envFile + "][alpine]"},
+		{"all before image and command", map[string]interface{}{
+			"image":      "alpine",
+			"env_file":   envFile,
+			"workdir":    "/srv/app",
+			"entrypoint": "/bin/sh",
+			"flags":      []interface{}{"--init"},
+			"command":    []interface{}{"-c", "pwd"},
+		}, "[run][--env-file][" + envFile + "][-w][/srv/app][--entrypoint][/bin/sh][--init][alpine][-c][pwd]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, result := callDocker(t, "docker_run", tt.args)
+			if result.Stdout != tt.want {
+				t.Errorf("docker called with %s, want %s", result.Stdout, tt.want)
+			}
+		})
+	}
+
+	outside := filepath.Join(t.TempDir(), "app.env")
+	if err := os.WriteFile(outside, []byte("DEBUG=1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, envFile := range []string{outside, filepath.Join(dir, "missing.env"), dir} {
+		toolResult, _ := callDocker(t, "docker_run", map[string]interface{}{"image": "alpine", "env_file": envFile})
+		if !toolResult.IsError {
+			t.Errorf("env_file %q: want error", envFile)
+		}
+	}
+}
+
+func TestDockerRunRestartLimitsAndHealthArgs(t *testing.T) {
+	fakeDocker(t, `for a in "$@"; do printf '[%s]' "$a"; done`)
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"restart policy", map[string]interface{}{"image": "nginx", "detach": true, "restart": "unless-stopped"},
+			"[run][-d][--restart][unless-stopped][nginx]"},
+		{"limits and healthcheck before image", map[string]interface{}{
+			"image":           "nginx",
+			"restart":         "on-failure",
+			"memory":          "512m",
+			"cpus":            "1.5",
+			"health_cmd":      "curl -f http://localhost/ || exit 1",
+			"health_interval": "30s",
+			"command":         []interface{}{"nginx", "-g", "daemon off;"},
+		}, "[run][--restart][on-failure][--memory][512m][--cpus][1.5][--health-cmd][curl -f http://localhost/ || exit 1][--health-interval][30s][nginx][nginx][-g][daemon off;]"},
+		{"numeric cpus", map[string]interface{}{"image": "nginx", "cpus": float64(2)}, "[run][--cpus][2][nginx]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, result := callDocker(t, "docker_run", tt.args)
+			if result.Stdout != tt.want {
+				t.Errorf("docker called with %s, want %s", result.Stdout, tt.want)
+			}
+		})
+	}
+}
+
+func TestDockerRunRejectsBadRestartLimitsAndHealth(t *testing.T) {
+	fakeDocker(t, `echo "docker should not run" >&2; exit 1`)
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"unknown restart policy", map[string]interface{}{"restart": "sometimes"}, "restart must be one of"},
+		{"restart with retry count", map[string]interface{}{"restart": "on-failure:3"}, "restart must be one of"},
+		{"zero cpus", map[string]interface{}{"cpus": float64(0)}, "cpus must be a positive number"},
+		{"non-numeric cpus", map[string]interface{}{"cpus": "lots"}, "cpus must be a positive number"},
+		{"bad health interval", map[string]interface{}{"health_interval": "often"}, "health_interval must be a positive duration"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.args["image"] = "nginx"
+			toolResult, _ := callDocker(t, "docker_run", tt.args)
+			if !toolResult.IsError || !strings.Contains(toolResult.Content[0].Text, tt.want) {
+				t.Errorf("result = %+v, want error containing %q", toolResult.Content, tt.want)
+			}
+		})
+	}
+}
+
+func TestDockerSaveLoadArgs(t *testing.T) {
+	dir := allowTempDir(t)
+	archive := filepath.Join(dir, "images.tar")
+	if err := os.WriteFile(archive, []byte("tar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fakeDocker(t, `echo "$@"`)
+
+	tests := []struct {
+		name string
+		tool string
+		args map[string]interface{}
+		want string
+	}{
+		{"save", "docker_save", map[string]interface{}{"images": []interface{}{"nginx:latest", "redis:7"}, "output": filepath.Join(dir, "out.tar")}, "save -o " + filepath.Join(dir, "out.tar") + " nginx:latest redis:7"},
+		{"load", "docker_load", map[string]interface{}{"input": archive}, "load -i " + archive},
+		{"load quietly", "docker_load", map[string]interface{}{"input": archive, "quiet": true}, "load -i " + archive + " -q"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toolResult, result := callDocker(t, tt.tool, tt.args)
+			if toolResult.IsError {
+				t.Fatalf("unexpected error: %+v", toolResult.Content)
+			}
+			if result.Stdout != tt.want {
+				t.Errorf("docker called with %q, want %q", result.Stdout, tt.want)
+			}
+		})
+	}
+}
+
+func TestDockerSaveLoadRejectsBadPaths(t *testing.T) {
+	dir := allowTempDir(t)
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "x.tar"), []byte("tar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "in.tar"), []byte("tar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "x.tar"), filepath.Join(dir, "link.tar")); err != nil {
+		t.Fatal(err)
+	}
+	fakeDocker(t, `echo "docker should not run" >&2; exit 1`)
+
+	tests := []struct {
+		name string
+		tool string
+		args map[string]interface{}
+		want string
+	}{
+		{"load missing file", "docker_load", map[string]interface{}{"input": filepath.Join(dir, "missing.tar")}, "does not exist"},
+		{"load directory", "docker_load", map[string]interface{}{"input": dir}, "not a regular file"},
+		{"load outside", "docker_load", map[string]interface{}{"input": filepath.Join(outside, "x.tar")}, "outside allowed directories"},
+		{"load through symlink", "docker_load", map[string]interface{}{"input": filepath.Join(dir, "escape", "x.tar")}, "outside allowed directories"},
+		{"save outside", "docker_save", map[string]interface{}{"images": []interface{}{"nginx"}, "output": filepath.Join(outside, "x.tar")}, "outside allowed directories"},
+		{"save through symlink", "docker_save", map[string]interface{}{"images": []interface{}{"nginx"}, "output": filepath.Join(dir, "escape", "x.tar")}, "outside allowed directories"},
+		{"save missing directory", "docker_save", map[string]interface{}{"images": []interface{}{"nginx"}, "output": filepath.Join(dir, "nope", "x.tar")}, "does not exist"},
+		{"save onto symlink", "docker_save", map[string]interface{}{"images": []interface{}{"nginx"}, "output": filepath.Join(dir, "link.tar")}, "is a symlink"},
+		{"save output flag", "docker_save", map[string]interface{}{"images": []interface{}{"nginx"}, "output": filepath.Join(dir, "x.tar"), "flags": []interface{}{"-o", "/etc/x"}}, "not allowed"},
+		{"save attached output flag", "docker_save", map[string]interface{}{"images": []interface{}{"nginx"}, "output": filepath.Join(dir, "x.tar"), "flags": []interface{}{"-o/etc/x"}}, "not allowed"},
+		{"save long output flag", "docker_save", map[string]interface{}{"images": []interface{}{"nginx"}, "output": filepath.Join(dir, "x.tar"), "flags": []interface{}{"--output=/etc/x"}}, "not allowed"},
+		{"load input flag", "docker_load", map[string]interface{}{"input": filepath.Join(dir, "in.tar"), "flags": []interface{}{"--input", "/etc/x.tar"}}, "not allowed"},
+		{"load grouped input flag", "docker_load", map[string]interface{}{"input": filepath.Join(dir, "in.tar"), "flags": []interface{}{"-qi", "/etc/x.tar"}}, "not allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toolResult, _ := callDocker(t, tt.tool, tt.args)
+			if !toolResult.IsError || !strings.Contains(toolResult.Content[0].Text, tt.want) {
+				t.Errorf("result = %+v, want error containing %q", toolResult.Content, tt.want)
+			}
+		})
+	}
+}
+
+func TestDockerWaitReturnsExitCodes(t *testing.T) {
+	fakeDocker(t, `shift; for c in "$@"; do case $c in web) echo 0;; worker) echo 137;; esac; done`)
+
+	toolResult, result := callDocker(t, "docker_wait", map[string]interface{}{"containers": []interface{}{"web", "worker"}})
+	if toolResult.IsError {
+		t.Fatalf("unexpected error: %+v", result)
+	}
+	if len(result.ExitCodes) != 2 || result.ExitCodes["web"] != 0 || result.ExitCodes["worker"] != 137 {
+		t.Errorf("exit_codes = %v, want web=0 worker=137", result.ExitCodes)
+	}
+}
+
+func TestWaitExitCodes(t *testing.T) {
+	tests := []struct {
+		name       string
+		containers []string
+		stdout     string
+		want       map[string]int
+	}{
+		{"one per container", []string{"a", "b"}, "0\n1", map[string]int{"a": 0, "b": 1}},
+		{"missing code", []string{"a", "b"}, "0", nil},
+		{"not a number", []string{"a"}, "Error: No such container: a", nil},
+		{"no output", []string{"a"}, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := waitExitCodes(tt.containers, tt.stdout)
+			if len(got) != len(tt.want) {
+				t.Fatalf("waitExitCodes = %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("waitExitCodes = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLogsOutputIsTruncated(t *testing.T) {
+	fakeDocker(t, "printf '%05000d' 0\nprintf '%03000d' 0 >&2\n")
+
+	prev := maxOutputBytes
+	maxOutputBytes = 1000
+	defer func() { maxOutputBytes = prev }()
+
+	tests := []struct {
+		name       string
+		limit      interface{}
+		wantStdout string
+	}{
+		{"default cap", nil, strings.Repeat("0", 1000) + "\n[output truncated: showing 1000 of 5000 bytes]"},
+		{"per-call cap", "100", strings.Repeat("0", 100) + "\n[output truncated: showing 100 of 5000 bytes]"},
+		{"per-call cap above output", float64(10000), strings.Repeat("0", 5000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := map[string]interface{}{"container": "web"}
+			if tt.limit != nil {
+				args["max_output_bytes"] = tt.limit
+			}
+			_, result := callDocker(t, "docker_logs", args)
+			if result.Stdout != tt.wantStdout {
+				t.Errorf("stdout has %d bytes, want %d", len(result.Stdout), len(tt.wantStdout))
+			}
+		})
+	}
+}
+
+func TestFailedCommandStderrIsTruncated(t *testing.T) {
+	fakeDocker(t, "printf '%03000d' 0 >&2\nexit 1\n")
+
+	_, result := callDocker(t, "docker_logs", map[string]interface{}{"container": "web", "max_output_bytes": float64(10)})
+	if want := "0000000000\n[output truncated: showing 10 of 3000 bytes]"; result.Stderr != want {
+		t.Errorf("stderr = %q, want %q", result.Stderr, want)
+	}
+}
+
+func TestMaxOutputBytesValidation(t *testing.T) {
+	fakeDocker(t, `echo "$@"`)
+
+	for _, v := range []interface{}{float64(0), 1.5, "lots"} {
+		tr, _ := callDocker(t, "docker_logs", map[string]interface{}{"container": "web", "max_output_bytes": v})
+		if !tr.IsError || !strings.Contains(tr.Content[0].Text, "max_output_bytes") {
+			t.Errorf("max_output_bytes=%v: result = %+v, want a tool error", v, tr)
+		}
+	}
+}
+
+func TestTruncateOutput(t *testing.T) {
+	tests := []struct {
+		in    string
+		limit int
+		want  string
+	}{
+		{"hello", 0, "hello"},
+		{"hello", 5, "hello"},
+		{"hello world", 5, "hello\n[output truncated: showing 5 of 11 bytes]"},
+		{"caféine", 4, "caf\n[output truncated: showing 3 of 8 bytes]"},
+	}
+	for _, tt := range tests {
+		if got := truncateOutput(tt.in, tt.limit); got != tt.want {
+			t.Errorf("truncateOutput(%q, %d) = %q, want %q", tt.in, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestDockerSearchArgs(t *testing.T) {
+	fakeDocker(t, `echo "$@"`)
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"term only", map[string]interface{}{"term": "nginx"}, "search nginx"},
+		{"limit as number", map[string]interface{}{"term": "nginx", "limit": float64(5)}, "search --limit 5 nginx"},
+		{"limit as string", map[string]interface{}{"term": "nginx", "limit": "5"}, "search --limit 5 nginx"},
+		{"filters", map[string]interface{}{"term": "postgres", "filter": []interface{}{"is-official=true", "stars=100"}},
+			"search --filter is-official=true --filter stars=100 postgres"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, result := callDocker(t, "docker_search", tt.args)
+			if result.Stdout != tt.want {
+				t.Errorf("docker called with %q, want %q", result.Stdout, tt.want)
+			}
+		})
+	}
+}
+
+func TestDockerSearchRejectsBadArgs(t *testing.T) {
+	fakeDocker(t, `echo "$@"`)
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"missing term", map[string]interface{}{}, "term is required"},
+		{"zero limit", map[string]interface{}{"term": "nginx", "limit": float64(0)}, "limit must be a positive integer"},
+		{"fractional limit", map[string]interface{}{"term": "nginx", "limit": float64(2.5)}, "limit must be a positive integer"},
+		{"non-numeric limit", map[string]interface{}{"term": "nginx", "limit": "lots"}, "limit must be a positive integer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toolResult, _ := callDocker(t, "docker_search", tt.args)
+			if !toolResult.IsError || !strings.Contains(toolResult.Content[0].Text, tt.want) {
+				t.Errorf("result = %+v, want error containing %q", toolResult, tt.want)
+			}
+		})
+	}
+}
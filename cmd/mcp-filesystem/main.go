@@ -4,16 +4,23 @@ import (
 	"bufio"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"log"
+	"mime"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
+	"github.com/soyeahso/hunter3/internal/logfile"
 )
 
 // MCP Protocol Types
@@ -87,7 +94,8 @@ type InitializeResult struct {
 }
 
 type Capabilities struct {
-	Tools map[string]interface{} `json:"tools"`
+	Tools     map[string]interface{} `json:"tools"`
+	Resources map[string]interface{} `json:"resources"`
 }
 
 type ServerInfo struct {
@@ -99,30 +107,72 @@ type ListToolsResult struct {
 	Tools []Tool `json:"tools"`
 }
 
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+type ListResourcesResult struct {
+	Resources []Resource `json:"resources"`
+}
+
+type ReadResourceParams struct {
+	URI string `json:"uri"`
+}
+
+// ResourceContents holds either Text or Blob. Text is a pointer so that an
+// empty text resource still carries "text": "".
+type ResourceContents struct {
+	URI      string  `json:"uri"`
+	MimeType string  `json:"mimeType,omitempty"`
+	Text     *string `json:"text,omitempty"`
+	Blob     string  `json:"blob,omitempty"`
+}
+
+type ReadResourceResult struct {
+	Contents []ResourceContents `json:"contents"`
+}
+
 type DirectoryEntry struct {
-	Name        string            `json:"name"`
-	Type        string            `json:"type"`
-	Children    []DirectoryEntry  `json:"children,omitempty"`
+	Name     string           `json:"name"`
+	Type     string           `json:"type"`
+	Children []DirectoryEntry `json:"children,omitempty"`
+
+	// Set for files only when directory_tree is asked for them.
+	SizeBytes    *int64 `json:"sizeBytes,omitempty"`
+	ModifiedUnix *int64 `json:"modifiedUnix,omitempty"`
+
+	// Truncated marks a directory whose contents were not listed because
+	// it sits at maxDepth.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// FileStat is one entry of a stat_files result.
+type FileStat struct {
+	Path         string `json:"path"`
+	Exists       bool   `json:"exists"`
+	SizeBytes    int64  `json:"sizeBytes"`
+	ModifiedUnix int64  `json:"modifiedUnix,omitempty"`
+	Type         string `json:"type,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// treeOptions controls what buildDirectoryTree includes.
+type treeOptions struct {
+	excludePatterns []string
+	includeSize     bool
+	includeModified bool
+	maxDepth        int // 0 means unlimited
 }
 
 var logger *log.Logger
 var allowedDirectories []string
 
 func initLogger() {
-	logsDir := filepath.Join(os.Getenv("HOME"), ".hunter3", "logs")
-	if err := os.MkdirAll(logsDir, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create logs directory: %v\n", err)
-		return
-	}
-
-	logFile := filepath.Join(logsDir, "mcp-filesystem.log")
-	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to open log file: %v\n", err)
-		return
-	}
-
-	logger = log.New(io.MultiWriter(f, os.Stderr), "[mcp-filesystem] ", log.LstdFlags)
+	// Log to stderr and to a file rotated by size and readable only by the owner
+	logger = logfile.NewLogger("mcp-filesystem")
 	logger.Println("MCP Filesystem server starting...")
 }
 
@@ -224,6 +274,10 @@ func (s *MCPServer) handleRequest(line string) {
 		s.handleListTools(req)
 	case "tools/call":
 		s.handleCallTool(req)
+	case "resources/list":
+		s.handleListResources(req)
+	case "resources/read":
+		s.handleReadResource(req)
 	case "notifications/initialized":
 		logger.Println("Received initialized notification")
 		return
@@ -238,7 +292,8 @@ func (s *MCPServer) handleInitialize(req JSONRPCRequest) {
 	result := InitializeResult{
 		ProtocolVersion: "2024-11-05",
 		Capabilities: Capabilities{
-			Tools: map[string]interface{}{},
+			Tools:     map[string]interface{}{},
+			Resources: map[string]interface{}{},
 		},
 		ServerInfo: ServerInfo{
 			Name:    "filesystem",
@@ -322,7 +377,7 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 		},
 		{
 			Name:        "edit_file",
-			Description: "Make line-based edits to a text file. Each edit replaces exact line sequences with new content. Returns a git-style diff showing the changes made. Only works within allowed directories.",
+			Description: "Make line-based edits to a text file. Each edit replaces the first occurrence of oldText with newText; an edit whose oldText is not found fails the whole call and nothing is written. Set flexibleWhitespace: true on an edit to retry a failed exact match line by line ignoring leading/trailing whitespace, keeping the file's indentation. Returns which match was used for each edit and a git-style diff showing the changes made. Only works within allowed directories.",
 			InputSchema: InputSchema{
 				Type: "object",
 				Properties: map[string]Property{
@@ -372,37 +427,43 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 		},
 		{
 			Name:        "directory_tree",
-			Description: "Get a recursive tree view of files and directories as a JSON structure. Each entry includes 'name', 'type' (file/directory), and 'children' for directories. Files have no children array, while directories always have a children array (which may be empty). The output is formatted with 2-space indentation for readability. Only works within allowed directories.",
+			Description: "Get a recursive tree view of files and directories as a JSON structure. Each entry includes 'name', 'type' (file/directory), and 'children' for directories. Files have no children array, while directories always have a children array (which may be empty). Set includeSize and includeModified to add 'sizeBytes' and 'modifiedUnix' to files, and maxDepth to limit recursion; directories at the limit are marked 'truncated'. The output is formatted with 2-space indentation for readability. Only works within allowed directories.",
 			InputSchema: InputSchema{
 				Type: "object",
 				Properties: map[string]Property{
 					"path":            {Type: "string"},
 					"excludePatterns": {Type: "array", Items: &Items{Type: "string"}, Default: []string{}},
+					"includeSize":     {Type: "boolean", Default: false, Description: "Include each file's size in bytes as sizeBytes"},
+					"includeModified": {Type: "boolean", Default: false, Description: "Include each file's modification time as modifiedUnix (seconds since the epoch)"},
+					"maxDepth":        {Type: "number", Description: "Maximum depth to descend; 1 lists only the direct entries of path. Unlimited when omitted"},
 				},
 				Required: []string{"path"},
 			},
 		},
 		{
 			Name:        "move_file",
-			Description: "Move or rename files and directories. Can move files between directories and rename them in a single operation. If the destination exists, the operation will fail. Works across different directories and can be used for simple renaming within the same directory. Both source and destination must be within allowed directories.",
+			Description: "Move or rename files and directories. Can move files between directories and rename them in a single operation. If the destination exists (including as a symlink), the operation will fail unless overwrite is true; a symlink at the destination is replaced itself, never written through. Works across different directories and can be used for simple renaming within the same directory. Both source and destination must be within allowed directories.",
 			InputSchema: InputSchema{
 				Type: "object",
 				Properties: map[string]Property{
 					"source":      {Type: "string"},
 					"destination": {Type: "string"},
+					"overwrite":   {Type: "boolean", Default: false, Description: "Replace the destination if it already exists"},
 				},
 				Required: []string{"source", "destination"},
 			},
 		},
 		{
 			Name:        "search_files",
-			Description: "Recursively search for files and directories matching a pattern. The patterns should be glob-style patterns that match paths relative to the working directory. Use pattern like '*.ext' to match files in current directory, and '**/*.ext' to match files in all subdirectories. Returns full paths to all matching items. Great for finding files when you don't know their exact location. Only searches within allowed directories.",
+			Description: "Recursively search for files and directories matching a pattern. The patterns should be glob-style patterns that match paths relative to the working directory. Use pattern like '*.ext' to match files in current directory, and '**/*.ext' to match files in all subdirectories. Returns full paths to all matching items. Great for finding files when you don't know their exact location. Symlinked directories are not descended into unless followSymlinks is true, and then only when their target is within allowed directories. Only searches within allowed directories.",
 			InputSchema: InputSchema{
 				Type: "object",
 				Properties: map[string]Property{
 					"path":            {Type: "string"},
 					"pattern":         {Type: "string"},
 					"excludePatterns": {Type: "array", Items: &Items{Type: "string"}, Default: []string{}},
+					"maxDepth":        {Type: "number", Description: "Maximum depth to descend; 1 searches only the direct entries of path. Unlimited when omitted"},
+					"followSymlinks":  {Type: "boolean", Default: false, Description: "Descend into symlinked directories whose targets are within allowed directories"},
 				},
 				Required: []string{"path", "pattern"},
 			},
@@ -418,6 +479,47 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 				Required: []string{"path"},
 			},
 		},
+		{
+			Name:        "stat_files",
+			Description: "Cheaply check whether files have changed without reading them. Returns a JSON array with path, exists, sizeBytes, modifiedUnix, and type (file or directory) for each path, in the order given. Missing paths are reported with exists set to false instead of failing the call. Only works within allowed directories.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"paths": {
+						Type:        "array",
+						Description: "Array of file or directory paths to stat.",
+						Items:       &Items{Type: "string"},
+						MinItems:    &minOne,
+					},
+				},
+				Required: []string{"paths"},
+			},
+		},
+		{
+			Name:        "set_permissions",
+			Description: "Change the permission bits of a file or directory, like chmod, e.g. to make a script executable or restrict a secret to its owner with '600'. With recursive, every file and directory below a directory gets the same mode; symlinks inside it are skipped. Only works within allowed directories.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"path":      {Type: "string"},
+					"mode":      {Type: "string", Description: "Octal permission bits, e.g. '644', '0755', or '600'"},
+					"recursive": {Type: "boolean", Default: false, Description: "Also apply the mode to everything below path"},
+				},
+				Required: []string{"path", "mode"},
+			},
+		},
+		{
+			Name:        "create_symlink",
+			Description: "Create a symbolic link at link_path pointing to target, e.g. to reference a shared directory from a project layout. A relative target is resolved from the directory containing the link and is stored as given. The target must resolve to a path within the allowed directories, though it need not exist yet. Fails if link_path already exists. Only works within allowed directories.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"target":    {Type: "string", Description: "Path the link points to, absolute or relative to the link's directory"},
+					"link_path": {Type: "string", Description: "Path of the link to create"},
+				},
+				Required: []string{"target", "link_path"},
+			},
+		},
 		{
 			Name:        "list_allowed_directories",
 			Description: "Returns the list of directories that this server is allowed to access. Subdirectories within these allowed directories are also accessible. Use this to understand which directories and their nested paths are available before trying to access files.",
@@ -470,6 +572,12 @@ func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
 		s.searchFiles(req.ID, params.Arguments)
 	case "get_file_info":
 		s.getFileInfo(req.ID, params.Arguments)
+	case "stat_files":
+		s.statFiles(req.ID, params.Arguments)
+	case "set_permissions":
+		s.setPermissions(req.ID, params.Arguments)
+	case "create_symlink":
+		s.createSymlink(req.ID, params.Arguments)
 	case "list_allowed_directories":
 		s.listAllowedDirectories(req.ID)
 	default:
@@ -478,6 +586,157 @@ func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
 	}
 }
 
+// directoryMimeType is the MIME type advertised for directory resources.
+const directoryMimeType = "inode/directory"
+
+// pathToResourceURI converts an absolute filesystem path to a file:// URI.
+func pathToResourceURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// resourceURIToPath converts a file:// URI back to a filesystem path.
+func resourceURIToPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("invalid resource URI: %w", err)
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("unsupported resource URI scheme: %q", u.Scheme)
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		return "", fmt.Errorf("unsupported resource URI host: %q", u.Host)
+	}
+	if u.Path == "" {
+		return "", fmt.Errorf("resource URI has no path")
+	}
+	return filepath.FromSlash(u.Path), nil
+}
+
+// resourceMimeType guesses a MIME type from the file extension, falling back
+// to text/plain for valid UTF-8 content and application/octet-stream otherwise.
+func resourceMimeType(path string, content []byte) string {
+	if mimeType := mime.TypeByExtension(filepath.Ext(path)); mimeType != "" {
+		return mimeType
+	}
+	if utf8.Valid(content) {
+		return "text/plain"
+	}
+	return "application/octet-stream"
+}
+
+// handleListResources advertises each allowed directory, plus the regular
+// files directly inside it, as a file:// resource.
+func (s *MCPServer) handleListResources(req JSONRPCRequest) {
+	logger.Println("Handling list resources request")
+
+	resources := []Resource{}
+	for _, dir := range allowedDirectories {
+		resources = append(resources, Resource{
+			URI:         pathToResourceURI(dir),
+			Name:        filepath.Base(dir),
+			Description: fmt.Sprintf("Allowed directory %s", dir),
+			MimeType:    directoryMimeType,
+		})
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			logger.Printf("Failed to read allowed directory %s: %v\n", dir, err)
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			resources = append(resources, Resource{
+				URI:      pathToResourceURI(path),
+				Name:     entry.Name(),
+				MimeType: mime.TypeByExtension(filepath.Ext(path)),
+			})
+		}
+	}
+
+	s.sendResponse(req.ID, ListResourcesResult{Resources: resources})
+}
+
+// handleReadResource serves a file:// resource. Files are returned as text
+// when they are valid UTF-8 and as base64 blobs otherwise; directories are
+// returned as a listing in the same format as list_directory.
+func (s *MCPServer) handleReadResource(req JSONRPCRequest) {
+	var params ReadResourceParams
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		logger.Printf("Invalid params: %v\n", err)
+		s.sendError(req.ID, -32602, "Invalid params", err.Error())
+		return
+	}
+
+	logger.Printf("Reading resource: %s\n", params.URI)
+
+	pathStr, err := resourceURIToPath(params.URI)
+	if err != nil {
+		s.sendError(req.ID, -32602, "Invalid params", err.Error())
+		return
+	}
+
+	validPath, err := validatePath(pathStr)
+	if err != nil {
+		s.sendError(req.ID, -32602, "Access denied", err.Error())
+		return
+	}
+
+	info, err := os.Stat(validPath)
+	if err != nil {
+		s.sendError(req.ID, -32002, "Resource not found", err.Error())
+		return
+	}
+
+	if info.IsDir() {
+		entries, err := os.ReadDir(validPath)
+		if err != nil {
+			s.sendError(req.ID, -32603, "Internal error", fmt.Sprintf("Failed to read directory: %v", err))
+			return
+		}
+
+		var lines []string
+		for _, entry := range entries {
+			prefix := "[FILE]"
+			if entry.IsDir() {
+				prefix = "[DIR]"
+			}
+			lines = append(lines, fmt.Sprintf("%s %s", prefix, entry.Name()))
+		}
+
+		text := strings.Join(lines, "\n")
+		s.sendResponse(req.ID, ReadResourceResult{
+			Contents: []ResourceContents{{
+				URI:      params.URI,
+				MimeType: directoryMimeType,
+				Text:     &text,
+			}},
+		})
+		return
+	}
+
+	content, err := os.ReadFile(validPath)
+	if err != nil {
+		s.sendError(req.ID, -32603, "Internal error", fmt.Sprintf("Failed to read file: %v", err))
+		return
+	}
+
+	contents := ResourceContents{
+		URI:      params.URI,
+		MimeType: resourceMimeType(validPath, content),
+	}
+	if utf8.Valid(content) {
+		text := string(content)
+		contents.Text = &text
+	} else {
+		contents.Blob = base64.StdEncoding.EncodeToString(content)
+	}
+
+	s.sendResponse(req.ID, ReadResourceResult{Contents: []ResourceContents{contents}})
+}
+
 // resolvePartialSymlinks finds the longest existing prefix of a path,
 // resolves symlinks on it, then appends the remaining components.
 // This prevents symlink-based escapes even for non-existent target paths.
@@ -521,6 +780,26 @@ func resolvePartialSymlinks(absPath string) (string, error) {
 	return resolved, nil
 }
 
+// validateDestPath validates a path that is about to be created or replaced.
+// Only its parent directory is resolved, so a symlink in the final component
+// names the link itself rather than its target, even when it dangles.
+func validateDestPath(path string) (string, error) {
+	if strings.HasPrefix(path, "~/") {
+		path = filepath.Join(os.Getenv("HOME"), path[2:])
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+
+	dir, err := validatePath(filepath.Dir(absPath))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.Base(absPath)), nil
+}
+
 // validatePath ensures a path is within allowed directories
 func validatePath(path string) (string, error) {
 	// Expand home directory
@@ -578,11 +857,7 @@ func (s *MCPServer) readTextFile(id interface{}, args map[string]interface{}) {
 
 	content, err := os.ReadFile(validPath)
 	if err != nil {
-		result := ToolResult{
-			Content: []ContentItem{{Type: "text", Text: fmt.Sprintf("Failed to read file: %v", err)}},
-			IsError: true,
-		}
-		s.sendResponse(id, result)
+		s.sendToolError(id, fmt.Errorf("Failed to read file: %w", err))
 		return
 	}
 
@@ -590,17 +865,17 @@ func (s *MCPServer) readTextFile(id interface{}, args map[string]interface{}) {
 
 	// Handle head/tail parameters
 	if head, ok := args["head"].(float64); ok {
-		lines := strings.Split(text, "\n")
-		if int(head) < len(lines) {
-			lines = lines[:int(head)]
+		if head < 0 {
+			s.sendError(id, -32602, "Invalid arguments", "head must not be negative")
+			return
 		}
-		text = strings.Join(lines, "\n")
+		text = headLines(text, int(head))
 	} else if tail, ok := args["tail"].(float64); ok {
-		lines := strings.Split(text, "\n")
-		if int(tail) < len(lines) {
-			lines = lines[len(lines)-int(tail):]
+		if tail < 0 {
+			s.sendError(id, -32602, "Invalid arguments", "tail must not be negative")
+			return
 		}
-		text = strings.Join(lines, "\n")
+		text = tailLines(text, int(tail))
 	}
 
 	result := ToolResult{
@@ -609,6 +884,35 @@ func (s *MCPServer) readTextFile(id interface{}, args map[string]interface{}) {
 	s.sendResponse(id, result)
 }
 
+// splitLines splits text into lines that keep their terminators ("\n" or
+// "\r\n"), so joining any run of them reproduces the original bytes. A final
+// line without a newline is kept as is.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// headLines returns the first n lines of text with their original endings.
+func headLines(text string, n int) string {
+	lines := splitLines(text)
+	if n < len(lines) {
+		lines = lines[:n]
+	}
+	return strings.Join(lines, "")
+}
+
+// tailLines returns the last n lines of text with their original endings.
+func tailLines(text string, n int) string {
+	lines := splitLines(text)
+	if n < len(lines) {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "")
+}
+
 func (s *MCPServer) readMediaFile(id interface{}, args map[string]interface{}) {
 	pathStr, ok := args["path"].(string)
 	if !ok {
@@ -624,11 +928,7 @@ func (s *MCPServer) readMediaFile(id interface{}, args map[string]interface{}) {
 
 	content, err := os.ReadFile(validPath)
 	if err != nil {
-		result := ToolResult{
-			Content: []ContentItem{{Type: "text", Text: fmt.Sprintf("Failed to read file: %v", err)}},
-			IsError: true,
-		}
-		s.sendResponse(id, result)
+		s.sendToolError(id, fmt.Errorf("Failed to read file: %w", err))
 		return
 	}
 
@@ -731,20 +1031,12 @@ func (s *MCPServer) writeFile(id interface{}, args map[string]interface{}) {
 	// Ensure parent directory exists
 	parentDir := filepath.Dir(validPath)
 	if err := os.MkdirAll(parentDir, 0755); err != nil {
-		result := ToolResult{
-			Content: []ContentItem{{Type: "text", Text: fmt.Sprintf("Failed to create parent directory: %v", err)}},
-			IsError: true,
-		}
-		s.sendResponse(id, result)
+		s.sendToolError(id, fmt.Errorf("Failed to create parent directory: %w", err))
 		return
 	}
 
 	if err := os.WriteFile(validPath, []byte(content), 0644); err != nil {
-		result := ToolResult{
-			Content: []ContentItem{{Type: "text", Text: fmt.Sprintf("Failed to write file: %v", err)}},
-			IsError: true,
-		}
-		s.sendResponse(id, result)
+		s.sendToolError(id, fmt.Errorf("Failed to write file: %w", err))
 		return
 	}
 
@@ -780,11 +1072,7 @@ func (s *MCPServer) editFile(id interface{}, args map[string]interface{}) {
 
 	content, err := os.ReadFile(validPath)
 	if err != nil {
-		result := ToolResult{
-			Content: []ContentItem{{Type: "text", Text: fmt.Sprintf("Failed to read file: %v", err)}},
-			IsError: true,
-		}
-		s.sendResponse(id, result)
+		s.sendToolError(id, fmt.Errorf("Failed to read file: %w", err))
 		return
 	}
 
@@ -792,7 +1080,8 @@ func (s *MCPServer) editFile(id interface{}, args map[string]interface{}) {
 	modifiedContent := originalContent
 
 	// Apply edits
-	for _, editInterface := range editsInterface {
+	var report strings.Builder
+	for i, editInterface := range editsInterface {
 		edit, ok := editInterface.(map[string]interface{})
 		if !ok {
 			continue
@@ -804,20 +1093,23 @@ func (s *MCPServer) editFile(id interface{}, args map[string]interface{}) {
 		if !ok1 || !ok2 {
 			continue
 		}
+		flexible, _ := edit["flexibleWhitespace"].(bool)
 
-		modifiedContent = strings.ReplaceAll(modifiedContent, oldText, newText)
+		var match string
+		modifiedContent, match, err = applyEdit(modifiedContent, oldText, newText, flexible)
+		if err != nil {
+			s.sendToolError(id, &ToolError{Code: codeInvalidArgument, Message: fmt.Sprintf("Edit %d failed: %v. No changes were written.", i+1, err)})
+			return
+		}
+		report.WriteString(fmt.Sprintf("Edit %d: %s match\n", i+1, match))
 	}
 
 	// Generate diff
-	diff := generateDiff(originalContent, modifiedContent, pathStr)
+	diff := report.String() + "\n" + generateDiff(originalContent, modifiedContent, pathStr)
 
 	if !dryRun {
 		if err := os.WriteFile(validPath, []byte(modifiedContent), 0644); err != nil {
-			result := ToolResult{
-				Content: []ContentItem{{Type: "text", Text: fmt.Sprintf("Failed to write file: %v", err)}},
-				IsError: true,
-			}
-			s.sendResponse(id, result)
+			s.sendToolError(id, fmt.Errorf("Failed to write file: %w", err))
 			return
 		}
 	}
@@ -828,6 +1120,165 @@ func (s *MCPServer) editFile(id interface{}, args map[string]interface{}) {
 	s.sendResponse(id, result)
 }
 
+// Match kinds reported by edit_file.
+const (
+	matchExact    = "exact"
+	matchFlexible = "flexible whitespace"
+)
+
+// applyEdit replaces the first occurrence of oldText in content with newText
+// and reports which kind of match was used. If there is no exact match and
+// flexible is set, it looks for a unique run of lines equal to oldText's
+// lines once leading and trailing whitespace is ignored, and replaces them
+// with newText re-indented to the file's indentation: its base indent is
+// moved to where the match is, and the further indentation of each line
+// becomes what the file uses for the same indentation in the matched lines,
+// or failing that, the same number of the file's indent units.
+func applyEdit(content, oldText, newText string, flexible bool) (string, string, error) {
+	if oldText == "" {
+		return "", "", fmt.Errorf("oldText must not be empty")
+	}
+	if strings.Contains(content, oldText) {
+		return strings.Replace(content, oldText, newText, 1), matchExact, nil
+	}
+	if !flexible {
+		return "", "", fmt.Errorf("oldText not found (set flexibleWhitespace to ignore indentation differences)")
+	}
+
+	// A trailing newline on oldText just ends its last line.
+	trimmedOld := strings.TrimSuffix(strings.TrimSuffix(oldText, "\n"), "\r")
+	if len(trimmedOld) < len(oldText) {
+		newText = strings.TrimSuffix(strings.TrimSuffix(newText, "\n"), "\r")
+	}
+	oldLines := strings.Split(trimmedOld, "\n")
+	lines := strings.Split(content, "\n")
+
+	start := -1
+	for i := 0; i+len(oldLines) <= len(lines); i++ {
+		matched := true
+		for j, oldLine := range oldLines {
+			if strings.TrimSpace(lines[i+j]) != strings.TrimSpace(oldLine) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		if start >= 0 {
+			return "", "", fmt.Errorf("oldText matches more than one location when ignoring whitespace; include more surrounding lines")
+		}
+		start = i
+	}
+	if start < 0 {
+		return "", "", fmt.Errorf("oldText not found, even ignoring leading/trailing whitespace")
+	}
+
+	region := lines[start : start+len(oldLines)]
+	fileIndent := leadingWhitespace(firstNonBlank(region))
+	editIndent := leadingWhitespace(firstNonBlank(oldLines))
+	crlf := strings.HasSuffix(region[len(region)-1], "\r")
+
+	// The matched lines show how the file writes each of oldText's indents.
+	indents := make(map[string]string)
+	for j, oldLine := range oldLines {
+		if strings.TrimSpace(oldLine) == "" || !strings.HasPrefix(oldLine, editIndent) || !strings.HasPrefix(region[j], fileIndent) {
+			continue
+		}
+		indents[leadingWhitespace(oldLine[len(editIndent):])] = leadingWhitespace(region[j][len(fileIndent):])
+	}
+
+	newLines := strings.Split(newText, "\n")
+	editUnit := indentUnit(append(oldLines, newLines...))
+	fileUnit := indentUnit(lines)
+	if fileUnit == "" {
+		fileUnit = editUnit
+	}
+
+	var replacement []string
+	for _, line := range newLines {
+		line = strings.TrimSuffix(line, "\r")
+		switch {
+		case strings.TrimSpace(line) == "":
+			line = ""
+		case strings.HasPrefix(line, editIndent):
+			rest := line[len(editIndent):]
+			if indent, ok := indents[leadingWhitespace(rest)]; ok {
+				line = fileIndent + indent + strings.TrimLeft(rest, " \t")
+			} else {
+				line = fileIndent + convertIndent(rest, editUnit, fileUnit)
+			}
+		default:
+			line = fileIndent + strings.TrimLeft(line, " \t")
+		}
+		if crlf {
+			line += "\r"
+		}
+		replacement = append(replacement, line)
+	}
+
+	result := make([]string, 0, len(lines)-len(region)+len(replacement))
+	result = append(result, lines[:start]...)
+	result = append(result, replacement...)
+	result = append(result, lines[start+len(oldLines):]...)
+	return strings.Join(result, "\n"), matchFlexible, nil
+}
+
+// firstNonBlank returns the first line that is not only whitespace.
+func firstNonBlank(lines []string) string {
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// indentUnit guesses the whitespace one level of indentation adds in lines:
+// a tab if any line is indented one tab deeper than the line before it,
+// otherwise the smallest such step in spaces. It returns "" if no line is
+// indented deeper than the one before it.
+func indentUnit(lines []string) string {
+	unit, prev := "", ""
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		ws := leadingWhitespace(line)
+		if len(ws) > len(prev) && strings.HasPrefix(ws, prev) {
+			step := ws[len(prev):]
+			if step == "\t" {
+				return step
+			}
+			if strings.Trim(step, " ") == "" && (unit == "" || len(step) < len(unit)) {
+				unit = step
+			}
+		}
+		prev = ws
+	}
+	return unit
+}
+
+// convertIndent rewrites the leading whitespace of line from whole units of
+// from to the same number of units of to. Indentation that is not a whole
+// number of units, such as alignment, is kept as it is.
+func convertIndent(line, from, to string) string {
+	if from == "" || from == to {
+		return line
+	}
+	ws := leadingWhitespace(line)
+	n := strings.Count(ws, from)
+	if strings.Repeat(from, n) != ws {
+		return line
+	}
+	return strings.Repeat(to, n) + line[len(ws):]
+}
+
+// leadingWhitespace returns the run of spaces and tabs that starts line.
+func leadingWhitespace(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
 func generateDiff(original, modified, filename string) string {
 	origLines := strings.Split(original, "\n")
 	modLines := strings.Split(modified, "\n")
@@ -878,11 +1329,7 @@ func (s *MCPServer) createDirectory(id interface{}, args map[string]interface{})
 	}
 
 	if err := os.MkdirAll(validPath, 0755); err != nil {
-		result := ToolResult{
-			Content: []ContentItem{{Type: "text", Text: fmt.Sprintf("Failed to create directory: %v", err)}},
-			IsError: true,
-		}
-		s.sendResponse(id, result)
+		s.sendToolError(id, fmt.Errorf("Failed to create directory: %w", err))
 		return
 	}
 
@@ -907,11 +1354,7 @@ func (s *MCPServer) listDirectory(id interface{}, args map[string]interface{}) {
 
 	entries, err := os.ReadDir(validPath)
 	if err != nil {
-		result := ToolResult{
-			Content: []ContentItem{{Type: "text", Text: fmt.Sprintf("Failed to read directory: %v", err)}},
-			IsError: true,
-		}
-		s.sendResponse(id, result)
+		s.sendToolError(id, fmt.Errorf("Failed to read directory: %w", err))
 		return
 	}
 
@@ -950,11 +1393,7 @@ func (s *MCPServer) listDirectoryWithSizes(id interface{}, args map[string]inter
 
 	entries, err := os.ReadDir(validPath)
 	if err != nil {
-		result := ToolResult{
-			Content: []ContentItem{{Type: "text", Text: fmt.Sprintf("Failed to read directory: %v", err)}},
-			IsError: true,
-		}
-		s.sendResponse(id, result)
+		s.sendToolError(id, fmt.Errorf("Failed to read directory: %w", err))
 		return
 	}
 
@@ -1041,14 +1480,23 @@ func (s *MCPServer) directoryTree(id interface{}, args map[string]interface{}) {
 		return
 	}
 
-	excludePatterns := []string{}
+	opts := treeOptions{excludePatterns: []string{}}
 	if ep, ok := args["excludePatterns"].([]interface{}); ok {
 		for _, p := range ep {
 			if pattern, ok := p.(string); ok {
-				excludePatterns = append(excludePatterns, pattern)
+				opts.excludePatterns = append(opts.excludePatterns, pattern)
 			}
 		}
 	}
+	opts.includeSize, _ = args["includeSize"].(bool)
+	opts.includeModified, _ = args["includeModified"].(bool)
+	if depth, ok := args["maxDepth"].(float64); ok {
+		if depth < 1 || depth != float64(int(depth)) {
+			s.sendError(id, -32602, "Invalid arguments", "maxDepth must be a positive integer")
+			return
+		}
+		opts.maxDepth = int(depth)
+	}
 
 	validPath, err := validatePath(pathStr)
 	if err != nil {
@@ -1056,23 +1504,15 @@ func (s *MCPServer) directoryTree(id interface{}, args map[string]interface{}) {
 		return
 	}
 
-	tree, err := buildDirectoryTree(validPath, validPath, excludePatterns)
+	tree, err := buildDirectoryTree(validPath, validPath, opts, 1)
 	if err != nil {
-		result := ToolResult{
-			Content: []ContentItem{{Type: "text", Text: fmt.Sprintf("Failed to build directory tree: %v", err)}},
-			IsError: true,
-		}
-		s.sendResponse(id, result)
+		s.sendToolError(id, fmt.Errorf("Failed to build directory tree: %w", err))
 		return
 	}
 
 	jsonData, err := json.MarshalIndent(tree, "", "  ")
 	if err != nil {
-		result := ToolResult{
-			Content: []ContentItem{{Type: "text", Text: fmt.Sprintf("Failed to marshal tree: %v", err)}},
-			IsError: true,
-		}
-		s.sendResponse(id, result)
+		s.sendToolError(id, fmt.Errorf("Failed to marshal tree: %w", err))
 		return
 	}
 
@@ -1082,7 +1522,9 @@ func (s *MCPServer) directoryTree(id interface{}, args map[string]interface{}) {
 	s.sendResponse(id, result)
 }
 
-func buildDirectoryTree(rootPath, currentPath string, excludePatterns []string) ([]DirectoryEntry, error) {
+// buildDirectoryTree lists currentPath, which is depth levels below
+// rootPath's entries (the root's own entries are at depth 1).
+func buildDirectoryTree(rootPath, currentPath string, opts treeOptions, depth int) ([]DirectoryEntry, error) {
 	entries, err := os.ReadDir(currentPath)
 	if err != nil {
 		return nil, err
@@ -1096,7 +1538,7 @@ func buildDirectoryTree(rootPath, currentPath string, excludePatterns []string)
 
 		// Check exclusions
 		excluded := false
-		for _, pattern := range excludePatterns {
+		for _, pattern := range opts.excludePatterns {
 			matched, _ := filepath.Match(pattern, entry.Name())
 			if matched {
 				excluded = true
@@ -1119,14 +1561,27 @@ func buildDirectoryTree(rootPath, currentPath string, excludePatterns []string)
 
 		if entry.IsDir() {
 			dirEntry.Type = "directory"
-			children, err := buildDirectoryTree(rootPath, entryPath, excludePatterns)
-			if err == nil {
+			if opts.maxDepth > 0 && depth >= opts.maxDepth {
+				dirEntry.Truncated = true
+			} else if children, err := buildDirectoryTree(rootPath, entryPath, opts, depth+1); err == nil {
 				dirEntry.Children = children
 			} else {
 				dirEntry.Children = []DirectoryEntry{}
 			}
 		} else {
 			dirEntry.Type = "file"
+			if opts.includeSize || opts.includeModified {
+				if info, err := entry.Info(); err == nil {
+					if opts.includeSize {
+						size := info.Size()
+						dirEntry.SizeBytes = &size
+					}
+					if opts.includeModified {
+						mtime := info.ModTime().Unix()
+						dirEntry.ModifiedUnix = &mtime
+					}
+				}
+			}
 		}
 
 		result = append(result, dirEntry)
@@ -1154,18 +1609,20 @@ func (s *MCPServer) moveFile(id interface{}, args map[string]interface{}) {
 		return
 	}
 
-	validDest, err := validatePath(destStr)
+	validDest, err := validateDestPath(destStr)
 	if err != nil {
 		s.sendError(id, -32602, "Access denied", fmt.Sprintf("destination: %v", err))
 		return
 	}
 
+	overwrite, _ := args["overwrite"].(bool)
+	if _, err := os.Lstat(validDest); err == nil && !overwrite {
+		s.sendToolError(id, &ToolError{Code: codeAlreadyExists, Message: fmt.Sprintf("Failed to move file: destination %s already exists (set overwrite to replace it)", destStr), Details: destStr})
+		return
+	}
+
 	if err := os.Rename(validSource, validDest); err != nil {
-		result := ToolResult{
-			Content: []ContentItem{{Type: "text", Text: fmt.Sprintf("Failed to move file: %v", err)}},
-			IsError: true,
-		}
-		s.sendResponse(id, result)
+		s.sendToolError(id, fmt.Errorf("Failed to move file: %w", err))
 		return
 	}
 
@@ -1188,14 +1645,22 @@ func (s *MCPServer) searchFiles(id interface{}, args map[string]interface{}) {
 		return
 	}
 
-	excludePatterns := []string{}
+	opts := searchOptions{pattern: pattern}
 	if ep, ok := args["excludePatterns"].([]interface{}); ok {
 		for _, p := range ep {
 			if pat, ok := p.(string); ok {
-				excludePatterns = append(excludePatterns, pat)
+				opts.excludePatterns = append(opts.excludePatterns, pat)
 			}
 		}
 	}
+	if depth, ok := args["maxDepth"].(float64); ok {
+		if depth < 1 || depth != float64(int(depth)) {
+			s.sendError(id, -32602, "Invalid arguments", "maxDepth must be a positive integer")
+			return
+		}
+		opts.maxDepth = int(depth)
+	}
+	opts.followSymlinks, _ = args["followSymlinks"].(bool)
 
 	validPath, err := validatePath(pathStr)
 	if err != nil {
@@ -1203,52 +1668,78 @@ func (s *MCPServer) searchFiles(id interface{}, args map[string]interface{}) {
 		return
 	}
 
-	var matches []string
-	err = filepath.WalkDir(validPath, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return nil // Skip errors
-		}
+	matches := searchTree(validPath, opts)
 
-		relPath, _ := filepath.Rel(validPath, path)
+	text := "No matches found"
+	if len(matches) > 0 {
+		text = strings.Join(matches, "\n")
+	}
 
-		// Check exclusions
-		for _, excl := range excludePatterns {
-			matched, _ := filepath.Match(excl, relPath)
-			if matched {
-				if d.IsDir() {
-					return filepath.SkipDir
-				}
-				return nil
+	result := ToolResult{
+		Content: []ContentItem{{Type: "text", Text: text}},
+	}
+	s.sendResponse(id, result)
+}
+
+// searchOptions controls searchTree.
+type searchOptions struct {
+	pattern         string
+	excludePatterns []string
+	maxDepth        int // 0 means unlimited
+	followSymlinks  bool
+}
+
+// searchTree returns the paths under root, root included, whose base name
+// matches opts.pattern. Unreadable directories are skipped. Symlinked
+// directories are descended into only with followSymlinks, and only when
+// validatePath accepts their target; each real directory is visited once,
+// so symlink cycles terminate.
+func searchTree(root string, opts searchOptions) []string {
+	var matches []string
+	visited := map[string]bool{}
+
+	var walk func(path string, isDir bool, depth int)
+	walk = func(path string, isDir bool, depth int) {
+		relPath, _ := filepath.Rel(root, path)
+		for _, excl := range opts.excludePatterns {
+			if matched, _ := filepath.Match(excl, relPath); matched {
+				return
 			}
 		}
 
-		// Check pattern match
-		matched, _ := filepath.Match(pattern, filepath.Base(path))
-		if matched {
+		if matched, _ := filepath.Match(opts.pattern, filepath.Base(path)); matched {
 			matches = append(matches, path)
 		}
 
-		return nil
-	})
-
-	if err != nil {
-		result := ToolResult{
-			Content: []ContentItem{{Type: "text", Text: fmt.Sprintf("Search failed: %v", err)}},
-			IsError: true,
+		if !isDir || (opts.maxDepth > 0 && depth >= opts.maxDepth) {
+			return
 		}
-		s.sendResponse(id, result)
-		return
-	}
+		real, err := filepath.EvalSymlinks(path)
+		if err != nil || visited[real] {
+			return
+		}
+		visited[real] = true
 
-	text := "No matches found"
-	if len(matches) > 0 {
-		text = strings.Join(matches, "\n")
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			child := filepath.Join(path, entry.Name())
+			childIsDir := entry.IsDir()
+			if opts.followSymlinks && entry.Type()&fs.ModeSymlink != 0 {
+				if target, err := validatePath(child); err != nil {
+					logger.Printf("search_files: not following %s: %v\n", child, err)
+				} else if info, err := os.Stat(target); err == nil && info.IsDir() {
+					childIsDir = true
+				}
+			}
+			walk(child, childIsDir, depth+1)
+		}
 	}
 
-	result := ToolResult{
-		Content: []ContentItem{{Type: "text", Text: text}},
-	}
-	s.sendResponse(id, result)
+	walk(root, true, 0)
+	return matches
 }
 
 func (s *MCPServer) getFileInfo(id interface{}, args map[string]interface{}) {
@@ -1266,11 +1757,7 @@ func (s *MCPServer) getFileInfo(id interface{}, args map[string]interface{}) {
 
 	info, err := os.Stat(validPath)
 	if err != nil {
-		result := ToolResult{
-			Content: []ContentItem{{Type: "text", Text: fmt.Sprintf("Failed to get file info: %v", err)}},
-			IsError: true,
-		}
-		s.sendResponse(id, result)
+		s.sendToolError(id, fmt.Errorf("Failed to get file info: %w", err))
 		return
 	}
 
@@ -1287,6 +1774,204 @@ func (s *MCPServer) getFileInfo(id interface{}, args map[string]interface{}) {
 	s.sendResponse(id, result)
 }
 
+func (s *MCPServer) statFiles(id interface{}, args map[string]interface{}) {
+	pathsInterface, ok := args["paths"].([]interface{})
+	if !ok || len(pathsInterface) == 0 {
+		s.sendError(id, -32602, "Invalid arguments", "paths parameter is required and must be a non-empty array")
+		return
+	}
+
+	stats := make([]FileStat, 0, len(pathsInterface))
+	for _, pathInterface := range pathsInterface {
+		pathStr, ok := pathInterface.(string)
+		if !ok {
+			s.sendError(id, -32602, "Invalid arguments", "paths must contain only strings")
+			return
+		}
+
+		validPath, err := validatePath(pathStr)
+		if err != nil {
+			s.sendError(id, -32602, "Access denied", fmt.Sprintf("%s: %v", pathStr, err))
+			return
+		}
+
+		stat := FileStat{Path: pathStr}
+		info, err := os.Stat(validPath)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			stat.Error = err.Error()
+		default:
+			stat.Exists = true
+			stat.SizeBytes = info.Size()
+			stat.ModifiedUnix = info.ModTime().Unix()
+			stat.Type = "file"
+			if info.IsDir() {
+				stat.Type = "directory"
+			}
+		}
+		stats = append(stats, stat)
+	}
+
+	jsonData, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		s.sendError(id, -32603, "Internal error", err.Error())
+		return
+	}
+
+	result := ToolResult{
+		Content: []ContentItem{{Type: "text", Text: string(jsonData)}},
+	}
+	s.sendResponse(id, result)
+}
+
+func (s *MCPServer) setPermissions(id interface{}, args map[string]interface{}) {
+	pathStr, ok := args["path"].(string)
+	if !ok {
+		s.sendError(id, -32602, "Invalid arguments", "path parameter is required")
+		return
+	}
+
+	modeStr, ok := args["mode"].(string)
+	if !ok {
+		s.sendError(id, -32602, "Invalid arguments", "mode parameter is required")
+		return
+	}
+	mode, err := parseMode(modeStr)
+	if err != nil {
+		s.sendError(id, -32602, "Invalid arguments", err.Error())
+		return
+	}
+
+	validPath, err := validatePath(pathStr)
+	if err != nil {
+		s.sendError(id, -32602, "Access denied", err.Error())
+		return
+	}
+
+	recursive, _ := args["recursive"].(bool)
+	count := 1
+	if recursive {
+		count, err = chmodTree(validPath, mode)
+	} else {
+		err = os.Chmod(validPath, mode)
+	}
+	if err != nil {
+		s.sendToolError(id, fmt.Errorf("Failed to set permissions: %w", err))
+		return
+	}
+
+	text := fmt.Sprintf("Successfully set permissions of %s to %04o", pathStr, mode)
+	if recursive {
+		text += fmt.Sprintf(" (%d entries)", count)
+	}
+	result := ToolResult{
+		Content: []ContentItem{{Type: "text", Text: text}},
+	}
+	s.sendResponse(id, result)
+}
+
+// parseMode parses an octal permission string such as "644" or "0755".
+// Only the permission bits are accepted, not setuid, setgid, or sticky.
+func parseMode(mode string) (os.FileMode, error) {
+	n, err := strconv.ParseUint(strings.TrimPrefix(mode, "0o"), 8, 32)
+	if err != nil || n > 0o777 {
+		return 0, fmt.Errorf("invalid mode %q: use octal permission bits such as 644 or 0755", mode)
+	}
+	return os.FileMode(n), nil
+}
+
+// chmodTree sets mode on root and everything below it, and returns how many
+// entries it changed. Symlinks are skipped rather than followed, since their
+// targets may lie outside the allowed directories. Directories are changed
+// after their contents, so a mode without search permission cannot cut the
+// walk short.
+func chmodTree(root string, mode os.FileMode) (int, error) {
+	var dirs []string
+	count := 0
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			return nil
+		case d.IsDir():
+			dirs = append(dirs, path)
+			return nil
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(dirs[i], mode); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (s *MCPServer) createSymlink(id interface{}, args map[string]interface{}) {
+	targetStr, ok := args["target"].(string)
+	if !ok || targetStr == "" {
+		s.sendError(id, -32602, "Invalid arguments", "target parameter is required")
+		return
+	}
+
+	linkStr, ok := args["link_path"].(string)
+	if !ok || linkStr == "" {
+		s.sendError(id, -32602, "Invalid arguments", "link_path parameter is required")
+		return
+	}
+
+	validLink, err := validateDestPath(linkStr)
+	if err != nil {
+		s.sendError(id, -32602, "Access denied", fmt.Sprintf("link_path: %v", err))
+		return
+	}
+
+	target, err := symlinkTarget(targetStr, validLink)
+	if err != nil {
+		s.sendError(id, -32602, "Access denied", fmt.Sprintf("target: %v", err))
+		return
+	}
+
+	if err := os.Symlink(target, validLink); err != nil {
+		s.sendToolError(id, fmt.Errorf("Failed to create symlink: %w", err))
+		return
+	}
+
+	result := ToolResult{
+		Content: []ContentItem{{Type: "text", Text: fmt.Sprintf("Successfully created symlink %s -> %s", linkStr, target)}},
+	}
+	s.sendResponse(id, result)
+}
+
+// symlinkTarget returns the target to store in a link at link, after
+// checking that it resolves within the allowed directories. A relative
+// target is resolved from the link's directory, as the kernel will, but is
+// returned unchanged so the link stays relative.
+func symlinkTarget(target, link string) (string, error) {
+	if strings.HasPrefix(target, "~/") {
+		target = filepath.Join(os.Getenv("HOME"), target[2:])
+	}
+	resolved := target
+	if !filepath.IsAbs(target) {
+		resolved = filepath.Join(filepath.Dir(link), target)
+	}
+	if _, err := validatePath(resolved); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
 func (s *MCPServer) listAllowedDirectories(id interface{}) {
 	text := "Allowed directories:\n" + strings.Join(allowedDirectories, "\n")
 	result := ToolResult{
@@ -1295,6 +1980,20 @@ func (s *MCPServer) listAllowedDirectories(id interface{}) {
 	s.sendResponse(id, result)
 }
 
+// stdoutMu serializes writes to stdoutWriter so that concurrent responses
+// can never interleave JSON-RPC lines on the protocol stream.
+var (
+	stdoutMu     sync.Mutex
+	stdoutWriter io.Writer = os.Stdout
+)
+
+// writeMessage writes a single newline-terminated JSON-RPC message to stdout.
+func writeMessage(data []byte) {
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+	stdoutWriter.Write(append(data, '\n'))
+}
+
 func (s *MCPServer) sendResponse(id interface{}, result interface{}) {
 	resp := JSONRPCResponse{
 		JSONRPC: "2.0",
@@ -1309,7 +2008,7 @@ func (s *MCPServer) sendResponse(id interface{}, result interface{}) {
 		return
 	}
 
-	fmt.Println(string(data))
+	writeMessage(data)
 	logger.Printf("Sent response for request ID: %v\n", id)
 }
 
@@ -1333,5 +2032,55 @@ func (s *MCPServer) sendError(id interface{}, code int, message string, data int
 		return
 	}
 
-	fmt.Println(string(jsonData))
+	writeMessage(jsonData)
+}
+
+// Error codes for ToolError, so that hosts can branch on the class of a
+// failure instead of parsing its message.
+const (
+	codeNotFound         = "not_found"
+	codePermissionDenied = "permission_denied"
+	codeAlreadyExists    = "already_exists"
+	codeInvalidArgument  = "invalid_argument"
+	codeTimeout          = "timeout"
+	codeUpstreamError    = "upstream_error"
+)
+
+// ToolError is the JSON body of a failed tool result.
+type ToolError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details string `json:"details,omitempty"`
+}
+
+func (e *ToolError) Error() string { return e.Message }
+
+// toToolError returns err as a ToolError, classifying plain errors by the
+// OS error they wrap.
+func toToolError(err error) *ToolError {
+	var te *ToolError
+	if errors.As(err, &te) {
+		return te
+	}
+	code := codeUpstreamError
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		code = codeNotFound
+	case errors.Is(err, fs.ErrPermission):
+		code = codePermissionDenied
+	case errors.Is(err, fs.ErrExist):
+		code = codeAlreadyExists
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		code = codeTimeout
+	}
+	return &ToolError{Code: code, Message: err.Error()}
+}
+
+// sendToolError sends err as a failed tool result whose text is a ToolError.
+func (s *MCPServer) sendToolError(id interface{}, err error) {
+	data, _ := json.Marshal(toToolError(err))
+	s.sendResponse(id, ToolResult{
+		Content: []ContentItem{{Type: "text", Text: string(data)}},
+		IsError: true,
+	})
 }
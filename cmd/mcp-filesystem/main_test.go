@@ -0,0 +1,1051 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	logger = log.New(io.Discard, "", 0)
+	os.Exit(m.Run())
+}
+
+// setupAllowedDir creates a temporary allowed directory and restores the
+// previous allowed directories when the test finishes.
+func setupAllowedDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("EvalSymlinks: %v", err)
+	}
+
+	prev := allowedDirectories
+	allowedDirectories = []string{dir}
+	t.Cleanup(func() { allowedDirectories = prev })
+
+	return dir
+}
+
+// call sends a single JSON-RPC request through the server and decodes the response.
+func call(t *testing.T, method string, params interface{}) JSONRPCResponse {
+	t.Helper()
+
+	var buf bytes.Buffer
+	stdoutWriter = &buf
+	defer func() { stdoutWriter = os.Stdout }()
+
+	req := map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method}
+	if params != nil {
+		req["params"] = params
+	}
+	line, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("Marshal request: %v", err)
+	}
+
+	s := &MCPServer{}
+	s.handleRequest(string(line))
+
+	var resp JSONRPCResponse
+	if err := json.Unmarshal(buf.Bytes(), &resp); err != nil {
+		t.Fatalf("Unmarshal response %q: %v", buf.String(), err)
+	}
+	return resp
+}
+
+// decodeResult re-marshals a generic response result into v.
+func decodeResult(t *testing.T, resp JSONRPCResponse, v interface{}) {
+	t.Helper()
+
+	if resp.Error != nil {
+		t.Fatalf("unexpected error response: %+v", resp.Error)
+	}
+	data, err := json.Marshal(resp.Result)
+	if err != nil {
+		t.Fatalf("Marshal result: %v", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("Unmarshal result: %v", err)
+	}
+}
+
+func TestInitializeAdvertisesResources(t *testing.T) {
+	var result InitializeResult
+	decodeResult(t, call(t, "initialize", nil), &result)
+
+	if result.Capabilities.Resources == nil {
+		t.Error("expected resources capability to be advertised")
+	}
+}
+
+func TestListResources(t *testing.T) {
+	dir := setupAllowedDir(t)
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var result ListResourcesResult
+	decodeResult(t, call(t, "resources/list", nil), &result)
+
+	uris := map[string]Resource{}
+	for _, r := range result.Resources {
+		uris[r.URI] = r
+	}
+
+	dirRes, ok := uris["file://"+filepath.ToSlash(dir)]
+	if !ok {
+		t.Fatalf("allowed directory missing from resources: %+v", result.Resources)
+	}
+	if dirRes.MimeType != directoryMimeType {
+		t.Errorf("directory MimeType = %q, want %q", dirRes.MimeType, directoryMimeType)
+	}
+
+	if _, ok := uris["file://"+filepath.ToSlash(filepath.Join(dir, "notes.txt"))]; !ok {
+		t.Errorf("top-level file missing from resources: %+v", result.Resources)
+	}
+	if _, ok := uris["file://"+filepath.ToSlash(filepath.Join(dir, "sub"))]; ok {
+		t.Errorf("subdirectory should not be listed as a resource: %+v", result.Resources)
+	}
+}
+
+func TestReadResource(t *testing.T) {
+	dir := setupAllowedDir(t)
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"text", "hello resources"},
+		{"empty file", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "notes.txt")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			uri := pathToResourceURI(path)
+			resp := call(t, "resources/read", ReadResourceParams{URI: uri})
+			var result ReadResourceResult
+			decodeResult(t, resp, &result)
+
+			if len(result.Contents) != 1 {
+				t.Fatalf("expected 1 content entry, got %d", len(result.Contents))
+			}
+			got := result.Contents[0]
+			if got.URI != uri {
+				t.Errorf("URI = %q, want %q", got.URI, uri)
+			}
+			if got.Text == nil || *got.Text != tt.content {
+				t.Errorf("Text = %v, want %q", got.Text, tt.content)
+			}
+			if got.Blob != "" {
+				t.Errorf("expected no blob for text content, got %q", got.Blob)
+			}
+		})
+	}
+}
+
+func TestReadResourceRejectsEscapes(t *testing.T) {
+	dir := setupAllowedDir(t)
+
+	outside := t.TempDir()
+	secret := filepath.Join(outside, "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		uri  string
+		code int
+	}{
+		{"dot-dot traversal", "file://" + filepath.ToSlash(dir) + "/../" + filepath.Base(outside) + "/secret.txt", -32602},
+		{"absolute path outside", pathToResourceURI(secret), -32602},
+		{"symlink escape", pathToResourceURI(filepath.Join(dir, "link", "secret.txt")), -32602},
+		{"unsupported scheme", "http://example.com/secret.txt", -32602},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := call(t, "resources/read", ReadResourceParams{URI: tt.uri})
+			if resp.Error == nil {
+				t.Fatalf("expected error for %q, got result %+v", tt.uri, resp.Result)
+			}
+			if resp.Error.Code != tt.code {
+				t.Errorf("error code = %d, want %d", resp.Error.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestHeadTailLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		n        int
+		wantHead string
+		wantTail string
+	}{
+		{"LF", "one\ntwo\nthree\n", 2, "one\ntwo\n", "two\nthree\n"},
+		{"CRLF", "one\r\ntwo\r\nthree\r\n", 2, "one\r\ntwo\r\n", "two\r\nthree\r\n"},
+		{"no trailing newline", "one\ntwo\nthree", 2, "one\ntwo\n", "two\nthree"},
+		{"single line without newline", "only", 1, "only", "only"},
+		{"more lines than file", "one\ntwo\n", 10, "one\ntwo\n", "one\ntwo\n"},
+		{"zero lines", "one\ntwo\n", 0, "", ""},
+		{"empty file", "", 3, "", ""},
+		{"blank lines", "\n\n\n", 2, "\n\n", "\n\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := headLines(tt.text, tt.n); got != tt.wantHead {
+				t.Errorf("headLines(%q, %d) = %q, want %q", tt.text, tt.n, got, tt.wantHead)
+			}
+			if got := tailLines(tt.text, tt.n); got != tt.wantTail {
+				t.Errorf("tailLines(%q, %d) = %q, want %q", tt.text, tt.n, got, tt.wantTail)
+			}
+		})
+	}
+}
+
+func TestReadTextFileHeadTail(t *testing.T) {
+	dir := setupAllowedDir(t)
+	path := filepath.Join(dir, "crlf.txt")
+	if err := os.WriteFile(path, []byte("a\r\nb\r\nc\r\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"full", map[string]interface{}{"path": path}, "a\r\nb\r\nc\r\n"},
+		{"head", map[string]interface{}{"path": path, "head": 1}, "a\r\n"},
+		{"tail", map[string]interface{}{"path": path, "tail": 1}, "c\r\n"},
+		{"head zero", map[string]interface{}{"path": path, "head": 0}, ""},
+		{"tail zero", map[string]interface{}{"path": path, "tail": 0}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result ToolResult
+			decodeResult(t, call(t, "tools/call", map[string]interface{}{
+				"name":      "read_text_file",
+				"arguments": tt.args,
+			}), &result)
+			if result.IsError {
+				t.Fatalf("unexpected tool error: %+v", result.Content)
+			}
+			if got := result.Content[0].Text; got != tt.want {
+				t.Errorf("text = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEdit(t *testing.T) {
+	const file = "func main() {\n\tif ok {\n\t\tgo run()\n\t}\n}\n"
+
+	tests := []struct {
+		name      string
+		content   string
+		oldText   string
+		newText   string
+		flexible  bool
+		want      string
+		wantMatch string
+		wantErr   string
+	}{
+		{
+			name:      "exact match",
+			content:   file,
+			oldText:   "\t\tgo run()",
+			newText:   "\t\tgo run(ctx)",
+			want:      "func main() {\n\tif ok {\n\t\tgo run(ctx)\n\t}\n}\n",
+			wantMatch: matchExact,
+		},
+		{
+			name:      "exact match replaces only the first occurrence",
+			content:   "a\na\n",
+			oldText:   "a",
+			newText:   "b",
+			want:      "b\na\n",
+			wantMatch: matchExact,
+		},
+		{
+			name:      "flexible indentation match",
+			content:   file,
+			oldText:   "if ok {\n    go run()\n}",
+			newText:   "if ok {\n    go run()\n    wait()\n}",
+			flexible:  true,
+			want:      "func main() {\n\tif ok {\n\t\tgo run()\n\t\twait()\n\t}\n}\n",
+			wantMatch: matchFlexible,
+		},
+		{
+			name:      "flexible match converts tabs to the file's spaces",
+			content:   "def main():\n    if ok:\n        run()\n",
+			oldText:   "if ok:\n\trun()",
+			newText:   "if ok:\n\trun()\n\tif again:\n\t\trun()",
+			flexible:  true,
+			want:      "def main():\n    if ok:\n        run()\n        if again:\n            run()\n",
+			wantMatch: matchFlexible,
+		},
+		{
+			name:      "flexible match keeps alignment",
+			content:   "func f() {\n\tcall(a,\n\t     b)\n}\n",
+			oldText:   "call(a,\n     b)",
+			newText:   "call(a,\n     c)",
+			flexible:  true,
+			want:      "func f() {\n\tcall(a,\n\t     c)\n}\n",
+			wantMatch: matchFlexible,
+		},
+		{
+			name:      "flexible match keeps CRLF",
+			content:   "a\r\n    b\r\nc\r\n",
+			oldText:   "b\n",
+			newText:   "B\n",
+			flexible:  true,
+			want:      "a\r\n    B\r\nc\r\n",
+			wantMatch: matchFlexible,
+		},
+		{
+			name:     "genuine non-match",
+			content:  file,
+			oldText:  "go walk()",
+			newText:  "go run()",
+			flexible: true,
+			wantErr:  "not found",
+		},
+		{
+			name:    "indentation mismatch without flexible",
+			content: file,
+			oldText: "    go run()",
+			newText: "    go run(ctx)",
+			wantErr: "set flexibleWhitespace",
+		},
+		{
+			name:     "ambiguous flexible match",
+			content:  "\tx := 1\n  x := 1\n",
+			oldText:  "    x := 1",
+			newText:  "x := 2",
+			flexible: true,
+			wantErr:  "more than one location",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, match, err := applyEdit(tt.content, tt.oldText, tt.newText, tt.flexible)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyEdit: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("content = %q, want %q", got, tt.want)
+			}
+			if match != tt.wantMatch {
+				t.Errorf("match = %q, want %q", match, tt.wantMatch)
+			}
+		})
+	}
+}
+
+func TestEditFileReportsMatchAndRejectsNonMatch(t *testing.T) {
+	dir := setupAllowedDir(t)
+	path := filepath.Join(dir, "main.go")
+	original := "func main() {\n\tfmt.Println(\"hi\")\n}\n"
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	var result ToolResult
+	decodeResult(t, call(t, "tools/call", map[string]interface{}{
+		"name": "edit_file",
+		"arguments": map[string]interface{}{
+			"path": path,
+			"edits": []interface{}{
+				map[string]interface{}{"oldText": "func main() {", "newText": "func main() {\n\tdefer cleanup()"},
+				map[string]interface{}{"oldText": "  fmt.Println(\"hi\")", "newText": "  fmt.Println(\"bye\")", "flexibleWhitespace": true},
+			},
+		},
+	}), &result)
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %+v", result.Content)
+	}
+	text := result.Content[0].Text
+	if !strings.Contains(text, "Edit 1: exact match") || !strings.Contains(text, "Edit 2: flexible whitespace match") {
+		t.Errorf("report = %q, want per-edit match kinds", text)
+	}
+	data, _ := os.ReadFile(path)
+	if want := "func main() {\n\tdefer cleanup()\n\tfmt.Println(\"bye\")\n}\n"; string(data) != want {
+		t.Errorf("file = %q, want %q", data, want)
+	}
+
+	decodeResult(t, call(t, "tools/call", map[string]interface{}{
+		"name": "edit_file",
+		"arguments": map[string]interface{}{
+			"path": path,
+			"edits": []interface{}{
+				map[string]interface{}{"oldText": "defer cleanup()", "newText": "defer close()"},
+				map[string]interface{}{"oldText": "os.Exit(1)", "newText": "os.Exit(2)", "flexibleWhitespace": true},
+			},
+		},
+	}), &result)
+	if !result.IsError || !strings.Contains(result.Content[0].Text, "Edit 2 failed") {
+		t.Errorf("result = %+v, want Edit 2 to fail", result)
+	}
+	after, _ := os.ReadFile(path)
+	if string(after) != string(data) {
+		t.Errorf("file changed after failed edit: %q", after)
+	}
+}
+
+func moveFile(t *testing.T, args map[string]interface{}) ToolResult {
+	t.Helper()
+
+	var result ToolResult
+	decodeResult(t, call(t, "tools/call", map[string]interface{}{
+		"name":      "move_file",
+		"arguments": args,
+	}), &result)
+	return result
+}
+
+func writeFiles(t *testing.T, files map[string]string) {
+	t.Helper()
+
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+}
+
+func TestMoveFileRefusesExistingDestination(t *testing.T) {
+	dir := setupAllowedDir(t)
+	src := filepath.Join(dir, "src.txt")
+	dest := filepath.Join(dir, "dest.txt")
+	writeFiles(t, map[string]string{src: "new", dest: "old"})
+
+	result := moveFile(t, map[string]interface{}{"source": src, "destination": dest})
+	if !result.IsError || !strings.Contains(result.Content[0].Text, "already exists") {
+		t.Fatalf("result = %+v, want already-exists error", result)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "old" {
+		t.Errorf("dest = %q, want it untouched", data)
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Errorf("source was moved: %v", err)
+	}
+
+	result = moveFile(t, map[string]interface{}{"source": src, "destination": dest, "overwrite": true})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %+v", result.Content)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "new" {
+		t.Errorf("dest = %q, want %q", data, "new")
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("source still exists after move: %v", err)
+	}
+}
+
+func TestMoveFileSymlinkAtDestination(t *testing.T) {
+	dir := setupAllowedDir(t)
+	src := filepath.Join(dir, "src.txt")
+	target := filepath.Join(dir, "target.txt")
+	link := filepath.Join(dir, "link.txt")
+	dangling := filepath.Join(dir, "dangling.txt")
+	writeFiles(t, map[string]string{src: "new", target: "target"})
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "missing.txt"), dangling); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dest := range []string{link, dangling} {
+		result := moveFile(t, map[string]interface{}{"source": src, "destination": dest})
+		if !result.IsError || !strings.Contains(result.Content[0].Text, "already exists") {
+			t.Errorf("move to %s: result = %+v, want already-exists error", filepath.Base(dest), result)
+		}
+	}
+
+	result := moveFile(t, map[string]interface{}{"source": src, "destination": link, "overwrite": true})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %+v", result.Content)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink != 0 {
+		t.Errorf("link was not replaced by a regular file: %v, %v", info, err)
+	}
+	if data, _ := os.ReadFile(link); string(data) != "new" {
+		t.Errorf("link = %q, want %q", data, "new")
+	}
+	if data, _ := os.ReadFile(target); string(data) != "target" {
+		t.Errorf("symlink target = %q, want it untouched", data)
+	}
+}
+
+func directoryTree(t *testing.T, args map[string]interface{}) []map[string]interface{} {
+	t.Helper()
+
+	var result ToolResult
+	decodeResult(t, call(t, "tools/call", map[string]interface{}{
+		"name":      "directory_tree",
+		"arguments": args,
+	}), &result)
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %+v", result.Content)
+	}
+	var tree []map[string]interface{}
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &tree); err != nil {
+		t.Fatalf("Unmarshal tree: %v", err)
+	}
+	return tree
+}
+
+// findEntry returns the entry named name in entries.
+func findEntry(t *testing.T, entries []map[string]interface{}, name string) map[string]interface{} {
+	t.Helper()
+
+	for _, e := range entries {
+		if e["name"] == name {
+			return e
+		}
+	}
+	t.Fatalf("no entry %q in %v", name, entries)
+	return nil
+}
+
+func children(e map[string]interface{}) []map[string]interface{} {
+	raw, _ := e["children"].([]interface{})
+	var out []map[string]interface{}
+	for _, c := range raw {
+		out = append(out, c.(map[string]interface{}))
+	}
+	return out
+}
+
+func TestDirectoryTreeSizesAndTimes(t *testing.T) {
+	dir := setupAllowedDir(t)
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{
+		filepath.Join(dir, "a.txt"):        "hello",
+		filepath.Join(dir, "sub", "b.txt"): "",
+	})
+	mtime := time.Unix(1700000000, 0)
+	if err := os.Chtimes(filepath.Join(dir, "a.txt"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	plain := findEntry(t, directoryTree(t, map[string]interface{}{"path": dir}), "a.txt")
+	if _, ok := plain["sizeBytes"]; ok {
+		t.Errorf("sizeBytes present without includeSize: %v", plain)
+	}
+	if _, ok := plain["modifiedUnix"]; ok {
+		t.Errorf("modifiedUnix present without includeModified: %v", plain)
+	}
+
+	tree := directoryTree(t, map[string]interface{}{"path": dir, "includeSize": true, "includeModified": true})
+	a := findEntry(t, tree, "a.txt")
+	if a["sizeBytes"] != float64(5) || a["modifiedUnix"] != float64(1700000000) {
+		t.Errorf("a.txt = %v, want sizeBytes 5 and modifiedUnix 1700000000", a)
+	}
+	b := findEntry(t, children(findEntry(t, tree, "sub")), "b.txt")
+	if b["sizeBytes"] != float64(0) {
+		t.Errorf("empty file = %v, want sizeBytes 0", b)
+	}
+	if _, ok := findEntry(t, tree, "sub")["sizeBytes"]; ok {
+		t.Error("directory has sizeBytes")
+	}
+}
+
+func TestDirectoryTreeMaxDepth(t *testing.T) {
+	dir := setupAllowedDir(t)
+	if err := os.MkdirAll(filepath.Join(dir, "a", "b", "c"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	a := findEntry(t, directoryTree(t, map[string]interface{}{"path": dir, "maxDepth": 1}), "a")
+	if a["truncated"] != true || a["children"] != nil {
+		t.Errorf("a = %v, want it truncated without children", a)
+	}
+
+	a = findEntry(t, directoryTree(t, map[string]interface{}{"path": dir, "maxDepth": 2}), "a")
+	b := findEntry(t, children(a), "b")
+	if b["truncated"] != true || b["children"] != nil {
+		t.Errorf("b = %v, want it truncated without children", b)
+	}
+
+	a = findEntry(t, directoryTree(t, map[string]interface{}{"path": dir}), "a")
+	c := findEntry(t, children(findEntry(t, children(a), "b")), "c")
+	if _, ok := c["truncated"]; ok {
+		t.Errorf("c = %v, want no truncation without maxDepth", c)
+	}
+
+	resp := call(t, "tools/call", map[string]interface{}{
+		"name":      "directory_tree",
+		"arguments": map[string]interface{}{"path": dir, "maxDepth": 0},
+	})
+	if resp.Error == nil {
+		t.Error("maxDepth 0: want an invalid arguments error")
+	}
+}
+
+func searchFiles(t *testing.T, args map[string]interface{}) []string {
+	t.Helper()
+
+	var result ToolResult
+	decodeResult(t, call(t, "tools/call", map[string]interface{}{
+		"name":      "search_files",
+		"arguments": args,
+	}), &result)
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %+v", result.Content)
+	}
+	if result.Content[0].Text == "No matches found" {
+		return nil
+	}
+	return strings.Split(result.Content[0].Text, "\n")
+}
+
+func TestSearchFilesMaxDepth(t *testing.T) {
+	dir := setupAllowedDir(t)
+	if err := os.MkdirAll(filepath.Join(dir, "a", "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{
+		filepath.Join(dir, "top.go"):            "",
+		filepath.Join(dir, "a", "mid.go"):       "",
+		filepath.Join(dir, "a", "b", "deep.go"): "",
+	})
+
+	tests := []struct {
+		maxDepth interface{}
+		want     int
+	}{
+		{nil, 3},
+		{1, 1},
+		{2, 2},
+	}
+	for _, tt := range tests {
+		args := map[string]interface{}{"path": dir, "pattern": "*.go"}
+		if tt.maxDepth != nil {
+			args["maxDepth"] = tt.maxDepth
+		}
+		if got := searchFiles(t, args); len(got) != tt.want {
+			t.Errorf("maxDepth %v: matches = %q, want %d", tt.maxDepth, got, tt.want)
+		}
+	}
+}
+
+func TestSearchFilesSymlinks(t *testing.T) {
+	dir := setupAllowedDir(t)
+	outside := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "real"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{
+		filepath.Join(dir, "real", "inside.txt"): "",
+		filepath.Join(outside, "secret.txt"):     "",
+	})
+	if err := os.Symlink(outside, filepath.Join(dir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "real"), filepath.Join(dir, "alias")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(dir, filepath.Join(dir, "real", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	got := searchFiles(t, map[string]interface{}{"path": dir, "pattern": "*.txt"})
+	if want := []string{filepath.Join(dir, "real", "inside.txt")}; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("default matches = %q, want %q", got, want)
+	}
+
+	got = searchFiles(t, map[string]interface{}{"path": dir, "pattern": "*.txt", "followSymlinks": true})
+	for _, m := range got {
+		if strings.Contains(m, "secret") {
+			t.Errorf("followed symlink outside allowed dirs: %q", got)
+		}
+	}
+	// alias/ and real/ are the same directory, so it is listed once, via
+	// the first path to reach it.
+	if want := filepath.Join(dir, "alias", "inside.txt"); len(got) != 1 || got[0] != want {
+		t.Errorf("followSymlinks matches = %q, want [%q]", got, want)
+	}
+}
+
+func statFiles(t *testing.T, paths ...string) []FileStat {
+	t.Helper()
+
+	var result ToolResult
+	decodeResult(t, call(t, "tools/call", map[string]interface{}{
+		"name":      "stat_files",
+		"arguments": map[string]interface{}{"paths": paths},
+	}), &result)
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %+v", result.Content)
+	}
+	var stats []FileStat
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &stats); err != nil {
+		t.Fatalf("Unmarshal stats: %v", err)
+	}
+	return stats
+}
+
+func TestStatFilesMixedExistence(t *testing.T) {
+	dir := setupAllowedDir(t)
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "a.txt")
+	writeFiles(t, map[string]string{file: "hello"})
+	mtime := time.Unix(1700000000, 0)
+	if err := os.Chtimes(file, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "gone.txt")
+
+	stats := statFiles(t, file, missing, filepath.Join(dir, "sub"))
+	if len(stats) != 3 {
+		t.Fatalf("got %d stats, want 3: %+v", len(stats), stats)
+	}
+	want := FileStat{Path: file, Exists: true, SizeBytes: 5, ModifiedUnix: 1700000000, Type: "file"}
+	if stats[0] != want {
+		t.Errorf("stats[0] = %+v, want %+v", stats[0], want)
+	}
+	if stats[1] != (FileStat{Path: missing}) {
+		t.Errorf("stats[1] = %+v, want a missing entry", stats[1])
+	}
+	if !stats[2].Exists || stats[2].Type != "directory" {
+		t.Errorf("stats[2] = %+v, want an existing directory", stats[2])
+	}
+
+	// A change to the file shows up on the next poll.
+	writeFiles(t, map[string]string{file: "hello, world"})
+	if got := statFiles(t, file)[0]; got.SizeBytes != 12 || got.ModifiedUnix == want.ModifiedUnix {
+		t.Errorf("after write = %+v, want new size and mtime", got)
+	}
+}
+
+func TestStatFilesReportsEmptyFiles(t *testing.T) {
+	dir := setupAllowedDir(t)
+	file := filepath.Join(dir, "empty.txt")
+	writeFiles(t, map[string]string{file: ""})
+
+	var result ToolResult
+	decodeResult(t, call(t, "tools/call", map[string]interface{}{
+		"name":      "stat_files",
+		"arguments": map[string]interface{}{"paths": []string{file}},
+	}), &result)
+	if !strings.Contains(result.Content[0].Text, `"sizeBytes": 0`) {
+		t.Errorf("stat = %s, want sizeBytes 0", result.Content[0].Text)
+	}
+}
+
+func TestStatFilesRejectsPathsOutsideAllowedDirs(t *testing.T) {
+	dir := setupAllowedDir(t)
+
+	resp := call(t, "tools/call", map[string]interface{}{
+		"name":      "stat_files",
+		"arguments": map[string]interface{}{"paths": []string{filepath.Join(dir, "a.txt"), filepath.Dir(dir)}},
+	})
+	if resp.Error == nil || resp.Error.Message != "Access denied" {
+		t.Errorf("response = %+v, want Access denied", resp)
+	}
+}
+
+func TestToToolErrorClassifiesOSErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"not exist", fmt.Errorf("Failed to read file: %w", &fs.PathError{Op: "open", Path: "/x", Err: syscall.ENOENT}), codeNotFound},
+		{"permission", fmt.Errorf("Failed to write file: %w", &fs.PathError{Op: "open", Path: "/x", Err: syscall.EACCES}), codePermissionDenied},
+		{"exists", fmt.Errorf("Failed to create directory: %w", &fs.PathError{Op: "mkdir", Path: "/x", Err: syscall.EEXIST}), codeAlreadyExists},
+		{"other", fmt.Errorf("Failed to read directory: %w", &fs.PathError{Op: "readdirent", Path: "/x", Err: syscall.EIO}), codeUpstreamError},
+		{"already classified", &ToolError{Code: codeInvalidArgument, Message: "bad"}, codeInvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := toToolError(tt.err)
+			if got.Code != tt.want || got.Message != tt.err.Error() {
+				t.Errorf("toToolError = %+v, want code %q and message %q", got, tt.want, tt.err.Error())
+			}
+		})
+	}
+}
+
+// toolError calls a tool that is expected to fail and decodes its ToolError.
+func toolError(t *testing.T, name string, args map[string]interface{}) ToolError {
+	t.Helper()
+
+	var result ToolResult
+	decodeResult(t, call(t, "tools/call", map[string]interface{}{
+		"name":      name,
+		"arguments": args,
+	}), &result)
+	if !result.IsError {
+		t.Fatalf("%s succeeded, want an error: %+v", name, result.Content)
+	}
+	var te ToolError
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &te); err != nil {
+		t.Fatalf("Unmarshal ToolError from %q: %v", result.Content[0].Text, err)
+	}
+	return te
+}
+
+func TestToolErrorCodes(t *testing.T) {
+	dir := setupAllowedDir(t)
+	file := filepath.Join(dir, "a.txt")
+	writeFiles(t, map[string]string{file: "hello", filepath.Join(dir, "b.txt"): "bye"})
+
+	tests := []struct {
+		name string
+		tool string
+		args map[string]interface{}
+		want string
+	}{
+		{"read missing file", "read_text_file", map[string]interface{}{"path": filepath.Join(dir, "missing.txt")}, codeNotFound},
+		{"info on missing file", "get_file_info", map[string]interface{}{"path": filepath.Join(dir, "missing.txt")}, codeNotFound},
+		{"list a file as a directory", "list_directory", map[string]interface{}{"path": file}, codeUpstreamError},
+		{"move onto existing file", "move_file", map[string]interface{}{"source": file, "destination": filepath.Join(dir, "b.txt")}, codeAlreadyExists},
+		{"edit without a match", "edit_file", map[string]interface{}{"path": file, "edits": []interface{}{map[string]interface{}{"oldText": "absent", "newText": "x"}}}, codeInvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := toolError(t, tt.tool, tt.args); got.Code != tt.want {
+				t.Errorf("code = %q (%s), want %q", got.Code, got.Message, tt.want)
+			}
+		})
+	}
+
+	if os.Geteuid() != 0 {
+		if err := os.Chmod(file, 0); err != nil {
+			t.Fatal(err)
+		}
+		if got := toolError(t, "read_text_file", map[string]interface{}{"path": file}); got.Code != codePermissionDenied {
+			t.Errorf("unreadable file code = %q, want %q", got.Code, codePermissionDenied)
+		}
+	}
+}
+
+func setPermissions(t *testing.T, args map[string]interface{}) ToolResult {
+	t.Helper()
+
+	var result ToolResult
+	decodeResult(t, call(t, "tools/call", map[string]interface{}{
+		"name":      "set_permissions",
+		"arguments": args,
+	}), &result)
+	return result
+}
+
+func assertPerm(t *testing.T, path string, want os.FileMode) {
+	t.Helper()
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode().Perm(); got != want {
+		t.Errorf("%s mode = %04o, want %04o", path, got, want)
+	}
+}
+
+func TestSetPermissions(t *testing.T) {
+	dir := setupAllowedDir(t)
+	secret := filepath.Join(dir, "secret.env")
+	writeFiles(t, map[string]string{secret: "TOKEN=x"})
+
+	for _, mode := range []string{"600", "0640", "0o755"} {
+		result := setPermissions(t, map[string]interface{}{"path": secret, "mode": mode})
+		if result.IsError {
+			t.Fatalf("set_permissions %s: %+v", mode, result.Content)
+		}
+		want, _ := parseMode(mode)
+		assertPerm(t, secret, want)
+	}
+}
+
+func TestSetPermissionsRecursive(t *testing.T) {
+	dir := setupAllowedDir(t)
+	tree := filepath.Join(dir, "keys")
+	sub := filepath.Join(tree, "sub")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(dir, "outside.txt")
+	writeFiles(t, map[string]string{
+		filepath.Join(tree, "a.pem"): "a",
+		filepath.Join(sub, "b.pem"):  "b",
+		outside:                      "keep",
+	})
+	if err := os.Chmod(outside, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(tree, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 0600 on the directories would stop a walk that changed them first.
+	result := setPermissions(t, map[string]interface{}{"path": tree, "mode": "600", "recursive": true})
+	if result.IsError {
+		t.Fatalf("set_permissions: %+v", result.Content)
+	}
+	if !strings.Contains(result.Content[0].Text, "(4 entries)") {
+		t.Errorf("text = %q, want 4 entries changed", result.Content[0].Text)
+	}
+	for _, p := range []string{tree, sub} {
+		assertPerm(t, p, 0600)
+		if err := os.Chmod(p, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertPerm(t, filepath.Join(tree, "a.pem"), 0600)
+	assertPerm(t, filepath.Join(sub, "b.pem"), 0600)
+	assertPerm(t, outside, 0644)
+}
+
+func TestSetPermissionsRejectsBadArguments(t *testing.T) {
+	dir := setupAllowedDir(t)
+	file := filepath.Join(dir, "a.txt")
+	writeFiles(t, map[string]string{file: "a"})
+	if err := os.Chmod(file, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range []map[string]interface{}{
+		{"path": file},
+		{"path": file, "mode": ""},
+		{"path": file, "mode": "rwx"},
+		{"path": file, "mode": "0999"},
+		{"path": file, "mode": "4755"},
+		{"path": "/etc/hostname", "mode": "600"},
+	} {
+		resp := call(t, "tools/call", map[string]interface{}{"name": "set_permissions", "arguments": args})
+		if resp.Error == nil || resp.Error.Code != -32602 {
+			t.Errorf("set_permissions(%v) = %+v, want an invalid-arguments error", args, resp)
+		}
+	}
+	assertPerm(t, file, 0644)
+
+	if got := toolError(t, "set_permissions", map[string]interface{}{"path": filepath.Join(dir, "missing"), "mode": "600"}); got.Code != codeNotFound {
+		t.Errorf("missing path code = %q, want %q", got.Code, codeNotFound)
+	}
+}
+
+func createSymlink(t *testing.T, args map[string]interface{}) ToolResult {
+	t.Helper()
+
+	var result ToolResult
+	decodeResult(t, call(t, "tools/call", map[string]interface{}{
+		"name":      "create_symlink",
+		"arguments": args,
+	}), &result)
+	return result
+}
+
+func TestCreateSymlink(t *testing.T) {
+	dir := setupAllowedDir(t)
+	shared := filepath.Join(dir, "shared")
+	project := filepath.Join(dir, "project")
+	for _, d := range []string{shared, project} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFiles(t, map[string]string{filepath.Join(shared, "config.json"): "{}"})
+
+	tests := []struct {
+		target, link string
+	}{
+		{shared, filepath.Join(project, "abs")},
+		{"../shared", filepath.Join(project, "rel")},
+		{filepath.Join(dir, "not-yet"), filepath.Join(project, "dangling")},
+	}
+	for _, tt := range tests {
+		if result := createSymlink(t, map[string]interface{}{"target": tt.target, "link_path": tt.link}); result.IsError {
+			t.Fatalf("create_symlink(%s, %s): %+v", tt.target, tt.link, result.Content)
+		}
+		got, err := os.Readlink(tt.link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.target {
+			t.Errorf("Readlink(%s) = %q, want %q", tt.link, got, tt.target)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(project, "rel", "config.json"))
+	if err != nil || string(data) != "{}" {
+		t.Errorf("reading through relative link = %q, %v", data, err)
+	}
+
+	if got := toolError(t, "create_symlink", map[string]interface{}{"target": shared, "link_path": filepath.Join(project, "abs")}); got.Code != codeAlreadyExists {
+		t.Errorf("existing link_path code = %q, want %q", got.Code, codeAlreadyExists)
+	}
+}
+
+func TestCreateSymlinkRejectsTargetsOutsideAllowedDirs(t *testing.T) {
+	dir := setupAllowedDir(t)
+	outside, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	escape := filepath.Join(dir, "escape")
+	if err := os.Symlink(outside, escape); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+
+	for _, args := range []map[string]interface{}{
+		{"link_path": link},
+		{"target": "", "link_path": link},
+		{"target": dir},
+		{"target": "/etc/passwd", "link_path": link},
+		{"target": outside, "link_path": link},
+		{"target": "../" + filepath.Base(outside), "link_path": link},
+		{"target": "escape/secret", "link_path": link},
+		{"target": dir, "link_path": filepath.Join(outside, "link")},
+	} {
+		resp := call(t, "tools/call", map[string]interface{}{"name": "create_symlink", "arguments": args})
+		if resp.Error == nil || resp.Error.Code != -32602 {
+			t.Errorf("create_symlink(%v) = %+v, want an invalid-arguments error", args, resp)
+		}
+	}
+	if _, err := os.Lstat(link); !os.IsNotExist(err) {
+		t.Errorf("Lstat(%s) = %v, want the link not to exist", link, err)
+	}
+}
@@ -2,18 +2,30 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime"
+	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/soyeahso/hunter3/internal/logfile"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
@@ -73,8 +85,10 @@ type ToolResult struct {
 }
 
 type ContentItem struct {
-	Type string `json:"type"`
-	Text string `json:"text,omitempty"`
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Data     string `json:"data,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
 }
 
 type InitializeResult struct {
@@ -99,20 +113,8 @@ type ListToolsResult struct {
 var logger *log.Logger
 
 func initLogger() {
-	logsDir := filepath.Join(os.Getenv("HOME"), ".hunter3", "logs")
-	if err := os.MkdirAll(logsDir, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create logs directory: %v\n", err)
-		return
-	}
-
-	logFile := filepath.Join(logsDir, "mcp-gdrive.log")
-	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to open log file: %v\n", err)
-		return
-	}
-
-	logger = log.New(io.MultiWriter(f, os.Stderr), "[mcp-gdrive] ", log.LstdFlags)
+	// Log to stderr and to a file rotated by size and readable only by the owner
+	logger = logfile.NewLogger("mcp-gdrive")
 	logger.Println("MCP Google Drive server starting...")
 }
 
@@ -127,11 +129,38 @@ func main() {
 		}
 	}
 
+	if v := os.Getenv("HUNTER3_GDRIVE_TIMEOUT"); v != "" {
+		timeout, err := parseTimeout(v)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		driveTimeout = timeout
+	}
+
 	server := &MCPServer{}
 	logger.Println("Server initialized")
 	server.Run()
 }
 
+// parseTimeout reads HUNTER3_GDRIVE_TIMEOUT, given as a Go duration ("45s",
+// "5m") or a whole number of seconds. Zero disables the timeout.
+func parseTimeout(v string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, fmt.Errorf("invalid HUNTER3_GDRIVE_TIMEOUT %q: must not be negative", v)
+		}
+		return time.Duration(secs) * time.Second, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid HUNTER3_GDRIVE_TIMEOUT %q: use a duration like 45s or a number of seconds", v)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid HUNTER3_GDRIVE_TIMEOUT %q: must not be negative", v)
+	}
+	return d, nil
+}
+
 func runAuth() {
 	credentialsPath := os.Getenv("GDRIVE_CREDENTIALS_FILE")
 	if credentialsPath == "" {
@@ -145,7 +174,13 @@ func runAuth() {
 		os.Exit(1)
 	}
 
-	config, err := google.ConfigFromJSON(b, drive.DriveScope, drive.DriveFileScope, drive.DriveMetadataReadonlyScope)
+	scopes, _, err := scopesFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	config, err := google.ConfigFromJSON(b, scopes...)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Unable to parse credentials: %v\n", err)
 		os.Exit(1)
@@ -153,8 +188,9 @@ func runAuth() {
 
 	tokenPath := filepath.Join(os.Getenv("HOME"), ".hunter3", "gdrive-token.json")
 
-	// Check if token already exists
-	if _, err := tokenFromFile(tokenPath); err == nil {
+	// Check if a usable token already exists; a token without a refresh token
+	// cannot outlive its access token, so re-authenticate in that case.
+	if tok, err := tokenFromFile(tokenPath); err == nil && tok.RefreshToken != "" {
 		fmt.Println("Already authenticated. Token exists at", tokenPath)
 		fmt.Println("To re-authenticate, delete the token first:")
 		fmt.Println("  rm", tokenPath)
@@ -167,13 +203,79 @@ func runAuth() {
 		os.Exit(1)
 	}
 
-	saveToken(tokenPath, token)
+	if err := saveToken(tokenPath, token); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save token: %v\n", err)
+		os.Exit(1)
+	}
 	fmt.Println("\nAuthentication successful! Token saved to", tokenPath)
 	fmt.Println("You can now use mcp-gdrive as an MCP server.")
 }
 
+// driveScopes maps the names accepted in GDRIVE_SCOPES to OAuth scopes.
+var driveScopes = map[string]string{
+	"drive":                   drive.DriveScope,
+	"drive.file":              drive.DriveFileScope,
+	"drive.readonly":          drive.DriveReadonlyScope,
+	"drive.metadata.readonly": drive.DriveMetadataReadonlyScope,
+}
+
+// defaultScopes are requested when GDRIVE_SCOPES is unset.
+var defaultScopes = []string{"drive", "drive.file", "drive.metadata.readonly"}
+
+// parseScopes turns a comma-separated list of scope names into OAuth scopes,
+// and reports whether they are all read-only, in which case the server
+// refuses write tools.
+func parseScopes(value string) ([]string, bool, error) {
+	names := defaultScopes
+	if strings.TrimSpace(value) != "" {
+		names = nil
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return nil, false, fmt.Errorf("GDRIVE_SCOPES %q names no scopes", value)
+		}
+	}
+
+	var scopes []string
+	readOnly := true
+	for _, name := range names {
+		scope, ok := driveScopes[name]
+		if !ok {
+			return nil, false, fmt.Errorf("unknown scope %q in GDRIVE_SCOPES: use drive, drive.file, drive.readonly, or drive.metadata.readonly", name)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+		if !strings.HasSuffix(name, "readonly") {
+			readOnly = false
+		}
+	}
+	return scopes, readOnly, nil
+}
+
+func scopesFromEnv() ([]string, bool, error) {
+	return parseScopes(os.Getenv("GDRIVE_SCOPES"))
+}
+
+// writeTools are the tools that change Drive, refused in read-only mode.
+var writeTools = map[string]bool{
+	"upload_file":         true,
+	"update_file_content": true,
+	"create_folder":       true,
+	"create_shortcut":     true,
+	"delete_file":         true,
+	"restore_file":        true,
+	"empty_trash":         true,
+	"share_file":          true,
+	"revoke_permission":   true,
+}
+
 type MCPServer struct {
 	driveService *drive.Service
+	readOnly     bool
 }
 
 func (s *MCPServer) Run() {
@@ -264,7 +366,12 @@ func (s *MCPServer) initDriveService() error {
 		return fmt.Errorf("unable to read credentials file: %w", err)
 	}
 
-	config, err := google.ConfigFromJSON(b, drive.DriveScope, drive.DriveFileScope, drive.DriveMetadataReadonlyScope)
+	scopes, readOnly, err := scopesFromEnv()
+	if err != nil {
+		return err
+	}
+
+	config, err := google.ConfigFromJSON(b, scopes...)
 	if err != nil {
 		return fmt.Errorf("unable to parse credentials: %w", err)
 	}
@@ -274,18 +381,247 @@ func (s *MCPServer) initDriveService() error {
 	if err != nil {
 		return fmt.Errorf("no auth token found at %s - run 'mcp-gdrive --auth' to authenticate first", tokenPath)
 	}
+	if token.RefreshToken == "" && !token.Valid() {
+		return reauthError(tokenPath, fmt.Errorf("access token expired and no refresh token is stored"))
+	}
 
-	client := config.Client(ctx, token)
+	// The token source refreshes expired access tokens using the refresh
+	// token and writes each new token back to disk, so long-running servers
+	// keep working past the first access token's lifetime.
+	ts := &persistingTokenSource{
+		base: config.TokenSource(ctx, token),
+		path: tokenPath,
+		last: token,
+	}
+	client := oauth2.NewClient(ctx, oauth2.ReuseTokenSource(token, ts))
 	s.driveService, err = drive.NewService(ctx, option.WithHTTPClient(client))
 	if err != nil {
 		return fmt.Errorf("unable to create Drive service: %w", err)
 	}
+	s.readOnly = readOnly
+	if readOnly {
+		logger.Println("Read-only scopes selected; write tools are disabled")
+	}
 
 	return nil
 }
 
+// Each Drive API attempt must finish within driveTimeout (set by
+// HUNTER3_GDRIVE_TIMEOUT; zero disables it), except for file content, which
+// gets longer; see downloadContent, transferTimeout, and uploadFile. Rate-limited and
+// failed attempts are retried up to driveMaxAttempts times in total. These
+// are variables so tests can shorten them.
+var (
+	driveTimeout     = 2 * time.Minute
+	driveMaxAttempts = 4
+	driveRetryBase   = time.Second
+	driveMaxBackoff  = 30 * time.Second
+)
+
+// driveDo runs fn, which issues one idempotent Drive request bound to the
+// context it is given. Rate-limit (429, or 403 rateLimitExceeded) and 5xx
+// responses are retried with exponential backoff, or after the server's
+// Retry-After when it sends one. fn is called afresh for each attempt, so it
+// must build any media reader inside.
+func driveDo(fn func(ctx context.Context) error) error {
+	return driveRetry(fn, true, driveTimeout)
+}
+
+// driveCreate is driveDo for requests that create something, such as a file
+// or a permission. Only rate-limit responses are retried, since the server
+// rejected those without acting; after a 5xx the change may already have
+// been made, and repeating the request could create it twice.
+func driveCreate(fn func(ctx context.Context) error) error {
+	return driveRetry(fn, false, driveTimeout)
+}
+
+// driveRetry runs fn with retries, giving each attempt timeout, or no
+// deadline when timeout is zero.
+func driveRetry(fn func(ctx context.Context) error, retryServerErrors bool, timeout time.Duration) error {
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(context.Background(), timeout)
+		}
+		err := fn(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			if timeout == 0 {
+				// Only downloadContent's wait for headers has a deadline.
+				timeout = driveTimeout
+			}
+			return fmt.Errorf("drive API request timed out after %s: %w", timeout, err)
+		}
+
+		delay, ok := retryDelay(err, attempt)
+		var apiErr *googleapi.Error
+		if ok && !retryServerErrors && errors.As(err, &apiErr) && !isRateLimited(apiErr) {
+			ok = false
+		}
+		if !ok || attempt+1 >= driveMaxAttempts {
+			return err
+		}
+		logger.Printf("Drive API request failed (%v), retrying in %s\n", err, delay)
+		time.Sleep(delay)
+	}
+}
+
+// downloadContent fetches file content with download, retrying like
+// driveDo. driveTimeout bounds each attempt only until the response headers
+// arrive; reading the body may take as long as the file needs.
+func downloadContent(download func(ctx context.Context) (*http.Response, error)) ([]byte, error) {
+	var content []byte
+	err := driveRetry(func(ctx context.Context) error {
+		resp, err := headersWithin(ctx, driveTimeout, download)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		content, err = io.ReadAll(resp.Body)
+		return err
+	}, true, 0)
+	return content, err
+}
+
+// headersWithin calls download, failing with context.DeadlineExceeded if it
+// has not returned the response headers within timeout. The deadline is
+// lifted once they arrive.
+func headersWithin(ctx context.Context, timeout time.Duration, download func(ctx context.Context) (*http.Response, error)) (*http.Response, error) {
+	if timeout <= 0 {
+		return download(ctx)
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	timer := time.AfterFunc(timeout, func() { cancel(context.DeadlineExceeded) })
+	resp, err := download(ctx)
+	if !timer.Stop() {
+		if err == nil {
+			resp.Body.Close()
+		}
+		cancel(nil)
+		return nil, context.DeadlineExceeded
+	}
+	if err != nil {
+		cancel(nil)
+		return nil, err
+	}
+	resp.Body = cancelOnClose{resp.Body, func() { cancel(nil) }}
+	return resp, nil
+}
+
+// cancelOnClose releases a response's context when its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel func()
+}
+
+func (b cancelOnClose) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// minTransferRate is the slowest upload rate, in bytes per second, that
+// transferTimeout allows for.
+const minTransferRate = 64 << 10
+
+// transferTimeout is the deadline for one attempt at a request that uploads
+// size bytes: driveTimeout plus the time to send them at minTransferRate.
+func transferTimeout(size int64) time.Duration {
+	if driveTimeout <= 0 {
+		return 0
+	}
+	return driveTimeout + time.Duration(size/minTransferRate)*time.Second
+}
+
+// retryDelay reports whether err is worth retrying and, if so, how long to
+// wait after the given (zero-based) attempt.
+func retryDelay(err error, attempt int) (time.Duration, bool) {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || !isRetryable(apiErr) {
+		return 0, false
+	}
+
+	delay := driveRetryBase << attempt
+	if after := apiErr.Header.Get("Retry-After"); after != "" {
+		if secs, err := strconv.Atoi(after); err == nil && secs >= 0 {
+			delay = time.Duration(secs) * time.Second
+		} else if at, err := http.ParseTime(after); err == nil {
+			delay = time.Until(at)
+		}
+	}
+	if delay > driveMaxBackoff {
+		delay = driveMaxBackoff
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return delay, true
+}
+
+// isRetryable reports whether a Drive API error is transient.
+func isRetryable(err *googleapi.Error) bool {
+	return err.Code >= 500 || isRateLimited(err)
+}
+
+// isRateLimited reports whether err rejected the request for exceeding a
+// rate limit. Drive signals some rate limiting with 403 and a
+// rateLimitExceeded reason.
+func isRateLimited(err *googleapi.Error) bool {
+	if err.Code == http.StatusTooManyRequests {
+		return true
+	}
+	if err.Code == http.StatusForbidden {
+		for _, item := range err.Errors {
+			if item.Reason == "rateLimitExceeded" || item.Reason == "userRateLimitExceeded" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// persistingTokenSource wraps a refreshing token source and saves every newly
+// issued token to path so refreshed credentials survive restarts.
+type persistingTokenSource struct {
+	base oauth2.TokenSource
+	path string
+
+	mu   sync.Mutex
+	last *oauth2.Token
+}
+
+func (p *persistingTokenSource) Token() (*oauth2.Token, error) {
+	tok, err := p.base.Token()
+	if err != nil {
+		logger.Printf("Failed to refresh OAuth token: %v\n", err)
+		return nil, reauthError(p.path, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.last == nil || tok.AccessToken != p.last.AccessToken {
+		logger.Println("OAuth token refreshed")
+		if err := saveToken(p.path, tok); err != nil {
+			logger.Printf("Failed to persist refreshed token: %v\n", err)
+		}
+		p.last = tok
+	}
+	return tok, nil
+}
+
+// reauthError explains how to recover when the stored token can no longer be
+// refreshed, e.g. because the refresh token is missing or was revoked.
+func reauthError(tokenPath string, err error) error {
+	return fmt.Errorf("Google Drive authorization is no longer valid (%v) - delete %s and re-run 'mcp-gdrive --auth'", err, tokenPath)
+}
+
 func getTokenFromWeb(config *oauth2.Config) (*oauth2.Token, error) {
-	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
+	// Force the consent screen so Google always issues a refresh token, even
+	// when the user has authorized this client before.
+	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline, oauth2.ApprovalForce)
 	fmt.Printf("Go to the following link in your browser then type the authorization code: \n%v\n", authURL)
 
 	var authCode string
@@ -318,7 +654,9 @@ func saveToken(path string, token *oauth2.Token) error {
 		return fmt.Errorf("unable to cache oauth token: %w", err)
 	}
 	defer f.Close()
-	json.NewEncoder(f).Encode(token)
+	if err := json.NewEncoder(f).Encode(token); err != nil {
+		return fmt.Errorf("unable to cache oauth token: %w", err)
+	}
 	return nil
 }
 
@@ -344,6 +682,18 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 						Type:        "string",
 						Description: "List files in a specific folder by folder ID (optional)",
 					},
+					"drive_id": {
+						Type:        "string",
+						Description: "ID of a shared drive to search within (optional). Use list_shared_drives to find IDs.",
+					},
+					"order_by": {
+						Type:        "string",
+						Description: "Sort order (optional). Comma-separated keys such as 'modifiedTime desc' or 'folder,name'. Keys: " + strings.Join(orderByKeys, ", "),
+					},
+					"include_trashed": {
+						Type:        "boolean",
+						Description: "Include files in the trash (default: false)",
+					},
 				},
 				Required: []string{},
 			},
@@ -364,7 +714,7 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 		},
 		{
 			Name:        "download_file",
-			Description: "Download a file from Google Drive to local storage. Returns the content for text files or saves binary files to disk.",
+			Description: "Download a file from Google Drive to local storage. Returns the content for text files or saves binary files to disk. Small binary files can be returned inline as base64 with inline=true.",
 			InputSchema: InputSchema{
 				Type: "object",
 				Properties: map[string]Property{
@@ -376,10 +726,50 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 						Type:        "string",
 						Description: "Local path to save the file (optional for text files)",
 					},
+					"inline": {
+						Type:        "boolean",
+						Description: "Return binary files inline as base64 data instead of requiring output_path (max 10 MB)",
+					},
+				},
+				Required: []string{"file_id"},
+			},
+		},
+		{
+			Name:        "list_revisions",
+			Description: "List the stored revisions (prior versions) of a file, oldest first.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"file_id": {
+						Type:        "string",
+						Description: "The ID of the file",
+					},
 				},
 				Required: []string{"file_id"},
 			},
 		},
+		{
+			Name:        "download_revision",
+			Description: "Download a prior version of a file. Returns the content for text files or saves binary files to disk. Use list_revisions to find revision IDs.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"file_id": {
+						Type:        "string",
+						Description: "The ID of the file",
+					},
+					"revision_id": {
+						Type:        "string",
+						Description: "The ID of the revision to download",
+					},
+					"output_path": {
+						Type:        "string",
+						Description: "Local path to save the revision (optional for text files)",
+					},
+				},
+				Required: []string{"file_id", "revision_id"},
+			},
+		},
 		{
 			Name:        "upload_file",
 			Description: "Upload a file to Google Drive from local storage.",
@@ -406,6 +796,32 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 				Required: []string{"file_path"},
 			},
 		},
+		{
+			Name:        "update_file_content",
+			Description: "Replace the content of an existing file in place from local storage, keeping its file ID and sharing settings. Can also rename the file or change its description.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"file_id": {
+						Type:        "string",
+						Description: "The ID of the file to update",
+					},
+					"file_path": {
+						Type:        "string",
+						Description: "Local path to the new content (optional if only changing metadata)",
+					},
+					"name": {
+						Type:        "string",
+						Description: "New name for the file (optional)",
+					},
+					"description": {
+						Type:        "string",
+						Description: "New description for the file (optional)",
+					},
+				},
+				Required: []string{"file_id"},
+			},
+		},
 		{
 			Name:        "create_folder",
 			Description: "Create a new folder in Google Drive.",
@@ -428,9 +844,31 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 				Required: []string{"name"},
 			},
 		},
+		{
+			Name:        "create_shortcut",
+			Description: "Create a shortcut to a file or folder, so it can appear in several folders without being copied.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"target_id": {
+						Type:        "string",
+						Description: "ID of the file or folder the shortcut points to",
+					},
+					"folder_id": {
+						Type:        "string",
+						Description: "ID of the folder to place the shortcut in",
+					},
+					"name": {
+						Type:        "string",
+						Description: "Name of the shortcut (optional, defaults to the target's name)",
+					},
+				},
+				Required: []string{"target_id", "folder_id"},
+			},
+		},
 		{
 			Name:        "delete_file",
-			Description: "Delete a file or folder from Google Drive (moves to trash).",
+			Description: "Delete a file or folder from Google Drive. Moves it to the trash by default; set permanent=true to delete it irreversibly.",
 			InputSchema: InputSchema{
 				Type: "object",
 				Properties: map[string]Property{
@@ -438,10 +876,65 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 						Type:        "string",
 						Description: "The ID of the file or folder to delete",
 					},
+					"permanent": {
+						Type:        "boolean",
+						Description: "Permanently delete the file, skipping the trash (cannot be undone)",
+					},
+				},
+				Required: []string{"file_id"},
+			},
+		},
+		{
+			Name:        "list_trash",
+			Description: "List files and folders in the trash.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"max_results": {
+						Type:        "string",
+						Description: "Maximum number of files to return (default: 20, max: 100)",
+						Default:     "20",
+					},
+					"drive_id": {
+						Type:        "string",
+						Description: "ID of a shared drive whose trash to list (optional)",
+					},
+					"order_by": {
+						Type:        "string",
+						Description: "Sort order (optional), as for list_files",
+					},
+				},
+				Required: []string{},
+			},
+		},
+		{
+			Name:        "restore_file",
+			Description: "Restore a file or folder from the trash.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"file_id": {
+						Type:        "string",
+						Description: "The ID of the trashed file or folder to restore",
+					},
 				},
 				Required: []string{"file_id"},
 			},
 		},
+		{
+			Name:        "empty_trash",
+			Description: "Permanently delete all files in the trash. This cannot be undone.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"drive_id": {
+						Type:        "string",
+						Description: "ID of a shared drive whose trash to empty (optional, defaults to the user's My Drive trash)",
+					},
+				},
+				Required: []string{},
+			},
+		},
 		{
 			Name:        "search_files",
 			Description: "Search for files in Google Drive using advanced query syntax.",
@@ -457,6 +950,18 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 						Description: "Maximum number of results (default: 20, max: 100)",
 						Default:     "20",
 					},
+					"drive_id": {
+						Type:        "string",
+						Description: "ID of a shared drive to search within (optional). Use list_shared_drives to find IDs.",
+					},
+					"order_by": {
+						Type:        "string",
+						Description: "Sort order (optional). Comma-separated keys such as 'modifiedTime desc' or 'folder,name'. Keys: " + strings.Join(orderByKeys, ", "),
+					},
+					"include_trashed": {
+						Type:        "boolean",
+						Description: "Include files in the trash (default: false)",
+					},
 				},
 				Required: []string{"query"},
 			},
@@ -491,47 +996,140 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 				Required: []string{"file_id"},
 			},
 		},
-	}
-
-	result := ListToolsResult{
-		Tools: tools,
-	}
-
-	s.sendResponse(req.ID, result)
-}
-
-func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
-	var params CallToolParams
-	if err := json.Unmarshal(req.Params, &params); err != nil {
-		logger.Printf("Invalid params: %v\n", err)
-		s.sendError(req.ID, -32602, "Invalid params", err.Error())
-		return
-	}
-
-	logger.Printf("Calling tool: %s\n", params.Name)
-
-	if s.driveService == nil {
-		s.sendError(req.ID, -32603, "Internal error", "Drive service not initialized")
-		return
-	}
-
-	switch params.Name {
-	case "list_files":
-		s.listFiles(req.ID, params.Arguments)
-	case "get_file_info":
-		s.getFileInfo(req.ID, params.Arguments)
-	case "download_file":
-		s.downloadFile(req.ID, params.Arguments)
-	case "upload_file":
-		s.uploadFile(req.ID, params.Arguments)
+		{
+			Name:        "list_permissions",
+			Description: "List the permissions (who has access) on a file or folder.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"file_id": {
+						Type:        "string",
+						Description: "The ID of the file or folder",
+					},
+				},
+				Required: []string{"file_id"},
+			},
+		},
+		{
+			Name:        "revoke_permission",
+			Description: "Revoke a permission from a file or folder. Use list_permissions to find the permission ID.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"file_id": {
+						Type:        "string",
+						Description: "The ID of the file or folder",
+					},
+					"permission_id": {
+						Type:        "string",
+						Description: "The ID of the permission to revoke",
+					},
+				},
+				Required: []string{"file_id", "permission_id"},
+			},
+		},
+		{
+			Name:        "list_shared_drives",
+			Description: "List the shared drives (Team Drives) the authenticated user is a member of.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"max_results": {
+						Type:        "string",
+						Description: "Maximum number of shared drives to return (default: 20, max: 100)",
+						Default:     "20",
+					},
+				},
+				Required: []string{},
+			},
+		},
+		{
+			Name:        "get_storage_quota",
+			Description: "Get the Drive storage quota and usage for the authenticated user. Use this to check available space before large uploads.",
+			InputSchema: InputSchema{
+				Type:       "object",
+				Properties: map[string]Property{},
+				Required:   []string{},
+			},
+		},
+	}
+
+	result := ListToolsResult{
+		Tools: tools,
+	}
+
+	s.sendResponse(req.ID, result)
+}
+
+func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
+	var params CallToolParams
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		logger.Printf("Invalid params: %v\n", err)
+		s.sendError(req.ID, -32602, "Invalid params", err.Error())
+		return
+	}
+
+	logger.Printf("Calling tool: %s\n", params.Name)
+
+	if s.driveService == nil {
+		s.sendError(req.ID, -32603, "Internal error", "Drive service not initialized")
+		return
+	}
+
+	if s.readOnly && writeTools[params.Name] {
+		logger.Printf("Refusing %s in read-only mode\n", params.Name)
+		result := ToolResult{
+			Content: []ContentItem{
+				{
+					Type: "text",
+					Text: fmt.Sprintf("Cannot run %s: server is in read-only mode (GDRIVE_SCOPES grants only read-only scopes)", params.Name),
+				},
+			},
+			IsError: true,
+		}
+		s.sendResponse(req.ID, result)
+		return
+	}
+
+	switch params.Name {
+	case "list_files":
+		s.listFiles(req.ID, params.Arguments)
+	case "get_file_info":
+		s.getFileInfo(req.ID, params.Arguments)
+	case "download_file":
+		s.downloadFile(req.ID, params.Arguments)
+	case "list_revisions":
+		s.listRevisions(req.ID, params.Arguments)
+	case "download_revision":
+		s.downloadRevision(req.ID, params.Arguments)
+	case "upload_file":
+		s.uploadFile(req.ID, params.Arguments)
+	case "update_file_content":
+		s.updateFileContent(req.ID, params.Arguments)
 	case "create_folder":
 		s.createFolder(req.ID, params.Arguments)
+	case "create_shortcut":
+		s.createShortcut(req.ID, params.Arguments)
 	case "delete_file":
 		s.deleteFile(req.ID, params.Arguments)
+	case "list_trash":
+		s.listTrash(req.ID, params.Arguments)
+	case "restore_file":
+		s.restoreFile(req.ID, params.Arguments)
+	case "empty_trash":
+		s.emptyTrash(req.ID, params.Arguments)
 	case "search_files":
 		s.searchFiles(req.ID, params.Arguments)
 	case "share_file":
 		s.shareFile(req.ID, params.Arguments)
+	case "list_permissions":
+		s.listPermissions(req.ID, params.Arguments)
+	case "revoke_permission":
+		s.revokePermission(req.ID, params.Arguments)
+	case "get_storage_quota":
+		s.getStorageQuota(req.ID, params.Arguments)
+	case "list_shared_drives":
+		s.listSharedDrives(req.ID, params.Arguments)
 	default:
 		logger.Printf("Unknown tool: %s\n", params.Name)
 		s.sendError(req.ID, -32602, "Unknown tool", fmt.Sprintf("Tool not found: %s", params.Name))
@@ -541,8 +1139,16 @@ func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
 func (s *MCPServer) listFiles(id interface{}, args map[string]interface{}) {
 	query, _ := args["query"].(string)
 	folderID, _ := args["folder_id"].(string)
+	driveID, _ := args["drive_id"].(string)
+	orderBy, _ := args["order_by"].(string)
+	includeTrashed, _ := args["include_trashed"].(bool)
 	maxResults := int64(20)
 
+	if err := validateOrderBy(orderBy); err != nil {
+		s.sendError(id, -32602, "Invalid arguments", err.Error())
+		return
+	}
+
 	if maxStr, ok := args["max_results"].(string); ok && maxStr != "" {
 		fmt.Sscanf(maxStr, "%d", &maxResults)
 		if maxResults > 100 {
@@ -550,25 +1156,31 @@ func (s *MCPServer) listFiles(id interface{}, args map[string]interface{}) {
 		}
 	}
 
-	logger.Printf("Listing files with query: %s, folder: %s, max: %d\n", query, folderID, maxResults)
+	logger.Printf("Listing files with query: %s, folder: %s, drive: %s, max: %d\n", query, folderID, driveID, maxResults)
 
 	call := s.driveService.Files.List().
 		PageSize(maxResults).
+		SupportsAllDrives(true).
+		IncludeItemsFromAllDrives(true).
 		Fields("files(id, name, mimeType, size, createdTime, modifiedTime, owners, webViewLink)")
 
-	// Build query
-	var queryParts []string
-	if query != "" {
-		queryParts = append(queryParts, query)
+	// Restrict the search to a single shared drive when requested
+	if driveID != "" {
+		call = call.Corpora("drive").DriveId(driveID)
 	}
-	if folderID != "" {
-		queryParts = append(queryParts, fmt.Sprintf("'%s' in parents", folderID))
+	if orderBy != "" {
+		call = call.OrderBy(orderBy)
 	}
-	if len(queryParts) > 0 {
-		call = call.Q(strings.Join(queryParts, " and "))
+	if q := buildFilesQuery(query, folderID, includeTrashed); q != "" {
+		call = call.Q(q)
 	}
 
-	r, err := call.Do()
+	var r *drive.FileList
+	err := driveDo(func(ctx context.Context) error {
+		var err error
+		r, err = call.Context(ctx).Do()
+		return err
+	})
 	if err != nil {
 		logger.Printf("Failed to list files: %v\n", err)
 		result := ToolResult{
@@ -625,6 +1237,46 @@ func (s *MCPServer) listFiles(id interface{}, args map[string]interface{}) {
 	s.sendResponse(id, result)
 }
 
+// orderByKeys are the sort keys the Drive API accepts in files.list orderBy.
+var orderByKeys = []string{"createdTime", "folder", "modifiedByMeTime", "modifiedTime", "name", "name_natural", "quotaBytesUsed", "recency", "sharedWithMeTime", "starred", "viewedByMeTime"}
+
+// validateOrderBy checks a comma-separated orderBy value such as
+// "folder,modifiedTime desc".
+func validateOrderBy(orderBy string) error {
+	if orderBy == "" {
+		return nil
+	}
+	for _, part := range strings.Split(orderBy, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 || len(fields) > 2 || !slices.Contains(orderByKeys, fields[0]) ||
+			(len(fields) == 2 && fields[1] != "desc") {
+			return fmt.Errorf("invalid order_by %q: use comma-separated keys from %s, each optionally followed by desc", orderBy, strings.Join(orderByKeys, ", "))
+		}
+	}
+	return nil
+}
+
+// trashedClause matches a "trashed = ..." or "trashed != ..." term in a
+// Drive query.
+var trashedClause = regexp.MustCompile(`\btrashed\s*!?=`)
+
+// buildFilesQuery combines the caller's query with the folder filter and,
+// unless includeTrashed is set, excludes trashed files. A query with its own
+// trashed clause is left to decide that for itself.
+func buildFilesQuery(query, folderID string, includeTrashed bool) string {
+	var queryParts []string
+	if query != "" {
+		queryParts = append(queryParts, "("+query+")")
+	}
+	if folderID != "" {
+		queryParts = append(queryParts, fmt.Sprintf("'%s' in parents", folderID))
+	}
+	if !includeTrashed && !trashedClause.MatchString(query) {
+		queryParts = append(queryParts, "trashed = false")
+	}
+	return strings.Join(queryParts, " and ")
+}
+
 func (s *MCPServer) getFileInfo(id interface{}, args map[string]interface{}) {
 	fileID, ok := args["file_id"].(string)
 	if !ok || fileID == "" {
@@ -634,9 +1286,16 @@ func (s *MCPServer) getFileInfo(id interface{}, args map[string]interface{}) {
 
 	logger.Printf("Getting file info for: %s\n", fileID)
 
-	file, err := s.driveService.Files.Get(fileID).
-		Fields("id, name, mimeType, size, createdTime, modifiedTime, description, owners, parents, webViewLink, webContentLink, permissions").
-		Do()
+	var file *drive.File
+	err := driveDo(func(ctx context.Context) error {
+		var err error
+		file, err = s.driveService.Files.Get(fileID).
+			SupportsAllDrives(true).
+			Fields("id, name, mimeType, size, createdTime, modifiedTime, description, owners, parents, webViewLink, webContentLink, permissions").
+			Context(ctx).
+			Do()
+		return err
+	})
 	if err != nil {
 		logger.Printf("Failed to get file info: %v\n", err)
 		result := ToolResult{
@@ -695,11 +1354,17 @@ func (s *MCPServer) downloadFile(id interface{}, args map[string]interface{}) {
 	}
 
 	outputPath, _ := args["output_path"].(string)
+	inline, _ := args["inline"].(bool)
 
-	logger.Printf("Downloading file: %s to: %s\n", fileID, outputPath)
+	logger.Printf("Downloading file: %s to: %s (inline: %v)\n", fileID, outputPath, inline)
 
 	// Get file metadata first
-	file, err := s.driveService.Files.Get(fileID).Fields("name, mimeType, size").Do()
+	var file *drive.File
+	err := driveDo(func(ctx context.Context) error {
+		var err error
+		file, err = s.driveService.Files.Get(fileID).SupportsAllDrives(true).Fields("name, mimeType, size").Context(ctx).Do()
+		return err
+	})
 	if err != nil {
 		logger.Printf("Failed to get file metadata: %v\n", err)
 		result := ToolResult{
@@ -715,15 +1380,13 @@ func (s *MCPServer) downloadFile(id interface{}, args map[string]interface{}) {
 		return
 	}
 
-	// Download file content
-	resp, err := s.driveService.Files.Get(fileID).Download()
-	if err != nil {
-		logger.Printf("Failed to download file: %v\n", err)
+	// Refuse oversized inline downloads before fetching any content
+	if inline && outputPath == "" && file.Size > maxInlineDownloadSize && !isTextMimeType(file.MimeType) {
 		result := ToolResult{
 			Content: []ContentItem{
 				{
 					Type: "text",
-					Text: fmt.Sprintf("Failed to download file: %v", err),
+					Text: fmt.Sprintf("File '%s' is too large to return inline (%d bytes, max %d). Please specify an output_path to save it.", file.Name, file.Size, maxInlineDownloadSize),
 				},
 			},
 			IsError: true,
@@ -731,16 +1394,18 @@ func (s *MCPServer) downloadFile(id interface{}, args map[string]interface{}) {
 		s.sendResponse(id, result)
 		return
 	}
-	defer resp.Body.Close()
 
-	content, err := io.ReadAll(resp.Body)
+	// Download file content
+	content, err := downloadContent(func(ctx context.Context) (*http.Response, error) {
+		return s.driveService.Files.Get(fileID).SupportsAllDrives(true).Context(ctx).Download()
+	})
 	if err != nil {
-		logger.Printf("Failed to read file content: %v\n", err)
+		logger.Printf("Failed to download file: %v\n", err)
 		result := ToolResult{
 			Content: []ContentItem{
 				{
 					Type: "text",
-					Text: fmt.Sprintf("Failed to read file content: %v", err),
+					Text: fmt.Sprintf("Failed to download file: %v", err),
 				},
 			},
 			IsError: true,
@@ -779,9 +1444,7 @@ func (s *MCPServer) downloadFile(id interface{}, args map[string]interface{}) {
 	}
 
 	// For text files, return content
-	if strings.HasPrefix(file.MimeType, "text/") || 
-	   strings.Contains(file.MimeType, "json") || 
-	   strings.Contains(file.MimeType, "xml") {
+	if isTextMimeType(file.MimeType) {
 		result := ToolResult{
 			Content: []ContentItem{
 				{
@@ -794,6 +1457,21 @@ func (s *MCPServer) downloadFile(id interface{}, args map[string]interface{}) {
 		return
 	}
 
+	// For binary files, return base64 data if requested
+	if inline && len(content) <= maxInlineDownloadSize {
+		result := ToolResult{
+			Content: []ContentItem{
+				{
+					Type:     inlineContentType(file.MimeType),
+					Data:     base64.StdEncoding.EncodeToString(content),
+					MimeType: file.MimeType,
+				},
+			},
+		}
+		s.sendResponse(id, result)
+		return
+	}
+
 	// For binary files, suggest saving to disk
 	result := ToolResult{
 		Content: []ContentItem{
@@ -806,32 +1484,56 @@ func (s *MCPServer) downloadFile(id interface{}, args map[string]interface{}) {
 	s.sendResponse(id, result)
 }
 
-func (s *MCPServer) uploadFile(id interface{}, args map[string]interface{}) {
-	filePath, ok := args["file_path"].(string)
-	if !ok || filePath == "" {
-		s.sendError(id, -32602, "Invalid arguments", "file_path is required")
-		return
-	}
+// maxInlineDownloadSize caps binary files returned inline as base64.
+const maxInlineDownloadSize = 10 * 1024 * 1024
 
-	name, _ := args["name"].(string)
-	if name == "" {
-		name = filepath.Base(filePath)
-	}
+func isTextMimeType(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "text/") ||
+		strings.Contains(mimeType, "json") ||
+		strings.Contains(mimeType, "xml")
+}
 
-	folderID, _ := args["folder_id"].(string)
-	description, _ := args["description"].(string)
+// inlineContentType maps a MIME type to an MCP content type, matching
+// mcp-filesystem's read_media_file.
+func inlineContentType(mimeType string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return "image"
+	case strings.HasPrefix(mimeType, "audio/"):
+		return "audio"
+	default:
+		return "blob"
+	}
+}
 
-	logger.Printf("Uploading file: %s as: %s to folder: %s\n", filePath, name, folderID)
+func (s *MCPServer) listRevisions(id interface{}, args map[string]interface{}) {
+	fileID, ok := args["file_id"].(string)
+	if !ok || fileID == "" {
+		s.sendError(id, -32602, "Invalid arguments", "file_id is required")
+		return
+	}
 
-	// Read file content
-	content, err := os.ReadFile(filePath)
+	logger.Printf("Listing revisions for: %s\n", fileID)
+
+	var revisions []*drive.Revision
+	err := driveDo(func(ctx context.Context) error {
+		// A retried attempt starts again from the first page.
+		revisions = nil
+		return s.driveService.Revisions.List(fileID).
+			PageSize(1000).
+			Fields("nextPageToken, revisions(id, modifiedTime, size, mimeType, keepForever, lastModifyingUser(displayName))").
+			Pages(ctx, func(r *drive.RevisionList) error {
+				revisions = append(revisions, r.Revisions...)
+				return nil
+			})
+	})
 	if err != nil {
-		logger.Printf("Failed to read file: %v\n", err)
+		logger.Printf("Failed to list revisions: %v\n", err)
 		result := ToolResult{
 			Content: []ContentItem{
 				{
 					Type: "text",
-					Text: fmt.Sprintf("Failed to read file: %v", err),
+					Text: fmt.Sprintf("Failed to list revisions: %v", err),
 				},
 			},
 			IsError: true,
@@ -840,76 +1542,76 @@ func (s *MCPServer) uploadFile(id interface{}, args map[string]interface{}) {
 		return
 	}
 
-	// Create file metadata
-	file := &drive.File{
-		Name:        name,
-		Description: description,
-	}
-
-	if folderID != "" {
-		file.Parents = []string{folderID}
-	}
-
-	// Upload file
-	uploadedFile, err := s.driveService.Files.Create(file).Media(strings.NewReader(string(content))).Do()
-	if err != nil {
-		logger.Printf("Failed to upload file: %v\n", err)
+	if len(revisions) == 0 {
 		result := ToolResult{
 			Content: []ContentItem{
 				{
 					Type: "text",
-					Text: fmt.Sprintf("Failed to upload file: %v", err),
+					Text: "No revisions found.",
 				},
 			},
-			IsError: true,
 		}
 		s.sendResponse(id, result)
 		return
 	}
 
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("Found %d revision(s):\n\n", len(revisions)))
+
+	for i, rev := range revisions {
+		output.WriteString(fmt.Sprintf("%d. ID: %s\n", i+1, rev.Id))
+		output.WriteString(fmt.Sprintf("   Modified: %s\n", rev.ModifiedTime))
+		if rev.Size > 0 {
+			output.WriteString(fmt.Sprintf("   Size: %d bytes\n", rev.Size))
+		}
+		if rev.MimeType != "" {
+			output.WriteString(fmt.Sprintf("   Type: %s\n", rev.MimeType))
+		}
+		if rev.LastModifyingUser != nil && rev.LastModifyingUser.DisplayName != "" {
+			output.WriteString(fmt.Sprintf("   Modified by: %s\n", rev.LastModifyingUser.DisplayName))
+		}
+		if rev.KeepForever {
+			output.WriteString("   Kept forever: yes\n")
+		}
+		output.WriteString("\n")
+	}
+
 	result := ToolResult{
 		Content: []ContentItem{
 			{
 				Type: "text",
-				Text: fmt.Sprintf("File '%s' uploaded successfully!\nFile ID: %s\nSize: %d bytes", uploadedFile.Name, uploadedFile.Id, len(content)),
+				Text: output.String(),
 			},
 		},
 	}
 	s.sendResponse(id, result)
 }
 
-func (s *MCPServer) createFolder(id interface{}, args map[string]interface{}) {
-	name, ok := args["name"].(string)
-	if !ok || name == "" {
-		s.sendError(id, -32602, "Invalid arguments", "name is required")
+func (s *MCPServer) downloadRevision(id interface{}, args map[string]interface{}) {
+	fileID, _ := args["file_id"].(string)
+	revisionID, _ := args["revision_id"].(string)
+	if fileID == "" || revisionID == "" {
+		s.sendError(id, -32602, "Invalid arguments", "file_id and revision_id are required")
 		return
 	}
 
-	parentID, _ := args["parent_id"].(string)
-	description, _ := args["description"].(string)
-
-	logger.Printf("Creating folder: %s in parent: %s\n", name, parentID)
-
-	// Create folder metadata
-	folder := &drive.File{
-		Name:        name,
-		MimeType:    "application/vnd.google-apps.folder",
-		Description: description,
-	}
+	outputPath, _ := args["output_path"].(string)
 
-	if parentID != "" {
-		folder.Parents = []string{parentID}
-	}
+	logger.Printf("Downloading revision %s of file %s to: %s\n", revisionID, fileID, outputPath)
 
-	// Create folder
-	createdFolder, err := s.driveService.Files.Create(folder).Do()
+	var rev *drive.Revision
+	err := driveDo(func(ctx context.Context) error {
+		var err error
+		rev, err = s.driveService.Revisions.Get(fileID, revisionID).Fields("id, mimeType, modifiedTime, size").Context(ctx).Do()
+		return err
+	})
 	if err != nil {
-		logger.Printf("Failed to create folder: %v\n", err)
+		logger.Printf("Failed to get revision metadata: %v\n", err)
 		result := ToolResult{
 			Content: []ContentItem{
 				{
 					Type: "text",
-					Text: fmt.Sprintf("Failed to create folder: %v", err),
+					Text: fmt.Sprintf("Failed to get revision metadata: %v", err),
 				},
 			},
 			IsError: true,
@@ -918,35 +1620,31 @@ func (s *MCPServer) createFolder(id interface{}, args map[string]interface{}) {
 		return
 	}
 
-	result := ToolResult{
-		Content: []ContentItem{
-			{
-				Type: "text",
-				Text: fmt.Sprintf("Folder '%s' created successfully!\nFolder ID: %s", createdFolder.Name, createdFolder.Id),
+	// Binary revisions are only saved to disk, so check before fetching
+	// any content.
+	if outputPath == "" && !isTextMimeType(rev.MimeType) {
+		result := ToolResult{
+			Content: []ContentItem{
+				{
+					Type: "text",
+					Text: fmt.Sprintf("Revision %s is a binary file (%s, %d bytes). Please specify an output_path to save it.", rev.Id, rev.MimeType, rev.Size),
+				},
 			},
-		},
-	}
-	s.sendResponse(id, result)
-}
-
-func (s *MCPServer) deleteFile(id interface{}, args map[string]interface{}) {
-	fileID, ok := args["file_id"].(string)
-	if !ok || fileID == "" {
-		s.sendError(id, -32602, "Invalid arguments", "file_id is required")
+		}
+		s.sendResponse(id, result)
 		return
 	}
 
-	logger.Printf("Deleting file: %s\n", fileID)
-
-	// Get file name first
-	file, err := s.driveService.Files.Get(fileID).Fields("name").Do()
+	content, err := downloadContent(func(ctx context.Context) (*http.Response, error) {
+		return s.driveService.Revisions.Get(fileID, revisionID).Context(ctx).Download()
+	})
 	if err != nil {
-		logger.Printf("Failed to get file info: %v\n", err)
+		logger.Printf("Failed to download revision: %v\n", err)
 		result := ToolResult{
 			Content: []ContentItem{
 				{
 					Type: "text",
-					Text: fmt.Sprintf("Failed to get file info: %v", err),
+					Text: fmt.Sprintf("Failed to download revision: %v", err),
 				},
 			},
 			IsError: true,
@@ -955,18 +1653,29 @@ func (s *MCPServer) deleteFile(id interface{}, args map[string]interface{}) {
 		return
 	}
 
-	// Delete file (moves to trash)
-	err = s.driveService.Files.Delete(fileID).Do()
-	if err != nil {
-		logger.Printf("Failed to delete file: %v\n", err)
+	if outputPath != "" {
+		if err := os.WriteFile(outputPath, content, 0644); err != nil {
+			logger.Printf("Failed to write file: %v\n", err)
+			result := ToolResult{
+				Content: []ContentItem{
+					{
+						Type: "text",
+						Text: fmt.Sprintf("Failed to write file: %v", err),
+					},
+				},
+				IsError: true,
+			}
+			s.sendResponse(id, result)
+			return
+		}
+
 		result := ToolResult{
 			Content: []ContentItem{
 				{
 					Type: "text",
-					Text: fmt.Sprintf("Failed to delete file: %v", err),
+					Text: fmt.Sprintf("Revision %s (modified %s) downloaded successfully to %s (%d bytes)", rev.Id, rev.ModifiedTime, outputPath, len(content)),
 				},
 			},
-			IsError: true,
 		}
 		s.sendResponse(id, result)
 		return
@@ -976,28 +1685,545 @@ func (s *MCPServer) deleteFile(id interface{}, args map[string]interface{}) {
 		Content: []ContentItem{
 			{
 				Type: "text",
-				Text: fmt.Sprintf("File '%s' moved to trash successfully!", file.Name),
+				Text: fmt.Sprintf("=== Revision: %s (modified %s) ===\n\n%s", rev.Id, rev.ModifiedTime, string(content)),
 			},
 		},
 	}
 	s.sendResponse(id, result)
 }
 
-func (s *MCPServer) searchFiles(id interface{}, args map[string]interface{}) {
-	query, ok := args["query"].(string)
-	if !ok || query == "" {
-		s.sendError(id, -32602, "Invalid arguments", "query is required")
+func (s *MCPServer) uploadFile(id interface{}, args map[string]interface{}) {
+	filePath, ok := args["file_path"].(string)
+	if !ok || filePath == "" {
+		s.sendError(id, -32602, "Invalid arguments", "file_path is required")
 		return
 	}
 
-	maxResults := int64(20)
-	if maxStr, ok := args["max_results"].(string); ok && maxStr != "" {
-		fmt.Sscanf(maxStr, "%d", &maxResults)
-		if maxResults > 100 {
-			maxResults = 100
-		}
-	}
-
+	name, _ := args["name"].(string)
+	if name == "" {
+		name = filepath.Base(filePath)
+	}
+
+	folderID, _ := args["folder_id"].(string)
+	description, _ := args["description"].(string)
+
+	logger.Printf("Uploading file: %s as: %s to folder: %s\n", filePath, name, folderID)
+
+	// Open the file rather than reading it, so large uploads are streamed
+	f, size, err := openUpload(filePath)
+	if err != nil {
+		logger.Printf("Failed to read file: %v\n", err)
+		result := ToolResult{
+			Content: []ContentItem{
+				{
+					Type: "text",
+					Text: fmt.Sprintf("Failed to read file: %v", err),
+				},
+			},
+			IsError: true,
+		}
+		s.sendResponse(id, result)
+		return
+	}
+	defer f.Close()
+	mimeType := uploadMimeType(filePath)
+
+	// Create file metadata
+	file := &drive.File{
+		Name:        name,
+		Description: description,
+		MimeType:    mimeType,
+	}
+
+	if folderID != "" {
+		file.Parents = []string{folderID}
+	}
+
+	// Upload file. A resumable upload has no overall deadline, since a large
+	// file can take far longer than driveTimeout; its chunks are retried
+	// individually instead.
+	resumable := size > resumableUploadThreshold
+	timeout := transferTimeout(size)
+	if resumable {
+		timeout = 0
+	}
+	var uploadedFile *drive.File
+	err = driveRetry(func(ctx context.Context) error {
+		call := s.driveService.Files.Create(file).SupportsAllDrives(true)
+		if resumable {
+			logger.Printf("Using resumable upload for %s (%d bytes)\n", filePath, size)
+			call = call.ResumableMedia(ctx, f, size, mimeType).ProgressUpdater(func(current, total int64) {
+				logger.Printf("Uploaded %d of %d bytes of %s\n", current, total, filePath)
+			})
+		} else {
+			call = call.Media(io.NewSectionReader(f, 0, size), googleapi.ContentType(mimeType))
+		}
+		var err error
+		uploadedFile, err = call.Context(ctx).Do()
+		return err
+	}, false, timeout)
+	if err != nil {
+		logger.Printf("Failed to upload file: %v\n", err)
+		result := ToolResult{
+			Content: []ContentItem{
+				{
+					Type: "text",
+					Text: fmt.Sprintf("Failed to upload file: %v", err),
+				},
+			},
+			IsError: true,
+		}
+		s.sendResponse(id, result)
+		return
+	}
+
+	result := ToolResult{
+		Content: []ContentItem{
+			{
+				Type: "text",
+				Text: fmt.Sprintf("File '%s' uploaded successfully!\nFile ID: %s\nSize: %d bytes", uploadedFile.Name, uploadedFile.Id, size),
+			},
+		},
+	}
+	s.sendResponse(id, result)
+}
+
+// resumableUploadThreshold is the size above which upload_file sends a file
+// with Drive's resumable protocol, in chunks that are retried individually,
+// instead of in a single request. It is a variable so tests can lower it.
+var resumableUploadThreshold int64 = 5 << 20
+
+// openUpload opens a regular file to upload and returns its size.
+func openUpload(path string) (*os.File, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err == nil && info.IsDir() {
+		err = fmt.Errorf("%s is a directory", path)
+	}
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+// uploadMimeType returns the MIME type for a local file from its extension,
+// without parameters such as charset, or "application/octet-stream" when the
+// extension is unknown.
+func uploadMimeType(path string) string {
+	mediaType, _, err := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(path)))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return mediaType
+}
+
+func (s *MCPServer) updateFileContent(id interface{}, args map[string]interface{}) {
+	fileID, ok := args["file_id"].(string)
+	if !ok || fileID == "" {
+		s.sendError(id, -32602, "Invalid arguments", "file_id is required")
+		return
+	}
+
+	filePath, _ := args["file_path"].(string)
+	name, _ := args["name"].(string)
+	description, _ := args["description"].(string)
+
+	if filePath == "" && name == "" && description == "" {
+		s.sendError(id, -32602, "Invalid arguments", "at least one of file_path, name, or description is required")
+		return
+	}
+
+	logger.Printf("Updating file: %s from: %s (name: %s)\n", fileID, filePath, name)
+
+	// Only the fields set here are changed; everything else, including the
+	// file's ID, parents, and permissions, is preserved.
+	file := &drive.File{
+		Name:        name,
+		Description: description,
+	}
+
+	var content []byte
+	if filePath != "" {
+		var err error
+		content, err = os.ReadFile(filePath)
+		if err != nil {
+			logger.Printf("Failed to read file: %v\n", err)
+			result := ToolResult{
+				Content: []ContentItem{
+					{
+						Type: "text",
+						Text: fmt.Sprintf("Failed to read file: %v", err),
+					},
+				},
+				IsError: true,
+			}
+			s.sendResponse(id, result)
+			return
+		}
+	}
+
+	var updatedFile *drive.File
+	err := driveRetry(func(ctx context.Context) error {
+		call := s.driveService.Files.Update(fileID, file).SupportsAllDrives(true)
+		if filePath != "" {
+			call = call.Media(bytes.NewReader(content))
+		}
+		var err error
+		updatedFile, err = call.Fields("id, name, modifiedTime").Context(ctx).Do()
+		return err
+	}, true, transferTimeout(int64(len(content))))
+	if err != nil {
+		logger.Printf("Failed to update file: %v\n", err)
+		result := ToolResult{
+			Content: []ContentItem{
+				{
+					Type: "text",
+					Text: fmt.Sprintf("Failed to update file: %v", err),
+				},
+			},
+			IsError: true,
+		}
+		s.sendResponse(id, result)
+		return
+	}
+
+	msg := fmt.Sprintf("File '%s' updated successfully!\nFile ID: %s\nModified: %s", updatedFile.Name, updatedFile.Id, updatedFile.ModifiedTime)
+	if filePath != "" {
+		msg += fmt.Sprintf("\nSize: %d bytes", len(content))
+	}
+
+	result := ToolResult{
+		Content: []ContentItem{
+			{
+				Type: "text",
+				Text: msg,
+			},
+		},
+	}
+	s.sendResponse(id, result)
+}
+
+func (s *MCPServer) createFolder(id interface{}, args map[string]interface{}) {
+	name, ok := args["name"].(string)
+	if !ok || name == "" {
+		s.sendError(id, -32602, "Invalid arguments", "name is required")
+		return
+	}
+
+	parentID, _ := args["parent_id"].(string)
+	description, _ := args["description"].(string)
+
+	logger.Printf("Creating folder: %s in parent: %s\n", name, parentID)
+
+	// Create folder metadata
+	folder := &drive.File{
+		Name:        name,
+		MimeType:    "application/vnd.google-apps.folder",
+		Description: description,
+	}
+
+	if parentID != "" {
+		folder.Parents = []string{parentID}
+	}
+
+	// Create folder
+	var createdFolder *drive.File
+	err := driveCreate(func(ctx context.Context) error {
+		var err error
+		createdFolder, err = s.driveService.Files.Create(folder).SupportsAllDrives(true).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		logger.Printf("Failed to create folder: %v\n", err)
+		result := ToolResult{
+			Content: []ContentItem{
+				{
+					Type: "text",
+					Text: fmt.Sprintf("Failed to create folder: %v", err),
+				},
+			},
+			IsError: true,
+		}
+		s.sendResponse(id, result)
+		return
+	}
+
+	result := ToolResult{
+		Content: []ContentItem{
+			{
+				Type: "text",
+				Text: fmt.Sprintf("Folder '%s' created successfully!\nFolder ID: %s", createdFolder.Name, createdFolder.Id),
+			},
+		},
+	}
+	s.sendResponse(id, result)
+}
+
+func (s *MCPServer) createShortcut(id interface{}, args map[string]interface{}) {
+	targetID, ok := args["target_id"].(string)
+	if !ok || targetID == "" {
+		s.sendError(id, -32602, "Invalid arguments", "target_id is required")
+		return
+	}
+	folderID, ok := args["folder_id"].(string)
+	if !ok || folderID == "" {
+		s.sendError(id, -32602, "Invalid arguments", "folder_id is required")
+		return
+	}
+
+	name, _ := args["name"].(string)
+
+	logger.Printf("Creating shortcut to %s in folder: %s\n", targetID, folderID)
+
+	// Default the shortcut's name to the target's, as the Drive UI does
+	if name == "" {
+		var target *drive.File
+		err := driveDo(func(ctx context.Context) error {
+			var err error
+			target, err = s.driveService.Files.Get(targetID).Fields("name").SupportsAllDrives(true).Context(ctx).Do()
+			return err
+		})
+		if err != nil {
+			logger.Printf("Failed to get shortcut target: %v\n", err)
+			result := ToolResult{
+				Content: []ContentItem{
+					{
+						Type: "text",
+						Text: fmt.Sprintf("Failed to get shortcut target: %v", err),
+					},
+				},
+				IsError: true,
+			}
+			s.sendResponse(id, result)
+			return
+		}
+		name = target.Name
+	}
+
+	shortcut := &drive.File{
+		Name:            name,
+		MimeType:        "application/vnd.google-apps.shortcut",
+		Parents:         []string{folderID},
+		ShortcutDetails: &drive.FileShortcutDetails{TargetId: targetID},
+	}
+
+	var created *drive.File
+	err := driveCreate(func(ctx context.Context) error {
+		var err error
+		created, err = s.driveService.Files.Create(shortcut).SupportsAllDrives(true).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		logger.Printf("Failed to create shortcut: %v\n", err)
+		result := ToolResult{
+			Content: []ContentItem{
+				{
+					Type: "text",
+					Text: fmt.Sprintf("Failed to create shortcut: %v", err),
+				},
+			},
+			IsError: true,
+		}
+		s.sendResponse(id, result)
+		return
+	}
+
+	result := ToolResult{
+		Content: []ContentItem{
+			{
+				Type: "text",
+				Text: fmt.Sprintf("Shortcut '%s' created successfully!\nShortcut ID: %s\nTarget ID: %s", created.Name, created.Id, targetID),
+			},
+		},
+	}
+	s.sendResponse(id, result)
+}
+
+func (s *MCPServer) deleteFile(id interface{}, args map[string]interface{}) {
+	fileID, ok := args["file_id"].(string)
+	if !ok || fileID == "" {
+		s.sendError(id, -32602, "Invalid arguments", "file_id is required")
+		return
+	}
+
+	permanent, _ := args["permanent"].(bool)
+
+	logger.Printf("Deleting file: %s (permanent: %v)\n", fileID, permanent)
+
+	// Get file name first
+	var file *drive.File
+	err := driveDo(func(ctx context.Context) error {
+		var err error
+		file, err = s.driveService.Files.Get(fileID).SupportsAllDrives(true).Fields("name").Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		logger.Printf("Failed to get file info: %v\n", err)
+		result := ToolResult{
+			Content: []ContentItem{
+				{
+					Type: "text",
+					Text: fmt.Sprintf("Failed to get file info: %v", err),
+				},
+			},
+			IsError: true,
+		}
+		s.sendResponse(id, result)
+		return
+	}
+
+	// Files.Delete skips the trash, so only use it when explicitly asked;
+	// otherwise mark the file as trashed so it can still be restored.
+	err = driveDo(func(ctx context.Context) error {
+		if permanent {
+			return s.driveService.Files.Delete(fileID).SupportsAllDrives(true).Context(ctx).Do()
+		}
+		_, err := s.driveService.Files.Update(fileID, &drive.File{Trashed: true}).SupportsAllDrives(true).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		logger.Printf("Failed to delete file: %v\n", err)
+		result := ToolResult{
+			Content: []ContentItem{
+				{
+					Type: "text",
+					Text: fmt.Sprintf("Failed to delete file: %v", err),
+				},
+			},
+			IsError: true,
+		}
+		s.sendResponse(id, result)
+		return
+	}
+
+	msg := fmt.Sprintf("File '%s' moved to trash successfully!", file.Name)
+	if permanent {
+		msg = fmt.Sprintf("File '%s' permanently deleted!", file.Name)
+	}
+
+	result := ToolResult{
+		Content: []ContentItem{
+			{
+				Type: "text",
+				Text: msg,
+			},
+		},
+	}
+	s.sendResponse(id, result)
+}
+
+func (s *MCPServer) listTrash(id interface{}, args map[string]interface{}) {
+	logger.Println("Listing trash")
+
+	// Use list_files implementation, limited to trashed files
+	trashArgs := map[string]interface{}{"query": "trashed = true"}
+	for _, key := range []string{"max_results", "drive_id", "order_by"} {
+		if v, ok := args[key]; ok {
+			trashArgs[key] = v
+		}
+	}
+	s.listFiles(id, trashArgs)
+}
+
+func (s *MCPServer) restoreFile(id interface{}, args map[string]interface{}) {
+	fileID, ok := args["file_id"].(string)
+	if !ok || fileID == "" {
+		s.sendError(id, -32602, "Invalid arguments", "file_id is required")
+		return
+	}
+
+	logger.Printf("Restoring file from trash: %s\n", fileID)
+
+	// Trashed is false, its zero value, so it must be sent explicitly.
+	update := &drive.File{Trashed: false, ForceSendFields: []string{"Trashed"}}
+
+	var restored *drive.File
+	err := driveDo(func(ctx context.Context) error {
+		var err error
+		restored, err = s.driveService.Files.Update(fileID, update).SupportsAllDrives(true).Fields("id, name").Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		logger.Printf("Failed to restore file: %v\n", err)
+		result := ToolResult{
+			Content: []ContentItem{
+				{
+					Type: "text",
+					Text: fmt.Sprintf("Failed to restore file: %v", err),
+				},
+			},
+			IsError: true,
+		}
+		s.sendResponse(id, result)
+		return
+	}
+
+	result := ToolResult{
+		Content: []ContentItem{
+			{
+				Type: "text",
+				Text: fmt.Sprintf("File '%s' restored from the trash!\nFile ID: %s", restored.Name, restored.Id),
+			},
+		},
+	}
+	s.sendResponse(id, result)
+}
+
+func (s *MCPServer) emptyTrash(id interface{}, args map[string]interface{}) {
+	driveID, _ := args["drive_id"].(string)
+
+	logger.Printf("Emptying trash (drive: %s)\n", driveID)
+
+	call := s.driveService.Files.EmptyTrash()
+	if driveID != "" {
+		call = call.DriveId(driveID)
+	}
+
+	if err := driveDo(func(ctx context.Context) error { return call.Context(ctx).Do() }); err != nil {
+		logger.Printf("Failed to empty trash: %v\n", err)
+		result := ToolResult{
+			Content: []ContentItem{
+				{
+					Type: "text",
+					Text: fmt.Sprintf("Failed to empty trash: %v", err),
+				},
+			},
+			IsError: true,
+		}
+		s.sendResponse(id, result)
+		return
+	}
+
+	result := ToolResult{
+		Content: []ContentItem{
+			{
+				Type: "text",
+				Text: "Trash emptied successfully!",
+			},
+		},
+	}
+	s.sendResponse(id, result)
+}
+
+func (s *MCPServer) searchFiles(id interface{}, args map[string]interface{}) {
+	query, ok := args["query"].(string)
+	if !ok || query == "" {
+		s.sendError(id, -32602, "Invalid arguments", "query is required")
+		return
+	}
+
+	maxResults := int64(20)
+	if maxStr, ok := args["max_results"].(string); ok && maxStr != "" {
+		fmt.Sscanf(maxStr, "%d", &maxResults)
+		if maxResults > 100 {
+			maxResults = 100
+		}
+	}
+
 	logger.Printf("Searching files with query: %s, max: %d\n", query, maxResults)
 
 	// Use list_files implementation
@@ -1034,7 +2260,10 @@ func (s *MCPServer) shareFile(id interface{}, args map[string]interface{}) {
 	}
 
 	// Share file
-	_, err := s.driveService.Permissions.Create(fileID, permission).Do()
+	err := driveCreate(func(ctx context.Context) error {
+		_, err := s.driveService.Permissions.Create(fileID, permission).SupportsAllDrives(true).Context(ctx).Do()
+		return err
+	})
 	if err != nil {
 		logger.Printf("Failed to share file: %v\n", err)
 		result := ToolResult{
@@ -1068,6 +2297,275 @@ func (s *MCPServer) shareFile(id interface{}, args map[string]interface{}) {
 	s.sendResponse(id, result)
 }
 
+func (s *MCPServer) listPermissions(id interface{}, args map[string]interface{}) {
+	fileID, ok := args["file_id"].(string)
+	if !ok || fileID == "" {
+		s.sendError(id, -32602, "Invalid arguments", "file_id is required")
+		return
+	}
+
+	logger.Printf("Listing permissions for: %s\n", fileID)
+
+	var permissions []*drive.Permission
+	err := driveDo(func(ctx context.Context) error {
+		// A retried attempt starts again from the first page.
+		permissions = nil
+		return s.driveService.Permissions.List(fileID).
+			PageSize(100).
+			SupportsAllDrives(true).
+			Fields("nextPageToken, permissions(id, type, role, emailAddress, domain, displayName)").
+			Pages(ctx, func(r *drive.PermissionList) error {
+				permissions = append(permissions, r.Permissions...)
+				return nil
+			})
+	})
+	if err != nil {
+		logger.Printf("Failed to list permissions: %v\n", err)
+		result := ToolResult{
+			Content: []ContentItem{
+				{
+					Type: "text",
+					Text: fmt.Sprintf("Failed to list permissions: %v", err),
+				},
+			},
+			IsError: true,
+		}
+		s.sendResponse(id, result)
+		return
+	}
+
+	if len(permissions) == 0 {
+		result := ToolResult{
+			Content: []ContentItem{
+				{
+					Type: "text",
+					Text: "No permissions found.",
+				},
+			},
+		}
+		s.sendResponse(id, result)
+		return
+	}
+
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("Found %d permission(s):\n\n", len(permissions)))
+
+	for i, perm := range permissions {
+		output.WriteString(fmt.Sprintf("%d. ID: %s\n", i+1, perm.Id))
+		output.WriteString(fmt.Sprintf("   Type: %s\n", perm.Type))
+		output.WriteString(fmt.Sprintf("   Role: %s\n", perm.Role))
+		if perm.EmailAddress != "" {
+			output.WriteString(fmt.Sprintf("   Email: %s\n", perm.EmailAddress))
+		}
+		if perm.Domain != "" {
+			output.WriteString(fmt.Sprintf("   Domain: %s\n", perm.Domain))
+		}
+		if perm.DisplayName != "" {
+			output.WriteString(fmt.Sprintf("   Name: %s\n", perm.DisplayName))
+		}
+		output.WriteString("\n")
+	}
+
+	result := ToolResult{
+		Content: []ContentItem{
+			{
+				Type: "text",
+				Text: output.String(),
+			},
+		},
+	}
+	s.sendResponse(id, result)
+}
+
+func (s *MCPServer) revokePermission(id interface{}, args map[string]interface{}) {
+	fileID, ok := args["file_id"].(string)
+	if !ok || fileID == "" {
+		s.sendError(id, -32602, "Invalid arguments", "file_id is required")
+		return
+	}
+
+	permissionID, ok := args["permission_id"].(string)
+	if !ok || permissionID == "" {
+		s.sendError(id, -32602, "Invalid arguments", "permission_id is required")
+		return
+	}
+
+	logger.Printf("Revoking permission %s on file: %s\n", permissionID, fileID)
+
+	err := driveDo(func(ctx context.Context) error {
+		return s.driveService.Permissions.Delete(fileID, permissionID).SupportsAllDrives(true).Context(ctx).Do()
+	})
+	if err != nil {
+		logger.Printf("Failed to revoke permission: %v\n", err)
+		result := ToolResult{
+			Content: []ContentItem{
+				{
+					Type: "text",
+					Text: fmt.Sprintf("Failed to revoke permission: %v", err),
+				},
+			},
+			IsError: true,
+		}
+		s.sendResponse(id, result)
+		return
+	}
+
+	result := ToolResult{
+		Content: []ContentItem{
+			{
+				Type: "text",
+				Text: fmt.Sprintf("Permission %s revoked successfully from file %s!", permissionID, fileID),
+			},
+		},
+	}
+	s.sendResponse(id, result)
+}
+
+func (s *MCPServer) listSharedDrives(id interface{}, args map[string]interface{}) {
+	maxResults := int64(20)
+	if maxStr, ok := args["max_results"].(string); ok && maxStr != "" {
+		fmt.Sscanf(maxStr, "%d", &maxResults)
+		if maxResults > 100 {
+			maxResults = 100
+		}
+	}
+
+	logger.Printf("Listing shared drives, max: %d\n", maxResults)
+
+	var r *drive.DriveList
+	err := driveDo(func(ctx context.Context) error {
+		var err error
+		r, err = s.driveService.Drives.List().
+			PageSize(maxResults).
+			Fields("drives(id, name, createdTime)").
+			Context(ctx).
+			Do()
+		return err
+	})
+	if err != nil {
+		logger.Printf("Failed to list shared drives: %v\n", err)
+		result := ToolResult{
+			Content: []ContentItem{
+				{
+					Type: "text",
+					Text: fmt.Sprintf("Failed to list shared drives: %v", err),
+				},
+			},
+			IsError: true,
+		}
+		s.sendResponse(id, result)
+		return
+	}
+
+	if len(r.Drives) == 0 {
+		result := ToolResult{
+			Content: []ContentItem{
+				{
+					Type: "text",
+					Text: "No shared drives found.",
+				},
+			},
+		}
+		s.sendResponse(id, result)
+		return
+	}
+
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("Found %d shared drive(s):\n\n", len(r.Drives)))
+
+	for i, d := range r.Drives {
+		output.WriteString(fmt.Sprintf("%d. %s\n", i+1, d.Name))
+		output.WriteString(fmt.Sprintf("   ID: %s\n", d.Id))
+		output.WriteString(fmt.Sprintf("   Created: %s\n\n", d.CreatedTime))
+	}
+
+	result := ToolResult{
+		Content: []ContentItem{
+			{
+				Type: "text",
+				Text: output.String(),
+			},
+		},
+	}
+	s.sendResponse(id, result)
+}
+
+func (s *MCPServer) getStorageQuota(id interface{}, args map[string]interface{}) {
+	logger.Println("Getting storage quota")
+
+	var about *drive.About
+	err := driveDo(func(ctx context.Context) error {
+		var err error
+		about, err = s.driveService.About.Get().
+			Fields("storageQuota, user").
+			Context(ctx).
+			Do()
+		return err
+	})
+	if err != nil {
+		logger.Printf("Failed to get storage quota: %v\n", err)
+		result := ToolResult{
+			Content: []ContentItem{
+				{
+					Type: "text",
+					Text: fmt.Sprintf("Failed to get storage quota: %v", err),
+				},
+			},
+			IsError: true,
+		}
+		s.sendResponse(id, result)
+		return
+	}
+
+	var output strings.Builder
+	output.WriteString("=== Storage Quota ===\n\n")
+	if about.User != nil {
+		output.WriteString(fmt.Sprintf("User: %s (%s)\n", about.User.DisplayName, about.User.EmailAddress))
+	}
+	if q := about.StorageQuota; q != nil {
+		// A zero limit means the account has unlimited storage.
+		if q.Limit > 0 {
+			output.WriteString(fmt.Sprintf("Total: %d bytes\n", q.Limit))
+		} else {
+			output.WriteString("Total: unlimited\n")
+		}
+		if q.Limit > 0 {
+			output.WriteString(fmt.Sprintf("Used: %d bytes (%.1f%%)\n", q.Usage, float64(q.Usage)*100/float64(q.Limit)))
+		} else {
+			output.WriteString(fmt.Sprintf("Used: %d bytes\n", q.Usage))
+		}
+		output.WriteString(fmt.Sprintf("Used in Drive: %d bytes\n", q.UsageInDrive))
+		output.WriteString(fmt.Sprintf("Used in Drive Trash: %d bytes\n", q.UsageInDriveTrash))
+		if q.Limit > 0 {
+			output.WriteString(fmt.Sprintf("Available: %d bytes\n", q.Limit-q.Usage))
+		}
+	}
+
+	result := ToolResult{
+		Content: []ContentItem{
+			{
+				Type: "text",
+				Text: output.String(),
+			},
+		},
+	}
+	s.sendResponse(id, result)
+}
+
+// stdoutMu serializes writes to stdoutWriter so that concurrent responses
+// can never interleave JSON-RPC lines on the protocol stream.
+var (
+	stdoutMu     sync.Mutex
+	stdoutWriter io.Writer = os.Stdout
+)
+
+// writeMessage writes a single newline-terminated JSON-RPC message to stdout.
+func writeMessage(data []byte) {
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+	stdoutWriter.Write(append(data, '\n'))
+}
+
 func (s *MCPServer) sendResponse(id interface{}, result interface{}) {
 	resp := JSONRPCResponse{
 		JSONRPC: "2.0",
@@ -1082,7 +2580,7 @@ func (s *MCPServer) sendResponse(id interface{}, result interface{}) {
 		return
 	}
 
-	fmt.Println(string(data))
+	writeMessage(data)
 	logger.Printf("Sent response for request ID: %v\n", id)
 }
 
@@ -1106,5 +2604,5 @@ func (s *MCPServer) sendError(id interface{}, code int, message string, data int
 		return
 	}
 
-	fmt.Println(string(jsonData))
+	writeMessage(jsonData)
 }
@@ -0,0 +1,821 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+func TestMain(m *testing.M) {
+	logger = log.New(io.Discard, "", 0)
+	driveRetryBase = time.Millisecond
+	os.Exit(m.Run())
+}
+
+// newTestServer returns an MCPServer whose Drive client talks to handler,
+// and a counter of the requests handler has received.
+func newTestServer(t *testing.T, handler http.HandlerFunc) (*MCPServer, *atomic.Int32) {
+	t.Helper()
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	svc, err := drive.NewService(context.Background(),
+		option.WithHTTPClient(srv.Client()),
+		option.WithEndpoint(srv.URL+"/"))
+	if err != nil {
+		t.Fatalf("drive.NewService: %v", err)
+	}
+	return &MCPServer{driveService: svc}, &requests
+}
+
+// failFirst answers the first n requests with status and the rest with body.
+func failFirst(n int32, status int, body string) http.HandlerFunc {
+	var seen atomic.Int32
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if seen.Add(1) <= n {
+			w.WriteHeader(status)
+			fmt.Fprintf(w, `{"error":{"code":%d,"message":"backend error"}}`, status)
+			return
+		}
+		io.WriteString(w, body)
+	}
+}
+
+// callTool invokes a tool handler and returns the decoded tool result.
+func callTool(t *testing.T, s *MCPServer, name string, args map[string]interface{}) ToolResult {
+	t.Helper()
+
+	var buf bytes.Buffer
+	stdoutWriter = &buf
+	defer func() { stdoutWriter = os.Stdout }()
+
+	params, _ := json.Marshal(CallToolParams{Name: name, Arguments: args})
+	s.handleCallTool(JSONRPCRequest{JSONRPC: "2.0", ID: 1, Method: "tools/call", Params: params})
+
+	var resp struct {
+		Result ToolResult `json:"result"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &resp); err != nil {
+		t.Fatalf("Unmarshal response %q: %v", buf.String(), err)
+	}
+	return resp.Result
+}
+
+func TestGetFileInfoRetriesServerErrors(t *testing.T) {
+	s, requests := newTestServer(t, failFirst(1, http.StatusServiceUnavailable, `{"id":"abc","name":"report.pdf","mimeType":"application/pdf"}`))
+
+	result := callTool(t, s, "get_file_info", map[string]interface{}{"file_id": "abc"})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %+v", result.Content)
+	}
+	if !strings.Contains(result.Content[0].Text, "Name: report.pdf") {
+		t.Errorf("text = %q, want the file info", result.Content[0].Text)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("requests = %d, want 2", n)
+	}
+}
+
+func TestDriveDoGivesUpAfterMaxAttempts(t *testing.T) {
+	s, requests := newTestServer(t, failFirst(100, http.StatusServiceUnavailable, `{}`))
+
+	err := driveDo(func(ctx context.Context) error {
+		_, err := s.driveService.Files.Get("abc").Context(ctx).Do()
+		return err
+	})
+	if err == nil {
+		t.Fatal("driveDo: want error")
+	}
+	if n := requests.Load(); n != int32(driveMaxAttempts) {
+		t.Errorf("requests = %d, want %d", n, driveMaxAttempts)
+	}
+}
+
+func TestDriveDoDoesNotRetryClientErrors(t *testing.T) {
+	s, requests := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"error":{"code":404,"message":"File not found: abc."}}`)
+	})
+
+	err := driveDo(func(ctx context.Context) error {
+		_, err := s.driveService.Files.Get("abc").Context(ctx).Do()
+		return err
+	})
+	if err == nil || !strings.Contains(err.Error(), "File not found") {
+		t.Errorf("err = %v, want the 404", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("requests = %d, want 1", n)
+	}
+}
+
+func TestDriveCreateRetriesOnlyRateLimits(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		wantRequests int32
+		wantErr      bool
+	}{
+		{"server error", http.StatusServiceUnavailable, 1, true},
+		{"rate limited", http.StatusTooManyRequests, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, requests := newTestServer(t, failFirst(1, tt.status, `{"id":"new","name":"Reports"}`))
+
+			result := callTool(t, s, "create_folder", map[string]interface{}{"name": "Reports"})
+			if result.IsError != tt.wantErr {
+				t.Errorf("IsError = %v, want %v: %+v", result.IsError, tt.wantErr, result.Content)
+			}
+			if n := requests.Load(); n != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", n, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestShareFileDoesNotRetryServerErrors(t *testing.T) {
+	s, requests := newTestServer(t, failFirst(1, http.StatusInternalServerError, `{"id":"perm"}`))
+
+	result := callTool(t, s, "share_file", map[string]interface{}{"file_id": "abc", "email": "a@example.com", "role": "reader"})
+	if !result.IsError {
+		t.Errorf("result = %+v, want the 500 reported", result.Content)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("requests = %d, want 1", n)
+	}
+}
+
+func TestDriveDoTimesOut(t *testing.T) {
+	prev := driveTimeout
+	driveTimeout = 20 * time.Millisecond
+	defer func() { driveTimeout = prev }()
+
+	s, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	err := driveDo(func(ctx context.Context) error {
+		_, err := s.driveService.Files.Get("abc").Context(ctx).Do()
+		return err
+	})
+	if err == nil || !strings.Contains(err.Error(), "timed out after 20ms") {
+		t.Errorf("err = %v, want a timeout error", err)
+	}
+}
+
+func TestDownloadContentOutlastsTimeout(t *testing.T) {
+	prev := driveTimeout
+	driveTimeout = 50 * time.Millisecond
+	defer func() { driveTimeout = prev }()
+
+	s, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		// The headers arrive in time, but the body takes longer than
+		// driveTimeout.
+		io.WriteString(w, "first half, ")
+		w.(http.Flusher).Flush()
+		time.Sleep(150 * time.Millisecond)
+		io.WriteString(w, "second half")
+	})
+
+	content, err := downloadContent(func(ctx context.Context) (*http.Response, error) {
+		return s.driveService.Files.Get("abc").Context(ctx).Download()
+	})
+	if err != nil {
+		t.Fatalf("downloadContent: %v", err)
+	}
+	if string(content) != "first half, second half" {
+		t.Errorf("content = %q", content)
+	}
+}
+
+func TestDownloadContentTimesOutWaitingForHeaders(t *testing.T) {
+	prev := driveTimeout
+	driveTimeout = 20 * time.Millisecond
+	defer func() { driveTimeout = prev }()
+
+	s, requests := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	_, err := downloadContent(func(ctx context.Context) (*http.Response, error) {
+		return s.driveService.Files.Get("abc").Context(ctx).Download()
+	})
+	if err == nil || !strings.Contains(err.Error(), "timed out after 20ms") {
+		t.Errorf("err = %v, want a timeout error", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("requests = %d, want 1", n)
+	}
+}
+
+func TestTransferTimeout(t *testing.T) {
+	prev := driveTimeout
+	defer func() { driveTimeout = prev }()
+
+	driveTimeout = 2 * time.Minute
+	if got := transferTimeout(0); got != 2*time.Minute {
+		t.Errorf("transferTimeout(0) = %s, want 2m0s", got)
+	}
+	if got := transferTimeout(100 * minTransferRate); got != 2*time.Minute+100*time.Second {
+		t.Errorf("transferTimeout(100 * minTransferRate) = %s, want 3m40s", got)
+	}
+	driveTimeout = 0
+	if got := transferTimeout(1 << 30); got != 0 {
+		t.Errorf("transferTimeout with no driveTimeout = %s, want 0", got)
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"45s", 45 * time.Second},
+		{"5m", 5 * time.Minute},
+		{"90", 90 * time.Second},
+		{"0", 0},
+	}
+	for _, tt := range tests {
+		got, err := parseTimeout(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseTimeout(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"-1", "-5s", "soon"} {
+		if _, err := parseTimeout(bad); err == nil {
+			t.Errorf("parseTimeout(%q): want error", bad)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		attempt   int
+		wantDelay time.Duration
+		wantRetry bool
+	}{
+		{"503 backs off", &googleapi.Error{Code: 503}, 2, 4 * time.Millisecond, true},
+		{"429 with Retry-After", &googleapi.Error{Code: 429, Header: http.Header{"Retry-After": {"7"}}}, 0, 7 * time.Second, true},
+		{"Retry-After is capped", &googleapi.Error{Code: 429, Header: http.Header{"Retry-After": {"3600"}}}, 0, driveMaxBackoff, true},
+		{"403 rate limit", &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}}, 0, time.Millisecond, true},
+		{"403 forbidden", &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "insufficientFilePermissions"}}}, 0, 0, false},
+		{"404", &googleapi.Error{Code: 404}, 0, 0, false},
+		{"not an API error", io.ErrUnexpectedEOF, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, retry := retryDelay(tt.err, tt.attempt)
+			if delay != tt.wantDelay || retry != tt.wantRetry {
+				t.Errorf("retryDelay = %s, %v, want %s, %v", delay, retry, tt.wantDelay, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestListRevisions(t *testing.T) {
+	s, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/files/abc/revisions" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("pageToken") == "" {
+			io.WriteString(w, `{"nextPageToken":"p2","revisions":[{"id":"r1","modifiedTime":"2024-01-01T00:00:00Z","size":"10","mimeType":"text/plain"}]}`)
+			return
+		}
+		io.WriteString(w, `{"revisions":[{"id":"r2","modifiedTime":"2024-02-01T00:00:00Z","size":"12","mimeType":"text/plain","keepForever":true}]}`)
+	})
+
+	result := callTool(t, s, "list_revisions", map[string]interface{}{"file_id": "abc"})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %+v", result.Content)
+	}
+	text := result.Content[0].Text
+	for _, want := range []string{"Found 2 revision(s)", "ID: r1", "Size: 10 bytes", "ID: r2", "Modified: 2024-02-01T00:00:00Z", "Kept forever: yes"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text = %q, want it to contain %q", text, want)
+		}
+	}
+}
+
+func TestDownloadRevision(t *testing.T) {
+	s, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path != "/files/abc/revisions/r1":
+			http.NotFound(w, r)
+		case r.URL.Query().Get("alt") == "media":
+			io.WriteString(w, "old contents")
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"id":"r1","mimeType":"text/plain","modifiedTime":"2024-01-01T00:00:00Z","size":"12"}`)
+		}
+	})
+
+	result := callTool(t, s, "download_revision", map[string]interface{}{"file_id": "abc", "revision_id": "r1"})
+	if result.IsError || !strings.HasSuffix(result.Content[0].Text, "\n\nold contents") {
+		t.Errorf("result = %+v, want the revision's contents", result)
+	}
+
+	out := filepath.Join(t.TempDir(), "old.txt")
+	result = callTool(t, s, "download_revision", map[string]interface{}{"file_id": "abc", "revision_id": "r1", "output_path": out})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %+v", result.Content)
+	}
+	if data, err := os.ReadFile(out); err != nil || string(data) != "old contents" {
+		t.Errorf("saved %q, %v; want the revision's contents", data, err)
+	}
+}
+
+func TestCreateShortcut(t *testing.T) {
+	var created drive.File
+	s, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/files/abc":
+			io.WriteString(w, `{"name":"report.pdf"}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/files":
+			json.NewDecoder(r.Body).Decode(&created)
+			io.WriteString(w, `{"id":"s1","name":"report.pdf"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	result := callTool(t, s, "create_shortcut", map[string]interface{}{"target_id": "abc", "folder_id": "f1"})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %+v", result.Content)
+	}
+	if created.MimeType != "application/vnd.google-apps.shortcut" || created.Name != "report.pdf" ||
+		created.ShortcutDetails == nil || created.ShortcutDetails.TargetId != "abc" ||
+		len(created.Parents) != 1 || created.Parents[0] != "f1" {
+		t.Errorf("created %+v, want a shortcut to abc named report.pdf in f1", created)
+	}
+	if !strings.Contains(result.Content[0].Text, "Shortcut ID: s1") {
+		t.Errorf("text = %q, want the shortcut ID", result.Content[0].Text)
+	}
+}
+
+func TestCreateShortcutDoesNotRetryServerErrors(t *testing.T) {
+	var creates atomic.Int32
+	s, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			creates.Add(1)
+			w.WriteHeader(http.StatusBadGateway)
+			io.WriteString(w, `{"error":{"code":502,"message":"backend error"}}`)
+			return
+		}
+		io.WriteString(w, `{"name":"report.pdf"}`)
+	})
+
+	result := callTool(t, s, "create_shortcut", map[string]interface{}{"target_id": "abc", "folder_id": "f1"})
+	if !result.IsError {
+		t.Errorf("result = %+v, want the 502 reported", result.Content)
+	}
+	if n := creates.Load(); n != 1 {
+		t.Errorf("create requests = %d, want 1", n)
+	}
+}
+
+func TestBuildFilesQuery(t *testing.T) {
+	tests := []struct {
+		query, folderID string
+		includeTrashed  bool
+		want            string
+	}{
+		{"", "", false, "trashed = false"},
+		{"", "", true, ""},
+		{"name contains 'a' or name contains 'b'", "f1", false, "(name contains 'a' or name contains 'b') and 'f1' in parents and trashed = false"},
+		{"trashed = true", "", false, "(trashed = true)"},
+		{"trashed=true", "", false, "(trashed=true)"},
+		{"trashed != false", "", false, "(trashed != false)"},
+		{"name contains 'trashed'", "", false, "(name contains 'trashed') and trashed = false"},
+		{"fullText contains 'untrashed=yes'", "", false, "(fullText contains 'untrashed=yes') and trashed = false"},
+	}
+	for _, tt := range tests {
+		if got := buildFilesQuery(tt.query, tt.folderID, tt.includeTrashed); got != tt.want {
+			t.Errorf("buildFilesQuery(%q, %q, %v) = %q, want %q", tt.query, tt.folderID, tt.includeTrashed, got, tt.want)
+		}
+	}
+}
+
+func TestListFilesOrderBy(t *testing.T) {
+	var got url.Values
+	s, requests := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"files":[]}`)
+	})
+
+	result := callTool(t, s, "search_files", map[string]interface{}{"query": "name contains 'budget'", "order_by": "folder,modifiedTime desc"})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %+v", result.Content)
+	}
+	if got.Get("orderBy") != "folder,modifiedTime desc" || got.Get("q") != "(name contains 'budget') and trashed = false" {
+		t.Errorf("orderBy = %q, q = %q", got.Get("orderBy"), got.Get("q"))
+	}
+
+	for _, orderBy := range []string{"size", "name asc", "name desc desc", "name,"} {
+		if err := validateOrderBy(orderBy); err == nil {
+			t.Errorf("validateOrderBy(%q): want error", orderBy)
+		}
+	}
+	callTool(t, s, "list_files", map[string]interface{}{"order_by": "size"})
+	if n := requests.Load(); n != 1 {
+		t.Errorf("requests = %d, want the invalid order_by rejected before calling Drive", n)
+	}
+}
+
+func TestListPermissions(t *testing.T) {
+	var query url.Values
+	s, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/files/abc/permissions" {
+			http.NotFound(w, r)
+			return
+		}
+		query = r.URL.Query()
+		if query.Get("pageToken") == "" {
+			io.WriteString(w, `{"nextPageToken":"p2","permissions":[{"id":"p1","type":"user","role":"writer","emailAddress":"alice@example.com","displayName":"Alice"}]}`)
+			return
+		}
+		io.WriteString(w, `{"permissions":[{"id":"anyoneWithLink","type":"anyone","role":"reader"},{"id":"p3","type":"domain","role":"reader","domain":"example.com"}]}`)
+	})
+
+	result := callTool(t, s, "list_permissions", map[string]interface{}{"file_id": "abc"})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %+v", result.Content)
+	}
+	text := result.Content[0].Text
+	for _, want := range []string{
+		"Found 3 permission(s)",
+		"1. ID: p1\n   Type: user\n   Role: writer\n   Email: alice@example.com\n   Name: Alice\n",
+		"2. ID: anyoneWithLink\n   Type: anyone\n   Role: reader\n\n",
+		"3. ID: p3\n   Type: domain\n   Role: reader\n   Domain: example.com\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text = %q, want it to contain %q", text, want)
+		}
+	}
+	if query.Get("supportsAllDrives") != "true" {
+		t.Errorf("supportsAllDrives = %q, want true", query.Get("supportsAllDrives"))
+	}
+
+	result = callTool(t, s, "list_permissions", map[string]interface{}{})
+	if len(result.Content) != 0 {
+		t.Errorf("result = %+v, want an invalid-arguments error", result)
+	}
+}
+
+func TestRevokePermission(t *testing.T) {
+	var method, path string
+	var query url.Values
+	s, requests := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		method, path, query = r.Method, r.URL.Path, r.URL.Query()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	result := callTool(t, s, "revoke_permission", map[string]interface{}{"file_id": "abc", "permission_id": "p1"})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %+v", result.Content)
+	}
+	if method != http.MethodDelete || path != "/files/abc/permissions/p1" || query.Get("supportsAllDrives") != "true" {
+		t.Errorf("request = %s %s?%s, want DELETE /files/abc/permissions/p1 on all drives", method, path, query.Encode())
+	}
+
+	for _, args := range []map[string]interface{}{{"permission_id": "p1"}, {"file_id": "abc"}} {
+		callTool(t, s, "revoke_permission", args)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("requests = %d, want missing IDs rejected before calling Drive", n)
+	}
+}
+
+func TestRevisionToolsRequireIDs(t *testing.T) {
+	s, requests := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+
+	for _, c := range []struct {
+		tool string
+		args map[string]interface{}
+	}{
+		{"list_revisions", map[string]interface{}{}},
+		{"download_revision", map[string]interface{}{"revision_id": "r1"}},
+		{"download_revision", map[string]interface{}{"file_id": "abc"}},
+	} {
+		if result := callTool(t, s, c.tool, c.args); len(result.Content) != 0 {
+			t.Errorf("%s(%v) = %+v, want an invalid-arguments error", c.tool, c.args, result)
+		}
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("requests = %d, want none", n)
+	}
+}
+
+func TestListTrash(t *testing.T) {
+	var query url.Values
+	s, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"files":[{"id":"abc","name":"old.txt","mimeType":"text/plain"}]}`)
+	})
+
+	result := callTool(t, s, "list_trash", map[string]interface{}{"max_results": "5", "query": "trashed = false"})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %+v", result.Content)
+	}
+	if query.Get("q") != "(trashed = true)" || query.Get("pageSize") != "5" {
+		t.Errorf("q = %q, pageSize = %q, want only trashed files", query.Get("q"), query.Get("pageSize"))
+	}
+	if !strings.Contains(result.Content[0].Text, "old.txt") {
+		t.Errorf("text = %q, want the trashed file", result.Content[0].Text)
+	}
+}
+
+func TestRestoreFile(t *testing.T) {
+	var method, path string
+	var body map[string]interface{}
+	s, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"abc","name":"old.txt"}`)
+	})
+
+	result := callTool(t, s, "restore_file", map[string]interface{}{"file_id": "abc"})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %+v", result.Content)
+	}
+	if method != http.MethodPatch || path != "/files/abc" {
+		t.Errorf("request = %s %s, want PATCH /files/abc", method, path)
+	}
+	if trashed, ok := body["trashed"]; !ok || trashed != false {
+		t.Errorf("body = %v, want trashed: false", body)
+	}
+}
+
+func TestGetStorageQuota(t *testing.T) {
+	tests := []struct {
+		name   string
+		quota  string
+		want   []string
+		absent string
+	}{
+		{
+			"limited",
+			`{"limit":"16000000000","usage":"12000000000","usageInDrive":"9000000000","usageInDriveTrash":"500000000"}`,
+			[]string{"Total: 16000000000 bytes", "Used: 12000000000 bytes (75.0%)", "Used in Drive: 9000000000 bytes", "Used in Drive Trash: 500000000 bytes", "Available: 4000000000 bytes"},
+			"unlimited",
+		},
+		{
+			"unlimited",
+			`{"usage":"42","usageInDrive":"40","usageInDriveTrash":"2"}`,
+			[]string{"Total: unlimited", "Used: 42 bytes\n", "Used in Drive: 40 bytes"},
+			"Available",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields string
+			s, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/about" {
+					http.NotFound(w, r)
+					return
+				}
+				fields = r.URL.Query().Get("fields")
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"user":{"displayName":"Alice","emailAddress":"alice@example.com"},"storageQuota":%s}`, tt.quota)
+			})
+
+			result := callTool(t, s, "get_storage_quota", map[string]interface{}{})
+			if result.IsError {
+				t.Fatalf("unexpected tool error: %+v", result.Content)
+			}
+			if fields != "storageQuota, user" {
+				t.Errorf("fields = %q, want storageQuota, user", fields)
+			}
+			text := result.Content[0].Text
+			for _, want := range append(tt.want, "User: Alice (alice@example.com)") {
+				if !strings.Contains(text, want) {
+					t.Errorf("text = %q, want it to contain %q", text, want)
+				}
+			}
+			if strings.Contains(text, tt.absent) {
+				t.Errorf("text = %q, want it not to contain %q", text, tt.absent)
+			}
+		})
+	}
+}
+
+func TestUploadFileChoosesUploadType(t *testing.T) {
+	defer func(old int64) { resumableUploadThreshold = old }(resumableUploadThreshold)
+	resumableUploadThreshold = 16
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"below threshold", "short", "multipart"},
+		{"at threshold", strings.Repeat("x", 16), "multipart"},
+		{"above threshold", strings.Repeat("x", 17), "resumable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			var uploadType, contentType string
+			var uploaded bytes.Buffer
+			s, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch {
+				case r.Method == http.MethodPost && r.URL.Query().Get("uploadType") == "resumable":
+					uploadType = "resumable"
+					contentType = r.Header.Get("X-Upload-Content-Type")
+					w.Header().Set("Location", "http://"+r.Host+"/upload/session")
+				case r.URL.Path == "/upload/session":
+					io.Copy(&uploaded, r.Body)
+					io.WriteString(w, `{"id":"u1","name":"notes.txt"}`)
+				case r.Method == http.MethodPost:
+					uploadType = r.URL.Query().Get("uploadType")
+					io.Copy(&uploaded, r.Body)
+					io.WriteString(w, `{"id":"u1","name":"notes.txt"}`)
+				default:
+					http.NotFound(w, r)
+				}
+			})
+
+			result := callTool(t, s, "upload_file", map[string]interface{}{"file_path": path})
+			if result.IsError {
+				t.Fatalf("unexpected tool error: %+v", result.Content)
+			}
+			if uploadType != tt.want {
+				t.Errorf("uploadType = %q, want %q", uploadType, tt.want)
+			}
+			if tt.want == "resumable" && contentType != "text/plain" {
+				t.Errorf("X-Upload-Content-Type = %q, want text/plain", contentType)
+			}
+			if !strings.Contains(uploaded.String(), tt.content) {
+				t.Errorf("uploaded body %q does not contain the file content", uploaded.String())
+			}
+			if want := fmt.Sprintf("Size: %d bytes", len(tt.content)); !strings.Contains(result.Content[0].Text, want) {
+				t.Errorf("text = %q, want %q", result.Content[0].Text, want)
+			}
+		})
+	}
+}
+
+func TestResumableUploadOutlastsTimeout(t *testing.T) {
+	defer func(old int64) { resumableUploadThreshold = old }(resumableUploadThreshold)
+	resumableUploadThreshold = 16
+	prev := driveTimeout
+	driveTimeout = 50 * time.Millisecond
+	defer func() { driveTimeout = prev }()
+
+	path := filepath.Join(t.TempDir(), "big.bin")
+	content := strings.Repeat("x", 64)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var uploaded bytes.Buffer
+	s, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Query().Get("uploadType") == "resumable":
+			w.Header().Set("Location", "http://"+r.Host+"/upload/session")
+		case r.URL.Path == "/upload/session":
+			// The chunk takes well past driveTimeout to be accepted.
+			io.Copy(&uploaded, r.Body)
+			time.Sleep(4 * driveTimeout)
+			io.WriteString(w, `{"id":"u1","name":"big.bin"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	result := callTool(t, s, "upload_file", map[string]interface{}{"file_path": path})
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %+v", result.Content)
+	}
+	if uploaded.String() != content {
+		t.Errorf("uploaded %q, want the file content", uploaded.String())
+	}
+}
+
+func TestUploadMimeType(t *testing.T) {
+	tests := map[string]string{
+		"notes.txt":   "text/plain",
+		"report.PDF":  "application/pdf",
+		"photo.png":   "image/png",
+		"archive.xyz": "application/octet-stream",
+		"Makefile":    "application/octet-stream",
+	}
+	for path, want := range tests {
+		if got := uploadMimeType(path); got != want {
+			t.Errorf("uploadMimeType(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestUploadFileRejectsDirectory(t *testing.T) {
+	s, requests := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {})
+	result := callTool(t, s, "upload_file", map[string]interface{}{"file_path": t.TempDir()})
+	if !result.IsError || !strings.Contains(result.Content[0].Text, "is a directory") {
+		t.Errorf("result = %+v, want a directory error", result)
+	}
+	if requests.Load() != 0 {
+		t.Errorf("made %d requests, want none", requests.Load())
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		value    string
+		want     []string
+		readOnly bool
+	}{
+		{"", []string{drive.DriveScope, drive.DriveFileScope, drive.DriveMetadataReadonlyScope}, false},
+		{"drive.readonly", []string{drive.DriveReadonlyScope}, true},
+		{" drive.readonly , drive.metadata.readonly ", []string{drive.DriveReadonlyScope, drive.DriveMetadataReadonlyScope}, true},
+		{"drive.file,drive.readonly", []string{drive.DriveFileScope, drive.DriveReadonlyScope}, false},
+		{"drive,drive", []string{drive.DriveScope}, false},
+	}
+	for _, tt := range tests {
+		got, readOnly, err := parseScopes(tt.value)
+		if err != nil {
+			t.Errorf("parseScopes(%q): %v", tt.value, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) || readOnly != tt.readOnly {
+			t.Errorf("parseScopes(%q) = %v, %v, want %v, %v", tt.value, got, readOnly, tt.want, tt.readOnly)
+		}
+	}
+
+	for _, value := range []string{"drive.write", "drive,photos", ","} {
+		if _, _, err := parseScopes(value); err == nil {
+			t.Errorf("parseScopes(%q) succeeded, want an error", value)
+		}
+	}
+}
+
+func TestReadOnlyModeRejectsWriteTools(t *testing.T) {
+	s, requests := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"files":[]}`)
+	})
+	s.readOnly = true
+
+	for _, tc := range []struct {
+		tool string
+		args map[string]interface{}
+	}{
+		{"upload_file", map[string]interface{}{"file_path": "/etc/hostname"}},
+		{"delete_file", map[string]interface{}{"file_id": "abc"}},
+		{"share_file", map[string]interface{}{"file_id": "abc", "email": "a@example.com", "role": "reader"}},
+	} {
+		result := callTool(t, s, tc.tool, tc.args)
+		if !result.IsError || !strings.Contains(result.Content[0].Text, "server is in read-only mode") {
+			t.Errorf("%s: result = %+v, want a read-only error", tc.tool, result)
+		}
+	}
+	if requests.Load() != 0 {
+		t.Fatalf("made %d requests for write tools, want none", requests.Load())
+	}
+
+	if result := callTool(t, s, "list_files", nil); result.IsError {
+		t.Errorf("list_files in read-only mode: %+v", result.Content)
+	}
+}
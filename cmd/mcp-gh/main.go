@@ -6,10 +6,19 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/soyeahso/hunter3/internal/logfile"
 )
 
 // JSON-RPC types
@@ -82,7 +91,8 @@ type InitializeResult struct {
 }
 
 type Capabilities struct {
-	Tools map[string]interface{} `json:"tools"`
+	Tools   map[string]interface{} `json:"tools"`
+	Prompts map[string]interface{} `json:"prompts"`
 }
 
 type ServerInfo struct {
@@ -94,6 +104,37 @@ type ListToolsResult struct {
 	Tools []Tool `json:"tools"`
 }
 
+type Prompt struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+type ListPromptsResult struct {
+	Prompts []Prompt `json:"prompts"`
+}
+
+type GetPromptParams struct {
+	Name      string            `json:"name"`
+	Arguments map[string]string `json:"arguments"`
+}
+
+type PromptMessage struct {
+	Role    string      `json:"role"`
+	Content ContentItem `json:"content"`
+}
+
+type GetPromptResult struct {
+	Description string          `json:"description"`
+	Messages    []PromptMessage `json:"messages"`
+}
+
 // GhResult is returned from executeGhCommand as JSON.
 type GhResult struct {
 	Command string `json:"command"`
@@ -101,6 +142,20 @@ type GhResult struct {
 	Stdout  string `json:"stdout,omitempty"`
 	Stderr  string `json:"stderr,omitempty"`
 	Error   string `json:"error,omitempty"`
+
+	// JSON holds the parsed output of commands run with --json, in place
+	// of Stdout.
+	JSON json.RawMessage `json:"json,omitempty"`
+}
+
+// HealthReport is returned from gh_health as JSON.
+type HealthReport struct {
+	Ready         bool     `json:"ready"`
+	GhPath        string   `json:"gh_path,omitempty"`
+	Version       string   `json:"version,omitempty"`
+	Authenticated bool     `json:"authenticated"`
+	Hosts         []string `json:"hosts,omitempty"`
+	Problems      []string `json:"problems,omitempty"`
 }
 
 // Helper constructors for schema properties
@@ -117,39 +172,37 @@ func stringArrayProp(desc string) Property {
 	return Property{Type: "array", Description: desc, Items: &ItemType{Type: "string"}}
 }
 
+func integerProp(desc string) Property {
+	return Property{Type: "integer", Description: desc}
+}
+
 func intProp(desc string, min, max int) Property {
 	return Property{Type: "number", Description: desc, Minimum: &min, Maximum: &max}
 }
 
 // MCPServer handles the JSON-RPC stdin/stdout protocol.
-type MCPServer struct{}
+type MCPServer struct {
+	// outputLimit is the byte cap on command output for the tool call in
+	// progress; see maxOutputBytes.
+	outputLimit int
+}
 
 var logger *log.Logger
 
 func initLogger() {
-	// Create logs directory if it doesn't exist
-	logsDir := filepath.Join(os.Getenv("HOME"), ".hunter3", "logs")
-	if err := os.MkdirAll(logsDir, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create logs directory: %v\n", err)
-		return
-	}
-
-	// Open log file
-	logFile := filepath.Join(logsDir, "mcp-gh.log")
-	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to open log file: %v\n", err)
-		return
-	}
-
-	// Create logger that writes to both file and stderr
-	logger = log.New(io.MultiWriter(f, os.Stderr), "[mcp-gh] ", log.LstdFlags)
+	// Log to stderr and to a file rotated by size and readable only by the owner
+	logger = logfile.NewLogger("mcp-gh")
 	logger.Println("MCP GitHub CLI server starting...")
 }
 
 func main() {
 	initLogger()
 	initAllowedPaths()
+	initAllowedRepos()
+	initMaxOutputBytes()
+	if report := checkHealth(); !report.Ready {
+		logger.Printf("WARNING: gh is not ready: %s\n", strings.Join(report.Problems, "; "))
+	}
 	s := &MCPServer{}
 	logger.Println("Server initialized")
 	s.Run()
@@ -167,7 +220,8 @@ func (s *MCPServer) Run() {
 		if line == "" {
 			continue
 		}
-		logger.Printf("Received request: %s\n", line)
+		// The raw line is not logged, since tool arguments can carry secrets.
+		logger.Printf("Received request (%d bytes)\n", len(line))
 		s.handleRequest(line)
 	}
 	if err := scanner.Err(); err != nil && err != io.EOF {
@@ -194,6 +248,10 @@ func (s *MCPServer) handleRequest(line string) {
 		s.handleListTools(req)
 	case "tools/call":
 		s.handleCallTool(req)
+	case "prompts/list":
+		s.handleListPrompts(req)
+	case "prompts/get":
+		s.handleGetPrompt(req)
 	case "notifications/initialized":
 		// no-op
 		logger.Println("Received initialized notification")
@@ -207,8 +265,126 @@ func (s *MCPServer) handleInitialize(req JSONRPCRequest) {
 	logger.Println("Handling initialize request")
 	s.sendResponse(req.ID, InitializeResult{
 		ProtocolVersion: "2024-11-05",
-		Capabilities:    Capabilities{Tools: map[string]interface{}{}},
-		ServerInfo:      ServerInfo{Name: "mcp-gh", Version: "1.0.0"},
+		Capabilities: Capabilities{
+			Tools:   map[string]interface{}{},
+			Prompts: map[string]interface{}{},
+		},
+		ServerInfo: ServerInfo{Name: "mcp-gh", Version: "1.0.0"},
+	})
+}
+
+// ---------- Prompt definitions ----------
+
+// promptTemplate pairs an advertised prompt with the message text it expands
+// to. Placeholders of the form {{name}} are replaced with argument values;
+// optional arguments that were not supplied fall back to defaults.
+type promptTemplate struct {
+	prompt   Prompt
+	defaults map[string]string
+	text     string
+}
+
+var promptTemplates = []promptTemplate{
+	{
+		prompt: Prompt{
+			Name:        "triage-open-issues",
+			Description: "Review the open issues in a repository, then label, prioritize, and flag stale or duplicate ones.",
+			Arguments: []PromptArgument{
+				{Name: "repo", Description: "Repository in OWNER/REPO format", Required: true},
+				{Name: "label", Description: "Only triage issues with this label (optional)"},
+				{Name: "limit", Description: "Maximum number of issues to review (default: 30)"},
+			},
+		},
+		defaults: map[string]string{"label": "", "limit": "30"},
+		text: `Triage the open issues in {{repo}}.
+
+1. Call gh_issue_list with repo "{{repo}}", state "open", label "{{label}}" (omit if empty), and limit {{limit}}.
+2. For each issue that needs more context, call gh_issue_view with repo "{{repo}}" and the issue number.
+3. Group the issues into: bugs, feature requests, questions, and stale or duplicate issues.
+4. For each group, suggest a priority (high/medium/low) and any labels that should be added.
+5. List issues that look safe to close, with a one-line reason each. Do not close anything without confirmation.`,
+	},
+	{
+		prompt: Prompt{
+			Name:        "review-pr",
+			Description: "Review a pull request: read its description and diff, check CI status, and draft review feedback.",
+			Arguments: []PromptArgument{
+				{Name: "repo", Description: "Repository in OWNER/REPO format", Required: true},
+				{Name: "number", Description: "Pull request number", Required: true},
+			},
+		},
+		text: `Review pull request #{{number}} in {{repo}}.
+
+1. Call gh_pr_view with repo "{{repo}}" and number "{{number}}" to read the title, description, and linked issues.
+2. Call gh_pr_diff with repo "{{repo}}" and number "{{number}}" to read the changes.
+3. Call gh_run_list with repo "{{repo}}" and flags ["--branch", <the PR's head branch>] to check CI status.
+4. Summarize what the PR changes, then list correctness issues, missing tests, and style concerns, citing file and line.
+5. Recommend approve, comment, or request changes. Only submit a review with gh_pr_review after confirmation.`,
+	},
+}
+
+func findPromptTemplate(name string) (promptTemplate, bool) {
+	for _, t := range promptTemplates {
+		if t.prompt.Name == name {
+			return t, true
+		}
+	}
+	return promptTemplate{}, false
+}
+
+// render fills in the template's placeholders, returning an error if a
+// required argument is missing.
+func (t promptTemplate) render(args map[string]string) (string, error) {
+	var pairs []string
+	for _, arg := range t.prompt.Arguments {
+		val := args[arg.Name]
+		if val == "" {
+			if arg.Required {
+				return "", fmt.Errorf("missing required argument: %s", arg.Name)
+			}
+			val = t.defaults[arg.Name]
+		}
+		pairs = append(pairs, "{{"+arg.Name+"}}", val)
+	}
+	return strings.NewReplacer(pairs...).Replace(t.text), nil
+}
+
+func (s *MCPServer) handleListPrompts(req JSONRPCRequest) {
+	logger.Println("Handling list prompts request")
+	prompts := make([]Prompt, 0, len(promptTemplates))
+	for _, t := range promptTemplates {
+		prompts = append(prompts, t.prompt)
+	}
+	s.sendResponse(req.ID, ListPromptsResult{Prompts: prompts})
+}
+
+func (s *MCPServer) handleGetPrompt(req JSONRPCRequest) {
+	var params GetPromptParams
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		logger.Printf("Invalid params: %v\n", err)
+		s.sendError(req.ID, -32602, "Invalid params", err.Error())
+		return
+	}
+
+	logger.Printf("Getting prompt: %s\n", params.Name)
+
+	t, ok := findPromptTemplate(params.Name)
+	if !ok {
+		s.sendError(req.ID, -32602, "Invalid params", fmt.Sprintf("Prompt not found: %s", params.Name))
+		return
+	}
+
+	text, err := t.render(params.Arguments)
+	if err != nil {
+		s.sendError(req.ID, -32602, "Invalid params", err.Error())
+		return
+	}
+
+	s.sendResponse(req.ID, GetPromptResult{
+		Description: t.prompt.Description,
+		Messages: []PromptMessage{
+			{Role: "user", Content: ContentItem{Type: "text", Text: text}},
+		},
 	})
 }
 
@@ -286,6 +462,45 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 				},
 			},
 		},
+		{
+			Name:        "gh_repo_delete",
+			Description: "Permanently delete a repository. This cannot be undone. Requires confirm=true; only call this when the user has explicitly asked to delete this exact repository.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"repo":    stringProp("Repository to delete (OWNER/REPO)"),
+					"confirm": stringProp("Must be 'true' to confirm the deletion"),
+				},
+				Required: []string{"repo", "confirm"},
+			},
+		},
+		{
+			Name:        "gh_repo_archive",
+			Description: "Archive a repository, making it read-only. Requires confirm=true; only call this when the user has explicitly asked to archive this exact repository.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"repo":    stringProp("Repository to archive (OWNER/REPO)"),
+					"confirm": stringProp("Must be 'true' to confirm archiving"),
+				},
+				Required: []string{"repo", "confirm"},
+			},
+		},
+		{
+			Name:        "gh_browse",
+			Description: "Get the GitHub web URL for a repository, file, issue, pull request, or commit. Prints the URL instead of opening a browser unless no_browser is 'false'.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"repository_path": repoProp,
+					"selector":        stringProp("File path (optionally with :LINE), issue or PR number, or commit SHA (optional; defaults to the repository home page)"),
+					"branch":          stringProp("Branch to show the file or repository at (optional)"),
+					"no_browser":      stringProp("Print the URL instead of opening it (true/false, default true)"),
+					"repo":            stringProp("Repository in OWNER/REPO format (optional)"),
+					"flags":           flagsProp,
+				},
+			},
+		},
 
 		// --- Issue operations ---
 		{
@@ -364,6 +579,21 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 				Required: []string{"number"},
 			},
 		},
+		{
+			Name:        "gh_issue_transfer",
+			Description: "Transfer an issue to another repository. Comments, labels that exist in the destination, and assignees who can be assigned there move with it.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"repository_path":  repoProp,
+					"number":           stringProp("Issue number"),
+					"destination_repo": stringProp("Destination repository in OWNER/REPO format"),
+					"repo":             stringProp("Source repository in OWNER/REPO format (optional)"),
+					"flags":            flagsProp,
+				},
+				Required: []string{"number", "destination_repo"},
+			},
+		},
 
 		// --- Pull Request operations ---
 		{
@@ -434,7 +664,7 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 		},
 		{
 			Name:        "gh_pr_merge",
-			Description: "Merge a pull request.",
+			Description: "Merge a pull request. Set auto to merge once required checks pass, or admin to bypass branch protection.",
 			InputSchema: InputSchema{
 				Type: "object",
 				Properties: map[string]Property{
@@ -442,6 +672,10 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 					"number":          stringProp("PR number"),
 					"merge_method":    stringProp("Merge method: merge, squash, or rebase"),
 					"delete_branch":   stringProp("Delete branch after merge (true/false)"),
+					"auto":            stringProp("Enable auto-merge: merge once requirements are met (true/false)"),
+					"admin":           stringProp("Use administrator privileges to merge despite unmet requirements (true/false)"),
+					"subject":         stringProp("Subject for the merge commit (optional)"),
+					"body":            stringProp("Body for the merge commit (optional)"),
 					"repo":            stringProp("Repository in OWNER/REPO format (optional)"),
 					"flags":           flagsProp,
 				},
@@ -483,13 +717,16 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 		},
 		{
 			Name:        "gh_pr_diff",
-			Description: "View changes in a pull request.",
+			Description: "View changes in a pull request. Use name_only to list the changed files first, then patch or the plain diff for the details.",
 			InputSchema: InputSchema{
 				Type: "object",
 				Properties: map[string]Property{
 					"repository_path": repoProp,
 					"number":          stringProp("PR number"),
 					"repo":            stringProp("Repository in OWNER/REPO format (optional)"),
+					"patch":           stringProp("Show the commits as a series of patches (true/false)"),
+					"name_only":       stringProp("List only the names of changed files (true/false)"),
+					"color":           {Type: "string", Description: "Colorize the output", Enum: prDiffColors, Default: "never"},
 					"flags":           flagsProp,
 				},
 				Required: []string{"number"},
@@ -513,7 +750,7 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 		},
 		{
 			Name:        "gh_run_view",
-			Description: "View a workflow run.",
+			Description: "View a workflow run, as text, as its full log, or as JSON listing each job and step with its conclusion.",
 			InputSchema: InputSchema{
 				Type: "object",
 				Properties: map[string]Property{
@@ -521,6 +758,8 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 					"run_id":          stringProp("Workflow run ID"),
 					"repo":            stringProp("Repository in OWNER/REPO format (optional)"),
 					"log":             stringProp("View full log (true/false)"),
+					"json":            stringProp("Return the run's status, conclusion, and jobs with their steps as parsed JSON, to find which job or step failed (true/false; not with log)"),
+					"job":             stringProp("View only this job, by job ID (with log, prints just its log)"),
 					"flags":           flagsProp,
 				},
 				Required: []string{"run_id"},
@@ -630,6 +869,40 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 				Required: []string{"tag"},
 			},
 		},
+		{
+			Name:        "gh_release_upload",
+			Description: "Upload assets to an existing release.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"repository_path": repoProp,
+					"tag":             stringProp("Release tag"),
+					"files":           stringArrayProp("Paths of files to upload, relative to repository_path or absolute. Append '#Label' to set a display label."),
+					"clobber":         stringProp("Overwrite existing assets of the same name (true/false)"),
+					"repo":            stringProp("Repository in OWNER/REPO format (optional)"),
+					"flags":           flagsProp,
+				},
+				Required: []string{"tag", "files"},
+			},
+		},
+		{
+			Name:        "gh_release_edit",
+			Description: "Edit a release's title, notes, or draft/prerelease status.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"repository_path": repoProp,
+					"tag":             stringProp("Release tag"),
+					"title":           stringProp("New release title"),
+					"notes":           stringProp("New release notes"),
+					"draft":           stringProp("Set draft status (true/false)"),
+					"prerelease":      stringProp("Set prerelease status (true/false)"),
+					"repo":            stringProp("Repository in OWNER/REPO format (optional)"),
+					"flags":           flagsProp,
+				},
+				Required: []string{"tag"},
+			},
+		},
 
 		// --- Gist operations ---
 		{
@@ -672,7 +945,114 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 			},
 		},
 
+		// --- Project operations ---
+		{
+			Name:        "gh_project_list",
+			Description: "List Projects (v2) owned by a user or organization.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"owner":  stringProp("Login of the owner (user or organization). Use \"@me\" for the current user; defaults to the current user"),
+					"closed": stringProp("Include closed projects (true/false)"),
+					"limit":  intProp("Maximum number of projects to fetch", 1, 1000),
+					"json":   stringProp("Return JSON instead of a table (true/false)"),
+					"flags":  flagsProp,
+				},
+			},
+		},
+		{
+			Name:        "gh_project_item_list",
+			Description: "List the items (issues, pull requests, and draft issues) in a project.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"number": stringProp("Project number"),
+					"owner":  stringProp("Login of the project owner (user or organization), or \"@me\""),
+					"limit":  intProp("Maximum number of items to fetch", 1, 1000),
+					"json":   stringProp("Return JSON instead of a table (true/false)"),
+					"flags":  flagsProp,
+				},
+				Required: []string{"number", "owner"},
+			},
+		},
+		{
+			Name:        "gh_project_item_add",
+			Description: "Add an issue or pull request to a project by its URL.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"number": stringProp("Project number"),
+					"owner":  stringProp("Login of the project owner (user or organization), or \"@me\""),
+					"url":    stringProp("URL of the issue or pull request to add"),
+					"json":   stringProp("Return the new item as JSON (true/false)"),
+					"flags":  flagsProp,
+				},
+				Required: []string{"number", "owner", "url"},
+			},
+		},
+
+		// --- Codespace operations ---
+		{
+			Name:        "gh_codespace_list",
+			Description: "List your codespaces.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"repo":  stringProp("Only list codespaces for this repository (OWNER/REPO)"),
+					"limit": intProp("Maximum number of codespaces to list", 1, 1000),
+					"flags": flagsProp,
+				},
+			},
+		},
+		{
+			Name:        "gh_codespace_create",
+			Description: "Create a codespace for a repository. Returns the new codespace's name.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"repo":    stringProp("Repository to create the codespace for (OWNER/REPO)"),
+					"branch":  stringProp("Branch to check out (default: the repository's default branch)"),
+					"machine": stringProp("Machine type (e.g. basicLinux32gb, standardLinux32gb). Required when the repository offers more than one"),
+					"flags":   flagsProp,
+				},
+				Required: []string{"repo"},
+			},
+		},
+		{
+			Name:        "gh_codespace_stop",
+			Description: "Stop a running codespace.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"name":  stringProp("Codespace name, as shown by gh_codespace_list"),
+					"flags": flagsProp,
+				},
+				Required: []string{"name"},
+			},
+		},
+		{
+			Name:        "gh_codespace_delete",
+			Description: "Delete a codespace. Unpushed work in it is lost.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"name":  stringProp("Codespace name, as shown by gh_codespace_list"),
+					"force": stringProp("Delete even if the codespace has unsaved or unpushed changes (true/false)"),
+					"flags": flagsProp,
+				},
+				Required: []string{"name"},
+			},
+		},
+
 		// --- Auth operations ---
+		{
+			Name:        "gh_health",
+			Description: "Check that the gh CLI is installed and authenticated. Returns the gh binary path, version, authenticated hosts, and any problems. Call this first if other gh tools fail unexpectedly.",
+			InputSchema: InputSchema{
+				Type:       "object",
+				Properties: map[string]Property{},
+			},
+		},
 		{
 			Name:        "gh_auth_status",
 			Description: "View authentication status.",
@@ -733,6 +1113,10 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 					"endpoint": stringProp("API endpoint (e.g., /repos/OWNER/REPO)"),
 					"method":   stringProp("HTTP method (GET, POST, PUT, DELETE, PATCH)"),
 					"field":    stringArrayProp("Add a parameter in key=value format"),
+					"header":   stringArrayProp("Add an HTTP request header in 'Key: Value' format"),
+					"paginate": stringProp("Follow Link headers and fetch every page of results (true/false, GET only)"),
+					"slurp":    stringProp("With paginate, combine all pages into a single JSON array (true/false)"),
+					"jq":       stringProp("jq expression to select values from the response (e.g. '.[].name'), to avoid returning the whole response"),
 					"flags":    flagsProp,
 				},
 				Required: []string{"endpoint"},
@@ -740,6 +1124,13 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 		},
 	}
 
+	for i := range tools {
+		if tools[i].InputSchema.Properties == nil {
+			tools[i].InputSchema.Properties = map[string]Property{}
+		}
+		tools[i].InputSchema.Properties["max_output_bytes"] = integerProp("Truncate stdout and stderr to this many bytes (defaults to HUNTER3_MAX_OUTPUT_BYTES, 1 MiB)")
+	}
+
 	s.sendResponse(req.ID, ListToolsResult{Tools: tools})
 }
 
@@ -756,6 +1147,19 @@ func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
 	logger.Printf("Calling tool: %s\n", params.Name)
 	args := params.Arguments
 
+	if err := checkAllowedRepos(params.Name, args); err != nil {
+		s.sendToolError(req.ID, err.Error())
+		return
+	}
+
+	limit, err := callOutputLimit(args)
+	if err != nil {
+		s.sendToolError(req.ID, err.Error())
+		return
+	}
+	s.outputLimit = limit
+	defer func() { s.outputLimit = 0 }()
+
 	switch params.Name {
 	// Repository
 	case "gh_repo_view":
@@ -768,6 +1172,12 @@ func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
 		s.ghRepoFork(req.ID, args)
 	case "gh_repo_list":
 		s.ghRepoList(req.ID, args)
+	case "gh_repo_delete":
+		s.ghRepoDestructive(req.ID, "delete", args)
+	case "gh_repo_archive":
+		s.ghRepoDestructive(req.ID, "archive", args)
+	case "gh_browse":
+		s.ghBrowse(req.ID, args)
 
 	// Issues
 	case "gh_issue_list":
@@ -780,6 +1190,8 @@ func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
 		s.ghIssueClose(req.ID, args)
 	case "gh_issue_reopen":
 		s.ghIssueReopen(req.ID, args)
+	case "gh_issue_transfer":
+		s.ghIssueTransfer(req.ID, args)
 
 	// Pull Requests
 	case "gh_pr_list":
@@ -820,6 +1232,10 @@ func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
 		s.ghReleaseCreate(req.ID, args)
 	case "gh_release_download":
 		s.ghReleaseDownload(req.ID, args)
+	case "gh_release_upload":
+		s.ghReleaseUpload(req.ID, args)
+	case "gh_release_edit":
+		s.ghReleaseEdit(req.ID, args)
 
 	// Gists
 	case "gh_gist_list":
@@ -829,7 +1245,27 @@ func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
 	case "gh_gist_create":
 		s.ghGistCreate(req.ID, args)
 
+	// Project operations
+	case "gh_project_list":
+		s.ghBuilt(req.ID, args, projectListArgs)
+	case "gh_project_item_list":
+		s.ghBuilt(req.ID, args, projectItemListArgs)
+	case "gh_project_item_add":
+		s.ghBuilt(req.ID, args, projectItemAddArgs)
+
+	// Codespace operations
+	case "gh_codespace_list":
+		s.ghBuilt(req.ID, args, codespaceListArgs)
+	case "gh_codespace_create":
+		s.ghBuilt(req.ID, args, codespaceCreateArgs)
+	case "gh_codespace_stop":
+		s.ghBuilt(req.ID, args, codespaceStopArgs)
+	case "gh_codespace_delete":
+		s.ghBuilt(req.ID, args, codespaceDeleteArgs)
+
 	// Auth
+	case "gh_health":
+		s.ghHealth(req.ID)
 	case "gh_auth_status":
 		s.ghAuthStatus(req.ID, args)
 	case "gh_auth_login":
@@ -940,7 +1376,7 @@ func (s *MCPServer) ghRepoList(id interface{}, args map[string]interface{}) {
 		cmdArgs = append(cmdArgs, owner)
 	}
 	
-	if limit, ok := args["limit"].(float64); ok {
+	if limit, ok := getNumber(args, "limit"); ok {
 		cmdArgs = append(cmdArgs, "--limit", fmt.Sprintf("%d", int(limit)))
 	}
 	
@@ -950,6 +1386,89 @@ func (s *MCPServer) ghRepoList(id interface{}, args map[string]interface{}) {
 	s.runGh(id, "", cmdArgs)
 }
 
+func (s *MCPServer) ghRepoDestructive(id interface{}, action string, args map[string]interface{}) {
+	cmdArgs, err := repoDestructiveArgs(action, args)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	
+	s.runGh(id, "", cmdArgs)
+}
+
+// repoDestructiveArgs builds the gh arguments for gh_repo_delete and
+// gh_repo_archive. gh's own prompt is skipped with --yes, so the caller must
+// pass confirm=true instead, and the repo must be named explicitly rather than
+// inferred from the working directory.
+func repoDestructiveArgs(action string, args map[string]interface{}) ([]string, error) {
+	repo, _ := args["repo"].(string)
+	if repo == "" {
+		return nil, fmt.Errorf("repo is required")
+	}
+	if !isOwnerRepo(repo) {
+		return nil, fmt.Errorf("invalid repo %q: expected OWNER/REPO", repo)
+	}
+	
+	confirmed := false
+	switch v := args["confirm"].(type) {
+	case string:
+		confirmed = v == "true"
+	case bool:
+		confirmed = v
+	}
+	if !confirmed {
+		return nil, fmt.Errorf("refusing to %s %s: confirm must be true", action, repo)
+	}
+	
+	return []string{"repo", action, repo, "--yes"}, nil
+}
+
+func (s *MCPServer) ghBrowse(id interface{}, args map[string]interface{}) {
+	cmdArgs, err := browseArgs(args)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	
+	cwd := getRepoPath(args)
+	s.runGh(id, cwd, cmdArgs)
+}
+
+// browseArgs builds the gh browse command line. The server has no display
+// to open a browser on, so --no-browser is the default.
+func browseArgs(args map[string]interface{}) ([]string, error) {
+	cmdArgs := []string{"browse"}
+	
+	if selector, ok := args["selector"].(string); ok && selector != "" {
+		if strings.HasPrefix(selector, "-") {
+			return nil, fmt.Errorf("invalid selector %q", selector)
+		}
+		cmdArgs = append(cmdArgs, selector)
+	}
+	
+	if branch, ok := args["branch"].(string); ok && branch != "" {
+		cmdArgs = append(cmdArgs, "--branch", branch)
+	}
+	
+	if noBrowser, _ := args["no_browser"].(string); noBrowser != "false" {
+		cmdArgs = append(cmdArgs, "--no-browser")
+	}
+	
+	if repo, ok := args["repo"].(string); ok && repo != "" {
+		cmdArgs = append(cmdArgs, "--repo", repo)
+	}
+	
+	flags, _ := getFlags(args)
+	cmdArgs = append(cmdArgs, flags...)
+	return cmdArgs, nil
+}
+
+// isOwnerRepo reports whether repo has the OWNER/REPO form and cannot be
+// mistaken for a flag.
+func isOwnerRepo(repo string) bool {
+	return !strings.HasPrefix(repo, "-") && strings.Count(repo, "/") == 1 && !strings.HasPrefix(repo, "/") && !strings.HasSuffix(repo, "/")
+}
+
 // ---------- Issue handlers ----------
 
 func (s *MCPServer) ghIssueList(id interface{}, args map[string]interface{}) {
@@ -971,7 +1490,7 @@ func (s *MCPServer) ghIssueList(id interface{}, args map[string]interface{}) {
 		cmdArgs = append(cmdArgs, "--label", label)
 	}
 	
-	if limit, ok := args["limit"].(float64); ok {
+	if limit, ok := getNumber(args, "limit"); ok {
 		cmdArgs = append(cmdArgs, "--limit", fmt.Sprintf("%d", int(limit)))
 	}
 	
@@ -1080,17 +1599,53 @@ func (s *MCPServer) ghIssueReopen(id interface{}, args map[string]interface{}) {
 	s.runGh(id, cwd, cmdArgs)
 }
 
-// ---------- Pull Request handlers ----------
-
-func (s *MCPServer) ghPRList(id interface{}, args map[string]interface{}) {
-	cmdArgs := []string{"pr", "list"}
-	
-	if repo, ok := args["repo"].(string); ok && repo != "" {
-		cmdArgs = append(cmdArgs, "--repo", repo)
-	}
-	
-	if state, ok := args["state"].(string); ok && state != "" {
-		cmdArgs = append(cmdArgs, "--state", state)
+func (s *MCPServer) ghIssueTransfer(id interface{}, args map[string]interface{}) {
+	cmdArgs, err := issueTransferArgs(args)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	
+	cwd := getRepoPath(args)
+	s.runGh(id, cwd, cmdArgs)
+}
+
+// issueTransferArgs builds gh issue transfer <number> <destination-repo>.
+func issueTransferArgs(args map[string]interface{}) ([]string, error) {
+	number, _ := args["number"].(string)
+	if number == "" {
+		return nil, fmt.Errorf("number is required")
+	}
+	dest, _ := args["destination_repo"].(string)
+	if dest == "" {
+		return nil, fmt.Errorf("destination_repo is required")
+	}
+	if !isOwnerRepo(dest) {
+		return nil, fmt.Errorf("invalid destination_repo %q: expected OWNER/REPO", dest)
+	}
+	
+	cmdArgs := []string{"issue", "transfer", number, dest}
+	
+	if repo, ok := args["repo"].(string); ok && repo != "" {
+		cmdArgs = append(cmdArgs, "--repo", repo)
+	}
+	
+	flags, _ := getFlags(args)
+	cmdArgs = append(cmdArgs, flags...)
+	return cmdArgs, nil
+}
+
+// ---------- Pull Request handlers ----------
+
+func (s *MCPServer) ghPRList(id interface{}, args map[string]interface{}) {
+	cmdArgs := []string{"pr", "list"}
+	
+	if repo, ok := args["repo"].(string); ok && repo != "" {
+		cmdArgs = append(cmdArgs, "--repo", repo)
+	}
+	
+	if state, ok := args["state"].(string); ok && state != "" {
+		cmdArgs = append(cmdArgs, "--state", state)
 	}
 	
 	if author, ok := args["author"].(string); ok && author != "" {
@@ -1105,7 +1660,7 @@ func (s *MCPServer) ghPRList(id interface{}, args map[string]interface{}) {
 		cmdArgs = append(cmdArgs, "--label", label)
 	}
 	
-	if limit, ok := args["limit"].(float64); ok {
+	if limit, ok := getNumber(args, "limit"); ok {
 		cmdArgs = append(cmdArgs, "--limit", fmt.Sprintf("%d", int(limit)))
 	}
 	
@@ -1207,10 +1762,23 @@ func (s *MCPServer) ghPRCheckout(id interface{}, args map[string]interface{}) {
 }
 
 func (s *MCPServer) ghPRMerge(id interface{}, args map[string]interface{}) {
+	cmdArgs, err := prMergeArgs(args)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	
+	cwd := getRepoPath(args)
+	s.runGh(id, cwd, cmdArgs)
+}
+
+// prMergeArgs builds the gh pr merge command line. auto queues the merge
+// until required checks pass; admin bypasses branch protection. gh accepts
+// only one of the two.
+func prMergeArgs(args map[string]interface{}) ([]string, error) {
 	number, _ := args["number"].(string)
 	if number == "" {
-		s.sendToolError(id, "number is required")
-		return
+		return nil, fmt.Errorf("number is required")
 	}
 	
 	cmdArgs := []string{"pr", "merge", number}
@@ -1230,15 +1798,32 @@ func (s *MCPServer) ghPRMerge(id interface{}, args map[string]interface{}) {
 		cmdArgs = append(cmdArgs, "--delete-branch")
 	}
 	
+	auto, _ := args["auto"].(string)
+	admin, _ := args["admin"].(string)
+	if auto == "true" && admin == "true" {
+		return nil, fmt.Errorf("auto and admin cannot be combined")
+	}
+	if auto == "true" {
+		cmdArgs = append(cmdArgs, "--auto")
+	}
+	if admin == "true" {
+		cmdArgs = append(cmdArgs, "--admin")
+	}
+	
+	if subject, ok := args["subject"].(string); ok && subject != "" {
+		cmdArgs = append(cmdArgs, "--subject", subject)
+	}
+	if body, ok := args["body"].(string); ok && body != "" {
+		cmdArgs = append(cmdArgs, "--body", body)
+	}
+	
 	if repo, ok := args["repo"].(string); ok && repo != "" {
 		cmdArgs = append(cmdArgs, "--repo", repo)
 	}
 	
 	flags, _ := getFlags(args)
 	cmdArgs = append(cmdArgs, flags...)
-	
-	cwd := getRepoPath(args)
-	s.runGh(id, cwd, cmdArgs)
+	return cmdArgs, nil
 }
 
 func (s *MCPServer) ghPRClose(id interface{}, args map[string]interface{}) {
@@ -1313,6 +1898,30 @@ func (s *MCPServer) ghPRDiff(id interface{}, args map[string]interface{}) {
 	if repo, ok := args["repo"].(string); ok && repo != "" {
 		cmdArgs = append(cmdArgs, "--repo", repo)
 	}
+
+	patch, _ := args["patch"].(string)
+	nameOnly, _ := args["name_only"].(string)
+	if patch == "true" && nameOnly == "true" {
+		s.sendToolError(id, "patch and name_only cannot be combined")
+		return
+	}
+	if patch == "true" {
+		cmdArgs = append(cmdArgs, "--patch")
+	}
+	if nameOnly == "true" {
+		cmdArgs = append(cmdArgs, "--name-only")
+	}
+
+	// Plain output by default, since ANSI escapes get in the way of parsing.
+	color, _ := args["color"].(string)
+	if color == "" {
+		color = "never"
+	}
+	if !slices.Contains(prDiffColors, color) {
+		s.sendToolError(id, fmt.Sprintf("invalid color %q: must be one of %s", color, strings.Join(prDiffColors, ", ")))
+		return
+	}
+	cmdArgs = append(cmdArgs, "--color="+color)
 	
 	flags, _ := getFlags(args)
 	cmdArgs = append(cmdArgs, flags...)
@@ -1321,6 +1930,9 @@ func (s *MCPServer) ghPRDiff(id interface{}, args map[string]interface{}) {
 	s.runGh(id, cwd, cmdArgs)
 }
 
+// prDiffColors are the values gh pr diff accepts for --color.
+var prDiffColors = []string{"never", "always", "auto"}
+
 // ---------- Workflow/Actions handlers ----------
 
 func (s *MCPServer) ghRunList(id interface{}, args map[string]interface{}) {
@@ -1334,7 +1946,7 @@ func (s *MCPServer) ghRunList(id interface{}, args map[string]interface{}) {
 		cmdArgs = append(cmdArgs, "--workflow", workflow)
 	}
 	
-	if limit, ok := args["limit"].(float64); ok {
+	if limit, ok := getNumber(args, "limit"); ok {
 		cmdArgs = append(cmdArgs, "--limit", fmt.Sprintf("%d", int(limit)))
 	}
 	
@@ -1357,18 +1969,43 @@ func (s *MCPServer) ghRunView(id interface{}, args map[string]interface{}) {
 	if repo, ok := args["repo"].(string); ok && repo != "" {
 		cmdArgs = append(cmdArgs, "--repo", repo)
 	}
-	
-	if logView, ok := args["log"].(string); ok && logView == "true" {
+
+	if job, _ := args["job"].(string); job != "" {
+		if strings.HasPrefix(job, "-") {
+			s.sendToolError(id, fmt.Sprintf("invalid job %q", job))
+			return
+		}
+		cmdArgs = append(cmdArgs, "--job", job)
+	}
+
+	logView, _ := args["log"].(string)
+	asJSON, _ := args["json"].(string)
+	if logView == "true" && asJSON == "true" {
+		s.sendToolError(id, "log and json cannot be used together")
+		return
+	}
+	if logView == "true" {
 		cmdArgs = append(cmdArgs, "--log")
 	}
+	if asJSON == "true" {
+		cmdArgs = append(cmdArgs, "--json", runViewJSONFields)
+	}
 	
 	flags, _ := getFlags(args)
 	cmdArgs = append(cmdArgs, flags...)
 	
 	cwd := getRepoPath(args)
+	if asJSON == "true" {
+		s.runGhJSON(id, cwd, cmdArgs)
+		return
+	}
 	s.runGh(id, cwd, cmdArgs)
 }
 
+// runViewJSONFields are the fields gh_run_view requests with json=true.
+// jobs carries each job's steps with their status and conclusion.
+const runViewJSONFields = "databaseId,name,displayTitle,workflowName,event,headBranch,headSha,status,conclusion,attempt,createdAt,updatedAt,url,jobs"
+
 func (s *MCPServer) ghRunRerun(id interface{}, args map[string]interface{}) {
 	runID, _ := args["run_id"].(string)
 	if runID == "" {
@@ -1436,7 +2073,7 @@ func (s *MCPServer) ghReleaseList(id interface{}, args map[string]interface{}) {
 		cmdArgs = append(cmdArgs, "--repo", repo)
 	}
 	
-	if limit, ok := args["limit"].(float64); ok {
+	if limit, ok := getNumber(args, "limit"); ok {
 		cmdArgs = append(cmdArgs, "--limit", fmt.Sprintf("%d", int(limit)))
 	}
 	
@@ -1531,12 +2168,115 @@ func (s *MCPServer) ghReleaseDownload(id interface{}, args map[string]interface{
 	s.runGh(id, cwd, cmdArgs)
 }
 
+func (s *MCPServer) ghReleaseUpload(id interface{}, args map[string]interface{}) {
+	cmdArgs, err := releaseUploadArgs(args)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	
+	cwd := getRepoPath(args)
+	s.runGh(id, cwd, cmdArgs)
+}
+
+// releaseUploadArgs builds the gh arguments for gh_release_upload.
+func releaseUploadArgs(args map[string]interface{}) ([]string, error) {
+	tag, _ := args["tag"].(string)
+	if tag == "" {
+		return nil, fmt.Errorf("tag is required")
+	}
+	
+	files := getStringArray(args, "files")
+	if len(files) == 0 {
+		return nil, fmt.Errorf("at least one file is required")
+	}
+	
+	cmdArgs := []string{"release", "upload", tag}
+	for _, f := range files {
+		if strings.HasPrefix(f, "-") {
+			return nil, fmt.Errorf("invalid file %q: paths must not start with '-'", f)
+		}
+		cmdArgs = append(cmdArgs, f)
+	}
+	
+	if clobber, ok := args["clobber"].(string); ok && clobber == "true" {
+		cmdArgs = append(cmdArgs, "--clobber")
+	}
+	
+	if repo, ok := args["repo"].(string); ok && repo != "" {
+		cmdArgs = append(cmdArgs, "--repo", repo)
+	}
+	
+	flags, _ := getFlags(args)
+	cmdArgs = append(cmdArgs, flags...)
+	
+	return cmdArgs, nil
+}
+
+func (s *MCPServer) ghReleaseEdit(id interface{}, args map[string]interface{}) {
+	cmdArgs, err := releaseEditArgs(args)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	
+	cwd := getRepoPath(args)
+	s.runGh(id, cwd, cmdArgs)
+}
+
+// releaseEditArgs builds the gh arguments for gh_release_edit. draft and
+// prerelease are passed as --draft=<bool> so that they can be cleared too.
+func releaseEditArgs(args map[string]interface{}) ([]string, error) {
+	tag, _ := args["tag"].(string)
+	if tag == "" {
+		return nil, fmt.Errorf("tag is required")
+	}
+	
+	cmdArgs := []string{"release", "edit", tag}
+	changed := false
+	
+	if title, ok := args["title"].(string); ok && title != "" {
+		cmdArgs = append(cmdArgs, "--title", title)
+		changed = true
+	}
+	
+	if notes, ok := args["notes"].(string); ok && notes != "" {
+		cmdArgs = append(cmdArgs, "--notes", notes)
+		changed = true
+	}
+	
+	for _, name := range []string{"draft", "prerelease"} {
+		value, ok := args[name].(string)
+		if !ok || value == "" {
+			continue
+		}
+		if value != "true" && value != "false" {
+			return nil, fmt.Errorf("%s must be true or false, got %q", name, value)
+		}
+		cmdArgs = append(cmdArgs, "--"+name+"="+value)
+		changed = true
+	}
+	
+	if !changed {
+		return nil, fmt.Errorf("at least one of title, notes, draft, or prerelease is required")
+	}
+	
+	if repo, ok := args["repo"].(string); ok && repo != "" {
+		cmdArgs = append(cmdArgs, "--repo", repo)
+	}
+	
+	flags, _ := getFlags(args)
+	cmdArgs = append(cmdArgs, flags...)
+	
+	return cmdArgs, nil
+}
+
 // ---------- Gist handlers ----------
 
 func (s *MCPServer) ghGistList(id interface{}, args map[string]interface{}) {
 	cmdArgs := []string{"gist", "list"}
 	
-	if limit, ok := args["limit"].(float64); ok {
+	if limit, ok := getNumber(args, "limit"); ok {
 		cmdArgs = append(cmdArgs, "--limit", fmt.Sprintf("%d", int(limit)))
 	}
 	
@@ -1593,8 +2333,210 @@ func (s *MCPServer) ghGistCreate(id interface{}, args map[string]interface{}) {
 	s.runGh(id, "", cmdArgs)
 }
 
+// ---------- Project handlers ----------
+
+// projectListArgs builds gh project list. Without an owner gh lists the
+// current user's projects.
+func projectListArgs(args map[string]interface{}) ([]string, error) {
+	cmdArgs := []string{"project", "list"}
+	
+	if owner, ok := args["owner"].(string); ok && owner != "" {
+		if !isProjectOwner(owner) {
+			return nil, fmt.Errorf("invalid owner %q", owner)
+		}
+		cmdArgs = append(cmdArgs, "--owner", owner)
+	}
+	
+	if closed, ok := args["closed"].(string); ok && closed == "true" {
+		cmdArgs = append(cmdArgs, "--closed")
+	}
+	
+	return appendProjectOutputArgs(cmdArgs, args), nil
+}
+
+// projectItemListArgs builds gh project item-list <number> --owner <owner>.
+func projectItemListArgs(args map[string]interface{}) ([]string, error) {
+	number, owner, err := projectTarget(args)
+	if err != nil {
+		return nil, err
+	}
+	
+	cmdArgs := []string{"project", "item-list", number, "--owner", owner}
+	return appendProjectOutputArgs(cmdArgs, args), nil
+}
+
+// projectItemAddArgs builds gh project item-add <number> --owner <owner> --url <url>.
+func projectItemAddArgs(args map[string]interface{}) ([]string, error) {
+	number, owner, err := projectTarget(args)
+	if err != nil {
+		return nil, err
+	}
+	url, _ := args["url"].(string)
+	if url == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		return nil, fmt.Errorf("invalid url %q: expected the issue or pull request URL", url)
+	}
+	
+	cmdArgs := []string{"project", "item-add", number, "--owner", owner, "--url", url}
+	
+	if asJSON, ok := args["json"].(string); ok && asJSON == "true" {
+		cmdArgs = append(cmdArgs, "--format", "json")
+	}
+	
+	flags, _ := getFlags(args)
+	cmdArgs = append(cmdArgs, flags...)
+	return cmdArgs, nil
+}
+
+// projectTarget returns the validated project number and owner that the
+// item commands require.
+func projectTarget(args map[string]interface{}) (string, string, error) {
+	number, _ := args["number"].(string)
+	if number == "" {
+		return "", "", fmt.Errorf("number is required")
+	}
+	if n, err := strconv.Atoi(number); err != nil || n < 1 {
+		return "", "", fmt.Errorf("invalid number %q: expected a positive project number", number)
+	}
+	owner, _ := args["owner"].(string)
+	if owner == "" {
+		return "", "", fmt.Errorf("owner is required")
+	}
+	if !isProjectOwner(owner) {
+		return "", "", fmt.Errorf("invalid owner %q", owner)
+	}
+	return number, owner, nil
+}
+
+// appendProjectOutputArgs adds the limit, json, and flags arguments shared by
+// the project list commands.
+func appendProjectOutputArgs(cmdArgs []string, args map[string]interface{}) []string {
+	if limit, ok := getNumber(args, "limit"); ok {
+		cmdArgs = append(cmdArgs, "--limit", fmt.Sprintf("%d", int(limit)))
+	}
+	
+	if asJSON, ok := args["json"].(string); ok && asJSON == "true" {
+		cmdArgs = append(cmdArgs, "--format", "json")
+	}
+	
+	flags, _ := getFlags(args)
+	return append(cmdArgs, flags...)
+}
+
+// isProjectOwner reports whether owner is "@me" or a plain user or
+// organization login.
+func isProjectOwner(owner string) bool {
+	return owner == "@me" || (!strings.HasPrefix(owner, "-") && !strings.ContainsAny(owner, "/ "))
+}
+
+// ---------- Codespace handlers ----------
+
+// Codespace tools never wrap gh codespace ssh or code: both need an
+// interactive terminal or a local editor that the server does not have.
+
+func codespaceListArgs(args map[string]interface{}) ([]string, error) {
+	cmdArgs := []string{"codespace", "list"}
+	
+	if repo, ok := args["repo"].(string); ok && repo != "" {
+		if !isOwnerRepo(repo) {
+			return nil, fmt.Errorf("invalid repo %q: expected OWNER/REPO", repo)
+		}
+		cmdArgs = append(cmdArgs, "--repo", repo)
+	}
+	
+	if limit, ok := getNumber(args, "limit"); ok {
+		cmdArgs = append(cmdArgs, "--limit", fmt.Sprintf("%d", int(limit)))
+	}
+	
+	flags, _ := getFlags(args)
+	cmdArgs = append(cmdArgs, flags...)
+	return cmdArgs, nil
+}
+
+// codespaceCreateArgs builds gh codespace create --repo <repo>.
+func codespaceCreateArgs(args map[string]interface{}) ([]string, error) {
+	repo, _ := args["repo"].(string)
+	if repo == "" {
+		return nil, fmt.Errorf("repo is required")
+	}
+	if !isOwnerRepo(repo) {
+		return nil, fmt.Errorf("invalid repo %q: expected OWNER/REPO", repo)
+	}
+	
+	cmdArgs := []string{"codespace", "create", "--repo", repo}
+	
+	if branch, ok := args["branch"].(string); ok && branch != "" {
+		cmdArgs = append(cmdArgs, "--branch", branch)
+	}
+	
+	if machine, ok := args["machine"].(string); ok && machine != "" {
+		cmdArgs = append(cmdArgs, "--machine", machine)
+	}
+	
+	flags, _ := getFlags(args)
+	cmdArgs = append(cmdArgs, flags...)
+	return cmdArgs, nil
+}
+
+func codespaceStopArgs(args map[string]interface{}) ([]string, error) {
+	name, err := codespaceName(args)
+	if err != nil {
+		return nil, err
+	}
+	
+	cmdArgs := []string{"codespace", "stop", "--codespace", name}
+	
+	flags, _ := getFlags(args)
+	cmdArgs = append(cmdArgs, flags...)
+	return cmdArgs, nil
+}
+
+func codespaceDeleteArgs(args map[string]interface{}) ([]string, error) {
+	name, err := codespaceName(args)
+	if err != nil {
+		return nil, err
+	}
+	
+	cmdArgs := []string{"codespace", "delete", "--codespace", name}
+	
+	if force, ok := args["force"].(string); ok && force == "true" {
+		cmdArgs = append(cmdArgs, "--force")
+	}
+	
+	flags, _ := getFlags(args)
+	cmdArgs = append(cmdArgs, flags...)
+	return cmdArgs, nil
+}
+
+// codespaceName returns the required name argument. Codespace names are
+// generated by GitHub from letters, digits, and hyphens.
+func codespaceName(args map[string]interface{}) (string, error) {
+	name, _ := args["name"].(string)
+	if name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+	if strings.HasPrefix(name, "-") {
+		return "", fmt.Errorf("invalid codespace name %q", name)
+	}
+	for _, c := range name {
+		if !(c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return "", fmt.Errorf("invalid codespace name %q", name)
+		}
+	}
+	return name, nil
+}
+
 // ---------- Auth handlers ----------
 
+func (s *MCPServer) ghHealth(id interface{}) {
+	data, _ := json.MarshalIndent(checkHealth(), "", "  ")
+	s.sendResponse(id, ToolResult{
+		Content: []ContentItem{{Type: "text", Text: string(data)}},
+	})
+}
+
 func (s *MCPServer) ghAuthStatus(id interface{}, args map[string]interface{}) {
 	cmdArgs := []string{"auth", "status"}
 	
@@ -1636,7 +2578,7 @@ func (s *MCPServer) ghSearchRepos(id interface{}, args map[string]interface{}) {
 	
 	cmdArgs := []string{"search", "repos", query}
 	
-	if limit, ok := args["limit"].(float64); ok {
+	if limit, ok := getNumber(args, "limit"); ok {
 		cmdArgs = append(cmdArgs, "--limit", fmt.Sprintf("%d", int(limit)))
 	}
 	
@@ -1655,7 +2597,7 @@ func (s *MCPServer) ghSearchIssues(id interface{}, args map[string]interface{})
 	
 	cmdArgs := []string{"search", "issues", query}
 	
-	if limit, ok := args["limit"].(float64); ok {
+	if limit, ok := getNumber(args, "limit"); ok {
 		cmdArgs = append(cmdArgs, "--limit", fmt.Sprintf("%d", int(limit)))
 	}
 	
@@ -1668,15 +2610,26 @@ func (s *MCPServer) ghSearchIssues(id interface{}, args map[string]interface{})
 // ---------- API handler ----------
 
 func (s *MCPServer) ghAPI(id interface{}, args map[string]interface{}) {
+	cmdArgs, err := apiArgs(args)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	
+	s.runGh(id, "", cmdArgs)
+}
+
+// apiArgs builds the gh arguments for gh_api.
+func apiArgs(args map[string]interface{}) ([]string, error) {
 	endpoint, _ := args["endpoint"].(string)
 	if endpoint == "" {
-		s.sendToolError(id, "endpoint is required")
-		return
+		return nil, fmt.Errorf("endpoint is required")
 	}
 	
 	cmdArgs := []string{"api", endpoint}
 	
-	if method, ok := args["method"].(string); ok && method != "" {
+	method, _ := args["method"].(string)
+	if method != "" {
 		cmdArgs = append(cmdArgs, "--method", method)
 	}
 	
@@ -1686,26 +2639,221 @@ func (s *MCPServer) ghAPI(id interface{}, args map[string]interface{}) {
 		}
 	}
 	
+	for _, header := range getStringArray(args, "header") {
+		if !strings.Contains(header, ":") {
+			return nil, fmt.Errorf("invalid header %q: expected 'Key: Value'", header)
+		}
+		cmdArgs = append(cmdArgs, "--header", header)
+	}
+	
+	paginate := args["paginate"] == "true"
+	slurp := args["slurp"] == "true"
+	if slurp && !paginate {
+		return nil, fmt.Errorf("slurp requires paginate=true")
+	}
+	if paginate {
+		if method != "" && !strings.EqualFold(method, "GET") {
+			return nil, fmt.Errorf("paginate is only supported for GET requests, got %s", method)
+		}
+		cmdArgs = append(cmdArgs, "--paginate")
+		if slurp {
+			cmdArgs = append(cmdArgs, "--slurp")
+		}
+	}
+
+	if jq, _ := args["jq"].(string); jq != "" {
+		if slurp {
+			return nil, fmt.Errorf("jq cannot be combined with slurp; with paginate, jq is applied to each page")
+		}
+		cmdArgs = append(cmdArgs, "--jq", jq)
+	}
+	
 	flags, _ := getFlags(args)
 	cmdArgs = append(cmdArgs, flags...)
 	
-	s.runGh(id, "", cmdArgs)
+	return cmdArgs, nil
 }
 
 // ---------- GitHub CLI execution ----------
 
+// ghBuilt runs the gh command line that build makes from args. These tools
+// name their target with flags, so they run outside any repository.
+func (s *MCPServer) ghBuilt(id interface{}, args map[string]interface{}, build func(map[string]interface{}) ([]string, error)) {
+	cmdArgs, err := build(args)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	
+	s.runGh(id, "", cmdArgs)
+}
+
+// maxOutputBytes caps the stdout and stderr returned by each command, since
+// many MCP hosts reject responses of tens of megabytes, such as the diff of a
+// huge PR. Zero disables it. Override via HUNTER3_MAX_OUTPUT_BYTES, or per
+// call with max_output_bytes.
+var maxOutputBytes = 1 << 20
+
+func initMaxOutputBytes() {
+	v := os.Getenv("HUNTER3_MAX_OUTPUT_BYTES")
+	if v == "" {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		logger.Printf("WARNING: invalid HUNTER3_MAX_OUTPUT_BYTES %q; using %d\n", v, maxOutputBytes)
+		return
+	}
+	maxOutputBytes = n
+}
+
+// callOutputLimit returns the call's max_output_bytes, or maxOutputBytes if
+// it has none.
+func callOutputLimit(args map[string]interface{}) (int, error) {
+	if _, ok := args["max_output_bytes"]; !ok {
+		return maxOutputBytes, nil
+	}
+	n, ok := getNumber(args, "max_output_bytes")
+	if !ok || n < 1 || n > math.MaxInt32 || n != math.Trunc(n) {
+		return 0, fmt.Errorf("max_output_bytes must be a positive integer")
+	}
+	return int(n), nil
+}
+
+// truncateOutput cuts out to at most limit bytes, backing up to a UTF-8
+// boundary, and appends a marker giving the original size. A limit of zero
+// leaves out unchanged.
+func truncateOutput(out string, limit int) string {
+	if limit <= 0 || len(out) <= limit {
+		return out
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(out[cut]) {
+		cut--
+	}
+	return out[:cut] + fmt.Sprintf("\n[output truncated: showing %d of %d bytes]", cut, len(out))
+}
+
+// redactedValue replaces secrets in logged commands and output.
+const redactedValue = "[REDACTED]"
+
+// sensitiveNamePattern matches field and header names whose values are
+// likely secrets.
+var sensitiveNamePattern = regexp.MustCompile(`(?i)pass|secret|token|credential|private|api[-_]?key|auth|cookie`)
+
+// redactArgs returns a copy of ghArgs with secret values replaced by
+// redactedValue, along with the secrets it replaced. Secrets are the values
+// of --token, --password, and similar flags, of gh secret set --body, of
+// --field/--raw-field entries with sensitive names, and of sensitive headers.
+func redactArgs(ghArgs []string) ([]string, []string) {
+	valueFlags := map[string]bool{"--token": true, "--password": true, "--secret": true, "--client-secret": true}
+	if len(ghArgs) > 0 && ghArgs[0] == "secret" {
+		valueFlags["--body"], valueFlags["-b"] = true, true
+	}
+	fieldFlags := map[string]bool{"--field": true, "-F": true, "--raw-field": true, "-f": true}
+	headerFlags := map[string]bool{"--header": true, "-H": true}
+
+	// secretPart returns the secret portion of a flag's value, if any.
+	secretPart := func(flag, value string) string {
+		switch {
+		case valueFlags[flag]:
+			return value
+		case fieldFlags[flag]:
+			if name, v, ok := strings.Cut(value, "="); ok && sensitiveNamePattern.MatchString(name) {
+				return v
+			}
+		case headerFlags[flag]:
+			if name, v, ok := strings.Cut(value, ":"); ok && sensitiveNamePattern.MatchString(name) {
+				return strings.TrimSpace(v)
+			}
+		}
+		return ""
+	}
+
+	out := make([]string, len(ghArgs))
+	copy(out, ghArgs)
+	var secrets []string
+	for i := 0; i < len(out); i++ {
+		flag, value, inline := strings.Cut(out[i], "=")
+		if !inline {
+			if i+1 >= len(out) {
+				break
+			}
+			value = out[i+1]
+		}
+		secret := secretPart(flag, value)
+		if secret == "" {
+			continue
+		}
+		secrets = append(secrets, secret)
+		redacted := strings.Replace(value, secret, redactedValue, 1)
+		if inline {
+			out[i] = flag + "=" + redacted
+		} else {
+			out[i+1] = redacted
+			i++
+		}
+	}
+	return out, secrets
+}
+
+// redactCommand renders ghArgs as a command line for the log, with secret
+// values masked.
+func redactCommand(ghArgs []string) string {
+	redacted, _ := redactArgs(ghArgs)
+	return "gh " + strings.Join(redacted, " ")
+}
+
+// redactOutput masks in out any secrets passed in ghArgs, since gh may echo
+// its inputs in error messages. Values under four bytes are left alone, as
+// masking them would garble the rest of the text.
+func redactOutput(out string, ghArgs []string) string {
+	_, secrets := redactArgs(ghArgs)
+	for _, secret := range secrets {
+		if len(secret) >= 4 {
+			out = strings.ReplaceAll(out, secret, redactedValue)
+		}
+	}
+	return out
+}
+
 func (s *MCPServer) runGh(id interface{}, cwd string, ghArgs []string) {
+	result, err := s.execGh(cwd, ghArgs)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	s.sendGhResult(id, result)
+}
+
+// runGhJSON runs a gh command given --json and returns its output parsed
+// in GhResult.JSON. Output that is not valid JSON, such as an error message
+// or output truncated by the output limit, is left in Stdout.
+func (s *MCPServer) runGhJSON(id interface{}, cwd string, ghArgs []string) {
+	result, err := s.execGh(cwd, ghArgs)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	if result.Success && json.Valid([]byte(result.Stdout)) {
+		result.JSON = json.RawMessage(result.Stdout)
+		result.Stdout = ""
+	}
+	s.sendGhResult(id, result)
+}
+
+// execGh runs gh in cwd, which must be an allowed path if set.
+func (s *MCPServer) execGh(cwd string, ghArgs []string) (GhResult, error) {
 	cmd := exec.Command("gh", ghArgs...)
 	if cwd != "" {
 		if err := validateRepoPath(cwd); err != nil {
-			s.sendToolError(id, err.Error())
-			return
+			return GhResult{}, err
 		}
 		cmd.Dir = cwd
 	}
 
 	commandStr := "gh " + strings.Join(ghArgs, " ")
-	logger.Printf("Executing: %s (cwd: %s)\n", commandStr, cwd)
+	logger.Printf("Executing: %s (cwd: %s)\n", redactCommand(ghArgs), cwd)
 
 	stdout, err := cmd.Output()
 	result := GhResult{
@@ -1718,13 +2866,19 @@ func (s *MCPServer) runGh(id interface{}, cwd string, ghArgs []string) {
 		logger.Printf("gh command failed: %v\n", err)
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			result.Stderr = strings.TrimSpace(string(exitErr.Stderr))
-			logger.Printf("gh stderr: %s\n", result.Stderr)
+			logger.Printf("gh stderr: %s\n", redactOutput(result.Stderr, ghArgs))
 		}
 		result.Error = err.Error()
 	} else {
 		logger.Printf("gh command succeeded, stdout length: %d bytes\n", len(result.Stdout))
 	}
 
+	result.Stdout = truncateOutput(result.Stdout, s.outputLimit)
+	result.Stderr = truncateOutput(result.Stderr, s.outputLimit)
+	return result, nil
+}
+
+func (s *MCPServer) sendGhResult(id interface{}, result GhResult) {
 	data, _ := json.MarshalIndent(result, "", "  ")
 	s.sendResponse(id, ToolResult{
 		Content: []ContentItem{{Type: "text", Text: string(data)}},
@@ -1732,6 +2886,50 @@ func (s *MCPServer) runGh(id interface{}, cwd string, ghArgs []string) {
 	})
 }
 
+// loggedInPattern matches the host in `gh auth status` lines such as
+// "✓ Logged in to github.com account octocat (keyring)".
+var loggedInPattern = regexp.MustCompile(`Logged in to (\S+)`)
+
+// checkHealth verifies that gh resolves on PATH and is authenticated.
+func checkHealth() HealthReport {
+	var report HealthReport
+
+	path, err := exec.LookPath("gh")
+	if err != nil {
+		report.Problems = append(report.Problems, "gh not found on PATH; install it from https://cli.github.com")
+		return report
+	}
+	report.GhPath = path
+
+	if out, err := exec.Command(path, "--version").Output(); err != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("gh --version failed: %v", err))
+	} else {
+		report.Version = strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	}
+
+	// Older gh versions print the status to stderr.
+	out, err := exec.Command(path, "auth", "status").CombinedOutput()
+	seen := make(map[string]bool)
+	for _, m := range loggedInPattern.FindAllStringSubmatch(string(out), -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			report.Hosts = append(report.Hosts, m[1])
+		}
+	}
+	if err != nil {
+		msg := strings.TrimSpace(string(out))
+		if msg == "" {
+			msg = err.Error()
+		}
+		report.Problems = append(report.Problems, "gh is not authenticated; run `gh auth login`: "+msg)
+	} else {
+		report.Authenticated = true
+	}
+
+	report.Ready = len(report.Problems) == 0
+	return report
+}
+
 // ---------- Helpers ----------
 
 func getRepoPath(args map[string]interface{}) string {
@@ -1761,6 +2959,122 @@ func initAllowedPaths() {
 	}
 }
 
+// allowedRemoteRepos restricts which remote repositories the repo and
+// destination_repo arguments may name. Empty means unrestricted. Set via
+// HUNTER3_GH_ALLOWED_REPOS (comma-separated OWNER/REPO or HOST/OWNER/REPO
+// patterns; * matches within one segment, e.g. "octo/*").
+var allowedRemoteRepos []string
+
+func initAllowedRepos() {
+	for _, p := range strings.Split(os.Getenv("HUNTER3_GH_ALLOWED_REPOS"), ",") {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			allowedRemoteRepos = append(allowedRemoteRepos, p)
+		}
+	}
+	if len(allowedRemoteRepos) > 0 {
+		logger.Printf("Remote repositories restricted to: %s\n", strings.Join(allowedRemoteRepos, ", "))
+	}
+}
+
+// repoArgKeys are the tool arguments that name a remote repository.
+var repoArgKeys = []string{"repo", "destination_repo"}
+
+// checkAllowedRepos rejects tool arguments naming a repository outside
+// allowedRemoteRepos. Since flags could name another repository with
+// --repo or -R, those are refused outright, and gh_api may only call
+// /repos/OWNER/REPO endpoints of allowed repositories.
+func checkAllowedRepos(name string, args map[string]interface{}) error {
+	if len(allowedRemoteRepos) == 0 {
+		return nil
+	}
+	for _, key := range repoArgKeys {
+		repo, _ := args[key].(string)
+		if repo == "" {
+			continue
+		}
+		if !repoAllowed(repo) {
+			return fmt.Errorf("%s %q is not in HUNTER3_GH_ALLOWED_REPOS", key, repo)
+		}
+	}
+	for _, flag := range getStringArray(args, "flags") {
+		if isRepoFlag(flag) {
+			return fmt.Errorf("flag %q is not allowed when HUNTER3_GH_ALLOWED_REPOS is set; use the repo argument", flag)
+		}
+	}
+	if name == "gh_api" {
+		endpoint, _ := args["endpoint"].(string)
+		return checkAPIEndpoint(endpoint)
+	}
+	return nil
+}
+
+// isRepoFlag reports whether a flag selects a repository: --repo, --repo=X,
+// or a shorthand group containing R such as -R, -RX, or -wR.
+func isRepoFlag(flag string) bool {
+	if flag == "--repo" || strings.HasPrefix(flag, "--repo=") {
+		return true
+	}
+	return len(flag) > 1 && flag[0] == '-' && flag[1] != '-' && strings.ContainsRune(flag, 'R')
+}
+
+// checkAPIEndpoint allows only /repos/OWNER/REPO endpoints whose repository
+// is in allowedRemoteRepos. Other endpoints, including graphql, full URLs,
+// and {owner}/{repo} placeholders, can reach any repository and are refused.
+func checkAPIEndpoint(endpoint string) error {
+	p := strings.TrimPrefix(endpoint, "/")
+	if i := strings.IndexAny(p, "?#"); i >= 0 {
+		p = p[:i]
+	}
+	parts := strings.Split(p, "/")
+	if len(parts) < 3 || parts[0] != "repos" || strings.ContainsAny(parts[1]+parts[2], "{}") {
+		return fmt.Errorf("endpoint %q is not allowed when HUNTER3_GH_ALLOWED_REPOS is set; only /repos/OWNER/REPO endpoints are", endpoint)
+	}
+	for _, part := range parts {
+		if part == "." || part == ".." || strings.Contains(part, "%") {
+			return fmt.Errorf("endpoint %q must not contain . or .. segments or escaped characters", endpoint)
+		}
+	}
+	if repo := parts[1] + "/" + parts[2]; !repoAllowed(repo) {
+		return fmt.Errorf("endpoint repository %q is not in HUNTER3_GH_ALLOWED_REPOS", repo)
+	}
+	return nil
+}
+
+// repoAllowed matches repo, given as [HOST/]OWNER/REPO or a URL, against
+// allowedRemoteRepos. GitHub names are case-insensitive. Anything that does
+// not parse as a repository is refused.
+func repoAllowed(repo string) bool {
+	name := strings.ToLower(strings.TrimSpace(repo))
+	if i := strings.Index(name, "://"); i >= 0 {
+		name = name[i+3:]
+	}
+	name = strings.TrimSuffix(strings.TrimSuffix(name, "/"), ".git")
+	parts := strings.Split(name, "/")
+	if len(parts) < 2 || len(parts) > 3 || strings.HasPrefix(name, "-") {
+		return false
+	}
+	for _, part := range parts {
+		if part == "" {
+			return false
+		}
+	}
+	ownerRepo := strings.Join(parts[len(parts)-2:], "/")
+
+	for _, pattern := range allowedRemoteRepos {
+		target := ownerRepo
+		if strings.Count(pattern, "/") == 2 {
+			if len(parts) != 3 {
+				continue
+			}
+			target = name
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
 func validateRepoPath(repoPath string) error {
 	if len(allowedRepoPaths) == 0 {
 		return nil
@@ -1784,6 +3098,26 @@ func getFlags(args map[string]interface{}) ([]string, error) {
 	return getStringArray(args, "flags"), nil
 }
 
+// getNumber reads a numeric argument sent either as a JSON number or as a
+// numeric string such as "50", since MCP hosts often send the latter. ok is
+// false when the key is absent or the value is not a finite number.
+func getNumber(args map[string]interface{}, key string) (float64, bool) {
+	switch v := args[key].(type) {
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			if v != "" {
+				logger.Printf("Ignoring non-numeric %s: %q\n", key, v)
+			}
+			return 0, false
+		}
+		return n, true
+	}
+	return 0, false
+}
+
 func getStringArray(args map[string]interface{}, key string) []string {
 	val, ok := args[key]
 	if !ok {
@@ -1806,6 +3140,20 @@ func getStringArray(args map[string]interface{}, key string) []string {
 
 // ---------- JSON-RPC responses ----------
 
+// stdoutMu serializes writes to stdoutWriter so that concurrent responses
+// can never interleave JSON-RPC lines on the protocol stream.
+var (
+	stdoutMu     sync.Mutex
+	stdoutWriter io.Writer = os.Stdout
+)
+
+// writeMessage writes a single newline-terminated JSON-RPC message to stdout.
+func writeMessage(data []byte) {
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+	stdoutWriter.Write(append(data, '\n'))
+}
+
 func (s *MCPServer) sendResponse(id interface{}, result interface{}) {
 	resp := JSONRPCResponse{
 		JSONRPC: "2.0",
@@ -1818,7 +3166,7 @@ func (s *MCPServer) sendResponse(id interface{}, result interface{}) {
 		fmt.Fprintf(os.Stderr, "Error marshaling response: %v\n", err)
 		return
 	}
-	fmt.Println(string(data))
+	writeMessage(data)
 	logger.Printf("Sent response for request ID: %v\n", id)
 }
 
@@ -1835,7 +3183,7 @@ func (s *MCPServer) sendError(id interface{}, code int, message string, data int
 		fmt.Fprintf(os.Stderr, "Error marshaling error response: %v\n", err)
 		return
 	}
-	fmt.Println(string(jsonData))
+	writeMessage(jsonData)
 }
 
 func (s *MCPServer) sendToolError(id interface{}, msg string) {
@@ -0,0 +1,1098 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	logger = log.New(io.Discard, "", 0)
+	os.Exit(m.Run())
+}
+
+// call sends a single JSON-RPC request through the server and decodes the response.
+func call(t *testing.T, method string, params interface{}) JSONRPCResponse {
+	t.Helper()
+
+	var buf bytes.Buffer
+	stdoutWriter = &buf
+	defer func() { stdoutWriter = os.Stdout }()
+
+	req := map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method}
+	if params != nil {
+		req["params"] = params
+	}
+	line, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("Marshal request: %v", err)
+	}
+
+	s := &MCPServer{}
+	s.handleRequest(string(line))
+
+	var resp JSONRPCResponse
+	if err := json.Unmarshal(buf.Bytes(), &resp); err != nil {
+		t.Fatalf("Unmarshal response %q: %v", buf.String(), err)
+	}
+	return resp
+}
+
+// decodeResult re-marshals a generic response result into v.
+func decodeResult(t *testing.T, resp JSONRPCResponse, v interface{}) {
+	t.Helper()
+
+	if resp.Error != nil {
+		t.Fatalf("unexpected error response: %+v", resp.Error)
+	}
+	data, err := json.Marshal(resp.Result)
+	if err != nil {
+		t.Fatalf("Marshal result: %v", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("Unmarshal result: %v", err)
+	}
+}
+
+func TestInitializeAdvertisesPrompts(t *testing.T) {
+	var result InitializeResult
+	decodeResult(t, call(t, "initialize", nil), &result)
+
+	if result.Capabilities.Prompts == nil {
+		t.Error("expected prompts capability to be advertised")
+	}
+}
+
+func TestListPrompts(t *testing.T) {
+	var result ListPromptsResult
+	decodeResult(t, call(t, "prompts/list", nil), &result)
+
+	want := map[string][]string{
+		"triage-open-issues": {"repo"},
+		"review-pr":          {"repo", "number"},
+	}
+	if len(result.Prompts) != len(want) {
+		t.Fatalf("got %d prompts, want %d", len(result.Prompts), len(want))
+	}
+
+	for _, p := range result.Prompts {
+		required, ok := want[p.Name]
+		if !ok {
+			t.Errorf("unexpected prompt %q", p.Name)
+			continue
+		}
+		if p.Description == "" {
+			t.Errorf("prompt %q has no description", p.Name)
+		}
+		var got []string
+		for _, arg := range p.Arguments {
+			if arg.Required {
+				got = append(got, arg.Name)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(required, ",") {
+			t.Errorf("prompt %q required args = %v, want %v", p.Name, got, required)
+		}
+	}
+}
+
+func TestGetPromptFillsPlaceholders(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     map[string]string
+		contains []string
+	}{
+		{
+			name:     "review-pr",
+			args:     map[string]string{"repo": "octo/widgets", "number": "42"},
+			contains: []string{"#42 in octo/widgets", `repo "octo/widgets" and number "42"`, "gh_pr_diff"},
+		},
+		{
+			name:     "triage-open-issues",
+			args:     map[string]string{"repo": "octo/widgets", "label": "bug"},
+			contains: []string{"open issues in octo/widgets", `label "bug"`, "limit 30", "gh_issue_list"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result GetPromptResult
+			decodeResult(t, call(t, "prompts/get", GetPromptParams{Name: tt.name, Arguments: tt.args}), &result)
+
+			if len(result.Messages) != 1 {
+				t.Fatalf("got %d messages, want 1", len(result.Messages))
+			}
+			msg := result.Messages[0]
+			if msg.Role != "user" || msg.Content.Type != "text" {
+				t.Errorf("unexpected message shape: %+v", msg)
+			}
+			if strings.Contains(msg.Content.Text, "{{") {
+				t.Errorf("unfilled placeholder in prompt text:\n%s", msg.Content.Text)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(msg.Content.Text, want) {
+					t.Errorf("prompt text missing %q:\n%s", want, msg.Content.Text)
+				}
+			}
+		})
+	}
+}
+
+func TestGetPromptErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		params GetPromptParams
+	}{
+		{"unknown prompt", GetPromptParams{Name: "does-not-exist"}},
+		{"missing required argument", GetPromptParams{Name: "review-pr", Arguments: map[string]string{"repo": "octo/widgets"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := call(t, "prompts/get", tt.params)
+			if resp.Error == nil {
+				t.Fatalf("expected error, got result %+v", resp.Result)
+			}
+			if resp.Error.Code != -32602 {
+				t.Errorf("error code = %d, want -32602", resp.Error.Code)
+			}
+		})
+	}
+}
+
+func TestReleaseUploadArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{
+			name: "files appended after tag",
+			args: map[string]interface{}{
+				"tag":   "v1.2.0",
+				"files": []interface{}{"dist/app-linux.tar.gz", "dist/app-darwin.tar.gz#macOS build"},
+			},
+			want: "release upload v1.2.0 dist/app-linux.tar.gz dist/app-darwin.tar.gz#macOS build",
+		},
+		{
+			name: "clobber and repo",
+			args: map[string]interface{}{
+				"tag":     "v1.2.0",
+				"files":   []interface{}{"checksums.txt"},
+				"clobber": "true",
+				"repo":    "octo/app",
+			},
+			want: "release upload v1.2.0 checksums.txt --clobber --repo octo/app",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := releaseUploadArgs(tt.args)
+			if err != nil {
+				t.Fatalf("releaseUploadArgs: %v", err)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("args = %q, want %q", strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+}
+
+func TestReleaseUploadArgsValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"missing tag", map[string]interface{}{"files": []interface{}{"a.zip"}}, "tag is required"},
+		{"no files", map[string]interface{}{"tag": "v1"}, "at least one file"},
+		{"flag-like file", map[string]interface{}{"tag": "v1", "files": []interface{}{"--repo=evil/repo"}}, "must not start with '-'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := releaseUploadArgs(tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReleaseEditArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{
+			name: "title and notes",
+			args: map[string]interface{}{"tag": "v2.0.0", "title": "v2.0.0 GA", "notes": "Stable release"},
+			want: "release edit v2.0.0 --title v2.0.0 GA --notes Stable release",
+		},
+		{
+			name: "publish draft",
+			args: map[string]interface{}{"tag": "v2.0.0", "draft": "false", "prerelease": "true"},
+			want: "release edit v2.0.0 --draft=false --prerelease=true",
+		},
+		{
+			name: "repo",
+			args: map[string]interface{}{"tag": "v2.0.0", "draft": "true", "repo": "octo/app"},
+			want: "release edit v2.0.0 --draft=true --repo octo/app",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := releaseEditArgs(tt.args)
+			if err != nil {
+				t.Fatalf("releaseEditArgs: %v", err)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("args = %q, want %q", strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+}
+
+func TestReleaseEditArgsValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"missing tag", map[string]interface{}{"title": "x"}, "tag is required"},
+		{"nothing to change", map[string]interface{}{"tag": "v1"}, "at least one of"},
+		{"bad draft value", map[string]interface{}{"tag": "v1", "draft": "yes"}, "draft must be true or false"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := releaseEditArgs(tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepoDestructiveArgs(t *testing.T) {
+	for _, action := range []string{"delete", "archive"} {
+		t.Run(action, func(t *testing.T) {
+			for _, confirm := range []interface{}{"true", true} {
+				got, err := repoDestructiveArgs(action, map[string]interface{}{"repo": "octo/app", "confirm": confirm})
+				if err != nil {
+					t.Fatalf("confirm=%v: %v", confirm, err)
+				}
+				want := "repo " + action + " octo/app --yes"
+				if strings.Join(got, " ") != want {
+					t.Errorf("args = %q, want %q", strings.Join(got, " "), want)
+				}
+			}
+		})
+	}
+}
+
+func TestRepoDestructiveArgsRequiresConfirm(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"missing confirm", map[string]interface{}{"repo": "octo/app"}, "confirm must be true"},
+		{"confirm false", map[string]interface{}{"repo": "octo/app", "confirm": "false"}, "confirm must be true"},
+		{"confirm bool false", map[string]interface{}{"repo": "octo/app", "confirm": false}, "confirm must be true"},
+		{"confirm yes", map[string]interface{}{"repo": "octo/app", "confirm": "yes"}, "confirm must be true"},
+		{"missing repo", map[string]interface{}{"confirm": "true"}, "repo is required"},
+		{"repo without owner", map[string]interface{}{"repo": "app", "confirm": "true"}, "expected OWNER/REPO"},
+		{"flag-like repo", map[string]interface{}{"repo": "--help/x", "confirm": "true"}, "expected OWNER/REPO"},
+	}
+
+	for _, action := range []string{"delete", "archive"} {
+		for _, tt := range tests {
+			t.Run(action+"/"+tt.name, func(t *testing.T) {
+				got, err := repoDestructiveArgs(action, tt.args)
+				if got != nil {
+					t.Errorf("args = %q, want none", got)
+				}
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("err = %v, want it to contain %q", err, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestRepoDeleteWithoutConfirmReturnsToolError(t *testing.T) {
+	resp := call(t, "tools/call", map[string]interface{}{
+		"name":      "gh_repo_delete",
+		"arguments": map[string]interface{}{"repo": "octo/app"},
+	})
+
+	var result ToolResult
+	decodeResult(t, resp, &result)
+	if !result.IsError {
+		t.Fatal("expected a tool error")
+	}
+	if len(result.Content) == 0 || !strings.Contains(result.Content[0].Text, "confirm must be true") {
+		t.Errorf("content = %+v, want confirmation error", result.Content)
+	}
+}
+
+func TestAPIArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{
+			name: "single page",
+			args: map[string]interface{}{"endpoint": "/repos/octo/app/issues"},
+			want: "api /repos/octo/app/issues",
+		},
+		{
+			name: "paginate",
+			args: map[string]interface{}{"endpoint": "/repos/octo/app/issues", "paginate": "true"},
+			want: "api /repos/octo/app/issues --paginate",
+		},
+		{
+			name: "paginate and slurp",
+			args: map[string]interface{}{"endpoint": "/repos/octo/app/issues", "method": "GET", "paginate": "true", "slurp": "true"},
+			want: "api /repos/octo/app/issues --method GET --paginate --slurp",
+		},
+		{
+			name: "headers",
+			args: map[string]interface{}{
+				"endpoint": "/repos/octo/app",
+				"header":   []interface{}{"Accept: application/vnd.github+json", "X-GitHub-Api-Version: 2022-11-28"},
+			},
+			want: "api /repos/octo/app --header Accept: application/vnd.github+json --header X-GitHub-Api-Version: 2022-11-28",
+		},
+		{
+			name: "jq",
+			args: map[string]interface{}{"endpoint": "/user/repos", "paginate": "true", "jq": ".[].name"},
+			want: "api /user/repos --paginate --jq .[].name",
+		},
+		{
+			name: "empty jq",
+			args: map[string]interface{}{"endpoint": "/user", "jq": ""},
+			want: "api /user",
+		},
+		{
+			name: "paginate false",
+			args: map[string]interface{}{"endpoint": "/user/repos", "paginate": "false"},
+			want: "api /user/repos",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := apiArgs(tt.args)
+			if err != nil {
+				t.Fatalf("apiArgs: %v", err)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("args = %q, want %q", strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIArgsValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"missing endpoint", map[string]interface{}{"paginate": "true"}, "endpoint is required"},
+		{"slurp without paginate", map[string]interface{}{"endpoint": "/user/repos", "slurp": "true"}, "slurp requires paginate"},
+		{"paginate with POST", map[string]interface{}{"endpoint": "/graphql", "method": "POST", "paginate": "true"}, "only supported for GET"},
+		{"malformed header", map[string]interface{}{"endpoint": "/user", "header": []interface{}{"Accept"}}, "expected 'Key: Value'"},
+		{"jq with slurp", map[string]interface{}{"endpoint": "/user/repos", "paginate": "true", "slurp": "true", "jq": "length"}, "jq cannot be combined with slurp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := apiArgs(tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPRMergeArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{
+			name: "plain",
+			args: map[string]interface{}{"number": "12"},
+			want: "pr merge 12",
+		},
+		{
+			name: "auto squash",
+			args: map[string]interface{}{"number": "12", "merge_method": "squash", "auto": "true", "delete_branch": "true"},
+			want: "pr merge 12 --squash --delete-branch --auto",
+		},
+		{
+			name: "admin with commit message",
+			args: map[string]interface{}{"number": "12", "admin": "true", "subject": "Release 1.2", "body": "Closes #10", "repo": "octo/app"},
+			want: "pr merge 12 --admin --subject Release 1.2 --body Closes #10 --repo octo/app",
+		},
+		{
+			name: "auto false",
+			args: map[string]interface{}{"number": "12", "auto": "false"},
+			want: "pr merge 12",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := prMergeArgs(tt.args)
+			if err != nil {
+				t.Fatalf("prMergeArgs: %v", err)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("args = %q, want %q", strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+
+	if _, err := prMergeArgs(map[string]interface{}{"number": "12", "auto": "true", "admin": "true"}); err == nil {
+		t.Error("auto and admin together: want error")
+	}
+	if _, err := prMergeArgs(map[string]interface{}{}); err == nil {
+		t.Error("missing number: want error")
+	}
+}
+
+func TestIssueTransferArgs(t *testing.T) {
+	got, err := issueTransferArgs(map[string]interface{}{"number": "42", "destination_repo": "octo/docs", "repo": "octo/app"})
+	if err != nil {
+		t.Fatalf("issueTransferArgs: %v", err)
+	}
+	if want := "issue transfer 42 octo/docs --repo octo/app"; strings.Join(got, " ") != want {
+		t.Errorf("args = %q, want %q", strings.Join(got, " "), want)
+	}
+
+	for _, args := range []map[string]interface{}{
+		{"destination_repo": "octo/docs"},
+		{"number": "42"},
+		{"number": "42", "destination_repo": "docs"},
+		{"number": "42", "destination_repo": "--help/x"},
+	} {
+		if _, err := issueTransferArgs(args); err == nil {
+			t.Errorf("issueTransferArgs(%v): want error", args)
+		}
+	}
+}
+
+func TestBrowseArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"defaults to no browser", map[string]interface{}{}, "browse --no-browser"},
+		{"file on branch", map[string]interface{}{"selector": "main.go:12", "branch": "dev", "repo": "octo/app"}, "browse main.go:12 --branch dev --no-browser --repo octo/app"},
+		{"issue number", map[string]interface{}{"selector": "217"}, "browse 217 --no-browser"},
+		{"open browser", map[string]interface{}{"no_browser": "false"}, "browse"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := browseArgs(tt.args)
+			if err != nil {
+				t.Fatalf("browseArgs: %v", err)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("args = %q, want %q", strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+
+	if _, err := browseArgs(map[string]interface{}{"selector": "--settings"}); err == nil {
+		t.Error("selector starting with '-': want error")
+	}
+}
+
+// fakeGh installs a shell script named gh as the only entry on PATH.
+func fakeGh(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake gh script requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	t.Setenv("PATH", dir)
+	return path
+}
+
+func TestCheckHealthMissingGh(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	report := checkHealth()
+	if report.Ready || report.GhPath != "" {
+		t.Errorf("report = %+v, want not ready without a gh path", report)
+	}
+	if len(report.Problems) != 1 || !strings.Contains(report.Problems[0], "gh not found") {
+		t.Errorf("problems = %q, want gh not found", report.Problems)
+	}
+}
+
+func TestCheckHealthAuthenticated(t *testing.T) {
+	path := fakeGh(t, `case "$1" in
+--version) echo "gh version 2.40.0 (2023-12-07)"; echo "https://github.com/cli/cli/releases/tag/v2.40.0" ;;
+auth)
+	echo "github.com"
+	echo "  ✓ Logged in to github.com account octocat (keyring)"
+	echo "ghe.example.com"
+	echo "  ✓ Logged in to ghe.example.com account octo (GH_ENTERPRISE_TOKEN)"
+	;;
+esac
+`)
+
+	report := checkHealth()
+	if !report.Ready || !report.Authenticated {
+		t.Fatalf("report = %+v, want ready", report)
+	}
+	if report.GhPath != path {
+		t.Errorf("gh_path = %q, want %q", report.GhPath, path)
+	}
+	if report.Version != "gh version 2.40.0 (2023-12-07)" {
+		t.Errorf("version = %q", report.Version)
+	}
+	if strings.Join(report.Hosts, ",") != "github.com,ghe.example.com" {
+		t.Errorf("hosts = %q", report.Hosts)
+	}
+}
+
+func TestCheckHealthNotAuthenticated(t *testing.T) {
+	fakeGh(t, `case "$1" in
+--version) echo "gh version 2.40.0 (2023-12-07)" ;;
+auth) echo "You are not logged into any GitHub hosts. To log in, run: gh auth login" >&2; exit 1 ;;
+esac
+`)
+
+	report := checkHealth()
+	if report.Ready || report.Authenticated {
+		t.Fatalf("report = %+v, want not ready", report)
+	}
+	if report.Version == "" {
+		t.Error("expected version to be reported even when unauthenticated")
+	}
+	if len(report.Problems) != 1 || !strings.Contains(report.Problems[0], "not logged into any GitHub hosts") {
+		t.Errorf("problems = %q", report.Problems)
+	}
+}
+
+func TestGetNumber(t *testing.T) {
+	args := map[string]interface{}{
+		"float":   float64(25),
+		"string":  "50",
+		"spaced":  " 7 ",
+		"invalid": "fifty",
+		"empty":   "",
+		"nan":     "NaN",
+		"bool":    true,
+	}
+
+	tests := []struct {
+		key    string
+		want   float64
+		wantOK bool
+	}{
+		{"float", 25, true},
+		{"string", 50, true},
+		{"spaced", 7, true},
+		{"invalid", 0, false},
+		{"empty", 0, false},
+		{"nan", 0, false},
+		{"bool", 0, false},
+		{"missing", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := getNumber(args, tt.key)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("getNumber(%q) = %v, %v; want %v, %v", tt.key, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestRepoListHonorsStringLimit(t *testing.T) {
+	fakeGh(t, `echo "$@"`)
+
+	tests := []struct {
+		name  string
+		limit interface{}
+		want  string
+	}{
+		{"number", float64(50), "repo list octo --limit 50"},
+		{"numeric string", "50", "repo list octo --limit 50"},
+		{"non-numeric string", "lots", "repo list octo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := call(t, "tools/call", map[string]interface{}{
+				"name":      "gh_repo_list",
+				"arguments": map[string]interface{}{"owner": "octo", "limit": tt.limit},
+			})
+
+			var result ToolResult
+			decodeResult(t, resp, &result)
+			var gh GhResult
+			if err := json.Unmarshal([]byte(result.Content[0].Text), &gh); err != nil {
+				t.Fatalf("Unmarshal GhResult: %v", err)
+			}
+			if gh.Stdout != tt.want {
+				t.Errorf("gh called with %q, want %q", gh.Stdout, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepoAllowed(t *testing.T) {
+	prev := allowedRemoteRepos
+	allowedRemoteRepos = []string{"octo/app", "tools/*", "ghe.example.com/team/svc"}
+	defer func() { allowedRemoteRepos = prev }()
+
+	tests := []struct {
+		repo string
+		want bool
+	}{
+		{"octo/app", true},
+		{"Octo/App", true},
+		{"https://github.com/octo/app.git", true},
+		{"github.com/octo/app", true},
+		{"tools/linter", true},
+		{"ghe.example.com/team/svc", true},
+		{"octo/other", false},
+		{"team/svc", false},
+		{"evil.example.com/team/svc", false},
+		{"tools/linter/extra/path", false},
+		{"octo", false},
+		{"--repo=octo/app", false},
+	}
+
+	for _, tt := range tests {
+		if got := repoAllowed(tt.repo); got != tt.want {
+			t.Errorf("repoAllowed(%q) = %v, want %v", tt.repo, got, tt.want)
+		}
+	}
+}
+
+func TestAllowedReposBlocksToolCalls(t *testing.T) {
+	prev := allowedRemoteRepos
+	allowedRemoteRepos = []string{"octo/*"}
+	defer func() { allowedRemoteRepos = prev }()
+	fakeGh(t, `echo "$@"`)
+
+	var result ToolResult
+	decodeResult(t, call(t, "tools/call", map[string]interface{}{
+		"name":      "gh_issue_transfer",
+		"arguments": map[string]interface{}{"number": "1", "repo": "octo/app", "destination_repo": "elsewhere/app"},
+	}), &result)
+	if !result.IsError || !strings.Contains(result.Content[0].Text, `destination_repo "elsewhere/app" is not in HUNTER3_GH_ALLOWED_REPOS`) {
+		t.Errorf("result = %+v, want the destination to be refused", result)
+	}
+
+	var allowed ToolResult
+	decodeResult(t, call(t, "tools/call", map[string]interface{}{
+		"name":      "gh_issue_view",
+		"arguments": map[string]interface{}{"number": "1", "repo": "octo/app"},
+	}), &allowed)
+	if allowed.IsError || !strings.Contains(allowed.Content[0].Text, "issue view 1") {
+		t.Errorf("result = %+v, want gh to run for an allowed repo", allowed)
+	}
+}
+
+func TestProjectArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(map[string]interface{}) ([]string, error)
+		args  map[string]interface{}
+		want  string
+	}{
+		{"list own projects", projectListArgs, map[string]interface{}{}, "project list"},
+		{"list org projects", projectListArgs, map[string]interface{}{"owner": "octo-org", "closed": "true", "limit": float64(5), "json": "true"}, "project list --owner octo-org --closed --limit 5 --format json"},
+		{"item list", projectItemListArgs, map[string]interface{}{"number": "3", "owner": "@me", "flags": []interface{}{"--jq", ".items"}}, "project item-list 3 --owner @me --jq .items"},
+		{"item add", projectItemAddArgs, map[string]interface{}{"number": "3", "owner": "octo-org", "url": "https://github.com/octo-org/app/issues/42"}, "project item-add 3 --owner octo-org --url https://github.com/octo-org/app/issues/42"},
+		{"item add as json", projectItemAddArgs, map[string]interface{}{"number": "3", "owner": "octo-org", "url": "https://github.com/octo-org/app/pull/7", "json": "true"}, "project item-add 3 --owner octo-org --url https://github.com/octo-org/app/pull/7 --format json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.build(tt.args)
+			if err != nil {
+				t.Fatalf("build: %v", err)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("args = %q, want %q", strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+
+	for _, args := range []map[string]interface{}{
+		{"owner": "octo-org", "url": "https://github.com/octo-org/app/issues/42"},
+		{"number": "3", "url": "https://github.com/octo-org/app/issues/42"},
+		{"number": "3", "owner": "octo-org"},
+		{"number": "three", "owner": "octo-org", "url": "https://github.com/octo-org/app/issues/42"},
+		{"number": "0", "owner": "octo-org", "url": "https://github.com/octo-org/app/issues/42"},
+		{"number": "3", "owner": "--help", "url": "https://github.com/octo-org/app/issues/42"},
+		{"number": "3", "owner": "octo-org/app", "url": "https://github.com/octo-org/app/issues/42"},
+		{"number": "3", "owner": "octo-org", "url": "--web"},
+	} {
+		if _, err := projectItemAddArgs(args); err == nil {
+			t.Errorf("projectItemAddArgs(%v): want error", args)
+		}
+	}
+}
+
+func TestCodespaceCreateArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"repo only", map[string]interface{}{"repo": "octo/app"}, "codespace create --repo octo/app"},
+		{"branch and machine", map[string]interface{}{"repo": "octo/app", "branch": "dev", "machine": "standardLinux32gb"}, "codespace create --repo octo/app --branch dev --machine standardLinux32gb"},
+		{"extra flags", map[string]interface{}{"repo": "octo/app", "flags": []interface{}{"--idle-timeout", "30m"}}, "codespace create --repo octo/app --idle-timeout 30m"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := codespaceCreateArgs(tt.args)
+			if err != nil {
+				t.Fatalf("codespaceCreateArgs: %v", err)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("args = %q, want %q", strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+
+	for _, args := range []map[string]interface{}{
+		{},
+		{"repo": "app"},
+		{"repo": "--web/app"},
+	} {
+		if _, err := codespaceCreateArgs(args); err == nil {
+			t.Errorf("codespaceCreateArgs(%v): want error", args)
+		}
+	}
+}
+
+func TestCodespaceDeleteArgs(t *testing.T) {
+	got, err := codespaceDeleteArgs(map[string]interface{}{"name": "monalisa-fuzzy-waffle-x4pq7", "force": "true"})
+	if err != nil {
+		t.Fatalf("codespaceDeleteArgs: %v", err)
+	}
+	if want := "codespace delete --codespace monalisa-fuzzy-waffle-x4pq7 --force"; strings.Join(got, " ") != want {
+		t.Errorf("args = %q, want %q", strings.Join(got, " "), want)
+	}
+
+	for _, name := range []interface{}{nil, "", "--all", "a b", "name;rm"} {
+		args := map[string]interface{}{}
+		if name != nil {
+			args["name"] = name
+		}
+		if _, err := codespaceDeleteArgs(args); err == nil {
+			t.Errorf("codespaceDeleteArgs(name=%v): want error", name)
+		}
+	}
+}
+
+func TestPRDiffOutputIsTruncated(t *testing.T) {
+	fakeGh(t, "printf '%05000d' 0\n")
+
+	prev := maxOutputBytes
+	maxOutputBytes = 1000
+	defer func() { maxOutputBytes = prev }()
+
+	tests := []struct {
+		name  string
+		limit interface{}
+		want  string
+	}{
+		{"default cap", nil, strings.Repeat("0", 1000) + "\n[output truncated: showing 1000 of 5000 bytes]"},
+		{"per-call cap", "100", strings.Repeat("0", 100) + "\n[output truncated: showing 100 of 5000 bytes]"},
+		{"per-call cap above output", float64(10000), strings.Repeat("0", 5000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := map[string]interface{}{"number": "1"}
+			if tt.limit != nil {
+				args["max_output_bytes"] = tt.limit
+			}
+			resp := call(t, "tools/call", map[string]interface{}{"name": "gh_pr_diff", "arguments": args})
+
+			var result ToolResult
+			decodeResult(t, resp, &result)
+			var gh GhResult
+			if err := json.Unmarshal([]byte(result.Content[0].Text), &gh); err != nil {
+				t.Fatalf("Unmarshal GhResult: %v", err)
+			}
+			if gh.Stdout != tt.want {
+				t.Errorf("stdout has %d bytes, want %d", len(gh.Stdout), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestPRDiffModeArgs(t *testing.T) {
+	fakeGh(t, `echo "$@"`)
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"default", map[string]interface{}{"number": "7"}, "pr diff 7 --color=never"},
+		{"name only", map[string]interface{}{"number": "7", "name_only": "true", "patch": "false"}, "pr diff 7 --name-only --color=never"},
+		{"patch with color", map[string]interface{}{"number": "7", "repo": "octo/app", "patch": "true", "color": "always"}, "pr diff 7 --repo octo/app --patch --color=always"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result ToolResult
+			decodeResult(t, call(t, "tools/call", map[string]interface{}{"name": "gh_pr_diff", "arguments": tt.args}), &result)
+			var gh GhResult
+			if err := json.Unmarshal([]byte(result.Content[0].Text), &gh); err != nil {
+				t.Fatalf("Unmarshal GhResult: %v", err)
+			}
+			if gh.Stdout != tt.want {
+				t.Errorf("gh called with %q, want %q", gh.Stdout, tt.want)
+			}
+		})
+	}
+
+	for _, args := range []map[string]interface{}{
+		{"number": "7", "patch": "true", "name_only": "true"},
+		{"number": "7", "color": "rainbow"},
+	} {
+		var result ToolResult
+		decodeResult(t, call(t, "tools/call", map[string]interface{}{"name": "gh_pr_diff", "arguments": args}), &result)
+		if !result.IsError {
+			t.Errorf("gh_pr_diff(%v) = %+v, want an error", args, result)
+		}
+	}
+}
+
+func TestRunViewArgs(t *testing.T) {
+	fakeGh(t, `echo "$@"`)
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"default", map[string]interface{}{"run_id": "42"}, "run view 42"},
+		{"job log", map[string]interface{}{"run_id": "42", "job": "777", "log": "true"}, "run view 42 --job 777 --log"},
+		{"json", map[string]interface{}{"run_id": "42", "repo": "octo/app", "json": "true", "log": "false"}, "run view 42 --repo octo/app --json " + runViewJSONFields},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result ToolResult
+			decodeResult(t, call(t, "tools/call", map[string]interface{}{"name": "gh_run_view", "arguments": tt.args}), &result)
+			var gh GhResult
+			if err := json.Unmarshal([]byte(result.Content[0].Text), &gh); err != nil {
+				t.Fatalf("Unmarshal GhResult: %v", err)
+			}
+			if gh.Stdout != tt.want {
+				t.Errorf("gh called with %q, want %q", gh.Stdout, tt.want)
+			}
+		})
+	}
+
+	for _, args := range []map[string]interface{}{
+		{"run_id": "42", "log": "true", "json": "true"},
+		{"run_id": "42", "job": "--web"},
+	} {
+		var result ToolResult
+		decodeResult(t, call(t, "tools/call", map[string]interface{}{"name": "gh_run_view", "arguments": args}), &result)
+		if !result.IsError {
+			t.Errorf("gh_run_view(%v) = %+v, want an error", args, result)
+		}
+	}
+}
+
+func TestRunViewJSONIsParsed(t *testing.T) {
+	fakeGh(t, `echo '{"status":"completed","conclusion":"failure","jobs":[{"name":"test","conclusion":"failure","steps":[{"name":"go test","conclusion":"failure"}]}]}'`)
+
+	var result ToolResult
+	decodeResult(t, call(t, "tools/call", map[string]interface{}{
+		"name":      "gh_run_view",
+		"arguments": map[string]interface{}{"run_id": "42", "json": "true"},
+	}), &result)
+	if result.IsError {
+		t.Fatalf("unexpected error: %+v", result)
+	}
+
+	var gh GhResult
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &gh); err != nil {
+		t.Fatalf("Unmarshal GhResult: %v", err)
+	}
+	if gh.Stdout != "" {
+		t.Errorf("Stdout = %q, want it moved to json", gh.Stdout)
+	}
+	var run struct {
+		Conclusion string `json:"conclusion"`
+		Jobs       []struct {
+			Name  string `json:"name"`
+			Steps []struct {
+				Name       string `json:"name"`
+				Conclusion string `json:"conclusion"`
+			} `json:"steps"`
+		} `json:"jobs"`
+	}
+	if err := json.Unmarshal(gh.JSON, &run); err != nil {
+		t.Fatalf("Unmarshal json %q: %v", gh.JSON, err)
+	}
+	if run.Conclusion != "failure" || len(run.Jobs) != 1 || run.Jobs[0].Steps[0].Name != "go test" {
+		t.Errorf("run = %+v, want the failed go test step", run)
+	}
+}
+
+func TestMaxOutputBytesValidation(t *testing.T) {
+	for _, v := range []interface{}{float64(0), 1.5, "lots"} {
+		resp := call(t, "tools/call", map[string]interface{}{
+			"name":      "gh_pr_diff",
+			"arguments": map[string]interface{}{"number": "1", "max_output_bytes": v},
+		})
+
+		var result ToolResult
+		decodeResult(t, resp, &result)
+		if !result.IsError || !strings.Contains(result.Content[0].Text, "max_output_bytes") {
+			t.Errorf("max_output_bytes=%v: result = %+v, want a tool error", v, result)
+		}
+	}
+}
+
+func TestTruncateOutput(t *testing.T) {
+	tests := []struct {
+		in    string
+		limit int
+		want  string
+	}{
+		{"hello", 0, "hello"},
+		{"hello", 5, "hello"},
+		{"hello world", 5, "hello\n[output truncated: showing 5 of 11 bytes]"},
+		{"caféine", 4, "caf\n[output truncated: showing 3 of 8 bytes]"},
+	}
+	for _, tt := range tests {
+		if got := truncateOutput(tt.in, tt.limit); got != tt.want {
+			t.Errorf("truncateOutput(%q, %d) = %q, want %q", tt.in, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestRedactCommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"pr", "view", "1", "--repo", "octo/app"}, "gh pr view 1 --repo octo/app"},
+		{[]string{"api", "user", "--field", "password=hunter2", "-f", "name=octo"}, "gh api user --field password=[REDACTED] -f name=octo"},
+		{[]string{"api", "user", "--raw-field=api_key=abc123", "-F", "title=hi"}, "gh api user --raw-field=api_key=[REDACTED] -F title=hi"},
+		{[]string{"api", "user", "-H", "Authorization: token ghp_abc", "--header", "Accept: application/json"}, "gh api user -H Authorization: [REDACTED] --header Accept: application/json"},
+		{[]string{"auth", "login", "--token", "ghp_abc"}, "gh auth login --token [REDACTED]"},
+		{[]string{"secret", "set", "DEPLOY_KEY", "--body", "s3cret"}, "gh secret set DEPLOY_KEY --body [REDACTED]"},
+		{[]string{"issue", "create", "--body", "not a secret"}, "gh issue create --body not a secret"},
+		{[]string{"auth", "login", "--token"}, "gh auth login --token"},
+	}
+	for _, tt := range tests {
+		if got := redactCommand(tt.args); got != tt.want {
+			t.Errorf("redactCommand(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+
+	args := []string{"api", "user", "--field", "token=ghp_abc", "--field", "pin=12"}
+	got := redactOutput("invalid token ghp_abc for pin 12", args)
+	if want := "invalid token [REDACTED] for pin 12"; got != want {
+		t.Errorf("redactOutput = %q, want %q", got, want)
+	}
+}
+
+func TestRunGhLogsRedactedCommand(t *testing.T) {
+	fakeGh(t, `echo "bad credentials: $4" >&2; exit 1`)
+
+	var logs bytes.Buffer
+	prev := logger
+	logger = log.New(&logs, "", 0)
+	defer func() { logger = prev }()
+
+	call(t, "tools/call", map[string]interface{}{
+		"name":      "gh_api",
+		"arguments": map[string]interface{}{"endpoint": "user", "field": []interface{}{"password=hunter2"}},
+	})
+	if strings.Contains(logs.String(), "hunter2") {
+		t.Errorf("log leaks the password:\n%s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "--field password=[REDACTED]") {
+		t.Errorf("log = %q, want the redacted command", logs.String())
+	}
+}
+
+func TestAllowedReposBlocksFlagsAndAPIEndpoints(t *testing.T) {
+	prev := allowedRemoteRepos
+	allowedRemoteRepos = []string{"octo/*"}
+	defer func() { allowedRemoteRepos = prev }()
+	fakeGh(t, `echo "$@"`)
+
+	refused := []struct {
+		name string
+		args map[string]interface{}
+	}{
+		{"gh_issue_list", map[string]interface{}{"flags": []interface{}{"--repo", "evil/x"}}},
+		{"gh_issue_list", map[string]interface{}{"flags": []interface{}{"--repo=evil/x"}}},
+		{"gh_issue_list", map[string]interface{}{"repo": "octo/app", "flags": []interface{}{"-R", "evil/x"}}},
+		{"gh_issue_list", map[string]interface{}{"flags": []interface{}{"-Revil/x"}}},
+		{"gh_repo_view", map[string]interface{}{"flags": []interface{}{"-wR", "evil/x"}}},
+		{"gh_api", map[string]interface{}{"endpoint": "/repos/evil/x/issues"}},
+		{"gh_api", map[string]interface{}{"endpoint": "repos/evil/x"}},
+		{"gh_api", map[string]interface{}{"endpoint": "/repos/octo/app/../../evil/x"}},
+		{"gh_api", map[string]interface{}{"endpoint": "/repos/octo/app/%2e%2e/%2e%2e/evil/x"}},
+		{"gh_api", map[string]interface{}{"endpoint": "/repos/{owner}/{repo}/issues"}},
+		{"gh_api", map[string]interface{}{"endpoint": "/user/repos"}},
+		{"gh_api", map[string]interface{}{"endpoint": "graphql"}},
+		{"gh_api", map[string]interface{}{"endpoint": "https://api.github.com/repos/octo/app"}},
+	}
+	for _, tt := range refused {
+		var result ToolResult
+		decodeResult(t, call(t, "tools/call", map[string]interface{}{"name": tt.name, "arguments": tt.args}), &result)
+		if !result.IsError || !strings.Contains(result.Content[0].Text, "HUNTER3_GH_ALLOWED_REPOS") && !strings.Contains(result.Content[0].Text, "segments") {
+			t.Errorf("%s(%v) = %+v, want it refused", tt.name, tt.args, result)
+		}
+	}
+
+	allowed := []struct {
+		name string
+		args map[string]interface{}
+	}{
+		{"gh_api", map[string]interface{}{"endpoint": "/repos/octo/app/pulls?state=open"}},
+		{"gh_issue_list", map[string]interface{}{"repo": "octo/app", "flags": []interface{}{"--limit", "5"}}},
+	}
+	for _, tt := range allowed {
+		var result ToolResult
+		decodeResult(t, call(t, "tools/call", map[string]interface{}{"name": tt.name, "arguments": tt.args}), &result)
+		if result.IsError {
+			t.Errorf("%s(%v) = %+v, want it allowed", tt.name, tt.args, result)
+		}
+	}
+}
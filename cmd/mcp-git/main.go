@@ -2,15 +2,24 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
+	"github.com/soyeahso/hunter3/internal/logfile"
 )
 
 // JSON-RPC types
@@ -93,6 +102,32 @@ type ListToolsResult struct {
 	Tools []Tool `json:"tools"`
 }
 
+// DiffStatFile is a single file entry parsed from git diff --numstat.
+type DiffStatFile struct {
+	File    string `json:"file"`
+	Added   int    `json:"added"`
+	Deleted int    `json:"deleted"`
+	Binary  bool   `json:"binary"`
+}
+
+// DiffStat is the structured result of git_diff_stat.
+type DiffStat struct {
+	Files        []DiffStatFile `json:"files"`
+	FilesChanged int            `json:"files_changed"`
+	TotalAdded   int            `json:"total_added"`
+	TotalDeleted int            `json:"total_deleted"`
+}
+
+// LogCommit is a single commit parsed from git_log's parsed mode.
+type LogCommit struct {
+	SHA     string `json:"sha"`
+	Author  string `json:"author"`
+	Email   string `json:"email"`
+	Date    string `json:"date"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
 // GitResult is returned from executeGitCommand as JSON.
 type GitResult struct {
 	Command string `json:"command"`
@@ -100,6 +135,12 @@ type GitResult struct {
 	Stdout  string `json:"stdout,omitempty"`
 	Stderr  string `json:"stderr,omitempty"`
 	Error   string `json:"error,omitempty"`
+
+	// Conflicts lists the unmerged files left by a failed merge or rebase.
+	Conflicts []string `json:"conflicts,omitempty"`
+
+	// timedOut is set when the command was killed at gitTimeout.
+	timedOut bool
 }
 
 // Helper constructors for schema properties
@@ -116,35 +157,34 @@ func stringArrayProp(desc string) Property {
 	return Property{Type: "array", Description: desc, Items: &ItemType{Type: "string"}}
 }
 
+func numberProp(desc string) Property {
+	return Property{Type: "number", Description: desc}
+}
+
+func integerProp(desc string) Property {
+	return Property{Type: "integer", Description: desc}
+}
+
 // MCPServer handles the JSON-RPC stdin/stdout protocol.
-type MCPServer struct{}
+type MCPServer struct {
+	// outputLimit is the byte cap on command output for the tool call in
+	// progress; see maxOutputBytes.
+	outputLimit int
+}
 
 var logger *log.Logger
 
 func initLogger() {
-	// Create logs directory if it doesn't exist
-	logsDir := filepath.Join(os.Getenv("HOME"), ".hunter3", "logs")
-	if err := os.MkdirAll(logsDir, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create logs directory: %v\n", err)
-		return
-	}
-
-	// Open log file
-	logFile := filepath.Join(logsDir, "mcp-git.log")
-	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to open log file: %v\n", err)
-		return
-	}
-
-	// Create logger that writes to both file and stderr
-	logger = log.New(io.MultiWriter(f, os.Stderr), "[mcp-git] ", log.LstdFlags)
+	// Log to stderr and to a file rotated by size and readable only by the owner
+	logger = logfile.NewLogger("mcp-git")
 	logger.Println("MCP Git server starting...")
 }
 
 func main() {
 	initLogger()
 	initAllowedPaths()
+	initTimeout()
+	initMaxOutputBytes()
 	s := &MCPServer{}
 	logger.Println("Server initialized")
 	s.Run()
@@ -232,11 +272,14 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 		},
 		{
 			Name:        "git_log",
-			Description: "Show commit logs. Supports flags like --oneline, --graph, --all, -n, --author, --since, --format, etc.",
+			Description: "Show commit logs. Supports flags like --oneline, --graph, --all, -n, --author, --since, --format, etc. Set parsed to 'true' to get a JSON array of {sha, author, email, date, subject, body} commit objects instead of text.",
 			InputSchema: InputSchema{
 				Type: "object",
 				Properties: map[string]Property{
 					"repository_path": repoProp,
+					"parsed":          stringProp("Return structured commit objects instead of raw text (true/false). Formatting flags like --oneline, --format, and --graph are not allowed in this mode."),
+					"limit":           numberProp("Maximum number of commits to return"),
+					"skip":            numberProp("Number of commits to skip before returning results (for paging)"),
 					"flags":           flagsProp,
 				},
 				Required: []string{"repository_path"},
@@ -249,7 +292,21 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 				Type: "object",
 				Properties: map[string]Property{
 					"repository_path": repoProp,
-					"target":          stringProp("Commit, branch, or path to diff against (e.g. 'HEAD~1', 'main', 'file.go')"),
+					"target":          stringProp("Commit, branch, range, or path to diff against (e.g. 'HEAD~1', 'main...feature', 'file.go')"),
+					"stat":            stringProp("Return per-file added/deleted line counts and totals as JSON instead of the patch, like git_diff_stat (true/false)"),
+					"flags":           flagsProp,
+				},
+				Required: []string{"repository_path"},
+			},
+		},
+		{
+			Name:        "git_diff_stat",
+			Description: "Summarize changes as structured JSON using git diff --numstat: per-file added/deleted line counts (binary files flagged) plus totals. Supports flags like --staged, --cached, -M, etc.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"repository_path": repoProp,
+					"target":          stringProp("Commit, branch, or range to diff against (e.g. 'HEAD~1', 'main', 'main...feature')"),
 					"flags":           flagsProp,
 				},
 				Required: []string{"repository_path"},
@@ -409,9 +466,10 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 			InputSchema: InputSchema{
 				Type: "object",
 				Properties: map[string]Property{
-					"repository_path": repoProp,
-					"branch":          stringProp("Branch to merge into current branch"),
-					"flags":           flagsProp,
+					"repository_path":  repoProp,
+					"branch":           stringProp("Branch to merge into current branch"),
+					"flags":            flagsProp,
+					"detect_conflicts": stringProp("If the command fails, list unmerged files in a conflicts array (true/false, default true)"),
 				},
 				Required: []string{"repository_path"},
 			},
@@ -422,9 +480,10 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 			InputSchema: InputSchema{
 				Type: "object",
 				Properties: map[string]Property{
-					"repository_path": repoProp,
-					"target":          stringProp("Branch or commit to rebase onto"),
-					"flags":           flagsProp,
+					"repository_path":  repoProp,
+					"target":           stringProp("Branch or commit to rebase onto"),
+					"flags":            flagsProp,
+					"detect_conflicts": stringProp("If the command fails, list unmerged files in a conflicts array (true/false, default true)"),
 				},
 				Required: []string{"repository_path"},
 			},
@@ -506,9 +565,13 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 			InputSchema: InputSchema{
 				Type: "object",
 				Properties: map[string]Property{
-					"url":  stringProp("Repository URL to clone"),
-					"path": stringProp("Local path to clone into (optional)"),
-					"flags": flagsProp,
+					"url":                stringProp("Repository URL to clone"),
+					"path":               stringProp("Local path to clone into (optional)"),
+					"branch":             stringProp("Branch or tag to check out instead of the remote's HEAD"),
+					"depth":              numberProp("Create a shallow clone with this many commits of history"),
+					"single_branch":      stringProp("Only fetch the history of one branch (true/false)"),
+					"recurse_submodules": stringProp("Also clone and initialize submodules (true/false)"),
+					"flags":              flagsProp,
 				},
 				Required: []string{"url"},
 			},
@@ -530,6 +593,24 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 			},
 		},
 
+		// --- Export ---
+		{
+			Name:        "git_archive",
+			Description: "Export a tree as a tar, zip, or tar.gz archive without the .git directory, e.g. for release packaging. The output path must be within the allowed directories.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"repository_path": repoProp,
+					"ref":             stringPropDefault("Commit, tag, or tree to export", "HEAD"),
+					"format":          {Type: "string", Description: "Archive format", Enum: archiveFormats, Default: "tar"},
+					"output":          stringProp("Path of the archive to write (relative paths are relative to the repository)"),
+					"prefix":          stringProp("Directory to put every file under inside the archive (e.g. 'myproject-1.2.0/')"),
+					"flags":           flagsProp,
+				},
+				Required: []string{"repository_path", "output"},
+			},
+		},
+
 		// --- Stash ---
 		{
 			Name:        "git_stash",
@@ -546,6 +627,44 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 			},
 		},
 
+		// --- Submodules ---
+		{
+			Name:        "git_submodule",
+			Description: "Manage submodules. Subcommands: status, init, update, add, sync.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"repository_path": repoProp,
+					"subcommand":      {Type: "string", Description: "Submodule subcommand", Enum: submoduleSubcommands, Default: "status"},
+					"paths":           stringArrayProp("Limit status, init, update, or sync to these submodule paths"),
+					"url":             stringProp("Repository URL of the submodule (for add)"),
+					"path":            stringProp("Where to place the submodule, relative to the repository (for add; defaults to the repository name)"),
+					"init":            stringProp("For update, initialize submodules that have not been initialized yet (true/false)"),
+					"recursive":       stringProp("For status, update, and sync, also act on nested submodules (true/false)"),
+					"flags":           flagsProp,
+				},
+				Required: []string{"repository_path"},
+			},
+		},
+
+		// --- Notes ---
+		{
+			Name:        "git_notes",
+			Description: "Read and write git notes, the metadata (such as CI results) attached to commits without changing them. Subcommands: add, append, show, list, remove.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"repository_path": repoProp,
+					"subcommand":      {Type: "string", Description: "Notes subcommand", Enum: notesSubcommands, Default: "list"},
+					"object":          stringProp("Commit the note is attached to (defaults to HEAD; for list, lists only that commit's note)"),
+					"message":         stringProp("Note text (required for add and append)"),
+					"notes_ref":       stringProp("Notes ref to use instead of refs/notes/commits (e.g. 'ci' for refs/notes/ci)"),
+					"flags":           flagsProp,
+				},
+				Required: []string{"repository_path"},
+			},
+		},
+
 		// --- Working tree ---
 		{
 			Name:        "git_clean",
@@ -587,6 +706,37 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 				Required: []string{"repository_path", "args"},
 			},
 		},
+		{
+			Name:        "git_describe",
+			Description: "Describe a commit by the nearest tag reachable from it (e.g. v1.4.2-3-gabc1234). This is how build scripts derive version strings.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"repository_path": repoProp,
+					"commit":          stringProp("Commit-ish to describe (defaults to HEAD)"),
+					"tags":            stringProp("Use any tag, not just annotated tags (true/false)"),
+					"always":          stringProp("Fall back to the abbreviated commit hash when no tag is reachable (true/false)"),
+					"dirty":           stringProp("Append -dirty when the working tree has local changes (true/false, HEAD only)"),
+					"flags":           flagsProp,
+				},
+				Required: []string{"repository_path"},
+			},
+		},
+		{
+			Name:        "git_show_ref",
+			Description: "List references in the local repository with the commits they point to.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"repository_path": repoProp,
+					"tags":            stringProp("Only show tags (true/false)"),
+					"heads":           stringProp("Only show branch heads (true/false)"),
+					"patterns":        stringArrayProp("Only show refs whose names end with these patterns (e.g. ['main', 'v1.0'])"),
+					"flags":           flagsProp,
+				},
+				Required: []string{"repository_path"},
+			},
+		},
 		{
 			Name:        "git_ls_files",
 			Description: "Show information about files in the index and working tree. Supports flags like --modified, --deleted, --others, --ignored, etc.",
@@ -601,6 +751,13 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 		},
 	}
 
+	for i := range tools {
+		if tools[i].InputSchema.Properties == nil {
+			tools[i].InputSchema.Properties = map[string]Property{}
+		}
+		tools[i].InputSchema.Properties["max_output_bytes"] = integerProp("Truncate stdout and stderr to this many bytes (defaults to HUNTER3_MAX_OUTPUT_BYTES, 1 MiB)")
+	}
+
 	s.sendResponse(req.ID, ListToolsResult{Tools: tools})
 }
 
@@ -617,13 +774,27 @@ func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
 	logger.Printf("Calling tool: %s\n", params.Name)
 	args := params.Arguments
 
+	limit, err := callOutputLimit(args)
+	if err != nil {
+		s.sendToolError(req.ID, err)
+		return
+	}
+	s.outputLimit = limit
+	defer func() { s.outputLimit = 0 }()
+
 	switch params.Name {
 	case "git_status":
 		s.gitSimple(req.ID, args, "status")
 	case "git_log":
-		s.gitSimple(req.ID, args, "log")
+		s.gitLog(req.ID, args)
 	case "git_diff":
-		s.gitWithTarget(req.ID, args, "diff", "target")
+		if stat, _ := args["stat"].(string); stat == "true" {
+			s.gitDiffStat(req.ID, args)
+		} else {
+			s.gitWithTarget(req.ID, args, "diff", "target")
+		}
+	case "git_diff_stat":
+		s.gitDiffStat(req.ID, args)
 	case "git_show":
 		s.gitWithTarget(req.ID, args, "show", "object")
 	case "git_blame":
@@ -647,9 +818,9 @@ func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
 	case "git_switch":
 		s.gitWithTarget(req.ID, args, "switch", "branch")
 	case "git_merge":
-		s.gitWithTarget(req.ID, args, "merge", "branch")
+		s.gitMergeRebase(req.ID, args, "merge", "branch")
 	case "git_rebase":
-		s.gitWithTarget(req.ID, args, "rebase", "target")
+		s.gitMergeRebase(req.ID, args, "rebase", "target")
 	case "git_cherry_pick":
 		s.gitCherryPick(req.ID, args)
 	case "git_remote":
@@ -664,39 +835,49 @@ func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
 		s.gitClone(req.ID, args)
 	case "git_tag":
 		s.gitTag(req.ID, args)
+	case "git_archive":
+		s.gitBuilt(req.ID, args, archiveArgs)
 	case "git_stash":
 		s.gitStash(req.ID, args)
+	case "git_submodule":
+		s.gitBuilt(req.ID, args, submoduleArgs)
+	case "git_notes":
+		s.gitBuilt(req.ID, args, notesArgs)
 	case "git_clean":
 		s.gitSimple(req.ID, args, "clean")
 	case "git_init":
 		s.gitInit(req.ID, args)
 	case "git_rev_parse":
 		s.gitRevParse(req.ID, args)
+	case "git_describe":
+		s.gitBuilt(req.ID, args, describeArgs)
+	case "git_show_ref":
+		s.gitBuilt(req.ID, args, showRefArgs)
 	case "git_ls_files":
 		s.gitSimple(req.ID, args, "ls-files")
 	default:
-		s.sendToolError(req.ID, fmt.Sprintf("Unknown tool: %s", params.Name))
+		s.sendToolError(req.ID, invalidArgf("Unknown tool: %s", params.Name))
 	}
 }
 
 // ---------- Tool handlers ----------
 
-// gitSimple handles commands that just take repository_path + flags (status, log, clean, ls-files).
+// gitSimple handles commands that just take repository_path + flags (status, clean, ls-files).
 func (s *MCPServer) gitSimple(id interface{}, args map[string]interface{}, subcmd string) {
 	repoPath, ok := getRepoPath(args)
 	if !ok {
-		s.sendToolError(id, "repository_path is required")
+		s.sendToolError(id, invalidArgf("repository_path is required"))
 		return
 	}
 	if err := verifyRepo(repoPath); err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 
 	cmdArgs := []string{subcmd}
 	flags, err := getFlags(args)
 	if err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 	cmdArgs = append(cmdArgs, flags...)
@@ -706,46 +887,78 @@ func (s *MCPServer) gitSimple(id interface{}, args map[string]interface{}, subcm
 
 // gitWithTarget handles commands with an optional positional argument (diff, show, branch, checkout, etc.).
 func (s *MCPServer) gitWithTarget(id interface{}, args map[string]interface{}, subcmd, targetKey string) {
+	repoPath, cmdArgs, err := targetCommand(args, subcmd, targetKey)
+	if err != nil {
+		s.sendToolError(id, err)
+		return
+	}
+	s.runGit(id, repoPath, cmdArgs)
+}
+
+// gitMergeRebase runs merge or rebase like gitWithTarget. When the command
+// fails it adds the files left unmerged, unless detect_conflicts is "false".
+func (s *MCPServer) gitMergeRebase(id interface{}, args map[string]interface{}, subcmd, targetKey string) {
+	repoPath, cmdArgs, err := targetCommand(args, subcmd, targetKey)
+	if err != nil {
+		s.sendToolError(id, err)
+		return
+	}
+
+	result := execGit(repoPath, cmdArgs)
+	if detect, _ := args["detect_conflicts"].(string); !result.Success && detect != "false" {
+		result.Conflicts = conflictedFiles(repoPath)
+	}
+	s.sendGitResult(id, result)
+}
+
+// targetCommand checks the repository and builds the git arguments for
+// gitWithTarget: subcmd, the flags, then args[targetKey] if it is set.
+func targetCommand(args map[string]interface{}, subcmd, targetKey string) (string, []string, error) {
 	repoPath, ok := getRepoPath(args)
 	if !ok {
-		s.sendToolError(id, "repository_path is required")
-		return
+		return "", nil, invalidArgf("repository_path is required")
 	}
 	if err := verifyRepo(repoPath); err != nil {
-		s.sendToolError(id, err.Error())
-		return
+		return "", nil, err
 	}
 
 	cmdArgs := []string{subcmd}
 	flags, err := getFlags(args)
 	if err != nil {
-		s.sendToolError(id, err.Error())
-		return
+		return "", nil, err
 	}
 	cmdArgs = append(cmdArgs, flags...)
 	if target, ok := args[targetKey].(string); ok && target != "" {
 		cmdArgs = append(cmdArgs, target)
 	}
+	return repoPath, cmdArgs, nil
+}
 
-	s.runGit(id, repoPath, cmdArgs)
+// conflictedFiles lists the unmerged paths in the repository at repoPath.
+func conflictedFiles(repoPath string) []string {
+	result := execGit(repoPath, []string{"diff", "--name-only", "--diff-filter=U"})
+	if !result.Success || result.Stdout == "" {
+		return nil
+	}
+	return strings.Split(result.Stdout, "\n")
 }
 
 // gitWithPaths handles commands that take an array of paths (add, restore, rm).
 func (s *MCPServer) gitWithPaths(id interface{}, args map[string]interface{}, subcmd string) {
 	repoPath, ok := getRepoPath(args)
 	if !ok {
-		s.sendToolError(id, "repository_path is required")
+		s.sendToolError(id, invalidArgf("repository_path is required"))
 		return
 	}
 	if err := verifyRepo(repoPath); err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 
 	cmdArgs := []string{subcmd}
 	flags, err := getFlags(args)
 	if err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 	cmdArgs = append(cmdArgs, flags...)
@@ -763,24 +976,24 @@ func (s *MCPServer) gitWithPaths(id interface{}, args map[string]interface{}, su
 func (s *MCPServer) gitBlame(id interface{}, args map[string]interface{}) {
 	repoPath, ok := getRepoPath(args)
 	if !ok {
-		s.sendToolError(id, "repository_path is required")
+		s.sendToolError(id, invalidArgf("repository_path is required"))
 		return
 	}
 	if err := verifyRepo(repoPath); err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 
 	file, _ := args["file"].(string)
 	if file == "" {
-		s.sendToolError(id, "file is required")
+		s.sendToolError(id, invalidArgf("file is required"))
 		return
 	}
 
 	cmdArgs := []string{"blame"}
 	flags, err := getFlags(args)
 	if err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 	cmdArgs = append(cmdArgs, flags...)
@@ -793,24 +1006,24 @@ func (s *MCPServer) gitBlame(id interface{}, args map[string]interface{}) {
 func (s *MCPServer) gitCommit(id interface{}, args map[string]interface{}) {
 	repoPath, ok := getRepoPath(args)
 	if !ok {
-		s.sendToolError(id, "repository_path is required")
+		s.sendToolError(id, invalidArgf("repository_path is required"))
 		return
 	}
 	if err := verifyRepo(repoPath); err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 
 	message, _ := args["message"].(string)
 	if message == "" {
-		s.sendToolError(id, "message is required")
+		s.sendToolError(id, invalidArgf("message is required"))
 		return
 	}
 
 	cmdArgs := []string{"commit"}
 	flags, err := getFlags(args)
 	if err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 	cmdArgs = append(cmdArgs, flags...)
@@ -823,25 +1036,25 @@ func (s *MCPServer) gitCommit(id interface{}, args map[string]interface{}) {
 func (s *MCPServer) gitMv(id interface{}, args map[string]interface{}) {
 	repoPath, ok := getRepoPath(args)
 	if !ok {
-		s.sendToolError(id, "repository_path is required")
+		s.sendToolError(id, invalidArgf("repository_path is required"))
 		return
 	}
 	if err := verifyRepo(repoPath); err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 
 	source, _ := args["source"].(string)
 	dest, _ := args["destination"].(string)
 	if source == "" || dest == "" {
-		s.sendToolError(id, "source and destination are required")
+		s.sendToolError(id, invalidArgf("source and destination are required"))
 		return
 	}
 
 	cmdArgs := []string{"mv"}
 	flags, err := getFlags(args)
 	if err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 	cmdArgs = append(cmdArgs, flags...)
@@ -854,24 +1067,24 @@ func (s *MCPServer) gitMv(id interface{}, args map[string]interface{}) {
 func (s *MCPServer) gitCherryPick(id interface{}, args map[string]interface{}) {
 	repoPath, ok := getRepoPath(args)
 	if !ok {
-		s.sendToolError(id, "repository_path is required")
+		s.sendToolError(id, invalidArgf("repository_path is required"))
 		return
 	}
 	if err := verifyRepo(repoPath); err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 
 	commits := getStringArray(args, "commits")
 	if len(commits) == 0 {
-		s.sendToolError(id, "commits is required")
+		s.sendToolError(id, invalidArgf("commits is required"))
 		return
 	}
 
 	cmdArgs := []string{"cherry-pick"}
 	flags, err := getFlags(args)
 	if err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 	cmdArgs = append(cmdArgs, flags...)
@@ -884,11 +1097,11 @@ func (s *MCPServer) gitCherryPick(id interface{}, args map[string]interface{}) {
 func (s *MCPServer) gitRemote(id interface{}, args map[string]interface{}) {
 	repoPath, ok := getRepoPath(args)
 	if !ok {
-		s.sendToolError(id, "repository_path is required")
+		s.sendToolError(id, invalidArgf("repository_path is required"))
 		return
 	}
 	if err := verifyRepo(repoPath); err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 
@@ -906,7 +1119,7 @@ func (s *MCPServer) gitRemote(id interface{}, args map[string]interface{}) {
 
 	flags, err := getFlags(args)
 	if err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 	cmdArgs = append(cmdArgs, flags...)
@@ -917,18 +1130,18 @@ func (s *MCPServer) gitRemote(id interface{}, args map[string]interface{}) {
 func (s *MCPServer) gitRemoteOp(id interface{}, args map[string]interface{}, subcmd string) {
 	repoPath, ok := getRepoPath(args)
 	if !ok {
-		s.sendToolError(id, "repository_path is required")
+		s.sendToolError(id, invalidArgf("repository_path is required"))
 		return
 	}
 	if err := verifyRepo(repoPath); err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 
 	cmdArgs := []string{subcmd}
 	flags, err := getFlags(args)
 	if err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 	cmdArgs = append(cmdArgs, flags...)
@@ -944,18 +1157,18 @@ func (s *MCPServer) gitRemoteOp(id interface{}, args map[string]interface{}, sub
 func (s *MCPServer) gitPullPush(id interface{}, args map[string]interface{}, subcmd string) {
 	repoPath, ok := getRepoPath(args)
 	if !ok {
-		s.sendToolError(id, "repository_path is required")
+		s.sendToolError(id, invalidArgf("repository_path is required"))
 		return
 	}
 	if err := verifyRepo(repoPath); err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 
 	cmdArgs := []string{subcmd}
 	flags, err := getFlags(args)
 	if err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 	cmdArgs = append(cmdArgs, flags...)
@@ -972,49 +1185,74 @@ func (s *MCPServer) gitPullPush(id interface{}, args map[string]interface{}, sub
 
 // gitClone handles git clone (no repo verification needed).
 func (s *MCPServer) gitClone(id interface{}, args map[string]interface{}) {
-	url, _ := args["url"].(string)
-	if url == "" {
-		s.sendToolError(id, "url is required")
+	cmdArgs, err := cloneArgs(args)
+	if err != nil {
+		s.sendToolError(id, err)
 		return
 	}
 
-	cmdArgs := []string{"clone"}
+	// Clone runs in the current working directory, not inside a repo.
+	s.runGit(id, "", cmdArgs)
+}
+
+// cloneArgs builds git clone [options] -- <url> [<path>].
+func cloneArgs(args map[string]interface{}) ([]string, error) {
+	url, _ := args["url"].(string)
+	if url == "" {
+		return nil, invalidArgf("url is required")
+	}
+	if strings.HasPrefix(url, "-") {
+		return nil, invalidArgf("invalid url %q", url)
+	}
 	flags, err := getFlags(args)
 	if err != nil {
-		s.sendToolError(id, err.Error())
-		return
+		return nil, err
+	}
+
+	cmdArgs := []string{"clone"}
+	if branch, _ := args["branch"].(string); branch != "" {
+		cmdArgs = append(cmdArgs, "--branch", branch)
+	}
+	if depth, ok := args["depth"].(float64); ok {
+		if depth < 1 || depth != float64(int(depth)) {
+			return nil, invalidArgf("depth must be a positive integer")
+		}
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--depth=%d", int(depth)))
+	}
+	if single, _ := args["single_branch"].(string); single == "true" {
+		cmdArgs = append(cmdArgs, "--single-branch")
+	}
+	if recurse, _ := args["recurse_submodules"].(string); recurse == "true" {
+		cmdArgs = append(cmdArgs, "--recurse-submodules")
 	}
 	cmdArgs = append(cmdArgs, flags...)
-	cmdArgs = append(cmdArgs, url)
+	cmdArgs = append(cmdArgs, "--", url)
 
 	if path, ok := args["path"].(string); ok && path != "" {
 		if err := validateRepoPath(path); err != nil {
-			s.sendToolError(id, err.Error())
-			return
+			return nil, err
 		}
 		cmdArgs = append(cmdArgs, path)
 	}
-
-	// Clone runs in the current working directory, not inside a repo.
-	s.runGit(id, "", cmdArgs)
+	return cmdArgs, nil
 }
 
 // gitTag handles git tag with optional name and message.
 func (s *MCPServer) gitTag(id interface{}, args map[string]interface{}) {
 	repoPath, ok := getRepoPath(args)
 	if !ok {
-		s.sendToolError(id, "repository_path is required")
+		s.sendToolError(id, invalidArgf("repository_path is required"))
 		return
 	}
 	if err := verifyRepo(repoPath); err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 
 	cmdArgs := []string{"tag"}
 	flags, err := getFlags(args)
 	if err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 	cmdArgs = append(cmdArgs, flags...)
@@ -1034,11 +1272,11 @@ func (s *MCPServer) gitTag(id interface{}, args map[string]interface{}) {
 func (s *MCPServer) gitStash(id interface{}, args map[string]interface{}) {
 	repoPath, ok := getRepoPath(args)
 	if !ok {
-		s.sendToolError(id, "repository_path is required")
+		s.sendToolError(id, invalidArgf("repository_path is required"))
 		return
 	}
 	if err := verifyRepo(repoPath); err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 
@@ -1051,7 +1289,7 @@ func (s *MCPServer) gitStash(id interface{}, args map[string]interface{}) {
 
 	flags, err := getFlags(args)
 	if err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 	cmdArgs = append(cmdArgs, flags...)
@@ -1070,14 +1308,14 @@ func (s *MCPServer) gitInit(id interface{}, args map[string]interface{}) {
 	cmdArgs := []string{"init"}
 	flags, err := getFlags(args)
 	if err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 	cmdArgs = append(cmdArgs, flags...)
 
 	if p, ok := args["path"].(string); ok && p != "" {
 		if err := validateRepoPath(p); err != nil {
-			s.sendToolError(id, err.Error())
+			s.sendToolError(id, err)
 			return
 		}
 		cmdArgs = append(cmdArgs, p)
@@ -1090,18 +1328,18 @@ func (s *MCPServer) gitInit(id interface{}, args map[string]interface{}) {
 func (s *MCPServer) gitRevParse(id interface{}, args map[string]interface{}) {
 	repoPath, ok := getRepoPath(args)
 	if !ok {
-		s.sendToolError(id, "repository_path is required")
+		s.sendToolError(id, invalidArgf("repository_path is required"))
 		return
 	}
 	if err := verifyRepo(repoPath); err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 
 	cmdArgs := []string{"rev-parse"}
 	flags, err := getFlags(args)
 	if err != nil {
-		s.sendToolError(id, err.Error())
+		s.sendToolError(id, err)
 		return
 	}
 	cmdArgs = append(cmdArgs, flags...)
@@ -1110,13 +1348,599 @@ func (s *MCPServer) gitRevParse(id interface{}, args map[string]interface{}) {
 	s.runGit(id, repoPath, cmdArgs)
 }
 
+// gitBuilt runs the git command line that build makes from args in the
+// repository at repository_path.
+func (s *MCPServer) gitBuilt(id interface{}, args map[string]interface{}, build func(map[string]interface{}) ([]string, error)) {
+	repoPath, ok := getRepoPath(args)
+	if !ok {
+		s.sendToolError(id, invalidArgf("repository_path is required"))
+		return
+	}
+	if err := verifyRepo(repoPath); err != nil {
+		s.sendToolError(id, err)
+		return
+	}
+
+	cmdArgs, err := build(args)
+	if err != nil {
+		s.sendToolError(id, err)
+		return
+	}
+
+	s.runGit(id, repoPath, cmdArgs)
+}
+
+// describeArgs builds git describe.
+func describeArgs(args map[string]interface{}) ([]string, error) {
+	flags, err := getFlags(args)
+	if err != nil {
+		return nil, err
+	}
+	commit, _ := args["commit"].(string)
+	if strings.HasPrefix(commit, "-") {
+		return nil, invalidArgf("invalid commit %q", commit)
+	}
+
+	cmdArgs := []string{"describe"}
+	if tags, _ := args["tags"].(string); tags == "true" {
+		cmdArgs = append(cmdArgs, "--tags")
+	}
+	if always, _ := args["always"].(string); always == "true" {
+		cmdArgs = append(cmdArgs, "--always")
+	}
+	if dirty, _ := args["dirty"].(string); dirty == "true" {
+		// git only checks the working tree when describing HEAD.
+		if commit != "" {
+			return nil, invalidArgf("dirty cannot be combined with commit")
+		}
+		cmdArgs = append(cmdArgs, "--dirty")
+	}
+	cmdArgs = append(cmdArgs, flags...)
+	if commit != "" {
+		cmdArgs = append(cmdArgs, commit)
+	}
+	return cmdArgs, nil
+}
+
+// showRefArgs builds git show-ref. git exits with status 1 when no ref
+// matches, which is reported as a failed command.
+func showRefArgs(args map[string]interface{}) ([]string, error) {
+	flags, err := getFlags(args)
+	if err != nil {
+		return nil, err
+	}
+
+	cmdArgs := []string{"show-ref"}
+	if tags, _ := args["tags"].(string); tags == "true" {
+		cmdArgs = append(cmdArgs, "--tags")
+	}
+	if heads, _ := args["heads"].(string); heads == "true" {
+		cmdArgs = append(cmdArgs, "--heads")
+	}
+	cmdArgs = append(cmdArgs, flags...)
+
+	patterns := getStringArray(args, "patterns")
+	if len(patterns) > 0 {
+		cmdArgs = append(cmdArgs, "--")
+		cmdArgs = append(cmdArgs, patterns...)
+	}
+	return cmdArgs, nil
+}
+
+// archiveFormats are the git archive formats git_archive accepts.
+var archiveFormats = []string{"tar", "zip", "tar.gz"}
+
+// archiveArgs builds git archive --format=<format> --output=<output> <ref>.
+func archiveArgs(args map[string]interface{}) ([]string, error) {
+	flags, err := getFlags(args)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range flags {
+		if isArchiveOutputFlag(f) {
+			return nil, invalidArgf("flag %q is not allowed: use output", f)
+		}
+	}
+
+	format, _ := args["format"].(string)
+	if format == "" {
+		format = "tar"
+	}
+	if !slices.Contains(archiveFormats, format) {
+		return nil, invalidArgf("invalid format %q: must be one of %s", format, strings.Join(archiveFormats, ", "))
+	}
+
+	output, _ := args["output"].(string)
+	if output == "" {
+		return nil, invalidArgf("output is required")
+	}
+	if !filepath.IsAbs(output) {
+		repoPath, _ := getRepoPath(args)
+		output = filepath.Join(repoPath, output)
+	}
+	output, err = resolveOutputPath(output)
+	if err != nil {
+		return nil, err
+	}
+
+	ref, _ := args["ref"].(string)
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if strings.HasPrefix(ref, "-") {
+		return nil, invalidArgf("invalid ref %q", ref)
+	}
+
+	cmdArgs := []string{"archive", "--format=" + format, "--output=" + output}
+	if prefix, _ := args["prefix"].(string); prefix != "" {
+		if !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		cmdArgs = append(cmdArgs, "--prefix="+prefix)
+	}
+	cmdArgs = append(cmdArgs, flags...)
+	cmdArgs = append(cmdArgs, ref)
+	return cmdArgs, nil
+}
+
+// isArchiveOutputFlag reports whether f would replace the validated output
+// of git archive: -o, -o<file>, a short group such as -vo, or --output and
+// the abbreviations git accepts for it, such as --out=<file>.
+func isArchiveOutputFlag(f string) bool {
+	if strings.HasPrefix(f, "--") {
+		name, _, _ := strings.Cut(f[2:], "=")
+		return name != "" && strings.HasPrefix("output", name)
+	}
+	return len(f) > 1 && f[0] == '-' && strings.Contains(f[1:], "o")
+}
+
+// resolveOutputPath returns the absolute form of a file to be written within
+// the allowed directories. Its directory must already exist and is resolved
+// through symlinks before the check, so a symlinked directory cannot lead
+// outside them. An existing symlink at the path itself is refused.
+func resolveOutputPath(output string) (string, error) {
+	abs, err := filepath.Abs(output)
+	if err != nil {
+		return "", invalidArgf("invalid path: %v", err)
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(abs))
+	if err != nil {
+		return "", invalidArgf("output directory for %q does not exist", output)
+	}
+	resolved := filepath.Join(dir, filepath.Base(abs))
+	if err := validateRepoPath(resolved); err != nil {
+		return "", err
+	}
+	if info, err := os.Lstat(resolved); err == nil {
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			return "", invalidArgf("output %q is a symlink", output)
+		case info.IsDir():
+			return "", invalidArgf("output %q is a directory", output)
+		}
+	}
+	return resolved, nil
+}
+
+// submoduleSubcommands are the git submodule subcommands git_submodule runs.
+var submoduleSubcommands = []string{"status", "init", "update", "add", "sync"}
+
+// submoduleArgs builds git submodule <subcommand>. Submodule paths are
+// resolved against the repository and must stay within the allowed
+// directories.
+func submoduleArgs(args map[string]interface{}) ([]string, error) {
+	flags, err := getFlags(args)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, _ := args["subcommand"].(string)
+	if sub == "" {
+		sub = "status"
+	}
+	if !slices.Contains(submoduleSubcommands, sub) {
+		return nil, invalidArgf("invalid subcommand %q: must be one of %s", sub, strings.Join(submoduleSubcommands, ", "))
+	}
+
+	cmdArgs := []string{"submodule", sub}
+	if init, _ := args["init"].(string); init == "true" {
+		if sub != "update" {
+			return nil, invalidArgf("init is only valid with update")
+		}
+		cmdArgs = append(cmdArgs, "--init")
+	}
+	if recursive, _ := args["recursive"].(string); recursive == "true" {
+		if sub == "init" || sub == "add" {
+			return nil, invalidArgf("recursive is not valid with %s", sub)
+		}
+		cmdArgs = append(cmdArgs, "--recursive")
+	}
+	cmdArgs = append(cmdArgs, flags...)
+
+	repoPath, _ := getRepoPath(args)
+	if sub == "add" {
+		u, _ := args["url"].(string)
+		if u == "" {
+			return nil, invalidArgf("url is required for add")
+		}
+		if strings.HasPrefix(u, "-") {
+			return nil, invalidArgf("invalid url %q", u)
+		}
+		cmdArgs = append(cmdArgs, "--", u)
+		if p, _ := args["path"].(string); p != "" {
+			if err := validateSubmodulePath(repoPath, p); err != nil {
+				return nil, err
+			}
+			cmdArgs = append(cmdArgs, p)
+		}
+		return cmdArgs, nil
+	}
+
+	paths := getStringArray(args, "paths")
+	for _, p := range paths {
+		if err := validateSubmodulePath(repoPath, p); err != nil {
+			return nil, err
+		}
+	}
+	if len(paths) > 0 {
+		cmdArgs = append(cmdArgs, "--")
+		cmdArgs = append(cmdArgs, paths...)
+	}
+	return cmdArgs, nil
+}
+
+// validateSubmodulePath checks a submodule path, taken relative to repoPath
+// unless absolute, with validateRepoPath.
+func validateSubmodulePath(repoPath, p string) error {
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(repoPath, p)
+	}
+	return validateRepoPath(p)
+}
+
+// notesSubcommands are the git notes subcommands git_notes runs.
+var notesSubcommands = []string{"add", "append", "show", "list", "remove"}
+
+// notesArgs builds git notes [--ref=<ref>] <subcommand>. add and append
+// need a message, since git would otherwise open an editor.
+func notesArgs(args map[string]interface{}) ([]string, error) {
+	flags, err := getFlags(args)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, _ := args["subcommand"].(string)
+	if sub == "" {
+		sub = "list"
+	}
+	if !slices.Contains(notesSubcommands, sub) {
+		return nil, invalidArgf("invalid subcommand %q: must be one of %s", sub, strings.Join(notesSubcommands, ", "))
+	}
+	object, _ := args["object"].(string)
+	if strings.HasPrefix(object, "-") {
+		return nil, invalidArgf("invalid object %q", object)
+	}
+
+	cmdArgs := []string{"notes"}
+	if ref, _ := args["notes_ref"].(string); ref != "" {
+		if strings.HasPrefix(ref, "-") {
+			return nil, invalidArgf("invalid notes_ref %q", ref)
+		}
+		cmdArgs = append(cmdArgs, "--ref="+ref)
+	}
+	cmdArgs = append(cmdArgs, sub)
+
+	message, _ := args["message"].(string)
+	switch sub {
+	case "add", "append":
+		if message == "" {
+			return nil, invalidArgf("message is required for %s", sub)
+		}
+		cmdArgs = append(cmdArgs, "-m", message)
+	default:
+		if message != "" {
+			return nil, invalidArgf("message is only valid with add and append")
+		}
+	}
+	cmdArgs = append(cmdArgs, flags...)
+	if object != "" {
+		cmdArgs = append(cmdArgs, object)
+	}
+	return cmdArgs, nil
+}
+
+// logFieldSep and logRecordSep delimit fields and commits in parsed git_log
+// output. The ASCII unit/record separators never appear in commit metadata.
+const (
+	logFieldSep  = "\x1f"
+	logRecordSep = "\x1e"
+)
+
+// logParsedFormat is the --pretty format used by git_log's parsed mode.
+const logParsedFormat = "--pretty=format:%H%x1f%an%x1f%ae%x1f%aI%x1f%s%x1f%b%x1e"
+
+// logFormatFlags are git log flags that change the output format and would
+// break parsing in parsed mode.
+var logFormatFlags = []string{"--oneline", "--format", "--pretty", "--graph", "-p", "--patch", "--stat", "--numstat", "--shortstat", "--name-only", "--name-status", "-z"}
+
+// gitLog handles git log, either as raw text or as parsed commit objects.
+func (s *MCPServer) gitLog(id interface{}, args map[string]interface{}) {
+	repoPath, ok := getRepoPath(args)
+	if !ok {
+		s.sendToolError(id, invalidArgf("repository_path is required"))
+		return
+	}
+	if err := verifyRepo(repoPath); err != nil {
+		s.sendToolError(id, err)
+		return
+	}
+
+	flags, err := getFlags(args)
+	if err != nil {
+		s.sendToolError(id, err)
+		return
+	}
+	parsed, _ := args["parsed"].(string)
+
+	cmdArgs := []string{"log"}
+	if limit, ok := args["limit"].(float64); ok && limit > 0 {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--max-count=%d", int(limit)))
+	}
+	if skip, ok := args["skip"].(float64); ok && skip > 0 {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--skip=%d", int(skip)))
+	}
+
+	if parsed != "true" {
+		cmdArgs = append(cmdArgs, flags...)
+		s.runGit(id, repoPath, cmdArgs)
+		return
+	}
+
+	for _, f := range flags {
+		for _, ff := range logFormatFlags {
+			if f == ff || strings.HasPrefix(f, ff+"=") {
+				s.sendToolError(id, invalidArgf("flag %q cannot be used with parsed mode", f))
+				return
+			}
+		}
+	}
+	cmdArgs = append(cmdArgs, logParsedFormat)
+	cmdArgs = append(cmdArgs, flags...)
+
+	result := execGit(repoPath, cmdArgs)
+	if !result.Success {
+		s.sendGitResult(id, result)
+		return
+	}
+
+	commits, err := parseLog(result.Stdout)
+	if err != nil {
+		s.sendToolError(id, err)
+		return
+	}
+
+	data, _ := json.MarshalIndent(commits, "", "  ")
+	s.sendResponse(id, ToolResult{
+		Content: []ContentItem{{Type: "text", Text: string(data)}},
+	})
+}
+
+// parseLog parses git log output produced with logParsedFormat.
+func parseLog(out string) ([]LogCommit, error) {
+	commits := []LogCommit{}
+	for _, record := range strings.Split(out, logRecordSep) {
+		record = strings.TrimLeft(record, "\n")
+		if strings.TrimSpace(record) == "" {
+			continue
+		}
+		fields := strings.Split(record, logFieldSep)
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("unexpected git log record with %d fields: %q", len(fields), record)
+		}
+		commits = append(commits, LogCommit{
+			SHA:     fields[0],
+			Author:  fields[1],
+			Email:   fields[2],
+			Date:    fields[3],
+			Subject: fields[4],
+			Body:    strings.TrimRight(fields[5], "\n"),
+		})
+	}
+	return commits, nil
+}
+
+// gitDiffStat runs git diff --numstat and returns the parsed per-file counts.
+func (s *MCPServer) gitDiffStat(id interface{}, args map[string]interface{}) {
+	repoPath, ok := getRepoPath(args)
+	if !ok {
+		s.sendToolError(id, invalidArgf("repository_path is required"))
+		return
+	}
+	if err := verifyRepo(repoPath); err != nil {
+		s.sendToolError(id, err)
+		return
+	}
+
+	cmdArgs := []string{"diff", "--numstat"}
+	flags, err := getFlags(args)
+	if err != nil {
+		s.sendToolError(id, err)
+		return
+	}
+	cmdArgs = append(cmdArgs, flags...)
+	if target, ok := args["target"].(string); ok && target != "" {
+		cmdArgs = append(cmdArgs, target)
+	}
+
+	result := execGit(repoPath, cmdArgs)
+	if !result.Success {
+		s.sendGitResult(id, result)
+		return
+	}
+
+	stat, err := parseNumstat(result.Stdout)
+	if err != nil {
+		s.sendToolError(id, err)
+		return
+	}
+
+	data, _ := json.MarshalIndent(stat, "", "  ")
+	s.sendResponse(id, ToolResult{
+		Content: []ContentItem{{Type: "text", Text: string(data)}},
+	})
+}
+
+// parseNumstat parses git diff --numstat output. Each line is
+// "<added>\t<deleted>\t<path>"; binary files report "-" for both counts.
+func parseNumstat(out string) (DiffStat, error) {
+	stat := DiffStat{Files: []DiffStatFile{}}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "\t", 3)
+		if len(parts) != 3 {
+			return DiffStat{}, fmt.Errorf("unexpected numstat line: %q", line)
+		}
+
+		f := DiffStatFile{File: parts[2]}
+		if parts[0] == "-" && parts[1] == "-" {
+			f.Binary = true
+		} else {
+			added, err := strconv.Atoi(parts[0])
+			if err != nil {
+				return DiffStat{}, fmt.Errorf("invalid added count in numstat line %q: %w", line, err)
+			}
+			deleted, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return DiffStat{}, fmt.Errorf("invalid deleted count in numstat line %q: %w", line, err)
+			}
+			f.Added, f.Deleted = added, deleted
+		}
+
+		stat.Files = append(stat.Files, f)
+		stat.TotalAdded += f.Added
+		stat.TotalDeleted += f.Deleted
+	}
+	stat.FilesChanged = len(stat.Files)
+	return stat, nil
+}
+
 // ---------- Git execution ----------
 
 func (s *MCPServer) runGit(id interface{}, cwd string, gitArgs []string) {
-	cmd := exec.Command("git", gitArgs...)
+	s.sendGitResult(id, execGit(cwd, gitArgs))
+}
+
+// sendGitResult sends a GitResult as the tool result, flagged as an error if
+// the command failed. A command killed at gitTimeout is reported as a
+// timeout ToolError instead.
+func (s *MCPServer) sendGitResult(id interface{}, result GitResult) {
+	if result.timedOut {
+		s.sendToolError(id, &ToolError{Code: codeTimeout, Message: result.Command + ": " + result.Error, Details: result.Command})
+		return
+	}
+	result.Stdout = truncateOutput(result.Stdout, s.outputLimit)
+	result.Stderr = truncateOutput(result.Stderr, s.outputLimit)
+	data, _ := json.MarshalIndent(result, "", "  ")
+	s.sendResponse(id, ToolResult{
+		Content: []ContentItem{{Type: "text", Text: string(data)}},
+		IsError: !result.Success,
+	})
+}
+
+// gitTimeout bounds every git command so that a hung network operation,
+// such as cloning an unreachable URL, cannot block the server. Zero disables
+// it. Override via HUNTER3_GIT_TIMEOUT.
+var gitTimeout = 5 * time.Minute
+
+func initTimeout() {
+	v := os.Getenv("HUNTER3_GIT_TIMEOUT")
+	if v == "" {
+		return
+	}
+	timeout, err := parseTimeout(v)
+	if err != nil {
+		logger.Printf("WARNING: %v; using %s\n", err, gitTimeout)
+		return
+	}
+	gitTimeout = timeout
+}
+
+// parseTimeout reads HUNTER3_GIT_TIMEOUT, given as a Go duration ("90s",
+// "10m") or a whole number of seconds.
+func parseTimeout(v string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid HUNTER3_GIT_TIMEOUT %q: use a duration like 90s or a number of seconds", v)
+	}
+	return d, nil
+}
+
+// maxOutputBytes caps the stdout and stderr returned by each command, since
+// many MCP hosts reject responses of tens of megabytes. Zero disables it.
+// Override via HUNTER3_MAX_OUTPUT_BYTES, or per call with max_output_bytes.
+var maxOutputBytes = 1 << 20
+
+func initMaxOutputBytes() {
+	v := os.Getenv("HUNTER3_MAX_OUTPUT_BYTES")
+	if v == "" {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		logger.Printf("WARNING: invalid HUNTER3_MAX_OUTPUT_BYTES %q; using %d\n", v, maxOutputBytes)
+		return
+	}
+	maxOutputBytes = n
+}
+
+// callOutputLimit returns the call's max_output_bytes, or maxOutputBytes if
+// it has none.
+func callOutputLimit(args map[string]interface{}) (int, error) {
+	if _, ok := args["max_output_bytes"]; !ok {
+		return maxOutputBytes, nil
+	}
+	n, ok := getNumber(args, "max_output_bytes")
+	if !ok || n < 1 || n > math.MaxInt32 || n != math.Trunc(n) {
+		return 0, invalidArgf("max_output_bytes must be a positive integer")
+	}
+	return int(n), nil
+}
+
+// truncateOutput cuts out to at most limit bytes, backing up to a UTF-8
+// boundary, and appends a marker giving the original size. A limit of zero
+// leaves out unchanged.
+func truncateOutput(out string, limit int) string {
+	if limit <= 0 || len(out) <= limit {
+		return out
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(out[cut]) {
+		cut--
+	}
+	return out[:cut] + fmt.Sprintf("\n[output truncated: showing %d of %d bytes]", cut, len(out))
+}
+
+// execGit runs git in cwd and captures its output without sending a response.
+func execGit(cwd string, gitArgs []string) GitResult {
+	ctx := context.Background()
+	if gitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, gitTimeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, "git", gitArgs...)
+	cmd.WaitDelay = time.Second
 	if cwd != "" {
 		cmd.Dir = cwd
 	}
+	// The server has no terminal, so a credential prompt would only stall
+	// the command until the timeout.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
 
 	commandStr := "git " + strings.Join(gitArgs, " ")
 	logger.Printf("Executing: %s (cwd: %s)\n", commandStr, cwd)
@@ -1135,15 +1959,15 @@ func (s *MCPServer) runGit(id interface{}, cwd string, gitArgs []string) {
 			logger.Printf("Git stderr: %s\n", result.Stderr)
 		}
 		result.Error = err.Error()
+		if ctx.Err() == context.DeadlineExceeded {
+			result.Error = fmt.Sprintf("timed out after %s", gitTimeout)
+			result.timedOut = true
+		}
 	} else {
 		logger.Printf("Git command succeeded, stdout length: %d bytes\n", len(result.Stdout))
 	}
 
-	data, _ := json.MarshalIndent(result, "", "  ")
-	s.sendResponse(id, ToolResult{
-		Content: []ContentItem{{Type: "text", Text: string(data)}},
-		IsError: !result.Success,
-	})
+	return result
 }
 
 // ---------- Helpers ----------
@@ -1180,7 +2004,7 @@ func validateRepoPath(repoPath string) error {
 
 	absPath, err := filepath.Abs(repoPath)
 	if err != nil {
-		return fmt.Errorf("invalid path: %w", err)
+		return invalidArgf("invalid path: %v", err)
 	}
 	normalized := filepath.Clean(absPath)
 
@@ -1189,7 +2013,7 @@ func validateRepoPath(repoPath string) error {
 			return nil
 		}
 	}
-	return fmt.Errorf("path %q is outside allowed directories", repoPath)
+	return &ToolError{Code: codePermissionDenied, Message: fmt.Sprintf("path %q is outside allowed directories", repoPath), Details: repoPath}
 }
 
 func verifyRepo(repoPath string) error {
@@ -1199,7 +2023,7 @@ func verifyRepo(repoPath string) error {
 	gitDir := filepath.Join(repoPath, ".git")
 	info, err := os.Stat(gitDir)
 	if err != nil {
-		return fmt.Errorf("not a git repository: %s", repoPath)
+		return notARepo(repoPath)
 	}
 	// .git can be a directory (normal) or a file (worktree/submodule)
 	if !info.IsDir() && info.Mode().IsRegular() {
@@ -1208,7 +2032,7 @@ func verifyRepo(repoPath string) error {
 	if info.IsDir() {
 		return nil
 	}
-	return fmt.Errorf("not a git repository: %s", repoPath)
+	return notARepo(repoPath)
 }
 
 // dangerousFlagPrefixes lists git flag prefixes that can lead to arbitrary
@@ -1228,7 +2052,7 @@ func sanitizeFlags(flags []string) ([]string, error) {
 		lower := strings.ToLower(f)
 		for _, prefix := range dangerousFlagPrefixes {
 			if lower == prefix || strings.HasPrefix(lower, prefix+"=") {
-				return nil, fmt.Errorf("flag %q is not allowed for security reasons", f)
+				return nil, &ToolError{Code: codePermissionDenied, Message: fmt.Sprintf("flag %q is not allowed for security reasons", f), Details: f}
 			}
 		}
 	}
@@ -1240,6 +2064,26 @@ func getFlags(args map[string]interface{}) ([]string, error) {
 	return sanitizeFlags(flags)
 }
 
+// getNumber reads a numeric argument sent either as a JSON number or as a
+// numeric string such as "50", since MCP hosts often send the latter. ok is
+// false when the key is absent or the value is not a finite number.
+func getNumber(args map[string]interface{}, key string) (float64, bool) {
+	switch v := args[key].(type) {
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			if v != "" {
+				logger.Printf("Ignoring non-numeric %s: %q\n", key, v)
+			}
+			return 0, false
+		}
+		return n, true
+	}
+	return 0, false
+}
+
 func getStringArray(args map[string]interface{}, key string) []string {
 	val, ok := args[key]
 	if !ok {
@@ -1262,6 +2106,20 @@ func getStringArray(args map[string]interface{}, key string) []string {
 
 // ---------- JSON-RPC responses ----------
 
+// stdoutMu serializes writes to stdoutWriter so that concurrent responses
+// can never interleave JSON-RPC lines on the protocol stream.
+var (
+	stdoutMu     sync.Mutex
+	stdoutWriter io.Writer = os.Stdout
+)
+
+// writeMessage writes a single newline-terminated JSON-RPC message to stdout.
+func writeMessage(data []byte) {
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+	stdoutWriter.Write(append(data, '\n'))
+}
+
 func (s *MCPServer) sendResponse(id interface{}, result interface{}) {
 	resp := JSONRPCResponse{
 		JSONRPC: "2.0",
@@ -1274,7 +2132,7 @@ func (s *MCPServer) sendResponse(id interface{}, result interface{}) {
 		fmt.Fprintf(os.Stderr, "Error marshaling response: %v\n", err)
 		return
 	}
-	fmt.Println(string(data))
+	writeMessage(data)
 	logger.Printf("Sent response for request ID: %v\n", id)
 }
 
@@ -1291,12 +2149,51 @@ func (s *MCPServer) sendError(id interface{}, code int, message string, data int
 		fmt.Fprintf(os.Stderr, "Error marshaling error response: %v\n", err)
 		return
 	}
-	fmt.Println(string(jsonData))
+	writeMessage(jsonData)
 }
 
-func (s *MCPServer) sendToolError(id interface{}, msg string) {
+// Error codes for ToolError, so that hosts can branch on the class of a
+// failure instead of parsing its message.
+const (
+	codeNotFound         = "not_found"
+	codePermissionDenied = "permission_denied"
+	codeInvalidArgument  = "invalid_argument"
+	codeTimeout          = "timeout"
+	codeUpstreamError    = "upstream_error"
+)
+
+// ToolError is the JSON body of a failed tool result.
+type ToolError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details string `json:"details,omitempty"`
+}
+
+func (e *ToolError) Error() string { return e.Message }
+
+func invalidArgf(format string, a ...interface{}) *ToolError {
+	return &ToolError{Code: codeInvalidArgument, Message: fmt.Sprintf(format, a...)}
+}
+
+func notARepo(repoPath string) *ToolError {
+	return &ToolError{Code: codeNotFound, Message: fmt.Sprintf("not a git repository: %s", repoPath), Details: repoPath}
+}
+
+// toToolError returns err as a ToolError. Errors that were not classified
+// where they arose come from git or its output and count as upstream errors.
+func toToolError(err error) *ToolError {
+	var te *ToolError
+	if errors.As(err, &te) {
+		return te
+	}
+	return &ToolError{Code: codeUpstreamError, Message: err.Error()}
+}
+
+// sendToolError sends err as a failed tool result whose text is a ToolError.
+func (s *MCPServer) sendToolError(id interface{}, err error) {
+	data, _ := json.Marshal(toToolError(err))
 	s.sendResponse(id, ToolResult{
-		Content: []ContentItem{{Type: "text", Text: msg}},
+		Content: []ContentItem{{Type: "text", Text: string(data)}},
 		IsError: true,
 	})
 }
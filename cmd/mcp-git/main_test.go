@@ -0,0 +1,741 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	logger = log.New(io.Discard, "", 0)
+	os.Exit(m.Run())
+}
+
+// callTool invokes a tool handler and returns the decoded tool result.
+func callTool(t *testing.T, name string, args map[string]interface{}) ToolResult {
+	t.Helper()
+
+	var buf bytes.Buffer
+	stdoutWriter = &buf
+	defer func() { stdoutWriter = os.Stdout }()
+
+	params, _ := json.Marshal(CallToolParams{Name: name, Arguments: args})
+	s := &MCPServer{}
+	s.handleCallTool(JSONRPCRequest{JSONRPC: "2.0", ID: 1, Method: "tools/call", Params: params})
+
+	var resp struct {
+		Result ToolResult `json:"result"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &resp); err != nil {
+		t.Fatalf("Unmarshal response %q: %v", buf.String(), err)
+	}
+	return resp.Result
+}
+
+func TestParseNumstat(t *testing.T) {
+	out := "10\t2\tcmd/mcp-git/main.go\n" +
+		"-\t-\tassets/logo.png\n" +
+		"0\t7\tREADME.md\n" +
+		"3\t0\tdocs/{old => new}/guide.md\n"
+
+	stat, err := parseNumstat(out)
+	if err != nil {
+		t.Fatalf("parseNumstat() error = %v", err)
+	}
+
+	want := []DiffStatFile{
+		{File: "cmd/mcp-git/main.go", Added: 10, Deleted: 2},
+		{File: "assets/logo.png", Binary: true},
+		{File: "README.md", Deleted: 7},
+		{File: "docs/{old => new}/guide.md", Added: 3},
+	}
+	if len(stat.Files) != len(want) {
+		t.Fatalf("got %d files, want %d", len(stat.Files), len(want))
+	}
+	for i := range want {
+		if stat.Files[i] != want[i] {
+			t.Errorf("Files[%d] = %+v, want %+v", i, stat.Files[i], want[i])
+		}
+	}
+
+	if stat.FilesChanged != 4 {
+		t.Errorf("FilesChanged = %d, want 4", stat.FilesChanged)
+	}
+	if stat.TotalAdded != 13 {
+		t.Errorf("TotalAdded = %d, want 13", stat.TotalAdded)
+	}
+	if stat.TotalDeleted != 9 {
+		t.Errorf("TotalDeleted = %d, want 9", stat.TotalDeleted)
+	}
+}
+
+func TestParseNumstatEmpty(t *testing.T) {
+	stat, err := parseNumstat("")
+	if err != nil {
+		t.Fatalf("parseNumstat() error = %v", err)
+	}
+	if stat.Files == nil || len(stat.Files) != 0 {
+		t.Errorf("Files = %#v, want empty non-nil slice", stat.Files)
+	}
+	if stat.FilesChanged != 0 || stat.TotalAdded != 0 || stat.TotalDeleted != 0 {
+		t.Errorf("unexpected totals: %+v", stat)
+	}
+}
+
+func TestParseNumstatMalformed(t *testing.T) {
+	tests := []string{
+		"not a numstat line",
+		"x\t1\tfile.go",
+		"1\ty\tfile.go",
+	}
+	for _, in := range tests {
+		if _, err := parseNumstat(in); err == nil {
+			t.Errorf("parseNumstat(%q) expected error", in)
+		}
+	}
+}
+
+func TestParseLog(t *testing.T) {
+	out := "a1b2c3\x1fAda Lovelace\x1fada@example.com\x1f2024-05-01T10:00:00+00:00\x1fAdd engine\x1f\x1e\n" +
+		"d4e5f6\x1fAlan Turing\x1falan@example.com\x1f2024-04-30T09:30:00+01:00\x1fFix tape handling\x1f" +
+		"The tape could run off the end.\n\nNow it wraps around instead.\n\x1e\n" +
+		"789abc\x1fGrace Hopper\x1fgrace@example.com\x1f2024-04-29T08:00:00-05:00\x1fInitial commit\x1f\x1e"
+
+	commits, err := parseLog(out)
+	if err != nil {
+		t.Fatalf("parseLog() error = %v", err)
+	}
+
+	want := []LogCommit{
+		{SHA: "a1b2c3", Author: "Ada Lovelace", Email: "ada@example.com", Date: "2024-05-01T10:00:00+00:00", Subject: "Add engine"},
+		{SHA: "d4e5f6", Author: "Alan Turing", Email: "alan@example.com", Date: "2024-04-30T09:30:00+01:00", Subject: "Fix tape handling",
+			Body: "The tape could run off the end.\n\nNow it wraps around instead."},
+		{SHA: "789abc", Author: "Grace Hopper", Email: "grace@example.com", Date: "2024-04-29T08:00:00-05:00", Subject: "Initial commit"},
+	}
+	if len(commits) != len(want) {
+		t.Fatalf("got %d commits, want %d", len(commits), len(want))
+	}
+	for i := range want {
+		if commits[i] != want[i] {
+			t.Errorf("commits[%d] = %+v, want %+v", i, commits[i], want[i])
+		}
+	}
+}
+
+func TestParseLogEmpty(t *testing.T) {
+	commits, err := parseLog("")
+	if err != nil {
+		t.Fatalf("parseLog() error = %v", err)
+	}
+	if commits == nil || len(commits) != 0 {
+		t.Errorf("commits = %#v, want empty non-nil slice", commits)
+	}
+}
+
+func TestParseLogMalformed(t *testing.T) {
+	if _, err := parseLog("a1b2c3\x1fonly two fields\x1e"); err == nil {
+		t.Error("parseLog() expected error for malformed record")
+	}
+}
+
+func TestDescribeAndShowRefArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(map[string]interface{}) ([]string, error)
+		args  map[string]interface{}
+		want  string
+	}{
+		{"describe", describeArgs, map[string]interface{}{}, "describe"},
+		{"describe version string", describeArgs, map[string]interface{}{"tags": "true", "always": "true", "dirty": "true"}, "describe --tags --always --dirty"},
+		{"describe commit", describeArgs, map[string]interface{}{"commit": "v1.2.0~3", "flags": []interface{}{"--abbrev=12"}}, "describe --abbrev=12 v1.2.0~3"},
+		{"show-ref", showRefArgs, map[string]interface{}{}, "show-ref"},
+		{"show-ref tags and heads", showRefArgs, map[string]interface{}{"tags": "true", "heads": "true"}, "show-ref --tags --heads"},
+		{"show-ref patterns", showRefArgs, map[string]interface{}{"heads": "true", "patterns": []interface{}{"main", "release"}}, "show-ref --heads -- main release"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.build(tt.args)
+			if err != nil {
+				t.Fatalf("build: %v", err)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("args = %q, want %q", strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+
+	for _, args := range []map[string]interface{}{
+		{"commit": "--all"},
+		{"commit": "HEAD~1", "dirty": "true"},
+		{"flags": []interface{}{"-c", "core.pager=sh"}},
+	} {
+		if _, err := describeArgs(args); err == nil {
+			t.Errorf("describeArgs(%v): want error", args)
+		}
+	}
+}
+
+func TestArchiveArgs(t *testing.T) {
+	work, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside := t.TempDir()
+	for _, d := range []string{filepath.Join(work, "app", "dist"), filepath.Join(work, "app", "sub")} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(work, "app", "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "x.tar"), filepath.Join(work, "app", "link.tar")); err != nil {
+		t.Fatal(err)
+	}
+	prev := allowedRepoPaths
+	allowedRepoPaths = []string{work}
+	defer func() { allowedRepoPaths = prev }()
+	app := filepath.Join(work, "app")
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"defaults", map[string]interface{}{"repository_path": app, "output": work + "/app.tar"}, "archive --format=tar --output=" + work + "/app.tar HEAD"},
+		{"relative output", map[string]interface{}{"repository_path": app, "output": "dist/app.zip", "format": "zip", "ref": "v1.2.0"}, "archive --format=zip --output=" + app + "/dist/app.zip v1.2.0"},
+		{"prefix", map[string]interface{}{"repository_path": app, "output": work + "/app.tar.gz", "format": "tar.gz", "prefix": "app-1.2.0"}, "archive --format=tar.gz --output=" + work + "/app.tar.gz --prefix=app-1.2.0/ HEAD"},
+		{"compression flag", map[string]interface{}{"repository_path": app, "output": "app.zip", "format": "zip", "flags": []interface{}{"-9", "--verbose"}}, "archive --format=zip --output=" + app + "/app.zip -9 --verbose HEAD"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := archiveArgs(tt.args)
+			if err != nil {
+				t.Fatalf("archiveArgs: %v", err)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("args = %q, want %q", strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+
+	for _, args := range []map[string]interface{}{
+		{"repository_path": app},
+		{"repository_path": app, "output": "/tmp/app.tar"},
+		{"repository_path": app, "output": "../../etc/app.tar"},
+		{"repository_path": app, "output": "app.rar", "format": "rar"},
+		{"repository_path": app, "output": "app.tar", "ref": "--remote=evil"},
+		{"repository_path": app, "output": "missing/app.tar"},
+		{"repository_path": app, "output": "escape/app.tar"},
+		{"repository_path": app, "output": "link.tar"},
+		{"repository_path": app, "output": "sub"},
+		{"repository_path": app, "output": "app.tar", "flags": []interface{}{"--output=/tmp/x"}},
+		{"repository_path": app, "output": "app.tar", "flags": []interface{}{"--out=/tmp/x"}},
+		{"repository_path": app, "output": "app.tar", "flags": []interface{}{"--o=/tmp/x"}},
+		{"repository_path": app, "output": "app.tar", "flags": []interface{}{"-o", "/x"}},
+		{"repository_path": app, "output": "app.tar", "flags": []interface{}{"-o/x"}},
+		{"repository_path": app, "output": "app.tar", "flags": []interface{}{"-vo", "/x"}},
+	} {
+		if _, err := archiveArgs(args); err == nil {
+			t.Errorf("archiveArgs(%v): want error", args)
+		}
+	}
+}
+
+func TestGitArchive(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := allowedRepoPaths
+	allowedRepoPaths = []string{dir}
+	defer func() { allowedRepoPaths = prev }()
+
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range [][]string{
+		{"init", "-q"},
+		{"add", "a.txt"},
+		{"-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "-q", "-m", "init"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, step...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", step, err, out)
+		}
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "dist"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	res := callTool(t, "git_archive", map[string]interface{}{
+		"repository_path": dir,
+		"output":          "dist/app.zip",
+		"format":          "zip",
+	})
+	if res.IsError {
+		t.Fatalf("unexpected tool error: %+v", res.Content)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "dist", "app.zip"))
+	if err != nil {
+		t.Fatalf("archive not written: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte("PK")) {
+		t.Errorf("archive starts with %q, want a zip file", data[:min(len(data), 4)])
+	}
+}
+
+func TestSubmoduleArgs(t *testing.T) {
+	prev := allowedRepoPaths
+	allowedRepoPaths = []string{"/work"}
+	defer func() { allowedRepoPaths = prev }()
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"default status", map[string]interface{}{"repository_path": "/work/app"}, "submodule status"},
+		{"update init recursive", map[string]interface{}{"repository_path": "/work/app", "subcommand": "update", "init": "true", "recursive": "true"}, "submodule update --init --recursive"},
+		{"update paths", map[string]interface{}{"repository_path": "/work/app", "subcommand": "update", "recursive": "false", "paths": []interface{}{"vendor/lib"}}, "submodule update -- vendor/lib"},
+		{"add", map[string]interface{}{"repository_path": "/work/app", "subcommand": "add", "url": "https://example.com/lib.git", "path": "vendor/lib"}, "submodule add -- https://example.com/lib.git vendor/lib"},
+		{"add with flags", map[string]interface{}{"repository_path": "/work/app", "subcommand": "add", "url": "https://example.com/lib.git", "flags": []interface{}{"-b", "main"}}, "submodule add -b main -- https://example.com/lib.git"},
+		{"sync recursive", map[string]interface{}{"repository_path": "/work/app", "subcommand": "sync", "recursive": "true"}, "submodule sync --recursive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := submoduleArgs(tt.args)
+			if err != nil {
+				t.Fatalf("submoduleArgs: %v", err)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("args = %q, want %q", strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+
+	for _, args := range []map[string]interface{}{
+		{"repository_path": "/work/app", "subcommand": "deinit"},
+		{"repository_path": "/work/app", "subcommand": "add"},
+		{"repository_path": "/work/app", "subcommand": "add", "url": "--reference=/etc"},
+		{"repository_path": "/work/app", "subcommand": "add", "url": "https://example.com/lib.git", "path": "../../etc/lib"},
+		{"repository_path": "/work/app", "subcommand": "update", "paths": []interface{}{"/tmp/lib"}},
+		{"repository_path": "/work/app", "subcommand": "status", "init": "true"},
+		{"repository_path": "/work/app", "subcommand": "init", "recursive": "true"},
+	} {
+		if _, err := submoduleArgs(args); err == nil {
+			t.Errorf("submoduleArgs(%v): want error", args)
+		}
+	}
+}
+
+func TestNotesArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"default list", map[string]interface{}{}, "notes list"},
+		{"list object", map[string]interface{}{"object": "abc123"}, "notes list abc123"},
+		{"add", map[string]interface{}{"subcommand": "add", "message": "build passed", "object": "abc123"}, "notes add -m build passed abc123"},
+		{"add with flags", map[string]interface{}{"subcommand": "add", "message": "retry", "flags": []interface{}{"-f"}}, "notes add -m retry -f"},
+		{"append to ref", map[string]interface{}{"subcommand": "append", "message": "deployed", "notes_ref": "ci"}, "notes --ref=ci append -m deployed"},
+		{"show", map[string]interface{}{"subcommand": "show", "object": "v1.0"}, "notes show v1.0"},
+		{"remove", map[string]interface{}{"subcommand": "remove", "object": "HEAD~1"}, "notes remove HEAD~1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := notesArgs(tt.args)
+			if err != nil {
+				t.Fatalf("notesArgs: %v", err)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("args = %q, want %q", strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+
+	for _, args := range []map[string]interface{}{
+		{"subcommand": "edit"},
+		{"subcommand": "add"},
+		{"subcommand": "append", "message": ""},
+		{"subcommand": "show", "message": "text"},
+		{"subcommand": "show", "object": "--help"},
+		{"notes_ref": "--exec=sh"},
+	} {
+		if _, err := notesArgs(args); err == nil {
+			t.Errorf("notesArgs(%v): want error", args)
+		}
+	}
+}
+
+func TestCloneArgs(t *testing.T) {
+	prev := allowedRepoPaths
+	allowedRepoPaths = []string{"/work"}
+	defer func() { allowedRepoPaths = prev }()
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"url only", map[string]interface{}{"url": "https://example.com/app.git"}, "clone -- https://example.com/app.git"},
+		{"shallow branch", map[string]interface{}{"url": "https://example.com/app.git", "path": "/work/app", "branch": "release", "depth": float64(1), "single_branch": "true"}, "clone --branch release --depth=1 --single-branch -- https://example.com/app.git /work/app"},
+		{"submodules and flags", map[string]interface{}{"url": "https://example.com/app.git", "recurse_submodules": "true", "single_branch": "false", "flags": []interface{}{"--quiet"}}, "clone --recurse-submodules --quiet -- https://example.com/app.git"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cloneArgs(tt.args)
+			if err != nil {
+				t.Fatalf("cloneArgs: %v", err)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("args = %q, want %q", strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+
+	for _, args := range []map[string]interface{}{
+		{},
+		{"url": "--upload-pack=touch /tmp/x"},
+		{"url": "https://example.com/app.git", "depth": float64(0)},
+		{"url": "https://example.com/app.git", "depth": float64(1.5)},
+		{"url": "https://example.com/app.git", "path": "/tmp/app"},
+		{"url": "https://example.com/app.git", "flags": []interface{}{"-c", "core.sshCommand=sh"}},
+	} {
+		if _, err := cloneArgs(args); err == nil {
+			t.Errorf("cloneArgs(%v): want error", args)
+		}
+	}
+}
+
+func TestExecGitTimesOut(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake git script requires a POSIX shell")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "git"), []byte("#!/bin/sh\nexec /bin/sleep 10\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+
+	prev := gitTimeout
+	gitTimeout = 100 * time.Millisecond
+	defer func() { gitTimeout = prev }()
+
+	start := time.Now()
+	result := execGit("", []string{"clone", "--", "https://unreachable.invalid/app.git"})
+	if result.Success || result.Error != "timed out after 100ms" {
+		t.Errorf("result = %+v, want a timeout", result)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("execGit took %s, want it killed at the timeout", elapsed)
+	}
+
+	// Through a tool, the timeout is reported with its own error code.
+	repo, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	prevPaths := allowedRepoPaths
+	allowedRepoPaths = []string{repo}
+	defer func() { allowedRepoPaths = prevPaths }()
+
+	res := callTool(t, "git_fetch", map[string]interface{}{"repository_path": repo})
+	var te ToolError
+	if err := json.Unmarshal([]byte(res.Content[0].Text), &te); err != nil {
+		t.Fatalf("Unmarshal ToolError from %q: %v", res.Content[0].Text, err)
+	}
+	if !res.IsError || te.Code != codeTimeout || !strings.Contains(te.Message, "timed out after 100ms") {
+		t.Errorf("result = %+v, want a timeout error", res)
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"90", 90 * time.Second, false},
+		{"10m", 10 * time.Minute, false},
+		{"0", 0, false},
+		{"-5", 0, true},
+		{"soon", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseTimeout(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("parseTimeout(%q) = %s, %v; want %s, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestGitDiffStatMode(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := allowedRepoPaths
+	allowedRepoPaths = []string{dir}
+	defer func() { allowedRepoPaths = prev }()
+
+	file := filepath.Join(dir, "a.txt")
+	for _, step := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "-q", "--allow-empty", "-m", "init"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, step...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", step, err, out)
+		}
+	}
+	if err := os.WriteFile(file, []byte("one\ntwo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("git", "-C", dir, "add", "a.txt").CombinedOutput(); err != nil {
+		t.Fatalf("git add: %v\n%s", err, out)
+	}
+
+	res := callTool(t, "git_diff", map[string]interface{}{
+		"repository_path": dir,
+		"stat":            "true",
+		"flags":           []interface{}{"--cached"},
+	})
+	var stat DiffStat
+	if err := json.Unmarshal([]byte(res.Content[0].Text), &stat); err != nil {
+		t.Fatalf("Unmarshal DiffStat from %q: %v", res.Content[0].Text, err)
+	}
+	if stat.FilesChanged != 1 || stat.TotalAdded != 2 || stat.Files[0].File != "a.txt" {
+		t.Errorf("stat = %+v, want a.txt with 2 added lines", stat)
+	}
+}
+
+func TestMergeRebaseConflicts(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_AUTHOR_NAME", "t")
+	t.Setenv("GIT_AUTHOR_EMAIL", "t@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "t")
+	t.Setenv("GIT_COMMITTER_EMAIL", "t@example.com")
+
+	// newConflictedRepo returns a repository on main whose branch "other"
+	// changes a.txt and b.txt differently.
+	newConflictedRepo := func(t *testing.T) string {
+		dir, err := filepath.EvalSymlinks(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		write := func(content string) {
+			for _, name := range []string{"a.txt", "b.txt"} {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		gitRun := func(args ...string) {
+			if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+				t.Fatalf("git %v: %v\n%s", args, err, out)
+			}
+		}
+		gitRun("init", "-q", "-b", "main")
+		write("base\n")
+		gitRun("add", ".")
+		gitRun("commit", "-q", "-m", "base")
+		gitRun("checkout", "-q", "-b", "other")
+		write("other\n")
+		gitRun("commit", "-q", "-am", "other")
+		gitRun("checkout", "-q", "main")
+		write("main\n")
+		gitRun("commit", "-q", "-am", "main")
+		return dir
+	}
+
+	tests := []struct {
+		name string
+		tool string
+		args map[string]interface{}
+		want []string
+	}{
+		{"merge", "git_merge", map[string]interface{}{"branch": "other"}, []string{"a.txt", "b.txt"}},
+		{"rebase", "git_rebase", map[string]interface{}{"target": "other"}, []string{"a.txt", "b.txt"}},
+		{"detection off", "git_merge", map[string]interface{}{"branch": "other", "detect_conflicts": "false"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newConflictedRepo(t)
+			prev := allowedRepoPaths
+			allowedRepoPaths = []string{dir}
+			defer func() { allowedRepoPaths = prev }()
+
+			tt.args["repository_path"] = dir
+			res := callTool(t, tt.tool, tt.args)
+			var result GitResult
+			if err := json.Unmarshal([]byte(res.Content[0].Text), &result); err != nil {
+				t.Fatalf("Unmarshal GitResult from %q: %v", res.Content[0].Text, err)
+			}
+			if result.Success || !res.IsError {
+				t.Fatalf("result = %+v, want a failed %s", result, tt.name)
+			}
+			if !slices.Equal(result.Conflicts, tt.want) {
+				t.Errorf("conflicts = %q, want %q", result.Conflicts, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolErrorCodes(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := filepath.Join(dir, "repo")
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	prev := allowedRepoPaths
+	allowedRepoPaths = []string{dir}
+	defer func() { allowedRepoPaths = prev }()
+
+	tests := []struct {
+		name string
+		tool string
+		args map[string]interface{}
+		code string
+	}{
+		{"missing repository_path", "git_status", map[string]interface{}{}, codeInvalidArgument},
+		{"not a repository", "git_status", map[string]interface{}{"repository_path": dir}, codeNotFound},
+		{"outside allowed dirs", "git_status", map[string]interface{}{"repository_path": filepath.Dir(dir)}, codePermissionDenied},
+		{"dangerous flag", "git_log", map[string]interface{}{"repository_path": repo, "flags": []interface{}{"--upload-pack=evil"}}, codePermissionDenied},
+		{"archive outside allowed dirs", "git_archive", map[string]interface{}{"repository_path": repo, "output": filepath.Join(filepath.Dir(dir), "repo.tar")}, codePermissionDenied},
+		{"archive bad format", "git_archive", map[string]interface{}{"repository_path": repo, "output": "repo.rar", "format": "rar"}, codeInvalidArgument},
+		{"unknown tool", "git_nope", map[string]interface{}{}, codeInvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := callTool(t, tt.tool, tt.args)
+			if !res.IsError {
+				t.Fatalf("result = %+v, want an error", res)
+			}
+			var te ToolError
+			if err := json.Unmarshal([]byte(res.Content[0].Text), &te); err != nil {
+				t.Fatalf("Unmarshal ToolError from %q: %v", res.Content[0].Text, err)
+			}
+			if te.Code != tt.code || te.Message == "" {
+				t.Errorf("error = %+v, want code %q", te, tt.code)
+			}
+		})
+	}
+}
+
+func TestOutputIsTruncated(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake git script requires a POSIX shell")
+	}
+	bin := t.TempDir()
+	script := "#!/bin/sh\nprintf '%05000d' 0\nprintf '%03000d' 0 >&2\nexit 1\n"
+	if err := os.WriteFile(filepath.Join(bin, "git"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	prevPaths, prevMax := allowedRepoPaths, maxOutputBytes
+	allowedRepoPaths, maxOutputBytes = []string{dir}, 1000
+	defer func() { allowedRepoPaths, maxOutputBytes = prevPaths, prevMax }()
+
+	tests := []struct {
+		name       string
+		args       map[string]interface{}
+		wantStdout string
+		wantStderr string
+	}{
+		{"default cap", map[string]interface{}{"repository_path": dir},
+			strings.Repeat("0", 1000) + "\n[output truncated: showing 1000 of 5000 bytes]",
+			strings.Repeat("0", 1000) + "\n[output truncated: showing 1000 of 3000 bytes]"},
+		{"per-call cap", map[string]interface{}{"repository_path": dir, "max_output_bytes": float64(10000)},
+			strings.Repeat("0", 5000),
+			strings.Repeat("0", 3000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := callTool(t, "git_status", tt.args)
+			var result GitResult
+			if err := json.Unmarshal([]byte(res.Content[0].Text), &result); err != nil {
+				t.Fatalf("Unmarshal GitResult: %v", err)
+			}
+			if result.Stdout != tt.wantStdout {
+				t.Errorf("stdout has %d bytes, ends %q; want %d bytes", len(result.Stdout), result.Stdout[max(0, len(result.Stdout)-50):], len(tt.wantStdout))
+			}
+			if result.Stderr != tt.wantStderr {
+				t.Errorf("stderr has %d bytes, ends %q; want %d bytes", len(result.Stderr), result.Stderr[max(0, len(result.Stderr)-50):], len(tt.wantStderr))
+			}
+		})
+	}
+}
+
+func TestTruncateOutput(t *testing.T) {
+	tests := []struct {
+		in    string
+		limit int
+		want  string
+	}{
+		{"hello", 0, "hello"},
+		{"hello", 5, "hello"},
+		{"hello world", 5, "hello\n[output truncated: showing 5 of 11 bytes]"},
+		// "é" is two bytes, so a cut inside it backs up to before it.
+		{"caféine", 4, "caf\n[output truncated: showing 3 of 8 bytes]"},
+	}
+	for _, tt := range tests {
+		if got := truncateOutput(tt.in, tt.limit); got != tt.want {
+			t.Errorf("truncateOutput(%q, %d) = %q, want %q", tt.in, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestCallOutputLimit(t *testing.T) {
+	if got, err := callOutputLimit(map[string]interface{}{}); got != maxOutputBytes || err != nil {
+		t.Errorf("callOutputLimit() = %d, %v; want the default", got, err)
+	}
+	for _, v := range []interface{}{float64(2048), "2048", " 2048 "} {
+		if got, err := callOutputLimit(map[string]interface{}{"max_output_bytes": v}); got != 2048 || err != nil {
+			t.Errorf("callOutputLimit(%q) = %d, %v", v, got, err)
+		}
+	}
+	for _, v := range []interface{}{float64(0), float64(-1), 1.5, "lots", float64(1 << 40)} {
+		if _, err := callOutputLimit(map[string]interface{}{"max_output_bytes": v}); err == nil {
+			t.Errorf("callOutputLimit(%v) expected error", v)
+		}
+	}
+}
@@ -0,0 +1,3404 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-sasl"
+	"github.com/soyeahso/hunter3/internal/logfile"
+)
+
+// JSON-RPC types
+
+type JSONRPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      interface{}     `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type JSONRPCResponse struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      interface{} `json:"id"`
+	Result  interface{} `json:"result,omitempty"`
+	Error   *RPCError   `json:"error,omitempty"`
+}
+
+type RPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+type Tool struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	InputSchema InputSchema `json:"inputSchema"`
+}
+
+type InputSchema struct {
+	Type       string              `json:"type"`
+	Properties map[string]Property `json:"properties"`
+	Required   []string            `json:"required,omitempty"`
+}
+
+type Property struct {
+	Type        string    `json:"type"`
+	Description string    `json:"description"`
+	Items       *ItemType `json:"items,omitempty"`
+	Enum        []string  `json:"enum,omitempty"`
+	Default     string    `json:"default,omitempty"`
+}
+
+type ItemType struct {
+	Type string `json:"type"`
+}
+
+type CallToolParams struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+type ToolResult struct {
+	Content []ContentItem `json:"content"`
+	IsError bool          `json:"isError,omitempty"`
+}
+
+type ContentItem struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type InitializeResult struct {
+	ProtocolVersion string       `json:"protocolVersion"`
+	Capabilities    Capabilities `json:"capabilities"`
+	ServerInfo      ServerInfo   `json:"serverInfo"`
+}
+
+type Capabilities struct {
+	Tools map[string]interface{} `json:"tools"`
+}
+
+type ServerInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type ListToolsResult struct {
+	Tools []Tool `json:"tools"`
+}
+
+// Config holds the account credentials and the IMAP/SMTP servers to use.
+// The servers default to iCloud Mail. When AccessToken is set, both servers
+// are authenticated with XOAUTH2 instead of the password.
+type Config struct {
+	Email       string `json:"email"`
+	Password    string `json:"password,omitempty"`
+	AccessToken string `json:"access_token,omitempty"`
+	IMAPHost    string `json:"imap_host,omitempty"`
+	IMAPPort    int    `json:"imap_port,omitempty"`
+	SMTPHost    string `json:"smtp_host,omitempty"`
+	SMTPPort    int    `json:"smtp_port,omitempty"`
+
+	// Timeout bounds each tool's IMAP work and each SMTP send. Zero
+	// disables it. Set from MAIL_TIMEOUT.
+	Timeout time.Duration `json:"-"`
+}
+
+// Mailbox describes a single IMAP folder as returned by list_mailboxes.
+type Mailbox struct {
+	Name       string   `json:"name"`
+	Delimiter  string   `json:"delimiter,omitempty"`
+	Attributes []string `json:"attributes"`
+}
+
+// MessageSummary is the envelope-level view of a message returned by
+// list_messages.
+type MessageSummary struct {
+	UID     uint32    `json:"uid"`
+	SeqNum  uint32    `json:"seq_num"`
+	From    []string  `json:"from"`
+	To      []string  `json:"to,omitempty"`
+	Subject string    `json:"subject"`
+	Date    time.Time `json:"date"`
+	Flags   []string  `json:"flags"`
+
+	HasAttachments bool `json:"has_attachments"`
+}
+
+// MessageDetail is the decoded message returned by read_message.
+type MessageDetail struct {
+	UID       uint32   `json:"uid"`
+	Mailbox   string   `json:"mailbox"`
+	From      string   `json:"from"`
+	To        string   `json:"to,omitempty"`
+	Cc        string   `json:"cc,omitempty"`
+	ReplyTo   string   `json:"reply_to,omitempty"`
+	Subject   string   `json:"subject"`
+	Date      string   `json:"date"`
+	MessageID string   `json:"message_id,omitempty"`
+	Flags     []string `json:"flags"`
+	TextBody  string   `json:"text_body,omitempty"`
+	HTMLBody  string   `json:"html_body,omitempty"`
+
+	Attachments []AttachmentInfo `json:"attachments,omitempty"`
+}
+
+// AttachmentInfo describes an attachment of a received message. Index is the
+// attachment's position in the message, as used by download_attachment.
+type AttachmentInfo struct {
+	Index       int    `json:"index"`
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+// Default iCloud Mail endpoints. IMAP port 143 and SMTP ports other than 465
+// are upgraded with STARTTLS; IMAP 993 and SMTP 465 use implicit TLS.
+const (
+	defaultIMAPHost = "imap.mail.me.com"
+	defaultIMAPPort = 993
+	defaultSMTPHost = "smtp.mail.me.com"
+	defaultSMTPPort = 587
+)
+
+// defaultTimeout is used when MAIL_TIMEOUT is unset.
+const defaultTimeout = 60 * time.Second
+
+// maxWaitTimeout caps wait_for_mail's timeout. It stays under the 29
+// minutes after which servers may end an IDLE.
+const maxWaitTimeout = 25 * time.Minute
+
+// OutgoingMessage holds the fields of a message composed by send_email,
+// reply_message, or forward_message.
+type OutgoingMessage struct {
+	From        string
+	To          []string
+	Cc          []string
+	Subject     string
+	TextBody    string
+	HTMLBody    string
+	Date        time.Time
+	Attachments []Attachment
+
+	// InReplyTo and References thread a reply under its original. They hold
+	// Message-IDs including the angle brackets.
+	InReplyTo  string
+	References []string
+}
+
+// Attachment is a file attached to an outgoing message.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// maxAttachmentBytes caps the combined size of attachments on one message;
+// iCloud rejects messages over 20 MB, and base64 adds a third on top.
+const maxAttachmentBytes = 15 * 1024 * 1024
+
+// MCPServer handles the JSON-RPC stdin/stdout protocol.
+type MCPServer struct {
+	config *Config
+
+	// conn is the cached IMAP connection. connMu is held from connect until
+	// release, so tool calls take turns on it.
+	connMu sync.Mutex
+	conn   *client.Client
+
+	// watchdog terminates conn when the operation holding it runs past
+	// config.Timeout; timedOut records that it fired.
+	watchdog *time.Timer
+	timedOut atomic.Bool
+}
+
+var logger *log.Logger
+
+func initLogger() {
+	// Log to stderr and to a file rotated by size and readable only by the owner
+	logger = logfile.NewLogger("mcp-imail")
+	logger.Println("MCP iCloud Mail server starting...")
+}
+
+// loadConfig reads credentials from ICLOUD_EMAIL plus ICLOUD_PASSWORD or
+// ICLOUD_ACCESS_TOKEN, falling back to ~/.hunter3/icloud-mail.json. IMAP_HOST, IMAP_PORT, SMTP_HOST and
+// SMTP_PORT override the servers from the file, which default to iCloud.
+// MAIL_TIMEOUT sets the operation timeout.
+func loadConfig() (*Config, error) {
+	cfg := &Config{}
+	email, password, token := os.Getenv("ICLOUD_EMAIL"), os.Getenv("ICLOUD_PASSWORD"), os.Getenv("ICLOUD_ACCESS_TOKEN")
+	if email != "" && (password != "" || token != "") {
+		cfg.Email, cfg.Password, cfg.AccessToken = email, password, token
+	} else {
+		path := filepath.Join(os.Getenv("HOME"), ".hunter3", "icloud-mail.json")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("set ICLOUD_EMAIL and ICLOUD_PASSWORD (or ICLOUD_ACCESS_TOKEN) or create %s: %w", path, err)
+		}
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if cfg.Email == "" || (cfg.Password == "" && cfg.AccessToken == "") {
+			return nil, fmt.Errorf("%s must set email and either password or access_token", path)
+		}
+	}
+
+	if host := os.Getenv("IMAP_HOST"); host != "" {
+		cfg.IMAPHost = host
+	}
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		cfg.SMTPHost = host
+	}
+	for _, p := range []struct {
+		env  string
+		port *int
+	}{
+		{"IMAP_PORT", &cfg.IMAPPort},
+		{"SMTP_PORT", &cfg.SMTPPort},
+	} {
+		if v := os.Getenv(p.env); v != "" {
+			port, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q: %w", p.env, v, err)
+			}
+			*p.port = port
+		}
+	}
+
+	if cfg.IMAPHost == "" {
+		cfg.IMAPHost = defaultIMAPHost
+	}
+	if cfg.IMAPPort == 0 {
+		cfg.IMAPPort = defaultIMAPPort
+	}
+	if cfg.SMTPHost == "" {
+		cfg.SMTPHost = defaultSMTPHost
+	}
+	if cfg.SMTPPort == 0 {
+		cfg.SMTPPort = defaultSMTPPort
+	}
+	cfg.Timeout = defaultTimeout
+	if v := os.Getenv("MAIL_TIMEOUT"); v != "" {
+		timeout, err := parseTimeout(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Timeout = timeout
+	}
+
+	if cfg.IMAPPort < 1 || cfg.IMAPPort > 65535 {
+		return nil, fmt.Errorf("invalid IMAP port %d", cfg.IMAPPort)
+	}
+	if cfg.SMTPPort < 1 || cfg.SMTPPort > 65535 {
+		return nil, fmt.Errorf("invalid SMTP port %d", cfg.SMTPPort)
+	}
+	return cfg, nil
+}
+
+// parseTimeout accepts a Go duration ("90s", "2m") or a number of seconds.
+func parseTimeout(v string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, fmt.Errorf("invalid MAIL_TIMEOUT %q: must not be negative", v)
+		}
+		return time.Duration(secs) * time.Second, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid MAIL_TIMEOUT %q: use a duration like 90s or a number of seconds", v)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid MAIL_TIMEOUT %q: must not be negative", v)
+	}
+	return d, nil
+}
+
+func (c *Config) imapAddr() string {
+	return net.JoinHostPort(c.IMAPHost, strconv.Itoa(c.IMAPPort))
+}
+
+func (c *Config) smtpAddr() string {
+	return net.JoinHostPort(c.SMTPHost, strconv.Itoa(c.SMTPPort))
+}
+
+func main() {
+	initLogger()
+
+	cfg, err := loadConfig()
+	if err != nil {
+		logger.Fatalf("Failed to load config: %v", err)
+	}
+
+	initAllowedPaths()
+
+	s := &MCPServer{config: cfg}
+	logger.Println("Server initialized")
+	s.Run()
+}
+
+func (s *MCPServer) Run() {
+	scanner := bufio.NewScanner(os.Stdin)
+	buf := make([]byte, 0, 64*1024)
+	scanner.Buffer(buf, 1024*1024)
+
+	logger.Println("Listening for requests on stdin...")
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		logger.Printf("Received request: %s\n", line)
+		s.handleRequest(line)
+	}
+	if err := scanner.Err(); err != nil && err != io.EOF {
+		logger.Printf("Error reading stdin: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
+	}
+	s.closeConn()
+	logger.Println("Server shutting down")
+}
+
+func (s *MCPServer) handleRequest(line string) {
+	var req JSONRPCRequest
+	if err := json.Unmarshal([]byte(line), &req); err != nil {
+		logger.Printf("Parse error: %v\n", err)
+		s.sendError(nil, -32700, "Parse error", err.Error())
+		return
+	}
+
+	logger.Printf("Handling method: %s\n", req.Method)
+
+	switch req.Method {
+	case "initialize":
+		s.handleInitialize(req)
+	case "tools/list":
+		s.handleListTools(req)
+	case "tools/call":
+		s.handleCallTool(req)
+	case "notifications/initialized":
+		// no-op
+		logger.Println("Received initialized notification")
+	default:
+		logger.Printf("Unknown method: %s\n", req.Method)
+		s.sendError(req.ID, -32601, "Method not found", fmt.Sprintf("Unknown method: %s", req.Method))
+	}
+}
+
+func (s *MCPServer) handleInitialize(req JSONRPCRequest) {
+	logger.Println("Handling initialize request")
+	s.sendResponse(req.ID, InitializeResult{
+		ProtocolVersion: "2024-11-05",
+		Capabilities:    Capabilities{Tools: map[string]interface{}{}},
+		ServerInfo:      ServerInfo{Name: "mcp-imail", Version: "1.0.0"},
+	})
+}
+
+// ---------- Tool definitions ----------
+
+func (s *MCPServer) handleListTools(req JSONRPCRequest) {
+	logger.Println("Handling list tools request")
+
+	tools := []Tool{
+		// --- Mailboxes ---
+		{
+			Name:        "list_mailboxes",
+			Description: "List all mailboxes (folders) in the iCloud account with their IMAP attributes, e.g. INBOX, Sent Messages, Drafts, Deleted Messages, Junk, Archive",
+			InputSchema: InputSchema{
+				Type:       "object",
+				Properties: map[string]Property{},
+			},
+		},
+		{
+			Name:        "create_mailbox",
+			Description: "Create a mailbox (folder) and subscribe to it, so messages can be filed into it with move_message. Nest it under parent, or give name as a full path using the server's hierarchy delimiter (see list_mailboxes).",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"name":   stringProp("Name of the new mailbox, e.g. 'Receipts' or 'Archive/2024'"),
+					"parent": stringProp("Existing mailbox to create it under (optional)"),
+				},
+				Required: []string{"name"},
+			},
+		},
+		{
+			Name:        "get_unread_count",
+			Description: "Get the number of unread and total messages in a mailbox without fetching any messages. A cheap way to check for new mail.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"mailbox": stringPropDefault("Mailbox to check", "INBOX"),
+				},
+			},
+		},
+		{
+			Name:        "wait_for_mail",
+			Description: "Wait with IMAP IDLE until a new message arrives in a mailbox or the timeout elapses, then report how many arrived and their UIDs, ready for read_message. An event-driven alternative to polling get_unread_count.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"mailbox": stringPropDefault("Mailbox to watch", "INBOX"),
+					"timeout": numberProp(fmt.Sprintf("Seconds to wait for new mail (max %d)", int(maxWaitTimeout.Seconds()))),
+				},
+				Required: []string{"timeout"},
+			},
+		},
+
+		// --- Messages ---
+		{
+			Name:        "list_messages",
+			Description: fmt.Sprintf("List messages in a mailbox, newest first, with UID, sender, recipients, subject, date, flags, and whether each has attachments. Returns at most %d messages per call; use offset to page back through older mail.", maxListLimit),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"mailbox": stringPropDefault("Mailbox to list (see list_mailboxes)", "INBOX"),
+					"limit":   numberProp(fmt.Sprintf("Maximum number of messages to return (default %d, max %d)", defaultListLimit, maxListLimit)),
+					"offset":  numberProp("Number of newest messages to skip (default 0)"),
+					"format":  formatProp,
+				},
+			},
+		},
+		{
+			Name:        "read_message",
+			Description: "Read a message by UID, returning decoded headers and its text/plain and text/html bodies. Does not mark the message as read.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"mailbox": stringPropDefault("Mailbox containing the message", "INBOX"),
+					"uid":     numberProp("UID of the message (from list_messages)"),
+					"headers": boolProp("Fetch only the From, To, Subject, and Date headers, skipping the body and attachments (default false)"),
+				},
+				Required: []string{"uid"},
+			},
+		},
+		{
+			Name:        "download_attachment",
+			Description: "Save an attachment of a message to a local file. Identify the attachment by attachment_index or filename, as listed in read_message's attachments. Returns the saved path and size.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"mailbox":          stringPropDefault("Mailbox containing the message", "INBOX"),
+					"uid":              numberProp("UID of the message"),
+					"attachment_index": numberProp("Index of the attachment (from read_message)"),
+					"filename":         stringProp("Filename of the attachment, used when attachment_index is not given"),
+					"output_path":      stringProp("File to write, or an existing directory to save into under the attachment's filename. '~' is expanded."),
+					"overwrite":        boolProp("Replace output_path if it already exists (default: false)"),
+				},
+				Required: []string{"uid", "output_path"},
+			},
+		},
+		{
+			Name:        "save_attachments",
+			Description: "Save every attachment of a message into a local directory, under its own filename reduced to a single path element. Existing files are never replaced; a clashing name gets a numbered suffix. Returns the saved paths.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"mailbox":    stringPropDefault("Mailbox containing the message", "INBOX"),
+					"uid":        numberProp("UID of the message"),
+					"output_dir": stringProp("Directory to save into, created if missing. '~' is expanded."),
+				},
+				Required: []string{"uid", "output_dir"},
+			},
+		},
+		{
+			Name:        "search_messages",
+			Description: fmt.Sprintf("Search a mailbox on the server with IMAP SEARCH. All given criteria must match. Returns the total match count and up to limit (max %d) matching messages, newest first.", maxListLimit),
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"mailbox": stringPropDefault("Mailbox to search", "INBOX"),
+					"from":    stringProp("Sender contains this text"),
+					"to":      stringProp("Recipient contains this text"),
+					"subject": stringProp("Subject contains this text"),
+					"body":    stringProp("Body contains this text"),
+					"text":    stringProp("Headers or body contain this text"),
+					"since":   stringProp("Received on or after this date (YYYY-MM-DD)"),
+					"before":  stringProp("Received before this date (YYYY-MM-DD)"),
+					"unseen":  boolProp("Only unread messages"),
+					"flagged": boolProp("Only flagged messages"),
+					"limit":   numberProp(fmt.Sprintf("Maximum number of messages to return (default %d, max %d)", defaultListLimit, maxListLimit)),
+					"format":  formatProp,
+				},
+			},
+		},
+
+		// --- Organizing ---
+		{
+			Name:        "move_message",
+			Description: "Move a message to another mailbox, e.g. to archive it or move it to Deleted Messages",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"mailbox":     stringPropDefault("Mailbox containing the message", "INBOX"),
+					"uid":         numberProp("UID of the message"),
+					"destination": stringProp("Mailbox to move the message to (see list_mailboxes, or create one with create_mailbox)"),
+				},
+				Required: []string{"uid", "destination"},
+			},
+		},
+		{
+			Name:        "delete_message",
+			Description: "Permanently delete a message by flagging it \\Deleted and expunging it. This cannot be undone; to keep a recoverable copy, use move_message with destination 'Deleted Messages' instead.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"mailbox": stringPropDefault("Mailbox containing the message", "INBOX"),
+					"uid":     numberProp("UID of the message"),
+				},
+				Required: []string{"uid"},
+			},
+		},
+
+		{
+			Name:        "set_flags",
+			Description: "Add or remove flags on a message, e.g. add \\Seen to mark it read, remove \\Seen to mark it unread, or add \\Flagged to star it. Returns the message's resulting flags.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"mailbox":      stringPropDefault("Mailbox containing the message", "INBOX"),
+					"uid":          numberProp("UID of the message"),
+					"add_flags":    stringArrayProp("Flags to add (e.g. ['\\Seen', '\\Flagged']); the leading backslash on system flags is optional"),
+					"remove_flags": stringArrayProp("Flags to remove"),
+				},
+				Required: []string{"uid"},
+			},
+		},
+
+		// --- Sending ---
+		{
+			Name:        "send_email",
+			Description: "Send an email from the configured iCloud address via SMTP. Provide html_body in addition to body to send a multipart message with both plain text and HTML versions, and attachments to attach local files.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"to":          stringArrayProp("Recipient addresses (e.g. ['alice@example.com', 'Bob <bob@example.com>'])"),
+					"cc":          stringArrayProp("Cc addresses"),
+					"subject":     stringProp("Subject line"),
+					"body":        stringProp("Plain-text body"),
+					"html_body":   stringProp("Optional HTML body"),
+					"attachments": stringArrayProp(fmt.Sprintf("Local file paths to attach (combined size up to %d MB)", maxAttachmentBytes/(1024*1024))),
+				},
+				Required: []string{"to", "subject", "body"},
+			},
+		},
+		{
+			Name:        "save_draft",
+			Description: "Compose a message like send_email but save it to the Drafts mailbox, flagged \\Draft, instead of sending it. Recipients are optional.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"mailbox":     stringPropDefault("Mailbox to save the draft in", "Drafts"),
+					"to":          stringArrayProp("Recipient addresses"),
+					"cc":          stringArrayProp("Cc addresses"),
+					"subject":     stringProp("Subject line"),
+					"body":        stringProp("Plain-text body"),
+					"html_body":   stringProp("Optional HTML body"),
+					"attachments": stringArrayProp(fmt.Sprintf("Local file paths to attach (combined size up to %d MB)", maxAttachmentBytes/(1024*1024))),
+				},
+			},
+		},
+		{
+			Name:        "reply_message",
+			Description: "Reply to a message by UID. The reply goes to the original's Reply-To or From address with a 'Re:' subject and In-Reply-To/References headers so mail clients thread it, and quotes the original text below the body. The original is flagged \\Answered.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"mailbox":     stringPropDefault("Mailbox containing the original message", "INBOX"),
+					"uid":         numberProp("UID of the message to reply to"),
+					"body":        stringProp("Plain-text reply, placed above the quoted original"),
+					"html_body":   stringProp("Optional HTML version of the reply"),
+					"reply_all":   boolProp("Also send to the original's To and Cc recipients, except yourself (default false)"),
+					"cc":          stringArrayProp("Additional Cc addresses"),
+					"quote":       boolProp("Quote the original text below the reply (default true)"),
+					"attachments": stringArrayProp("Local file paths to attach"),
+				},
+				Required: []string{"uid", "body"},
+			},
+		},
+		{
+			Name:        "forward_message",
+			Description: "Forward a message by UID with a 'Fwd:' subject. By default the original headers and text are quoted inline and its attachments are carried over; with as_attachment=true the whole original is attached as an .eml file instead. The original is flagged $Forwarded.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"mailbox":       stringPropDefault("Mailbox containing the original message", "INBOX"),
+					"uid":           numberProp("UID of the message to forward"),
+					"to":            stringArrayProp("Recipient addresses"),
+					"cc":            stringArrayProp("Cc addresses"),
+					"body":          stringProp("Optional note placed above the forwarded message"),
+					"as_attachment": boolProp("Attach the original as message/rfc822 instead of quoting it inline (default false)"),
+					"attachments":   stringArrayProp("Additional local file paths to attach"),
+				},
+				Required: []string{"uid", "to"},
+			},
+		},
+	}
+
+	s.sendResponse(req.ID, ListToolsResult{Tools: tools})
+}
+
+// ---------- Tool dispatch ----------
+
+func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
+	var params CallToolParams
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		logger.Printf("Invalid params: %v\n", err)
+		s.sendError(req.ID, -32602, "Invalid params", err.Error())
+		return
+	}
+
+	logger.Printf("Calling tool: %s\n", params.Name)
+
+	switch params.Name {
+	case "list_mailboxes":
+		s.listMailboxes(req.ID, params.Arguments)
+	case "create_mailbox":
+		s.createMailbox(req.ID, params.Arguments)
+	case "get_unread_count":
+		s.getUnreadCount(req.ID, params.Arguments)
+	case "wait_for_mail":
+		s.waitForMail(req.ID, params.Arguments)
+	case "list_messages":
+		s.listMessages(req.ID, params.Arguments)
+	case "read_message":
+		s.readMessage(req.ID, params.Arguments)
+	case "download_attachment":
+		s.downloadAttachment(req.ID, params.Arguments)
+	case "save_attachments":
+		s.saveAttachments(req.ID, params.Arguments)
+	case "search_messages":
+		s.searchMessages(req.ID, params.Arguments)
+	case "move_message":
+		s.moveMessage(req.ID, params.Arguments)
+	case "delete_message":
+		s.deleteMessage(req.ID, params.Arguments)
+	case "set_flags":
+		s.setFlags(req.ID, params.Arguments)
+	case "send_email":
+		s.sendEmail(req.ID, params.Arguments)
+	case "save_draft":
+		s.saveDraft(req.ID, params.Arguments)
+	case "reply_message":
+		s.replyMessage(req.ID, params.Arguments)
+	case "forward_message":
+		s.forwardMessage(req.ID, params.Arguments)
+	default:
+		logger.Printf("Unknown tool: %s\n", params.Name)
+		s.sendError(req.ID, -32602, "Unknown tool", fmt.Sprintf("Tool not found: %s", params.Name))
+	}
+}
+
+// ---------- IMAP ----------
+
+// connect returns the cached IMAP connection, dialing a new one if there is
+// none or the old one has dropped. On success the connection is locked until
+// the caller calls release.
+func (s *MCPServer) connect() (*client.Client, error) {
+	s.connMu.Lock()
+
+	if s.conn != nil {
+		s.watch(s.conn)
+		if !connAlive(s.conn) {
+			logger.Println("IMAP connection lost, reconnecting")
+			s.conn.Terminate()
+			s.conn = nil
+		}
+	}
+	if s.conn == nil {
+		c, err := s.dial()
+		if err != nil {
+			s.release()
+			return nil, err
+		}
+		s.conn = c
+	}
+	return s.conn, nil
+}
+
+// release disarms the watchdog and unlocks the connection returned by
+// connect.
+func (s *MCPServer) release() {
+	if s.watchdog != nil {
+		s.watchdog.Stop()
+		s.watchdog = nil
+	}
+	s.timedOut.Store(false)
+	s.connMu.Unlock()
+}
+
+// watch (re)arms the watchdog for c. If it fires, c is terminated, which
+// makes every pending command on it fail instead of blocking the stdin loop;
+// the next connect then dials a fresh connection.
+func (s *MCPServer) watch(c *client.Client) {
+	s.watchFor(c, s.config.Timeout)
+}
+
+// watchFor is watch with a limit of d instead of MAIL_TIMEOUT. A d of zero
+// or less disarms the watchdog.
+func (s *MCPServer) watchFor(c *client.Client, d time.Duration) {
+	if s.watchdog != nil {
+		s.watchdog.Stop()
+	}
+	s.timedOut.Store(false)
+	if d <= 0 {
+		return
+	}
+	s.watchdog = time.AfterFunc(d, func() {
+		logger.Printf("IMAP operation exceeded %s, closing connection\n", d)
+		s.timedOut.Store(true)
+		c.Terminate()
+	})
+}
+
+// closeConn logs out of the cached connection, if any.
+func (s *MCPServer) closeConn() {
+	s.connMu.Lock()
+	defer s.release()
+
+	if s.conn != nil {
+		s.watch(s.conn)
+		if err := s.conn.Logout(); err != nil {
+			logger.Printf("IMAP logout failed: %v\n", err)
+		}
+		s.conn = nil
+	}
+}
+
+// dial connects to the configured IMAP server and logs in.
+func (s *MCPServer) dial() (*client.Client, error) {
+	addr := s.config.imapAddr()
+
+	// The dialer timeout covers the TCP connect, TLS handshake and greeting;
+	// the watchdog takes over from there.
+	dialer := &net.Dialer{Timeout: s.config.Timeout}
+
+	var c *client.Client
+	var err error
+	if s.config.IMAPPort == 143 {
+		c, err = client.DialWithDialer(dialer, addr)
+	} else {
+		c, err = client.DialWithDialerTLS(dialer, addr, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	s.watch(c)
+
+	if s.config.IMAPPort == 143 {
+		if err := c.StartTLS(&tls.Config{ServerName: s.config.IMAPHost}); err != nil {
+			c.Logout()
+			return nil, fmt.Errorf("STARTTLS with %s failed: %w", addr, s.timeoutErr(err))
+		}
+	}
+
+	if s.config.AccessToken != "" {
+		if err := c.Authenticate(newXoauth2Client(s.config.Email, s.config.AccessToken)); err != nil {
+			c.Logout()
+			return nil, fmt.Errorf("XOAUTH2 login failed (is the access token expired?): %w", s.timeoutErr(err))
+		}
+	} else if err := c.Login(s.config.Email, s.config.Password); err != nil {
+		c.Logout()
+		if s.timedOut.Load() {
+			return nil, fmt.Errorf("login failed: %w", s.timeoutErr(err))
+		}
+		if s.config.IMAPHost == defaultIMAPHost {
+			return nil, fmt.Errorf("login failed (iCloud requires an App-Specific Password): %w", err)
+		}
+		return nil, fmt.Errorf("login failed: %w", err)
+	}
+	logger.Println("Connected to", addr)
+	return c, nil
+}
+
+// timeoutErr explains err as a timeout if the watchdog fired, since the
+// error go-imap reports for a terminated connection is just "connection
+// closed".
+func (s *MCPServer) timeoutErr(err error) error {
+	if s.timedOut.Load() {
+		return fmt.Errorf("timed out after %s (set MAIL_TIMEOUT to change): %w", s.config.Timeout, err)
+	}
+	return err
+}
+
+// xoauth2Client implements the XOAUTH2 SASL mechanism used by Gmail and
+// Outlook for OAuth2 bearer tokens.
+type xoauth2Client struct {
+	username, token string
+}
+
+func newXoauth2Client(username, token string) sasl.Client {
+	return &xoauth2Client{username: username, token: token}
+}
+
+func (a *xoauth2Client) Start() (mech string, ir []byte, err error) {
+	return "XOAUTH2", xoauth2Response(a.username, a.token), nil
+}
+
+// Next is only called when the server rejects the token. The challenge is a
+// JSON error description; an empty reply lets the server finish with NO.
+func (a *xoauth2Client) Next(challenge []byte) ([]byte, error) {
+	logger.Printf("XOAUTH2 token rejected: %s\n", challenge)
+	return []byte{}, nil
+}
+
+// xoauth2SMTPAuth is the smtp.Auth counterpart of xoauth2Client.
+type xoauth2SMTPAuth struct {
+	username, token, host string
+}
+
+func (a *xoauth2SMTPAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// Like smtp.PlainAuth, refuse to send the token in the clear.
+	if !server.TLS {
+		return "", nil, fmt.Errorf("refusing XOAUTH2 over an unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, fmt.Errorf("wrong host name %q", server.Name)
+	}
+	return "XOAUTH2", xoauth2Response(a.username, a.token), nil
+}
+
+// Next answers the server's error challenge with an empty response so that
+// it completes the exchange with its final error status.
+func (a *xoauth2SMTPAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		return []byte{}, nil
+	}
+	return nil, nil
+}
+
+func xoauth2Response(username, token string) []byte {
+	return []byte("user=" + username + "\x01auth=Bearer " + token + "\x01\x01")
+}
+
+// connAlive reports whether c is still logged in and answering. iCloud drops
+// idle connections after a few minutes, so a NOOP round trip is the only
+// reliable check.
+func connAlive(c *client.Client) bool {
+	select {
+	case <-c.LoggedOut():
+		return false
+	default:
+	}
+	if c.State()&imap.AuthenticatedState == 0 {
+		return false
+	}
+	return c.Noop() == nil
+}
+
+// ---------- Tool implementations ----------
+
+func (s *MCPServer) listMailboxes(id interface{}, args map[string]interface{}) {
+	c, err := s.connect()
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	defer s.release()
+
+	infos := make(chan *imap.MailboxInfo, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.List("", "*", infos)
+	}()
+
+	mailboxes := []Mailbox{}
+	for info := range infos {
+		attrs := info.Attributes
+		if attrs == nil {
+			attrs = []string{}
+		}
+		mailboxes = append(mailboxes, Mailbox{
+			Name:       info.Name,
+			Delimiter:  info.Delimiter,
+			Attributes: attrs,
+		})
+	}
+	if err := <-done; err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to list mailboxes: %v", err))
+		return
+	}
+
+	s.sendJSONResponse(id, mailboxes)
+}
+
+func (s *MCPServer) createMailbox(id interface{}, args map[string]interface{}) {
+	name := getString(args, "name")
+	parent := getString(args, "parent")
+	if strings.TrimSpace(name) == "" {
+		s.sendToolError(id, "name is required")
+		return
+	}
+
+	c, err := s.connect()
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	defer s.release()
+
+	delim, err := hierarchyDelimiter(c)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to get the hierarchy delimiter: %v", err))
+		return
+	}
+	mailbox, err := mailboxPath(parent, name, delim)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+
+	if err := c.Create(mailbox); err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to create mailbox %q: %v", mailbox, err))
+		return
+	}
+	// Many clients, iCloud's included, only show subscribed mailboxes.
+	subscribed := true
+	if err := c.Subscribe(mailbox); err != nil {
+		logger.Printf("Failed to subscribe to %q: %v\n", mailbox, err)
+		subscribed = false
+	}
+
+	logger.Printf("Created mailbox %q\n", mailbox)
+	s.sendJSONResponse(id, map[string]interface{}{
+		"status":     "created",
+		"mailbox":    mailbox,
+		"delimiter":  delim,
+		"subscribed": subscribed,
+	})
+}
+
+// hierarchyDelimiter returns the character the server separates mailbox
+// levels with, or "" if it has a flat namespace.
+func hierarchyDelimiter(c *client.Client) (string, error) {
+	infos := make(chan *imap.MailboxInfo, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.List("", "", infos)
+	}()
+
+	delim := ""
+	for info := range infos {
+		delim = info.Delimiter
+	}
+	return delim, <-done
+}
+
+// mailboxPath joins parent and name with the hierarchy delimiter. name may
+// itself be a path, but neither may have empty levels.
+func mailboxPath(parent, name, delim string) (string, error) {
+	name = strings.TrimSpace(name)
+	parent = strings.TrimSpace(parent)
+	if name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+	if parent != "" {
+		if delim == "" {
+			return "", fmt.Errorf("the server does not support nested mailboxes")
+		}
+		name = parent + delim + name
+	}
+	if delim != "" {
+		for _, level := range strings.Split(name, delim) {
+			if strings.TrimSpace(level) == "" {
+				return "", fmt.Errorf("invalid mailbox name %q: empty level between %q delimiters", name, delim)
+			}
+		}
+	}
+	return name, nil
+}
+
+func (s *MCPServer) getUnreadCount(id interface{}, args map[string]interface{}) {
+	mailbox := getString(args, "mailbox")
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+
+	c, err := s.connect()
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	defer s.release()
+
+	status, err := c.Status(mailbox, []imap.StatusItem{imap.StatusUnseen, imap.StatusMessages})
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to get status of mailbox %q: %v", mailbox, err))
+		return
+	}
+
+	s.sendJSONResponse(id, map[string]interface{}{
+		"mailbox":  mailbox,
+		"unseen":   status.Unseen,
+		"messages": status.Messages,
+	})
+}
+
+func (s *MCPServer) waitForMail(id interface{}, args map[string]interface{}) {
+	mailbox := getString(args, "mailbox")
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	secs := getInt(args, "timeout")
+	if secs <= 0 {
+		s.sendToolError(id, "timeout is required and must be positive")
+		return
+	}
+	timeout := time.Duration(secs) * time.Second
+	if timeout > maxWaitTimeout {
+		timeout = maxWaitTimeout
+	}
+
+	c, err := s.connect()
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	defer s.release()
+
+	status, err := c.Select(mailbox, true)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to select mailbox %q: %v", mailbox, s.timeoutErr(err)))
+		return
+	}
+	// The client updates status as EXISTS responses arrive, so take the
+	// count before IDLE starts rather than reading it concurrently.
+	count := status.Messages
+
+	// The wait itself may run past MAIL_TIMEOUT, so the watchdog only steps
+	// in if stopping the IDLE then takes longer than MAIL_TIMEOUT.
+	if s.config.Timeout > 0 {
+		s.watchFor(c, timeout+s.config.Timeout)
+	}
+
+	updates := make(chan client.Update, 10)
+	c.Updates = updates
+	defer func() { c.Updates = nil }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	logger.Printf("Waiting up to %s for new mail in %s\n", timeout, mailbox)
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Idle(stop, nil)
+	}()
+
+	prev, count, err := awaitNewMail(ctx, updates, done, count)
+	close(stop)
+	if err == nil {
+		// Keep reading updates until IDLE has ended, so the client never
+		// blocks delivering one.
+		for waiting := true; waiting; {
+			select {
+			case <-updates:
+			case err = <-done:
+				waiting = false
+			}
+		}
+	}
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("IDLE on %q failed: %v", mailbox, s.timeoutErr(err)))
+		return
+	}
+
+	uids := []uint32{}
+	if count > prev {
+		s.watch(c)
+		if uids, err = newMessageUIDs(c, prev, count); err != nil {
+			s.sendToolError(id, fmt.Sprintf("Failed to fetch new messages in %q: %v", mailbox, s.timeoutErr(err)))
+			return
+		}
+	}
+
+	s.sendJSONResponse(id, map[string]interface{}{
+		"mailbox":      mailbox,
+		"new_mail":     count > prev,
+		"new_messages": count - prev,
+		"messages":     count,
+		"uids":         uids,
+	})
+}
+
+// newMessageUIDs returns the UIDs of the messages with sequence numbers
+// prev+1 through cur, the ones that arrived while waiting, in order.
+func newMessageUIDs(c *client.Client, prev, cur uint32) ([]uint32, error) {
+	seqset := new(imap.SeqSet)
+	seqset.AddRange(prev+1, cur)
+
+	messages := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Fetch(seqset, []imap.FetchItem{imap.FetchUid}, messages)
+	}()
+
+	uids := []uint32{}
+	for msg := range messages {
+		uids = append(uids, msg.Uid)
+	}
+	if err := <-done; err != nil {
+		return nil, err
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	return uids, nil
+}
+
+// awaitNewMail reads mailbox updates until the message count rises above
+// count or ctx is done. It returns the count before and after the rise,
+// which are equal if no mail arrived. An IDLE that ends by itself, reported
+// on done, is an error.
+func awaitNewMail(ctx context.Context, updates <-chan client.Update, done <-chan error, count uint32) (prev, cur uint32, err error) {
+	for {
+		select {
+		case u := <-updates:
+			mu, ok := u.(*client.MailboxUpdate)
+			if !ok || mu.Mailbox == nil {
+				continue
+			}
+			if mu.Mailbox.Messages > count {
+				return count, mu.Mailbox.Messages, nil
+			}
+			count = mu.Mailbox.Messages
+		case err := <-done:
+			if err == nil {
+				err = errors.New("IDLE ended unexpectedly")
+			}
+			return count, count, err
+		case <-ctx.Done():
+			return count, count, nil
+		}
+	}
+}
+
+func (s *MCPServer) listMessages(id interface{}, args map[string]interface{}) {
+	mailbox := getString(args, "mailbox")
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	limit := getInt(args, "limit")
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+	offset := getInt(args, "offset")
+	if offset < 0 {
+		offset = 0
+	}
+	format, err := getFormat(args)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+
+	c, err := s.connect()
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	defer s.release()
+
+	status, err := c.Select(mailbox, true)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to select mailbox %q: %v", mailbox, err))
+		return
+	}
+
+	messages := []MessageSummary{}
+	if from, to, ok := messageRange(status.Messages, offset, limit); ok {
+		seqset := new(imap.SeqSet)
+		seqset.AddRange(from, to)
+
+		messages, err = fetchSummaries(c, seqset, false)
+		if err != nil {
+			s.sendToolError(id, fmt.Sprintf("Failed to fetch messages: %v", err))
+			return
+		}
+	}
+
+	if format == "text" {
+		s.sendTextResponse(id, fmt.Sprintf("%d of %d messages in %s\n%s", len(messages), status.Messages, mailbox, formatSummaries(messages)))
+		return
+	}
+	s.sendJSONResponse(id, messages)
+}
+
+// headerSection peeks at just the headers needed to triage a message,
+// BODY.PEEK[HEADER.FIELDS (FROM TO SUBJECT DATE)].
+var headerSection = &imap.BodySectionName{
+	BodyPartName: imap.BodyPartName{
+		Specifier: imap.HeaderSpecifier,
+		Fields:    []string{"FROM", "TO", "SUBJECT", "DATE"},
+	},
+	Peek: true,
+}
+
+// fetchRawMessage selects mailbox read-only and fetches the full source of
+// the message with the given UID. It peeks, so the message is not marked
+// \Seen.
+func fetchRawMessage(c *client.Client, mailbox string, uid uint32) (*imap.Message, imap.Literal, error) {
+	return fetchRawSection(c, mailbox, uid, &imap.BodySectionName{Peek: true})
+}
+
+// fetchRawSection is fetchRawMessage for any section of the message.
+func fetchRawSection(c *client.Client, mailbox string, uid uint32, section *imap.BodySectionName) (*imap.Message, imap.Literal, error) {
+	if _, err := c.Select(mailbox, true); err != nil {
+		return nil, nil, fmt.Errorf("Failed to select mailbox %q: %v", mailbox, err)
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uid)
+
+	ch := make(chan *imap.Message, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetch(seqset, []imap.FetchItem{section.FetchItem(), imap.FetchFlags, imap.FetchUid}, ch)
+	}()
+
+	var msg *imap.Message
+	for m := range ch {
+		msg = m
+	}
+	if err := <-done; err != nil {
+		return nil, nil, fmt.Errorf("Failed to fetch message: %v", err)
+	}
+	if msg == nil {
+		return nil, nil, fmt.Errorf("No message with UID %d in %s", uid, mailbox)
+	}
+
+	body := msg.GetBody(section)
+	if body == nil {
+		return nil, nil, fmt.Errorf("Server returned no body for UID %d", uid)
+	}
+	return msg, body, nil
+}
+
+// fetchSummaries fetches envelopes for the messages in seqset, which holds
+// UIDs when byUID is set and sequence numbers otherwise. The result is
+// ordered newest first.
+func fetchSummaries(c *client.Client, seqset *imap.SeqSet, byUID bool) ([]MessageSummary, error) {
+	items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchUid, imap.FetchBodyStructure}
+	ch := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		if byUID {
+			done <- c.UidFetch(seqset, items, ch)
+		} else {
+			done <- c.Fetch(seqset, items, ch)
+		}
+	}()
+
+	messages := []MessageSummary{}
+	for msg := range ch {
+		messages = append(messages, summarizeMessage(msg))
+	}
+	if err := <-done; err != nil {
+		return nil, err
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].SeqNum > messages[j].SeqNum
+	})
+	return messages, nil
+}
+
+func (s *MCPServer) searchMessages(id interface{}, args map[string]interface{}) {
+	mailbox := getString(args, "mailbox")
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	limit := getInt(args, "limit")
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	criteria, err := buildSearchCriteria(args)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	format, err := getFormat(args)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+
+	c, err := s.connect()
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	defer s.release()
+
+	if _, err := c.Select(mailbox, true); err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to select mailbox %q: %v", mailbox, err))
+		return
+	}
+
+	uids, err := c.UidSearch(criteria)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Search failed: %v", err))
+		return
+	}
+
+	total := len(uids)
+	messages := []MessageSummary{}
+	if total > 0 {
+		// UIDs grow with arrival order, so the highest ones are the newest.
+		sort.Slice(uids, func(i, j int) bool { return uids[i] > uids[j] })
+		if len(uids) > limit {
+			uids = uids[:limit]
+		}
+
+		seqset := new(imap.SeqSet)
+		seqset.AddNum(uids...)
+
+		messages, err = fetchSummaries(c, seqset, true)
+		if err != nil {
+			s.sendToolError(id, fmt.Sprintf("Failed to fetch messages: %v", err))
+			return
+		}
+	}
+
+	if format == "text" {
+		s.sendTextResponse(id, fmt.Sprintf("%d of %d matches in %s\n%s", len(messages), total, mailbox, formatSummaries(messages)))
+		return
+	}
+	s.sendJSONResponse(id, map[string]interface{}{
+		"mailbox":  mailbox,
+		"total":    total,
+		"messages": messages,
+	})
+}
+
+// searchDateLayout is the format accepted for since/before.
+const searchDateLayout = "2006-01-02"
+
+// buildSearchCriteria converts search_messages arguments into IMAP SEARCH
+// criteria. All given criteria must match.
+func buildSearchCriteria(args map[string]interface{}) (*imap.SearchCriteria, error) {
+	criteria := imap.NewSearchCriteria()
+
+	for arg, header := range map[string]string{"from": "From", "to": "To", "subject": "Subject"} {
+		if v := getString(args, arg); v != "" {
+			criteria.Header.Add(header, v)
+		}
+	}
+	if v := getString(args, "body"); v != "" {
+		criteria.Body = append(criteria.Body, v)
+	}
+	if v := getString(args, "text"); v != "" {
+		criteria.Text = append(criteria.Text, v)
+	}
+
+	for arg, field := range map[string]*time.Time{"since": &criteria.Since, "before": &criteria.Before} {
+		v := getString(args, arg)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(searchDateLayout, v)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a date like 2024-01-31, got %q", arg, v)
+		}
+		*field = t
+	}
+
+	if getBool(args, "unseen") {
+		criteria.WithoutFlags = append(criteria.WithoutFlags, imap.SeenFlag)
+	}
+	if getBool(args, "flagged") {
+		criteria.WithFlags = append(criteria.WithFlags, imap.FlaggedFlag)
+	}
+
+	return criteria, nil
+}
+
+// messageRange returns the sequence-number range covering the page of
+// newest-first messages that skips offset and holds up to limit. ok is false
+// when the page lies beyond the oldest message.
+func messageRange(total uint32, offset, limit int) (from, to uint32, ok bool) {
+	if offset >= int(total) {
+		return 0, 0, false
+	}
+	to = total - uint32(offset)
+	from = 1
+	if int(to) > limit {
+		from = to - uint32(limit) + 1
+	}
+	return from, to, true
+}
+
+// summarizeMessage converts a fetched message into a MessageSummary.
+func summarizeMessage(msg *imap.Message) MessageSummary {
+	summary := MessageSummary{
+		UID:    msg.Uid,
+		SeqNum: msg.SeqNum,
+		From:   []string{},
+		Flags:  msg.Flags,
+	}
+	if summary.Flags == nil {
+		summary.Flags = []string{}
+	}
+	if env := msg.Envelope; env != nil {
+		summary.Subject = env.Subject
+		summary.Date = env.Date
+		for _, addr := range env.From {
+			summary.From = append(summary.From, formatAddress(addr))
+		}
+		for _, addr := range env.To {
+			summary.To = append(summary.To, formatAddress(addr))
+		}
+	}
+	summary.HasAttachments = hasAttachments(msg.BodyStructure)
+	return summary
+}
+
+// hasAttachments reports whether a body structure has a part walkParts
+// would count as an attachment: one with an attachment disposition or a
+// filename.
+func hasAttachments(bs *imap.BodyStructure) bool {
+	if bs == nil {
+		return false
+	}
+	if strings.EqualFold(bs.MIMEType, "multipart") {
+		for _, part := range bs.Parts {
+			if hasAttachments(part) {
+				return true
+			}
+		}
+		return false
+	}
+	return strings.EqualFold(bs.Disposition, "attachment") || bs.DispositionParams["filename"] != "" || bs.Params["name"] != ""
+}
+
+// formatProp is the format argument shared by the tools that list messages.
+var formatProp = Property{
+	Type:        "string",
+	Description: "Result format: json for structured results, or text for one compact line per message",
+	Enum:        []string{"json", "text"},
+	Default:     "json",
+}
+
+// getFormat returns the format argument, defaulting to json.
+func getFormat(args map[string]interface{}) (string, error) {
+	switch format := getString(args, "format"); format {
+	case "", "json":
+		return "json", nil
+	case "text":
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid format %q: use json or text", format)
+	}
+}
+
+// formatSummaries renders messages one per line, as
+// "UID date | from | subject [flags] (attachments)".
+func formatSummaries(messages []MessageSummary) string {
+	var b strings.Builder
+	for _, m := range messages {
+		fmt.Fprintf(&b, "%d %s | %s | %s", m.UID, m.Date.Format("2006-01-02 15:04"), strings.Join(m.From, ", "), m.Subject)
+		if len(m.Flags) > 0 {
+			fmt.Fprintf(&b, " [%s]", strings.Join(m.Flags, " "))
+		}
+		if m.HasAttachments {
+			b.WriteString(" (attachments)")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// formatAddress renders an IMAP address as "Name <user@host>".
+func formatAddress(addr *imap.Address) string {
+	email := addr.Address()
+	if addr.PersonalName == "" {
+		return email
+	}
+	return fmt.Sprintf("%s <%s>", addr.PersonalName, email)
+}
+
+func (s *MCPServer) readMessage(id interface{}, args map[string]interface{}) {
+	mailbox := getString(args, "mailbox")
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	uid := getInt(args, "uid")
+	if uid <= 0 {
+		s.sendToolError(id, "uid is required")
+		return
+	}
+
+	c, err := s.connect()
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	defer s.release()
+
+	section := &imap.BodySectionName{Peek: true}
+	parse := parseMessage
+	if getBool(args, "headers") {
+		section, parse = headerSection, parseHeaders
+	}
+	msg, body, err := fetchRawSection(c, mailbox, uint32(uid), section)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+
+	detail, err := parse(body)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to parse message: %v", err))
+		return
+	}
+	detail.UID = msg.Uid
+	detail.Mailbox = mailbox
+	detail.Flags = msg.Flags
+	if detail.Flags == nil {
+		detail.Flags = []string{}
+	}
+
+	s.sendJSONResponse(id, detail)
+}
+
+func (s *MCPServer) downloadAttachment(id interface{}, args map[string]interface{}) {
+	mailbox := getString(args, "mailbox")
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	uid := getInt(args, "uid")
+	if uid <= 0 {
+		s.sendToolError(id, "uid is required")
+		return
+	}
+	index := -1
+	if _, ok := args["attachment_index"].(float64); ok {
+		index = getInt(args, "attachment_index")
+		if index < 0 {
+			s.sendToolError(id, "attachment_index must not be negative")
+			return
+		}
+	}
+	filename := getString(args, "filename")
+	if index < 0 && filename == "" {
+		s.sendToolError(id, "attachment_index or filename is required")
+		return
+	}
+	outputPath := getString(args, "output_path")
+	if outputPath == "" {
+		s.sendToolError(id, "output_path is required")
+		return
+	}
+	outputPath, err := resolveAllowedPath(outputPath)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Invalid output_path: %v", err))
+		return
+	}
+
+	c, err := s.connect()
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	defer s.release()
+
+	_, body, err := fetchRawMessage(c, mailbox, uint32(uid))
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+
+	att, data, err := extractAttachment(body, index, filename)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+
+	if info, err := os.Stat(outputPath); err == nil && info.IsDir() {
+		name := safeFilename(att.Filename)
+		if name == "" {
+			name = fmt.Sprintf("attachment-%d-%d", uid, att.Index)
+		}
+		outputPath = filepath.Join(outputPath, name)
+	}
+	if info, err := os.Lstat(outputPath); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		s.sendToolError(id, fmt.Sprintf("%s is a symlink; refusing to write through it", outputPath))
+		return
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if getBool(args, "overwrite") {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(outputPath, flags, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			s.sendToolError(id, fmt.Sprintf("%s already exists; set overwrite=true to replace it", outputPath))
+			return
+		}
+		s.sendToolError(id, fmt.Sprintf("Failed to create %s: %v", outputPath, err))
+		return
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		s.sendToolError(id, fmt.Sprintf("Failed to write %s: %v", outputPath, err))
+		return
+	}
+	if err := f.Close(); err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to write %s: %v", outputPath, err))
+		return
+	}
+
+	logger.Printf("Saved attachment %q of UID %d to %s\n", att.Filename, uid, outputPath)
+	s.sendJSONResponse(id, map[string]interface{}{
+		"path":         outputPath,
+		"size":         att.Size,
+		"filename":     att.Filename,
+		"content_type": att.ContentType,
+		"index":        att.Index,
+	})
+}
+
+func (s *MCPServer) saveAttachments(id interface{}, args map[string]interface{}) {
+	mailbox := getString(args, "mailbox")
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	uid := getInt(args, "uid")
+	if uid <= 0 {
+		s.sendToolError(id, "uid is required")
+		return
+	}
+	outputDir := getString(args, "output_dir")
+	if outputDir == "" {
+		s.sendToolError(id, "output_dir is required")
+		return
+	}
+	outputDir, err := resolveAllowedPath(outputDir)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Invalid output_dir: %v", err))
+		return
+	}
+	if err := os.MkdirAll(outputDir, 0700); err != nil {
+		s.sendToolError(id, fmt.Sprintf("Invalid output_dir: %v", err))
+		return
+	}
+
+	c, err := s.connect()
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	defer s.release()
+
+	_, body, err := fetchRawMessage(c, mailbox, uint32(uid))
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+
+	saved, err := writeAttachments(body, outputDir, uint32(uid))
+	for _, att := range saved {
+		logger.Printf("Saved attachment %q of UID %d to %s\n", att.Filename, uid, att.Path)
+	}
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+
+	s.sendJSONResponse(id, map[string]interface{}{
+		"uid":         uid,
+		"mailbox":     mailbox,
+		"output_dir":  outputDir,
+		"attachments": saved,
+	})
+}
+
+// composeMessage builds the OutgoingMessage described by send_email-style
+// arguments, loading any attachments. With requireTo, a missing recipient
+// is reported before any attachment file is read.
+func (s *MCPServer) composeMessage(args map[string]interface{}, requireTo bool) (OutgoingMessage, error) {
+	to := getStringArray(args, "to")
+	if len(to) == 0 {
+		if single := getString(args, "to"); single != "" {
+			to = []string{single}
+		}
+	}
+	if requireTo && len(to) == 0 {
+		return OutgoingMessage{}, fmt.Errorf("to is required")
+	}
+
+	msg := OutgoingMessage{
+		From:     s.config.Email,
+		To:       to,
+		Cc:       getStringArray(args, "cc"),
+		Subject:  getString(args, "subject"),
+		TextBody: getRawString(args, "body"),
+		HTMLBody: getRawString(args, "html_body"),
+		Date:     time.Now(),
+	}
+
+	attachments, err := loadAttachments(getStringArray(args, "attachments"))
+	if err != nil {
+		return msg, err
+	}
+	msg.Attachments = attachments
+	return msg, nil
+}
+
+func (s *MCPServer) sendEmail(id interface{}, args map[string]interface{}) {
+	msg, err := s.composeMessage(args, true)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+
+	data, recipients, err := buildMessage(msg)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+
+	if err := s.sendMail(recipients, data); err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to send email: %v", err))
+		return
+	}
+
+	logger.Printf("Sent email to %d recipient(s)\n", len(recipients))
+	s.sendJSONResponse(id, map[string]interface{}{
+		"status":      "sent",
+		"recipients":  recipients,
+		"subject":     msg.Subject,
+		"attachments": len(msg.Attachments),
+	})
+}
+
+func (s *MCPServer) saveDraft(id interface{}, args map[string]interface{}) {
+	mailbox := getString(args, "mailbox")
+	if mailbox == "" {
+		mailbox = "Drafts"
+	}
+
+	msg, err := s.composeMessage(args, false)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	data, recipients, err := buildMessage(msg)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+
+	c, err := s.connect()
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	defer s.release()
+
+	if err := c.Append(mailbox, []string{imap.DraftFlag}, msg.Date, bytes.NewBuffer(data)); err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to save draft to %q: %v", mailbox, s.timeoutErr(err)))
+		return
+	}
+
+	logger.Printf("Saved draft %q to %s\n", msg.Subject, mailbox)
+	s.sendJSONResponse(id, map[string]interface{}{
+		"status":      "saved",
+		"mailbox":     mailbox,
+		"recipients":  recipients,
+		"subject":     msg.Subject,
+		"attachments": len(msg.Attachments),
+	})
+}
+
+func (s *MCPServer) replyMessage(id interface{}, args map[string]interface{}) {
+	mailbox := getString(args, "mailbox")
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	uid := getInt(args, "uid")
+	if uid <= 0 {
+		s.sendToolError(id, "uid is required")
+		return
+	}
+	body := getRawString(args, "body")
+	if strings.TrimSpace(body) == "" {
+		s.sendToolError(id, "body is required")
+		return
+	}
+	quote := true
+	if v, ok := args["quote"].(bool); ok {
+		quote = v
+	}
+
+	orig, err := s.fetchOriginal(mailbox, uint32(uid))
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+
+	msg, err := composeReply(orig, s.config.Email, body, getBool(args, "reply_all"), quote)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	msg.Cc = append(msg.Cc, getStringArray(args, "cc")...)
+	msg.HTMLBody = getRawString(args, "html_body")
+
+	if msg.Attachments, err = loadAttachments(getStringArray(args, "attachments")); err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+
+	s.sendDerived(id, msg, mailbox, uint32(uid), imap.AnsweredFlag)
+}
+
+func (s *MCPServer) forwardMessage(id interface{}, args map[string]interface{}) {
+	mailbox := getString(args, "mailbox")
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	uid := getInt(args, "uid")
+	if uid <= 0 {
+		s.sendToolError(id, "uid is required")
+		return
+	}
+	to := getStringArray(args, "to")
+	if len(to) == 0 {
+		if single := getString(args, "to"); single != "" {
+			to = []string{single}
+		}
+	}
+	if len(to) == 0 {
+		s.sendToolError(id, "to is required")
+		return
+	}
+
+	orig, err := s.fetchOriginal(mailbox, uint32(uid))
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+
+	msg, err := composeForward(orig, s.config.Email, getRawString(args, "body"), getBool(args, "as_attachment"))
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	msg.To = to
+	msg.Cc = getStringArray(args, "cc")
+
+	extra, err := loadAttachments(getStringArray(args, "attachments"))
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	msg.Attachments = append(msg.Attachments, extra...)
+	if total := attachmentBytes(msg.Attachments); total > maxAttachmentBytes {
+		s.sendToolError(id, fmt.Sprintf("attachments exceed the %d MB limit", maxAttachmentBytes/(1024*1024)))
+		return
+	}
+
+	s.sendDerived(id, msg, mailbox, uint32(uid), forwardedFlag)
+}
+
+// fetchOriginal fetches and parses the message being replied to or
+// forwarded. The IMAP connection is released before the SMTP send, so a slow
+// send does not count against the IMAP watchdog.
+func (s *MCPServer) fetchOriginal(mailbox string, uid uint32) (*originalMessage, error) {
+	c, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer s.release()
+
+	_, body, err := fetchRawMessage(c, mailbox, uid)
+	if err != nil {
+		return nil, s.timeoutErr(err)
+	}
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read message: %v", err)
+	}
+	return parseOriginal(raw)
+}
+
+// sendDerived sends a reply or forward and then sets flag on the original.
+// Failing to set the flag is logged but does not fail the call, since the
+// mail has already gone out.
+func (s *MCPServer) sendDerived(id interface{}, msg OutgoingMessage, mailbox string, uid uint32, flag string) {
+	data, recipients, err := buildMessage(msg)
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+
+	if err := s.sendMail(recipients, data); err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to send email: %v", err))
+		return
+	}
+	logger.Printf("Sent %q to %d recipient(s)\n", msg.Subject, len(recipients))
+
+	result := map[string]interface{}{
+		"status":      "sent",
+		"recipients":  recipients,
+		"subject":     msg.Subject,
+		"attachments": len(msg.Attachments),
+	}
+	if msg.InReplyTo != "" {
+		result["in_reply_to"] = msg.InReplyTo
+	}
+	if err := s.addFlag(mailbox, uid, flag); err != nil {
+		logger.Printf("Failed to flag UID %d in %s as %s: %v\n", uid, mailbox, flag, err)
+	} else {
+		result["flagged"] = flag
+	}
+	s.sendJSONResponse(id, result)
+}
+
+// addFlag adds flag to the message with the given UID.
+func (s *MCPServer) addFlag(mailbox string, uid uint32, flag string) error {
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer s.release()
+
+	if _, err := c.Select(mailbox, false); err != nil {
+		return s.timeoutErr(err)
+	}
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uid)
+	return s.timeoutErr(c.UidStore(seqset, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{flag}, nil))
+}
+
+func (s *MCPServer) moveMessage(id interface{}, args map[string]interface{}) {
+	mailbox := getString(args, "mailbox")
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	uid := getInt(args, "uid")
+	destination := getString(args, "destination")
+	if uid <= 0 || destination == "" {
+		s.sendToolError(id, "uid and destination are required")
+		return
+	}
+	if destination == mailbox {
+		s.sendToolError(id, "destination must differ from mailbox")
+		return
+	}
+
+	c, err := s.connect()
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	defer s.release()
+
+	if _, err := c.Select(mailbox, false); err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to select mailbox %q: %v", mailbox, err))
+		return
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uint32(uid))
+
+	method, err := moveUID(c, seqset, destination)
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to move message: %v", err))
+		return
+	}
+
+	s.sendJSONResponse(id, map[string]interface{}{
+		"status":      "moved",
+		"uid":         uid,
+		"from":        mailbox,
+		"destination": destination,
+		"method":      method,
+	})
+}
+
+func (s *MCPServer) deleteMessage(id interface{}, args map[string]interface{}) {
+	mailbox := getString(args, "mailbox")
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	uid := getInt(args, "uid")
+	if uid <= 0 {
+		s.sendToolError(id, "uid is required")
+		return
+	}
+
+	c, err := s.connect()
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	defer s.release()
+
+	if _, err := c.Select(mailbox, false); err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to select mailbox %q: %v", mailbox, err))
+		return
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uint32(uid))
+
+	flags := []interface{}{imap.DeletedFlag}
+	if err := c.UidStore(seqset, imap.FormatFlagsOp(imap.AddFlags, true), flags, nil); err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to flag message as deleted: %v", err))
+		return
+	}
+	if err := expungeUIDs(c, seqset); err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to expunge message: %v", err))
+		return
+	}
+
+	s.sendJSONResponse(id, map[string]interface{}{
+		"status":  "deleted",
+		"uid":     uid,
+		"mailbox": mailbox,
+	})
+}
+
+func (s *MCPServer) setFlags(id interface{}, args map[string]interface{}) {
+	mailbox := getString(args, "mailbox")
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	uid := getInt(args, "uid")
+	if uid <= 0 {
+		s.sendToolError(id, "uid is required")
+		return
+	}
+
+	add, err := normalizeFlags(getStringArray(args, "add_flags"))
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	remove, err := normalizeFlags(getStringArray(args, "remove_flags"))
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	if len(add) == 0 && len(remove) == 0 {
+		s.sendToolError(id, "at least one of add_flags or remove_flags is required")
+		return
+	}
+
+	c, err := s.connect()
+	if err != nil {
+		s.sendToolError(id, err.Error())
+		return
+	}
+	defer s.release()
+
+	if _, err := c.Select(mailbox, false); err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to select mailbox %q: %v", mailbox, err))
+		return
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uint32(uid))
+
+	var flags []string
+	for _, change := range []struct {
+		op    imap.FlagsOp
+		flags []string
+	}{
+		{imap.AddFlags, add},
+		{imap.RemoveFlags, remove},
+	} {
+		if len(change.flags) == 0 {
+			continue
+		}
+		values := make([]interface{}, len(change.flags))
+		for i, f := range change.flags {
+			values[i] = f
+		}
+
+		// Non-silent STORE makes the server echo the resulting flags.
+		ch := make(chan *imap.Message, 1)
+		done := make(chan error, 1)
+		go func() {
+			done <- c.UidStore(seqset, imap.FormatFlagsOp(change.op, false), values, ch)
+		}()
+		for msg := range ch {
+			flags = msg.Flags
+		}
+		if err := <-done; err != nil {
+			s.sendToolError(id, fmt.Sprintf("Failed to update flags: %v", err))
+			return
+		}
+	}
+	if flags == nil {
+		flags = []string{}
+	}
+
+	s.sendJSONResponse(id, map[string]interface{}{
+		"uid":     uid,
+		"mailbox": mailbox,
+		"flags":   flags,
+	})
+}
+
+// systemFlags maps lower-cased system flag names, with or without the
+// leading backslash, to their canonical form.
+var systemFlags = map[string]string{}
+
+func init() {
+	for _, f := range []string{imap.SeenFlag, imap.AnsweredFlag, imap.FlaggedFlag, imap.DeletedFlag, imap.DraftFlag} {
+		systemFlags[strings.ToLower(f)] = f
+		systemFlags[strings.ToLower(strings.TrimPrefix(f, "\\"))] = f
+	}
+}
+
+// normalizeFlags canonicalizes system flags ("seen" -> "\\Seen") and passes
+// keywords such as "$Junk" through unchanged.
+func normalizeFlags(flags []string) ([]string, error) {
+	var result []string
+	for _, f := range flags {
+		if canonical, ok := systemFlags[strings.ToLower(f)]; ok {
+			result = append(result, canonical)
+			continue
+		}
+		if strings.HasPrefix(f, "\\") {
+			return nil, fmt.Errorf("unknown system flag %q; expected one of \\Seen, \\Answered, \\Flagged, \\Deleted, \\Draft", f)
+		}
+		if strings.ContainsAny(f, " ()[]{}%*\"\\") {
+			return nil, fmt.Errorf("invalid flag %q", f)
+		}
+		result = append(result, f)
+	}
+	return result, nil
+}
+
+// moveUID moves the messages in seqset (UIDs) to dest, using MOVE when the
+// server supports it and COPY + STORE \Deleted + EXPUNGE otherwise. It
+// reports which method was used.
+func moveUID(c *client.Client, seqset *imap.SeqSet, dest string) (string, error) {
+	if ok, err := c.Support("MOVE"); err != nil {
+		return "", err
+	} else if ok {
+		return "move", c.UidMove(seqset, dest)
+	}
+
+	if err := c.UidCopy(seqset, dest); err != nil {
+		return "", err
+	}
+	flags := []interface{}{imap.DeletedFlag}
+	if err := c.UidStore(seqset, imap.FormatFlagsOp(imap.AddFlags, true), flags, nil); err != nil {
+		return "", fmt.Errorf("copied to %s but failed to flag the original: %w", dest, err)
+	}
+	if err := expungeUIDs(c, seqset); err != nil {
+		return "", fmt.Errorf("copied to %s but failed to expunge the original: %w", dest, err)
+	}
+	return "copy+expunge", nil
+}
+
+// expungeUIDs permanently removes the \Deleted messages in seqset. With
+// UIDPLUS it issues UID EXPUNGE so that other messages already flagged
+// \Deleted in the mailbox are left alone; otherwise it falls back to a
+// plain EXPUNGE.
+func expungeUIDs(c *client.Client, seqset *imap.SeqSet) error {
+	ok, err := c.Support("UIDPLUS")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return c.Expunge(nil)
+	}
+
+	cmd := &commands.Uid{Cmd: &imap.Command{Name: "EXPUNGE", Arguments: []interface{}{seqset}}}
+	status, err := c.Execute(cmd, nil)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+// ---------- Replies and forwards ----------
+
+// forwardedFlag is the keyword mail clients use to mark forwarded messages.
+const forwardedFlag = "$Forwarded"
+
+// originalMessage is a received message being replied to or forwarded.
+type originalMessage struct {
+	raw    []byte
+	detail *MessageDetail
+	date   time.Time
+
+	// replyTo is the Reply-To address list, or From when there is none.
+	replyTo []*mail.Address
+	to, cc  []*mail.Address
+
+	// messageID is the original's Message-ID, and references its References
+	// chain followed by messageID, oldest first.
+	messageID  string
+	references []string
+}
+
+var messageIDPattern = regexp.MustCompile(`<[^<>\s]+>`)
+
+// parseOriginal parses the raw source of a received message.
+func parseOriginal(raw []byte) (*originalMessage, error) {
+	detail, err := parseMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse message: %v", err)
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse message: %v", err)
+	}
+
+	orig := &originalMessage{
+		raw:     raw,
+		detail:  detail,
+		replyTo: headerAddresses(m.Header, "Reply-To"),
+		to:      headerAddresses(m.Header, "To"),
+		cc:      headerAddresses(m.Header, "Cc"),
+	}
+	if len(orig.replyTo) == 0 {
+		orig.replyTo = headerAddresses(m.Header, "From")
+	}
+	if date, err := m.Header.Date(); err == nil {
+		orig.date = date
+	}
+
+	if ids := messageIDPattern.FindAllString(m.Header.Get("Message-Id"), 1); len(ids) > 0 {
+		orig.messageID = ids[0]
+	}
+	orig.references = messageIDPattern.FindAllString(m.Header.Get("References"), -1)
+	if len(orig.references) == 0 {
+		// RFC 5322 3.6.4: without References, the parent's In-Reply-To
+		// stands in for it.
+		orig.references = messageIDPattern.FindAllString(m.Header.Get("In-Reply-To"), 1)
+	}
+	if orig.messageID != "" {
+		orig.references = append(orig.references, orig.messageID)
+	}
+	return orig, nil
+}
+
+// headerAddresses parses an address-list header, returning nil if it is
+// missing or malformed.
+func headerAddresses(h mail.Header, key string) []*mail.Address {
+	addrs, err := h.AddressList(key)
+	if err != nil {
+		return nil
+	}
+	return addrs
+}
+
+// composeReply builds a reply to orig from self. The reply goes to the
+// original's Reply-To or From; replyAll also copies its To and Cc
+// recipients, minus self and duplicates.
+func composeReply(orig *originalMessage, self, body string, replyAll, quote bool) (OutgoingMessage, error) {
+	if len(orig.replyTo) == 0 {
+		return OutgoingMessage{}, fmt.Errorf("original message has no From or Reply-To address to reply to")
+	}
+
+	seen := map[string]bool{strings.ToLower(self): true}
+	var to, cc []string
+	for _, addr := range orig.replyTo {
+		seen[strings.ToLower(addr.Address)] = true
+		to = append(to, addr.String())
+	}
+	if replyAll {
+		for _, addr := range append(orig.to, orig.cc...) {
+			key := strings.ToLower(addr.Address)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			cc = append(cc, addr.String())
+		}
+	}
+
+	text := body
+	if quote && orig.detail.TextBody != "" {
+		attribution := orig.detail.From + " wrote:"
+		if !orig.date.IsZero() {
+			attribution = fmt.Sprintf("On %s, %s", orig.date.Format("Mon, Jan 2, 2006 at 15:04"), attribution)
+		}
+		text = strings.TrimRight(body, "\r\n") + "\n\n" + attribution + "\n" + quoteText(orig.detail.TextBody)
+	}
+
+	return OutgoingMessage{
+		From:       self,
+		To:         to,
+		Cc:         cc,
+		Subject:    prefixSubject("Re:", orig.detail.Subject),
+		TextBody:   text,
+		Date:       time.Now(),
+		InReplyTo:  orig.messageID,
+		References: orig.references,
+	}, nil
+}
+
+// composeForward builds a forward of orig from self, with note above it.
+// Inline forwards quote the original's headers and bodies and carry over
+// its attachments; asAttachment attaches the whole original instead.
+func composeForward(orig *originalMessage, self, note string, asAttachment bool) (OutgoingMessage, error) {
+	msg := OutgoingMessage{
+		From:    self,
+		Subject: prefixSubject("Fwd:", orig.detail.Subject),
+		Date:    time.Now(),
+	}
+
+	if asAttachment {
+		msg.TextBody = note
+		msg.Attachments = []Attachment{{
+			Filename:    emlFilename(orig.detail.Subject),
+			ContentType: "message/rfc822",
+			Data:        orig.raw,
+		}}
+		return msg, nil
+	}
+
+	fields := [][2]string{
+		{"From", orig.detail.From},
+		{"Date", orig.detail.Date},
+		{"Subject", orig.detail.Subject},
+		{"To", orig.detail.To},
+		{"Cc", orig.detail.Cc},
+	}
+	if !orig.date.IsZero() {
+		fields[1][1] = orig.date.Format("Mon, Jan 2, 2006 at 15:04")
+	}
+
+	var text, htmlText strings.Builder
+	if note = strings.TrimRight(note, "\r\n"); note != "" {
+		text.WriteString(note + "\n\n")
+		htmlText.WriteString("<p>" + strings.ReplaceAll(html.EscapeString(note), "\n", "<br>\n") + "</p>\n")
+	}
+	text.WriteString("---------- Forwarded message ---------\n")
+	htmlText.WriteString("<p>---------- Forwarded message ---------<br>\n")
+	for _, f := range fields {
+		if f[1] == "" {
+			continue
+		}
+		fmt.Fprintf(&text, "%s: %s\n", f[0], f[1])
+		fmt.Fprintf(&htmlText, "%s: %s<br>\n", f[0], html.EscapeString(f[1]))
+	}
+	text.WriteString("\n" + orig.detail.TextBody)
+	htmlText.WriteString("</p>\n" + orig.detail.HTMLBody)
+
+	msg.TextBody = text.String()
+	if orig.detail.HTMLBody != "" {
+		msg.HTMLBody = htmlText.String()
+	}
+
+	attachments, err := collectAttachments(orig.raw)
+	if err != nil {
+		return OutgoingMessage{}, err
+	}
+	msg.Attachments = attachments
+	return msg, nil
+}
+
+// collectAttachments decodes every attachment of a raw message.
+func collectAttachments(raw []byte) ([]Attachment, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse message: %v", err)
+	}
+
+	var attachments []Attachment
+	err = walkParts(m.Header, m.Body, func(p *mimePart) error {
+		if !p.attachment {
+			return nil
+		}
+		data, err := io.ReadAll(p.decoded())
+		if err != nil {
+			return fmt.Errorf("Failed to decode attachment %d: %v", len(attachments), err)
+		}
+		attachments = append(attachments, Attachment{
+			Filename:    p.filename,
+			ContentType: p.mediaType,
+			Data:        data,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+func attachmentBytes(attachments []Attachment) int {
+	total := 0
+	for _, att := range attachments {
+		total += len(att.Data)
+	}
+	return total
+}
+
+// prefixSubject prepends prefix ("Re:" or "Fwd:") to subject unless it is
+// already there, ignoring case.
+func prefixSubject(prefix, subject string) string {
+	subject = strings.TrimSpace(subject)
+	if len(subject) >= len(prefix) && strings.EqualFold(subject[:len(prefix)], prefix) {
+		return subject
+	}
+	if subject == "" {
+		return prefix
+	}
+	return prefix + " " + subject
+}
+
+// quoteText prefixes each line of text with "> ".
+func quoteText(text string) string {
+	lines := strings.Split(strings.TrimRight(text, "\r\n"), "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if line == "" || strings.HasPrefix(line, ">") {
+			lines[i] = ">" + line
+		} else {
+			lines[i] = "> " + line
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// emlFilename turns a subject into a filename for a forwarded .eml file.
+func emlFilename(subject string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(subject))
+	if runes := []rune(name); len(runes) > 100 {
+		name = string(runes[:100])
+	}
+	if name == "" {
+		name = "message"
+	}
+	return name + ".eml"
+}
+
+// ---------- MIME composition ----------
+
+// buildMessage renders msg as an RFC 5322 message and returns it together
+// with the bare envelope recipient addresses.
+func buildMessage(msg OutgoingMessage) ([]byte, []string, error) {
+	to, err := parseAddressList("to", msg.To)
+	if err != nil {
+		return nil, nil, err
+	}
+	cc, err := parseAddressList("cc", msg.Cc)
+	if err != nil {
+		return nil, nil, err
+	}
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid from address %q: %w", msg.From, err)
+	}
+
+	var recipients []string
+	for _, addr := range append(to, cc...) {
+		recipients = append(recipients, addr.Address)
+	}
+
+	var buf bytes.Buffer
+	writeHeader := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+	writeHeader("From", from.String())
+	if len(to) > 0 {
+		writeHeader("To", formatAddressList(to))
+	}
+	if len(cc) > 0 {
+		writeHeader("Cc", formatAddressList(cc))
+	}
+	writeHeader("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	writeHeader("Date", msg.Date.Format(time.RFC1123Z))
+	writeHeader("Message-ID", newMessageID(from.Address))
+	if msg.InReplyTo != "" {
+		writeHeader("In-Reply-To", msg.InReplyTo)
+	}
+	if len(msg.References) > 0 {
+		writeHeader("References", strings.Join(msg.References, "\r\n "))
+	}
+	writeHeader("MIME-Version", "1.0")
+
+	bodyHeader, body, err := buildBody(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(msg.Attachments) == 0 {
+		writeHeader("Content-Type", bodyHeader.Get("Content-Type"))
+		if cte := bodyHeader.Get("Content-Transfer-Encoding"); cte != "" {
+			writeHeader("Content-Transfer-Encoding", cte)
+		}
+		buf.WriteString("\r\n")
+		buf.Write(body)
+		return buf.Bytes(), recipients, nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	writeHeader("Content-Type", fmt.Sprintf("multipart/mixed; boundary=%q", mw.Boundary()))
+	buf.WriteString("\r\n")
+
+	w, err := mw.CreatePart(bodyHeader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, nil, err
+	}
+
+	for _, att := range msg.Attachments {
+		contentType := att.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		if contentType == "message/rfc822" {
+			// RFC 2046 forbids base64 for message/rfc822, so the original
+			// is embedded as is.
+			w, err := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":              {contentType},
+				"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": att.Filename})},
+				"Content-Transfer-Encoding": {transferEncoding8bit(att.Data)},
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			if _, err := w.Write(att.Data); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(contentType, map[string]string{"name": att.Filename})},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": att.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		writeBase64Lines(w, att.Data)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	return buf.Bytes(), recipients, nil
+}
+
+// buildBody renders the text part of msg: a single text/plain part, or a
+// multipart/alternative holding plain and HTML versions.
+func buildBody(msg OutgoingMessage) (textproto.MIMEHeader, []byte, error) {
+	var buf bytes.Buffer
+
+	if msg.HTMLBody == "" {
+		if err := writeQuotedPrintable(&buf, msg.TextBody); err != nil {
+			return nil, nil, err
+		}
+		return textproto.MIMEHeader{
+			"Content-Type":              {"text/plain; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		}, buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	for _, part := range []struct{ mediaType, body string }{
+		{"text/plain", msg.TextBody},
+		{"text/html", msg.HTMLBody},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.mediaType + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	return textproto.MIMEHeader{
+		"Content-Type": {fmt.Sprintf("multipart/alternative; boundary=%q", mw.Boundary())},
+	}, buf.Bytes(), nil
+}
+
+// transferEncoding8bit returns "7bit" if data is plain ASCII and "8bit"
+// otherwise.
+func transferEncoding8bit(data []byte) string {
+	for _, b := range data {
+		if b >= 0x80 {
+			return "8bit"
+		}
+	}
+	return "7bit"
+}
+
+// writeBase64Lines base64-encodes data in 76-character lines as required
+// by RFC 2045.
+func writeBase64Lines(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		io.WriteString(w, encoded[:76]+"\r\n")
+		encoded = encoded[76:]
+	}
+	io.WriteString(w, encoded+"\r\n")
+}
+
+// loadAttachments reads the files at paths, enforcing maxAttachmentBytes
+// across all of them. Each must be inside allowedPaths, so that files such
+// as SSH keys cannot be mailed out.
+func loadAttachments(paths []string) ([]Attachment, error) {
+	var attachments []Attachment
+	var total int64
+
+	for _, p := range paths {
+		path, err := resolveAllowedPath(p)
+		if err != nil {
+			return nil, fmt.Errorf("attachment %q: %w", p, err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("attachment %q: %w", p, err)
+		}
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("attachment %q is not a regular file", p)
+		}
+		total += info.Size()
+		if total > maxAttachmentBytes {
+			return nil, fmt.Errorf("attachments exceed the %d MB limit", maxAttachmentBytes/(1024*1024))
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("attachment %q: %w", p, err)
+		}
+		// Name the attachment after the path given, not a symlink's target.
+		name := filepath.Base(p)
+		attachments = append(attachments, Attachment{
+			Filename:    name,
+			ContentType: mime.TypeByExtension(filepath.Ext(name)),
+			Data:        data,
+		})
+	}
+	return attachments, nil
+}
+
+// allowedPaths restricts where attachments may be saved and which files may
+// be attached to outgoing mail. Defaults to $HOME.
+// Override via HUNTER3_IMAIL_ALLOWED_PATHS (comma-separated). Hidden files
+// and directories below an allowed directory, such as ~/.ssh, are refused
+// unless they are listed themselves.
+var allowedPaths []string
+
+func initAllowedPaths() {
+	var paths []string
+	if envPaths := os.Getenv("HUNTER3_IMAIL_ALLOWED_PATHS"); envPaths != "" {
+		paths = strings.Split(envPaths, ",")
+	} else if home := os.Getenv("HOME"); home != "" {
+		paths = []string{home}
+	}
+	for _, p := range paths {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		abs, err := expandPath(p)
+		if err != nil {
+			continue
+		}
+		if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+			abs = resolved
+		}
+		allowedPaths = append(allowedPaths, filepath.Clean(abs))
+	}
+	logger.Printf("Attachment paths restricted to: %s\n", strings.Join(allowedPaths, ", "))
+}
+
+// resolveAllowedPath expands p and resolves symlinks in the part of it that
+// exists, then checks the result against allowedPaths. The returned path
+// may not exist yet.
+func resolveAllowedPath(p string) (string, error) {
+	abs, err := expandPath(p)
+	if err != nil {
+		return "", err
+	}
+
+	// Walk up to the longest existing prefix, which is the part a symlink
+	// could redirect, and resolve that. A dangling symlink on the way could
+	// later be followed anywhere, so it is refused.
+	dir, rest := abs, []string{}
+	resolved, err := filepath.EvalSymlinks(dir)
+	for err != nil {
+		if !os.IsNotExist(err) || filepath.Dir(dir) == dir {
+			return "", err
+		}
+		if _, lerr := os.Lstat(dir); lerr == nil {
+			return "", fmt.Errorf("path %q goes through a dangling symlink", p)
+		}
+		rest = append([]string{filepath.Base(dir)}, rest...)
+		dir = filepath.Dir(dir)
+		resolved, err = filepath.EvalSymlinks(dir)
+	}
+	resolved = filepath.Join(append([]string{resolved}, rest...)...)
+
+	for _, allowed := range allowedPaths {
+		if resolved == allowed {
+			return resolved, nil
+		}
+		rel, ok := strings.CutPrefix(resolved, allowed+string(filepath.Separator))
+		if !ok {
+			continue
+		}
+		for _, part := range strings.Split(rel, string(filepath.Separator)) {
+			if strings.HasPrefix(part, ".") {
+				return "", fmt.Errorf("path %q is inside a hidden directory or file", p)
+			}
+		}
+		return resolved, nil
+	}
+	return "", fmt.Errorf("path %q is outside the allowed directories (set HUNTER3_IMAIL_ALLOWED_PATHS)", p)
+}
+
+// expandPath resolves a leading ~ and makes path absolute.
+func expandPath(path string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, path[1:])
+	}
+	return filepath.Abs(path)
+}
+
+// parseAddressList validates each address, rejecting anything that could
+// smuggle extra headers into the message.
+func parseAddressList(field string, values []string) ([]*mail.Address, error) {
+	var addrs []*mail.Address
+	for _, v := range values {
+		addr, err := mail.ParseAddress(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s address %q: %w", field, v, err)
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+func formatAddressList(addrs []*mail.Address) string {
+	parts := make([]string, len(addrs))
+	for i, addr := range addrs {
+		parts[i] = addr.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// sendMail delivers data over SMTP. Port 465 uses implicit TLS; any other
+// port is upgraded with STARTTLS when the server offers it. A single deadline
+// covers the whole exchange.
+func (s *MCPServer) sendMail(recipients []string, data []byte) error {
+	var auth smtp.Auth
+	if s.config.AccessToken != "" {
+		auth = &xoauth2SMTPAuth{username: s.config.Email, token: s.config.AccessToken, host: s.config.SMTPHost}
+	} else {
+		auth = smtp.PlainAuth("", s.config.Email, s.config.Password, s.config.SMTPHost)
+	}
+
+	dialer := &net.Dialer{Timeout: s.config.Timeout}
+	tlsConfig := &tls.Config{ServerName: s.config.SMTPHost}
+	var conn net.Conn
+	var err error
+	if s.config.SMTPPort == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.config.smtpAddr(), tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", s.config.smtpAddr())
+	}
+	if err != nil {
+		return err
+	}
+	if s.config.Timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(s.config.Timeout)); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	c, err := smtp.NewClient(conn, s.config.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if s.config.SMTPPort != 465 {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		}
+	}
+	if err := c.Auth(auth); err != nil {
+		return err
+	}
+	if err := c.Mail(s.config.Email); err != nil {
+		return err
+	}
+	for _, rcpt := range recipients {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// newMessageID returns a unique Message-ID in the sender's domain.
+func newMessageID(from string) string {
+	domain := "icloud.com"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(b), domain)
+}
+
+// ---------- MIME parsing ----------
+
+// headerGetter is satisfied by both mail.Header and textproto.MIMEHeader.
+type headerGetter interface {
+	Get(key string) string
+}
+
+var wordDecoder = new(mime.WordDecoder)
+
+// parseMessage decodes a raw RFC 5322 message into its headers and the first
+// text/plain and text/html parts.
+func parseMessage(r io.Reader) (*MessageDetail, error) {
+	m, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := detailFromHeader(m.Header)
+	if err := collectTextParts(m.Header, m.Body, detail); err != nil {
+		return nil, err
+	}
+	return detail, nil
+}
+
+// parseHeaders decodes a message's headers alone, such as a fetched
+// headerSection, leaving the bodies and attachments empty.
+func parseHeaders(r io.Reader) (*MessageDetail, error) {
+	m, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	return detailFromHeader(m.Header), nil
+}
+
+// detailFromHeader decodes the header fields of a MessageDetail.
+func detailFromHeader(h mail.Header) *MessageDetail {
+	detail := &MessageDetail{
+		From:      decodeHeader(h.Get("From")),
+		To:        decodeHeader(h.Get("To")),
+		Cc:        decodeHeader(h.Get("Cc")),
+		ReplyTo:   decodeHeader(h.Get("Reply-To")),
+		Subject:   decodeHeader(h.Get("Subject")),
+		Date:      h.Get("Date"),
+		MessageID: h.Get("Message-Id"),
+	}
+	if date, err := h.Date(); err == nil {
+		detail.Date = date.Format(time.RFC3339)
+	}
+	return detail
+}
+
+// collectTextParts walks a (possibly nested) MIME entity, stores the first
+// text/plain and text/html bodies that are not attachments, and lists the
+// attachments.
+func collectTextParts(h headerGetter, body io.Reader, detail *MessageDetail) error {
+	return walkParts(h, body, func(p *mimePart) error {
+		if p.attachment {
+			size, err := io.Copy(io.Discard, p.decoded())
+			if err != nil {
+				return err
+			}
+			detail.Attachments = append(detail.Attachments, AttachmentInfo{
+				Index:       len(detail.Attachments),
+				Filename:    p.filename,
+				ContentType: p.mediaType,
+				Size:        size,
+			})
+			return nil
+		}
+		if p.mediaType != "text/plain" && p.mediaType != "text/html" {
+			return nil
+		}
+
+		data, err := io.ReadAll(p.decoded())
+		if err != nil {
+			return err
+		}
+		text := decodeCharset(data, p.params["charset"])
+
+		switch {
+		case p.mediaType == "text/plain" && detail.TextBody == "":
+			detail.TextBody = text
+		case p.mediaType == "text/html" && detail.HTMLBody == "":
+			detail.HTMLBody = text
+		}
+		return nil
+	})
+}
+
+// mimePart is a leaf part of a MIME message.
+type mimePart struct {
+	header     headerGetter
+	mediaType  string
+	params     map[string]string
+	filename   string
+	attachment bool
+	body       io.Reader
+}
+
+// decoded returns the part's body with its transfer encoding undone.
+func (p *mimePart) decoded() io.Reader {
+	return decodeTransferEncoding(p.body, p.header.Get("Content-Transfer-Encoding"))
+}
+
+// errStopWalk ends walkParts early without reporting an error.
+var errStopWalk = errors.New("stop walk")
+
+// walkParts calls fn for each leaf part of a (possibly nested) MIME entity,
+// in order. A part is an attachment if its Content-Disposition says so or it
+// carries a filename.
+func walkParts(h headerGetter, body io.Reader, fn func(*mimePart) error) error {
+	err := walkPartsRec(h, body, fn)
+	if err == errStopWalk {
+		return nil
+	}
+	return err
+}
+
+func walkPartsRec(h headerGetter, body io.Reader, fn func(*mimePart) error) error {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		// RFC 2045: a missing or malformed Content-Type means plain text.
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := walkPartsRec(part.Header, part, fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	disposition, dparams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	filename := dparams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	filename = decodeHeader(filename)
+
+	return fn(&mimePart{
+		header:     h,
+		mediaType:  mediaType,
+		params:     params,
+		filename:   filename,
+		attachment: disposition == "attachment" || filename != "",
+		body:       body,
+	})
+}
+
+// extractAttachment finds an attachment in a raw message by index, or by
+// filename (case-insensitively) when index is negative, and decodes it.
+func extractAttachment(r io.Reader, index int, filename string) (*AttachmentInfo, []byte, error) {
+	m, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to parse message: %v", err)
+	}
+
+	var found *AttachmentInfo
+	var data []byte
+	var names []string
+	n := 0
+	err = walkParts(m.Header, m.Body, func(p *mimePart) error {
+		if !p.attachment {
+			return nil
+		}
+		i := n
+		n++
+		names = append(names, p.filename)
+		if (index >= 0 && i != index) || (index < 0 && !strings.EqualFold(p.filename, filename)) {
+			return nil
+		}
+
+		var err error
+		if data, err = io.ReadAll(p.decoded()); err != nil {
+			return fmt.Errorf("Failed to decode attachment %d: %v", i, err)
+		}
+		found = &AttachmentInfo{Index: i, Filename: p.filename, ContentType: p.mediaType, Size: int64(len(data))}
+		return errStopWalk
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if found == nil {
+		if n == 0 {
+			return nil, nil, fmt.Errorf("message has no attachments")
+		}
+		if index >= 0 {
+			return nil, nil, fmt.Errorf("attachment_index %d out of range; message has %d attachment(s)", index, n)
+		}
+		return nil, nil, fmt.Errorf("no attachment named %q; attachments are %q", filename, names)
+	}
+	return found, data, nil
+}
+
+// SavedAttachment is an attachment written to disk by save_attachments.
+type SavedAttachment struct {
+	AttachmentInfo
+	Path string `json:"path"`
+}
+
+// writeAttachments decodes every attachment of a raw message into dir. Each
+// is named after its sanitized filename, falling back to
+// attachment-<uid>-<index>, and never replaces an existing file: a clashing
+// name gets a "-1", "-2", ... suffix before its extension. The attachments
+// written before any error are returned with it.
+func writeAttachments(r io.Reader, dir string, uid uint32) ([]SavedAttachment, error) {
+	m, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse message: %v", err)
+	}
+
+	var saved []SavedAttachment
+	n := 0
+	err = walkParts(m.Header, m.Body, func(p *mimePart) error {
+		if !p.attachment {
+			return nil
+		}
+		i := n
+		n++
+		data, err := io.ReadAll(p.decoded())
+		if err != nil {
+			return fmt.Errorf("Failed to decode attachment %d: %v", i, err)
+		}
+
+		name := safeFilename(p.filename)
+		if name == "" {
+			name = fmt.Sprintf("attachment-%d-%d", uid, i)
+		}
+		path, err := createUnique(dir, name, data)
+		if err != nil {
+			return err
+		}
+		saved = append(saved, SavedAttachment{
+			AttachmentInfo: AttachmentInfo{Index: i, Filename: p.filename, ContentType: p.mediaType, Size: int64(len(data))},
+			Path:           path,
+		})
+		return nil
+	})
+	if err != nil {
+		return saved, err
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("message has no attachments")
+	}
+	return saved, nil
+}
+
+// createUnique writes data to a new file named name in dir, or to name with
+// a numbered suffix if that is taken, and returns its path.
+func createUnique(dir, name string, data []byte) (string, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 0; ; i++ {
+		path := filepath.Join(dir, name)
+		if i > 0 {
+			path = filepath.Join(dir, fmt.Sprintf("%s-%d%s", base, i, ext))
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("Failed to create %s: %v", path, err)
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return "", fmt.Errorf("Failed to write %s: %v", path, err)
+		}
+		if err := f.Close(); err != nil {
+			return "", fmt.Errorf("Failed to write %s: %v", path, err)
+		}
+		return path, nil
+	}
+}
+
+// safeFilename reduces an attachment's filename to a single path element so
+// that a crafted name cannot escape the output directory.
+func safeFilename(name string) string {
+	name = filepath.Base(filepath.Clean("/" + strings.ReplaceAll(name, "\\", "/")))
+	// Leading dots would hide the file, or make it a dotfile such as
+	// .bashrc when saving into a home directory.
+	name = strings.TrimLeft(name, ".")
+	if name == "/" {
+		return ""
+	}
+	return name
+}
+
+// decodeTransferEncoding undoes a Content-Transfer-Encoding.
+func decodeTransferEncoding(r io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	default:
+		return r
+	}
+}
+
+// decodeCharset converts body bytes to UTF-8. Only the charsets the standard
+// library understands are converted; anything else is returned unchanged.
+func decodeCharset(data []byte, charset string) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	default:
+		return string(data)
+	}
+}
+
+// decodeHeader decodes RFC 2047 encoded-words such as =?UTF-8?B?...?=.
+func decodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// ---------- Helpers ----------
+
+func stringProp(desc string) Property {
+	return Property{Type: "string", Description: desc}
+}
+
+func stringPropDefault(desc, def string) Property {
+	return Property{Type: "string", Description: desc, Default: def}
+}
+
+func numberProp(desc string) Property {
+	return Property{Type: "number", Description: desc}
+}
+
+func stringArrayProp(desc string) Property {
+	return Property{Type: "array", Description: desc, Items: &ItemType{Type: "string"}}
+}
+
+func boolProp(desc string) Property {
+	return Property{Type: "boolean", Description: desc}
+}
+
+func getBool(args map[string]interface{}, key string) bool {
+	if val, ok := args[key].(bool); ok {
+		return val
+	}
+	return false
+}
+
+func getString(args map[string]interface{}, key string) string {
+	if val, ok := args[key].(string); ok {
+		return strings.TrimSpace(val)
+	}
+	return ""
+}
+
+// getRawString is getString without trimming, for message bodies where
+// leading and trailing whitespace is content.
+func getRawString(args map[string]interface{}, key string) string {
+	if val, ok := args[key].(string); ok {
+		return val
+	}
+	return ""
+}
+
+func getStringArray(args map[string]interface{}, key string) []string {
+	arr, ok := args[key].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	result := make([]string, 0, len(arr))
+	for _, v := range arr {
+		if str, ok := v.(string); ok && strings.TrimSpace(str) != "" {
+			result = append(result, strings.TrimSpace(str))
+		}
+	}
+	return result
+}
+
+func getInt(args map[string]interface{}, key string) int {
+	if val, ok := args[key].(float64); ok {
+		return int(val)
+	}
+	return 0
+}
+
+// ---------- JSON-RPC responses ----------
+
+// stdoutMu serializes writes to stdoutWriter so that concurrent responses
+// can never interleave JSON-RPC lines on the protocol stream.
+var (
+	stdoutMu     sync.Mutex
+	stdoutWriter io.Writer = os.Stdout
+)
+
+// writeMessage writes a single newline-terminated JSON-RPC message to stdout.
+func writeMessage(data []byte) {
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+	stdoutWriter.Write(append(data, '\n'))
+}
+
+func (s *MCPServer) sendResponse(id interface{}, result interface{}) {
+	resp := JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  result,
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		logger.Printf("Error marshaling response: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error marshaling response: %v\n", err)
+		return
+	}
+	writeMessage(data)
+	logger.Printf("Sent response for request ID: %v\n", id)
+}
+
+func (s *MCPServer) sendTextResponse(id interface{}, text string) {
+	s.sendResponse(id, ToolResult{
+		Content: []ContentItem{{Type: "text", Text: text}},
+	})
+}
+
+func (s *MCPServer) sendJSONResponse(id interface{}, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		s.sendToolError(id, fmt.Sprintf("Failed to marshal result: %v", err))
+		return
+	}
+	s.sendResponse(id, ToolResult{
+		Content: []ContentItem{{Type: "text", Text: string(data)}},
+	})
+}
+
+func (s *MCPServer) sendError(id interface{}, code int, message string, data interface{}) {
+	logger.Printf("Sending error response: code=%d, message=%s\n", code, message)
+	resp := JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error:   &RPCError{Code: code, Message: message, Data: data},
+	}
+	jsonData, err := json.Marshal(resp)
+	if err != nil {
+		logger.Printf("Error marshaling error response: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error marshaling error response: %v\n", err)
+		return
+	}
+	writeMessage(jsonData)
+}
+
+func (s *MCPServer) sendToolError(id interface{}, msg string) {
+	if s.timedOut.Load() {
+		msg += fmt.Sprintf(" (IMAP operation timed out after %s; set MAIL_TIMEOUT to change)", s.config.Timeout)
+	}
+	s.sendResponse(id, ToolResult{
+		Content: []ContentItem{{Type: "text", Text: msg}},
+		IsError: true,
+	})
+}
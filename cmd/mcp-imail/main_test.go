@@ -0,0 +1,1114 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+func TestMain(m *testing.M) {
+	logger = log.New(io.Discard, "", 0)
+	os.Exit(m.Run())
+}
+
+// twoAttachments is a multipart message with a text body and two
+// attachments: a base64 PDF whose filename tries to escape the output
+// directory, and a quoted-printable text file.
+const twoAttachments = "From: Alice <alice@example.com>\r\n" +
+	"To: bob@example.com\r\n" +
+	"Subject: Files\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"XYZ\"\r\n" +
+	"\r\n" +
+	"--XYZ\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"See attached.\r\n" +
+	"--XYZ\r\n" +
+	"Content-Type: application/pdf\r\n" +
+	"Content-Disposition: attachment; filename=\"../../etc/report.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0xLjQKJcOkw7w=\r\n" +
+	"--XYZ\r\n" +
+	"Content-Type: text/plain; name=\"notes.txt\"\r\n" +
+	"Content-Disposition: attachment; filename=\"notes.txt\"\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"caf=C3=A9 at 9=3D30\r\n" +
+	"--XYZ--\r\n"
+
+func TestWriteAttachments(t *testing.T) {
+	dir := t.TempDir()
+	saved, err := writeAttachments(strings.NewReader(twoAttachments), dir, 7)
+	if err != nil {
+		t.Fatalf("writeAttachments: %v", err)
+	}
+	if len(saved) != 2 {
+		t.Fatalf("saved %d attachments, want 2: %+v", len(saved), saved)
+	}
+
+	want := []struct {
+		filename, path, content string
+	}{
+		{"../../etc/report.pdf", filepath.Join(dir, "report.pdf"), "%PDF-1.4\n%\xc3\xa4\xc3\xbc"},
+		{"notes.txt", filepath.Join(dir, "notes.txt"), "café at 9=30"},
+	}
+	for i, w := range want {
+		if saved[i].Index != i || saved[i].Filename != w.filename || saved[i].Path != w.path {
+			t.Errorf("saved[%d] = %+v, want index %d, filename %q, path %q", i, saved[i], i, w.filename, w.path)
+		}
+		data, err := os.ReadFile(w.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != w.content {
+			t.Errorf("%s = %q, want %q", w.path, data, w.content)
+		}
+		if saved[i].Size != int64(len(w.content)) {
+			t.Errorf("saved[%d].Size = %d, want %d", i, saved[i].Size, len(w.content))
+		}
+		info, err := os.Stat(w.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("%s mode = %v, want 0600", w.path, info.Mode().Perm())
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("output dir has %d entries, want only the 2 attachments", len(entries))
+	}
+}
+
+func TestWriteAttachmentsKeepsExistingFiles(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(existing, []byte("mine"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := writeAttachments(strings.NewReader(twoAttachments), dir, 7)
+	if err != nil {
+		t.Fatalf("writeAttachments: %v", err)
+	}
+	if got := saved[1].Path; got != filepath.Join(dir, "notes-1.txt") {
+		t.Errorf("clashing attachment saved to %s, want notes-1.txt", got)
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "mine" {
+		t.Errorf("existing file was replaced with %q", data)
+	}
+}
+
+func TestWriteAttachmentsWithoutAttachments(t *testing.T) {
+	msg := "From: alice@example.com\r\nSubject: Hi\r\n\r\nJust text.\r\n"
+	if _, err := writeAttachments(strings.NewReader(msg), t.TempDir(), 7); err == nil {
+		t.Error("writeAttachments succeeded on a message without attachments")
+	}
+}
+
+func TestExtractAttachment(t *testing.T) {
+	tests := []struct {
+		name        string
+		index       int
+		filename    string
+		want        AttachmentInfo
+		wantContent string
+		wantErr     string
+	}{
+		{name: "base64 by index", index: 0, want: AttachmentInfo{Index: 0, Filename: "../../etc/report.pdf", ContentType: "application/pdf", Size: 14}, wantContent: "%PDF-1.4\n%\xc3\xa4\xc3\xbc"},
+		{name: "quoted-printable by index", index: 1, want: AttachmentInfo{Index: 1, Filename: "notes.txt", ContentType: "text/plain", Size: 13}, wantContent: "café at 9=30"},
+		{name: "by filename ignoring case", index: -1, filename: "NOTES.TXT", want: AttachmentInfo{Index: 1, Filename: "notes.txt", ContentType: "text/plain", Size: 13}, wantContent: "café at 9=30"},
+		{name: "by the filename as sent", index: -1, filename: "../../etc/report.pdf", want: AttachmentInfo{Index: 0, Filename: "../../etc/report.pdf", ContentType: "application/pdf", Size: 14}, wantContent: "%PDF-1.4\n%\xc3\xa4\xc3\xbc"},
+		{name: "index out of range", index: 2, wantErr: "out of range; message has 2 attachment(s)"},
+		{name: "unknown filename", index: -1, filename: "missing.zip", wantErr: `no attachment named "missing.zip"; attachments are ["../../etc/report.pdf" "notes.txt"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			att, data, err := extractAttachment(strings.NewReader(twoAttachments), tt.index, tt.filename)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extractAttachment: %v", err)
+			}
+			if *att != tt.want {
+				t.Errorf("attachment = %+v, want %+v", *att, tt.want)
+			}
+			if string(data) != tt.wantContent {
+				t.Errorf("content = %q, want %q", data, tt.wantContent)
+			}
+		})
+	}
+
+	msg := "From: alice@example.com\r\nSubject: Hi\r\n\r\nJust text.\r\n"
+	if _, _, err := extractAttachment(strings.NewReader(msg), 0, ""); err == nil || !strings.Contains(err.Error(), "no attachments") {
+		t.Errorf("err = %v, want no attachments", err)
+	}
+}
+
+func TestDecodeTransferEncoding(t *testing.T) {
+	tests := []struct {
+		encoding, in, want string
+	}{
+		{"base64", "aGVsbG8=", "hello"},
+		{" BASE64 ", "aGVs\r\nbG8=\r\n", "hello"},
+		{"quoted-printable", "caf=C3=A9 =3D soft=\r\nbreak", "café = softbreak"},
+		{"7bit", "plain =41", "plain =41"},
+		{"", "as is", "as is"},
+	}
+	for _, tt := range tests {
+		got, err := io.ReadAll(decodeTransferEncoding(strings.NewReader(tt.in), tt.encoding))
+		if err != nil {
+			t.Errorf("%q: %v", tt.encoding, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("decodeTransferEncoding(%q, %q) = %q, want %q", tt.in, tt.encoding, got, tt.want)
+		}
+	}
+}
+
+func TestSafeFilename(t *testing.T) {
+	tests := map[string]string{
+		"report.pdf":              "report.pdf",
+		"../../etc/passwd":        "passwd",
+		`..\..\windows\evil.exe`:  "evil.exe",
+		"/abs/path/file.txt":      "file.txt",
+		"..":                      "",
+		".bashrc":                 "bashrc",
+		"../.ssh/authorized_keys": "authorized_keys",
+		"":                        "",
+	}
+	for name, want := range tests {
+		if got := safeFilename(name); got != want {
+			t.Errorf("safeFilename(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// fakeIMAP is a scripted IMAP server on one end of a pipe. Every command
+// succeeds; untagged returns the lines to send before the tagged OK. For
+// IDLE, they are sent after the continuation, and the OK waits for DONE.
+// Literals, as sent by APPEND, are recorded separately from the command.
+type fakeIMAP struct {
+	untagged func(cmd string) []string
+
+	mu       sync.Mutex
+	commands []string
+	literals []string
+}
+
+// newFakeIMAPServer returns an MCPServer whose cached connection is already
+// authenticated (by a PREAUTH greeting) with f.
+func newFakeIMAPServer(t *testing.T, f *fakeIMAP) *MCPServer {
+	t.Helper()
+
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() {
+		clientConn.Close()
+		serverConn.Close()
+	})
+	go f.serve(serverConn)
+
+	c, err := client.New(clientConn)
+	if err != nil {
+		t.Fatalf("client.New: %v", err)
+	}
+	c.ErrorLog = log.New(io.Discard, "", 0)
+	return &MCPServer{config: &Config{Timeout: 5 * time.Second}, conn: c}
+}
+
+func (f *fakeIMAP) serve(conn net.Conn) {
+	fmt.Fprint(conn, "* PREAUTH [CAPABILITY IMAP4rev1 MOVE IDLE] ready\r\n")
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		tag, cmd, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		f.mu.Lock()
+		f.commands = append(f.commands, cmd)
+		f.mu.Unlock()
+
+		var size int
+		if i := strings.LastIndex(cmd, " {"); i >= 0 {
+			if _, err := fmt.Sscanf(cmd[i+1:], "{%d}", &size); err == nil {
+				fmt.Fprint(conn, "+ send literal\r\n")
+				literal := make([]byte, size)
+				if _, err := io.ReadFull(r, literal); err != nil {
+					return
+				}
+				// The command line ends after the literal.
+				if _, err := r.ReadString('\n'); err != nil {
+					return
+				}
+				f.mu.Lock()
+				f.literals = append(f.literals, string(literal))
+				f.mu.Unlock()
+			}
+		}
+
+		if cmd == "IDLE" {
+			fmt.Fprint(conn, "+ idling\r\n")
+		}
+		if f.untagged != nil {
+			for _, u := range f.untagged(cmd) {
+				fmt.Fprintf(conn, "* %s\r\n", u)
+			}
+		}
+		if cmd == "IDLE" {
+			if _, err := r.ReadString('\n'); err != nil {
+				return
+			}
+		}
+		fmt.Fprintf(conn, "%s OK done\r\n", tag)
+	}
+}
+
+// sent returns the commands received so far, without tags or NOOPs.
+func (f *fakeIMAP) sent() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var cmds []string
+	for _, cmd := range f.commands {
+		if cmd != "NOOP" {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return cmds
+}
+
+// callTool invokes a tool handler and returns the decoded tool result.
+func callTool(t *testing.T, s *MCPServer, name string, args map[string]interface{}) ToolResult {
+	t.Helper()
+
+	var buf bytes.Buffer
+	stdoutWriter = &buf
+	defer func() { stdoutWriter = os.Stdout }()
+
+	params, _ := json.Marshal(CallToolParams{Name: name, Arguments: args})
+	s.handleCallTool(JSONRPCRequest{JSONRPC: "2.0", ID: 1, Method: "tools/call", Params: params})
+
+	var resp struct {
+		Result ToolResult `json:"result"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &resp); err != nil {
+		t.Fatalf("Unmarshal response %q: %v", buf.String(), err)
+	}
+	return resp.Result
+}
+
+// delimiterSlash answers LIST "" "" with a "/" hierarchy delimiter.
+func delimiterSlash(cmd string) []string {
+	if cmd == `LIST "" ""` {
+		return []string{`LIST (\Noselect) "/" ""`}
+	}
+	return nil
+}
+
+func TestCreateMailboxThenMoveIntoIt(t *testing.T) {
+	f := &fakeIMAP{untagged: delimiterSlash}
+	s := newFakeIMAPServer(t, f)
+
+	result := callTool(t, s, "create_mailbox", map[string]interface{}{"name": "2024", "parent": "Receipts"})
+	if result.IsError {
+		t.Fatalf("create_mailbox: %+v", result.Content)
+	}
+	var created struct {
+		Mailbox    string `json:"mailbox"`
+		Subscribed bool   `json:"subscribed"`
+	}
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Mailbox != "Receipts/2024" || !created.Subscribed {
+		t.Errorf("created = %+v, want subscribed Receipts/2024", created)
+	}
+
+	result = callTool(t, s, "move_message", map[string]interface{}{"uid": float64(42), "destination": created.Mailbox})
+	if result.IsError {
+		t.Fatalf("move_message: %+v", result.Content)
+	}
+
+	want := []string{
+		`LIST "" ""`,
+		`CREATE "Receipts/2024"`,
+		`SUBSCRIBE "Receipts/2024"`,
+		"SELECT INBOX",
+		`UID MOVE 42 "Receipts/2024"`,
+	}
+	got := f.sent()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCreateMailboxRejectsBadNames(t *testing.T) {
+	for _, args := range []map[string]interface{}{
+		{},
+		{"name": "  "},
+		{"name": "Archive//2024"},
+		{"name": "/Receipts"},
+		{"name": "2024", "parent": "Receipts/"},
+	} {
+		f := &fakeIMAP{untagged: delimiterSlash}
+		s := newFakeIMAPServer(t, f)
+		result := callTool(t, s, "create_mailbox", args)
+		if !result.IsError {
+			t.Errorf("create_mailbox(%v) = %+v, want an error", args, result)
+		}
+		for _, cmd := range f.sent() {
+			if strings.HasPrefix(cmd, "CREATE") {
+				t.Errorf("create_mailbox(%v) sent %q", args, cmd)
+			}
+		}
+	}
+}
+
+func TestMailboxPath(t *testing.T) {
+	tests := []struct {
+		parent, name, delim string
+		want                string
+	}{
+		{"", "Receipts", "/", "Receipts"},
+		{"", "Archive/2024", "/", "Archive/2024"},
+		{"Archive", "2024", ".", "Archive.2024"},
+		{"", " Receipts ", "/", "Receipts"},
+		{"", "a/b", "", "a/b"},
+	}
+	for _, tt := range tests {
+		got, err := mailboxPath(tt.parent, tt.name, tt.delim)
+		if err != nil || got != tt.want {
+			t.Errorf("mailboxPath(%q, %q, %q) = %q, %v, want %q", tt.parent, tt.name, tt.delim, got, err, tt.want)
+		}
+	}
+	if _, err := mailboxPath("Archive", "2024", ""); err == nil {
+		t.Error("mailboxPath with a parent on a flat server succeeded")
+	}
+}
+
+func TestAwaitNewMailSeesNewMessage(t *testing.T) {
+	updates := make(chan client.Update, 3)
+	updates <- &client.StatusUpdate{}
+	updates <- &client.MailboxUpdate{Mailbox: &imap.MailboxStatus{Messages: 2}}
+	updates <- &client.MailboxUpdate{Mailbox: &imap.MailboxStatus{Messages: 4}}
+
+	prev, cur, err := awaitNewMail(context.Background(), updates, make(chan error), 3)
+	if err != nil || prev != 2 || cur != 4 {
+		t.Errorf("awaitNewMail = %d, %d, %v, want 2, 4 after an expunge and two arrivals", prev, cur, err)
+	}
+}
+
+func TestAwaitNewMailTimesOut(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	prev, cur, err := awaitNewMail(ctx, make(chan client.Update), make(chan error), 3)
+	if err != nil || prev != 3 || cur != 3 {
+		t.Errorf("awaitNewMail = %d, %d, %v, want 3, 3, nil", prev, cur, err)
+	}
+}
+
+func TestAwaitNewMailIdleEnded(t *testing.T) {
+	done := make(chan error, 1)
+	done <- nil
+	if _, _, err := awaitNewMail(context.Background(), make(chan client.Update), done, 3); err == nil {
+		t.Error("awaitNewMail succeeded after IDLE ended by itself")
+	}
+}
+
+func TestWaitForMailReturnsNewUIDs(t *testing.T) {
+	f := &fakeIMAP{untagged: func(cmd string) []string {
+		switch cmd {
+		case "EXAMINE INBOX":
+			return []string{"3 EXISTS"}
+		case "IDLE":
+			return []string{"5 EXISTS"}
+		case "FETCH 4:5 (UID)":
+			return []string{"4 FETCH (UID 1004)", "5 FETCH (UID 1005)"}
+		}
+		return nil
+	}}
+	s := newFakeIMAPServer(t, f)
+
+	result := callTool(t, s, "wait_for_mail", map[string]interface{}{"timeout": float64(5)})
+	if result.IsError {
+		t.Fatalf("wait_for_mail: %+v", result.Content)
+	}
+	var got struct {
+		NewMail     bool     `json:"new_mail"`
+		NewMessages int      `json:"new_messages"`
+		Messages    int      `json:"messages"`
+		UIDs        []uint32 `json:"uids"`
+	}
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.NewMail || got.NewMessages != 2 || got.Messages != 5 || len(got.UIDs) != 2 || got.UIDs[0] != 1004 || got.UIDs[1] != 1005 {
+		t.Errorf("result = %+v, want 2 new messages with UIDs 1004 and 1005", got)
+	}
+	want := []string{"EXAMINE INBOX", "IDLE", "FETCH 4:5 (UID)"}
+	if got := f.sent(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+}
+
+func TestWaitForMailTimesOut(t *testing.T) {
+	f := &fakeIMAP{untagged: func(cmd string) []string {
+		if cmd == "EXAMINE INBOX" {
+			return []string{"3 EXISTS"}
+		}
+		return nil
+	}}
+	s := newFakeIMAPServer(t, f)
+
+	start := time.Now()
+	result := callTool(t, s, "wait_for_mail", map[string]interface{}{"timeout": float64(1)})
+	if result.IsError {
+		t.Fatalf("wait_for_mail: %+v", result.Content)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("returned after %s, want the 1s timeout", elapsed)
+	}
+	if !strings.Contains(result.Content[0].Text, `"new_mail": false`) || !strings.Contains(result.Content[0].Text, `"uids": []`) {
+		t.Errorf("result = %s, want no new mail", result.Content[0].Text)
+	}
+
+	// The IDLE was ended cleanly, so the connection is still usable.
+	if !connAlive(s.conn) {
+		t.Error("connection unusable after the wait")
+	}
+}
+
+func TestWaitForMailRequiresTimeout(t *testing.T) {
+	s := &MCPServer{config: &Config{Timeout: 5 * time.Second}}
+	for _, args := range []map[string]interface{}{
+		{},
+		{"mailbox": "INBOX"},
+		{"timeout": float64(0)},
+		{"timeout": float64(-5)},
+	} {
+		res := callTool(t, s, "wait_for_mail", args)
+		if !res.IsError || !strings.Contains(res.Content[0].Text, "timeout is required") {
+			t.Errorf("%v: result = %+v, want timeout is required", args, res)
+		}
+	}
+}
+
+func TestSummarizeMessageJSONShape(t *testing.T) {
+	msg := &imap.Message{
+		SeqNum: 7,
+		Uid:    42,
+		Flags:  []string{imap.SeenFlag, imap.FlaggedFlag},
+		Envelope: &imap.Envelope{
+			Date:    time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC),
+			Subject: "Invoice",
+			From:    []*imap.Address{{PersonalName: "Billing", MailboxName: "billing", HostName: "example.com"}},
+			To:      []*imap.Address{{MailboxName: "me", HostName: "example.org"}},
+		},
+		BodyStructure: &imap.BodyStructure{
+			MIMEType:    "multipart",
+			MIMESubType: "mixed",
+			Parts: []*imap.BodyStructure{
+				{MIMEType: "text", MIMESubType: "plain"},
+				{MIMEType: "application", MIMESubType: "pdf", Disposition: "attachment", DispositionParams: map[string]string{"filename": "invoice.pdf"}},
+			},
+		},
+	}
+
+	data, err := json.Marshal([]MessageSummary{summarizeMessage(msg)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{{
+		"uid":             float64(42),
+		"seq_num":         float64(7),
+		"from":            []interface{}{"Billing <billing@example.com>"},
+		"to":              []interface{}{"me@example.org"},
+		"subject":         "Invoice",
+		"date":            "2024-03-01T09:30:00Z",
+		"flags":           []interface{}{`\Seen`, `\Flagged`},
+		"has_attachments": true,
+	}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("summary JSON = %s\nwant %v", data, want)
+	}
+}
+
+func TestHasAttachments(t *testing.T) {
+	text := &imap.BodyStructure{MIMEType: "text", MIMESubType: "plain"}
+	tests := []struct {
+		name string
+		bs   *imap.BodyStructure
+		want bool
+	}{
+		{"no structure", nil, false},
+		{"plain text", text, false},
+		{"alternative", &imap.BodyStructure{MIMEType: "multipart", Parts: []*imap.BodyStructure{text, {MIMEType: "text", MIMESubType: "html"}}}, false},
+		{"disposition", &imap.BodyStructure{MIMEType: "multipart", Parts: []*imap.BodyStructure{text, {MIMEType: "image", Disposition: "ATTACHMENT"}}}, true},
+		{"named part", &imap.BodyStructure{MIMEType: "multipart", Parts: []*imap.BodyStructure{text, {MIMEType: "application", Params: map[string]string{"name": "a.zip"}}}}, true},
+		{"nested", &imap.BodyStructure{MIMEType: "multipart", Parts: []*imap.BodyStructure{
+			{MIMEType: "multipart", Parts: []*imap.BodyStructure{text, {MIMEType: "text", DispositionParams: map[string]string{"filename": "notes.txt"}}}},
+		}}, true},
+	}
+	for _, tt := range tests {
+		if got := hasAttachments(tt.bs); got != tt.want {
+			t.Errorf("%s: hasAttachments = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormatSummaries(t *testing.T) {
+	got := formatSummaries([]MessageSummary{
+		{UID: 42, From: []string{"a@example.com"}, Subject: "Invoice", Date: time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC), Flags: []string{`\Seen`}, HasAttachments: true},
+		{UID: 41, From: []string{"b@example.com"}, Subject: "Hi", Date: time.Date(2024, 2, 28, 18, 0, 0, 0, time.UTC)},
+	})
+	want := "42 2024-03-01 09:30 | a@example.com | Invoice [\\Seen] (attachments)\n" +
+		"41 2024-02-28 18:00 | b@example.com | Hi\n"
+	if got != want {
+		t.Errorf("formatSummaries =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestListMessagesRejectsBadFormat(t *testing.T) {
+	s := &MCPServer{config: &Config{Timeout: 5 * time.Second}}
+	res := callTool(t, s, "list_messages", map[string]interface{}{"format": "xml"})
+	if !res.IsError || !strings.Contains(res.Content[0].Text, "invalid format") {
+		t.Errorf("result = %+v, want invalid format error", res)
+	}
+}
+
+// allowTempDir restricts attachment paths to a fresh temporary directory
+// and returns it.
+func allowTempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := allowedPaths
+	allowedPaths = []string{dir}
+	t.Cleanup(func() { allowedPaths = prev })
+	return dir
+}
+
+func TestResolveAllowedPath(t *testing.T) {
+	dir := allowTempDir(t)
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "real"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "real"), filepath.Join(dir, "alias")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "later"), filepath.Join(dir, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+
+	allowed := map[string]string{
+		dir:                                  dir,
+		filepath.Join(dir, "invoices/2024"):  filepath.Join(dir, "invoices", "2024"),
+		filepath.Join(dir, "alias", "a.pdf"): filepath.Join(dir, "real", "a.pdf"),
+	}
+	for p, want := range allowed {
+		if got, err := resolveAllowedPath(p); err != nil || got != want {
+			t.Errorf("resolveAllowedPath(%q) = %q, %v; want %q", p, got, err, want)
+		}
+	}
+
+	for _, p := range []string{
+		outside,
+		filepath.Join(dir, "escape", "new"),
+		filepath.Join(dir, "dangling", "new"),
+		filepath.Join(dir, "..", "x"),
+		filepath.Join(dir, ".ssh"),
+		filepath.Join(dir, "work", ".git", "hooks"),
+	} {
+		if got, err := resolveAllowedPath(p); err == nil {
+			t.Errorf("resolveAllowedPath(%q) = %q, want an error", p, got)
+		}
+	}
+}
+
+func TestAttachmentOutputOutsideAllowedPaths(t *testing.T) {
+	allowTempDir(t)
+	outside := t.TempDir()
+	s := &MCPServer{config: &Config{Timeout: 5 * time.Second}}
+
+	for _, tt := range []struct {
+		tool string
+		args map[string]interface{}
+	}{
+		{"save_attachments", map[string]interface{}{"uid": float64(7), "output_dir": filepath.Join(outside, "attachments")}},
+		{"download_attachment", map[string]interface{}{"uid": float64(7), "attachment_index": float64(0), "output_path": outside}},
+	} {
+		res := callTool(t, s, tt.tool, tt.args)
+		if !res.IsError || !strings.Contains(res.Content[0].Text, "outside the allowed directories") {
+			t.Errorf("%s: result = %+v, want the path refused", tt.tool, res)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outside, "attachments")); !os.IsNotExist(err) {
+		t.Errorf("output_dir was created outside the allowed directories: %v", err)
+	}
+}
+
+func TestLoadAttachmentsChecksAllowedPaths(t *testing.T) {
+	dir := allowTempDir(t)
+	outside := t.TempDir()
+	writeFile := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(filepath.Join(dir, "report.pdf"), "%PDF")
+	writeFile(filepath.Join(dir, ".ssh", "id_ed25519"), "secret")
+	writeFile(filepath.Join(outside, "secret.txt"), "secret")
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(dir, "notes.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	atts, err := loadAttachments([]string{filepath.Join(dir, "report.pdf")})
+	if err != nil {
+		t.Fatalf("loadAttachments: %v", err)
+	}
+	if len(atts) != 1 || atts[0].Filename != "report.pdf" || atts[0].ContentType != "application/pdf" || string(atts[0].Data) != "%PDF" {
+		t.Errorf("attachments = %+v", atts)
+	}
+
+	for _, p := range []string{
+		filepath.Join(dir, ".ssh", "id_ed25519"),
+		filepath.Join(outside, "secret.txt"),
+		filepath.Join(dir, "notes.txt"),
+	} {
+		if _, err := loadAttachments([]string{filepath.Join(dir, "report.pdf"), p}); err == nil {
+			t.Errorf("loadAttachments(%q): want an error", p)
+		}
+	}
+
+	s := &MCPServer{config: &Config{Timeout: 5 * time.Second}}
+	res := callTool(t, s, "send_email", map[string]interface{}{
+		"to":          []interface{}{"someone@example.com"},
+		"subject":     "keys",
+		"body":        "here",
+		"attachments": []interface{}{filepath.Join(dir, ".ssh", "id_ed25519")},
+	})
+	if !res.IsError || !strings.Contains(res.Content[0].Text, "hidden") {
+		t.Errorf("send_email result = %+v, want the attachment refused", res)
+	}
+}
+
+func TestSaveDraftAppendsWithDraftFlag(t *testing.T) {
+	f := &fakeIMAP{}
+	s := newFakeIMAPServer(t, f)
+	s.config.Email = "me@example.org"
+
+	res := callTool(t, s, "save_draft", map[string]interface{}{
+		"subject": "Plans",
+		"body":    "Not sure yet.",
+	})
+	if res.IsError {
+		t.Fatalf("save_draft: %+v", res.Content)
+	}
+
+	sent := f.sent()
+	if len(sent) != 1 || !strings.HasPrefix(sent[0], `APPEND "Drafts" (\Draft) `) {
+		t.Fatalf("commands = %q, want one APPEND to Drafts with \\Draft", sent)
+	}
+	if len(f.literals) != 1 {
+		t.Fatalf("literals = %q, want the draft", f.literals)
+	}
+	for _, want := range []string{"From: <me@example.org>\r\n", "Subject: Plans\r\n", "Not sure yet."} {
+		if !strings.Contains(f.literals[0], want) {
+			t.Errorf("draft lacks %q:\n%s", want, f.literals[0])
+		}
+	}
+	if strings.Contains(f.literals[0], "\r\nTo:") {
+		t.Errorf("draft without recipients has a To header:\n%s", f.literals[0])
+	}
+
+	res = callTool(t, s, "save_draft", map[string]interface{}{
+		"mailbox": "Work/Drafts",
+		"to":      "bob@example.com",
+		"body":    "Hi",
+	})
+	if res.IsError {
+		t.Fatalf("save_draft: %+v", res.Content)
+	}
+	if sent := f.sent(); len(sent) != 2 || !strings.HasPrefix(sent[1], `APPEND "Work/Drafts" (\Draft) `) {
+		t.Errorf("commands = %q, want an APPEND to Work/Drafts", sent)
+	}
+}
+
+func TestComposeMessage(t *testing.T) {
+	dir := allowTempDir(t)
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s := &MCPServer{config: &Config{Email: "me@example.org"}}
+
+	msg, err := s.composeMessage(map[string]interface{}{
+		"to":          "bob@example.com",
+		"cc":          []interface{}{"carol@example.com"},
+		"subject":     "Hi",
+		"body":        "  indented\n",
+		"html_body":   "<p>hi</p>",
+		"attachments": []interface{}{filepath.Join(dir, "a.txt")},
+	}, true)
+	if err != nil {
+		t.Fatalf("composeMessage: %v", err)
+	}
+	if msg.From != "me@example.org" || fmt.Sprint(msg.To) != "[bob@example.com]" || fmt.Sprint(msg.Cc) != "[carol@example.com]" {
+		t.Errorf("addresses = %q %q %q", msg.From, msg.To, msg.Cc)
+	}
+	if msg.Subject != "Hi" || msg.TextBody != "  indented\n" || msg.HTMLBody != "<p>hi</p>" {
+		t.Errorf("content = %q %q %q", msg.Subject, msg.TextBody, msg.HTMLBody)
+	}
+	if len(msg.Attachments) != 1 || string(msg.Attachments[0].Data) != "hello" {
+		t.Errorf("attachments = %+v", msg.Attachments)
+	}
+
+	if _, err := s.composeMessage(map[string]interface{}{"body": "x"}, false); err != nil {
+		t.Errorf("draft without recipients: %v", err)
+	}
+
+	// A missing recipient is reported before attachments are read.
+	_, err = s.composeMessage(map[string]interface{}{
+		"attachments": []interface{}{filepath.Join(dir, "missing.txt")},
+	}, true)
+	if err == nil || err.Error() != "to is required" {
+		t.Errorf("err = %v, want to is required", err)
+	}
+}
+
+// original is a received message for reply and forward tests.
+const original = "From: Alice <alice@example.com>\r\n" +
+	"To: me@example.org, Carol <carol@example.com>\r\n" +
+	"Cc: ALICE@example.com, dave@example.com\r\n" +
+	"Subject: Lunch\r\n" +
+	"Date: Fri, 01 Mar 2024 09:30:00 +0000\r\n" +
+	"Message-ID: <c@example.com>\r\n" +
+	"In-Reply-To: <b@example.com>\r\n" +
+	"References: <a@example.com>\r\n <b@example.com>\r\n" +
+	"\r\n" +
+	"Noon?\r\n" +
+	"\r\n" +
+	"> earlier\r\n"
+
+func TestParseOriginal(t *testing.T) {
+	tests := []struct {
+		name        string
+		headers     string
+		wantReplyTo string
+		wantID      string
+		wantRefs    []string
+	}{
+		{
+			name:        "references chain",
+			headers:     "From: alice@example.com\r\nMessage-ID: <c@example.com>\r\nIn-Reply-To: <b@example.com>\r\nReferences: <a@example.com> <b@example.com>\r\n",
+			wantReplyTo: "alice@example.com",
+			wantID:      "<c@example.com>",
+			wantRefs:    []string{"<a@example.com>", "<b@example.com>", "<c@example.com>"},
+		},
+		{
+			name:        "in-reply-to without references",
+			headers:     "From: alice@example.com\r\nMessage-ID: <c@example.com>\r\nIn-Reply-To: <b@example.com> (Bob's message)\r\n",
+			wantReplyTo: "alice@example.com",
+			wantID:      "<c@example.com>",
+			wantRefs:    []string{"<b@example.com>", "<c@example.com>"},
+		},
+		{
+			name:        "first message in thread",
+			headers:     "From: alice@example.com\r\nMessage-ID: <a@example.com>\r\n",
+			wantReplyTo: "alice@example.com",
+			wantID:      "<a@example.com>",
+			wantRefs:    []string{"<a@example.com>"},
+		},
+		{
+			name:        "no message-id",
+			headers:     "From: alice@example.com\r\nReferences: <a@example.com>\r\n",
+			wantReplyTo: "alice@example.com",
+			wantRefs:    []string{"<a@example.com>"},
+		},
+		{
+			name:        "reply-to overrides from",
+			headers:     "From: alice@example.com\r\nReply-To: list@example.com\r\n",
+			wantReplyTo: "list@example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orig, err := parseOriginal([]byte(tt.headers + "Subject: Hi\r\n\r\nBody\r\n"))
+			if err != nil {
+				t.Fatalf("parseOriginal: %v", err)
+			}
+			if len(orig.replyTo) != 1 || orig.replyTo[0].Address != tt.wantReplyTo {
+				t.Errorf("replyTo = %v, want %s", orig.replyTo, tt.wantReplyTo)
+			}
+			if orig.messageID != tt.wantID {
+				t.Errorf("messageID = %q, want %q", orig.messageID, tt.wantID)
+			}
+			if fmt.Sprint(orig.references) != fmt.Sprint(tt.wantRefs) {
+				t.Errorf("references = %q, want %q", orig.references, tt.wantRefs)
+			}
+		})
+	}
+}
+
+func TestComposeReply(t *testing.T) {
+	orig, err := parseOriginal([]byte(original))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		replyAll bool
+		quote    bool
+		wantCc   []string
+		wantText string
+	}{
+		{name: "reply", wantText: "Sure."},
+		{
+			name:     "reply all skips self and duplicates",
+			replyAll: true,
+			wantCc:   []string{`"Carol" <carol@example.com>`, "<dave@example.com>"},
+			wantText: "Sure.",
+		},
+		{
+			name:     "quoted",
+			quote:    true,
+			wantText: "Sure.\n\nOn Fri, Mar 1, 2024 at 09:30, Alice <alice@example.com> wrote:\n> Noon?\n>\n>> earlier\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := composeReply(orig, "me@example.org", "Sure.\n", tt.replyAll, tt.quote)
+			if err != nil {
+				t.Fatalf("composeReply: %v", err)
+			}
+			if fmt.Sprint(msg.To) != fmt.Sprint([]string{`"Alice" <alice@example.com>`}) {
+				t.Errorf("To = %q", msg.To)
+			}
+			if fmt.Sprint(msg.Cc) != fmt.Sprint(tt.wantCc) {
+				t.Errorf("Cc = %q, want %q", msg.Cc, tt.wantCc)
+			}
+			if msg.Subject != "Re: Lunch" {
+				t.Errorf("Subject = %q, want %q", msg.Subject, "Re: Lunch")
+			}
+			if msg.InReplyTo != "<c@example.com>" {
+				t.Errorf("InReplyTo = %q, want <c@example.com>", msg.InReplyTo)
+			}
+			wantRefs := []string{"<a@example.com>", "<b@example.com>", "<c@example.com>"}
+			if fmt.Sprint(msg.References) != fmt.Sprint(wantRefs) {
+				t.Errorf("References = %q, want %q", msg.References, wantRefs)
+			}
+			if strings.TrimRight(msg.TextBody, "\n") != strings.TrimRight(tt.wantText, "\n") {
+				t.Errorf("TextBody = %q, want %q", msg.TextBody, tt.wantText)
+			}
+		})
+	}
+
+	// The threading headers make it into the rendered message.
+	msg, _ := composeReply(orig, "me@example.org", "Sure.", false, false)
+	raw, _, err := buildMessage(msg)
+	if err != nil {
+		t.Fatalf("buildMessage: %v", err)
+	}
+	for _, want := range []string{
+		"Subject: Re: Lunch\r\n",
+		"In-Reply-To: <c@example.com>\r\n",
+		"References: <a@example.com>\r\n <b@example.com>\r\n <c@example.com>\r\n",
+	} {
+		if !strings.Contains(string(raw), want) {
+			t.Errorf("message lacks %q:\n%s", want, raw)
+		}
+	}
+
+	if _, err := composeReply(&originalMessage{detail: &MessageDetail{}}, "me@example.org", "", false, false); err == nil {
+		t.Error("reply to a message without From succeeded")
+	}
+}
+
+func TestComposeForwardAsAttachment(t *testing.T) {
+	orig, err := parseOriginal([]byte(original))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := composeForward(orig, "me@example.org", "FYI", true)
+	if err != nil {
+		t.Fatalf("composeForward: %v", err)
+	}
+	msg.To = []string{"erin@example.com"}
+	if msg.Subject != "Fwd: Lunch" {
+		t.Errorf("Subject = %q, want %q", msg.Subject, "Fwd: Lunch")
+	}
+
+	raw, _, err := buildMessage(msg)
+	if err != nil {
+		t.Fatalf("buildMessage: %v", err)
+	}
+	for _, want := range []string{
+		"Content-Type: message/rfc822\r\n",
+		"filename=Lunch.eml\r\n",
+		"Message-ID: <c@example.com>\r\n",
+	} {
+		if !strings.Contains(string(raw), want) {
+			t.Errorf("message lacks %q:\n%s", want, raw)
+		}
+	}
+}
+
+func TestPrefixSubject(t *testing.T) {
+	tests := []struct {
+		prefix, subject, want string
+	}{
+		{"Re:", "Lunch", "Re: Lunch"},
+		{"Re:", "Re: Lunch", "Re: Lunch"},
+		{"Re:", "RE: Lunch", "RE: Lunch"},
+		{"Re:", "  Lunch ", "Re: Lunch"},
+		{"Re:", "", "Re:"},
+		{"Fwd:", "Lunch", "Fwd: Lunch"},
+		{"Fwd:", "fwd: Lunch", "fwd: Lunch"},
+		{"Fwd:", "Re: Lunch", "Fwd: Re: Lunch"},
+		{"Re:", "Fwd: Lunch", "Re: Fwd: Lunch"},
+		{"Re:", "Rent", "Re: Rent"},
+	}
+	for _, tt := range tests {
+		if got := prefixSubject(tt.prefix, tt.subject); got != tt.want {
+			t.Errorf("prefixSubject(%q, %q) = %q, want %q", tt.prefix, tt.subject, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"one line", "> one line\n"},
+		{"a\r\nb\r\n", "> a\n> b\n"},
+		{"a\n\nb", "> a\n>\n> b\n"},
+		{"> quoted\n>> deeper", ">> quoted\n>>> deeper\n"},
+		{"trailing\n\n\n", "> trailing\n"},
+	}
+	for _, tt := range tests {
+		if got := quoteText(tt.in); got != tt.want {
+			t.Errorf("quoteText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers string
+		want    MessageDetail
+	}{
+		{
+			name: "encoded words",
+			headers: "From: =?utf-8?q?Jos=C3=A9?= <jose@example.com>\r\n" +
+				"To: =?iso-8859-1?b?SvxyZ2Vu?= <j@example.com>, bob@example.com\r\n" +
+				"Subject: =?utf-8?q?Caf=C3=A9?= =?utf-8?b?IG1lbnU=?=\r\n" +
+				"Date: Fri, 01 Mar 2024 09:30:00 +0100\r\n",
+			want: MessageDetail{
+				From:    "José <jose@example.com>",
+				To:      "Jürgen <j@example.com>, bob@example.com",
+				Subject: "Café menu",
+				Date:    "2024-03-01T09:30:00+01:00",
+			},
+		},
+		{
+			name:    "missing date",
+			headers: "From: alice@example.com\r\nSubject: Hi\r\n",
+			want:    MessageDetail{From: "alice@example.com", Subject: "Hi"},
+		},
+		{
+			name:    "malformed date is kept as sent",
+			headers: "From: alice@example.com\r\nDate: last Tuesday\r\n",
+			want:    MessageDetail{From: "alice@example.com", Date: "last Tuesday"},
+		},
+		{
+			name:    "bad encoded word is kept as sent",
+			headers: "Subject: =?x-unknown?q?abc?=\r\n",
+			want:    MessageDetail{Subject: "=?x-unknown?q?abc?="},
+		},
+		{
+			name:    "threading fields",
+			headers: "Reply-To: list@example.com\r\nCc: carol@example.com\r\nMessage-ID: <a@example.com>\r\n",
+			want:    MessageDetail{ReplyTo: "list@example.com", Cc: "carol@example.com", MessageID: "<a@example.com>"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseHeaders(strings.NewReader(tt.headers + "\r\n"))
+			if err != nil {
+				t.Fatalf("parseHeaders: %v", err)
+			}
+			if fmt.Sprintf("%+v", *got) != fmt.Sprintf("%+v", tt.want) {
+				t.Errorf("parseHeaders =\n%+v\nwant\n%+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadMessageHeadersOnly(t *testing.T) {
+	headers := "From: alice@example.com\r\nSubject: =?utf-8?q?Caf=C3=A9?=\r\n\r\n"
+	f := &fakeIMAP{untagged: func(cmd string) []string {
+		if strings.HasPrefix(cmd, "UID FETCH 7 ") {
+			return []string{fmt.Sprintf("1 FETCH (UID 7 FLAGS (\\Seen) BODY[HEADER.FIELDS (FROM TO SUBJECT DATE)] {%d}\r\n%s)", len(headers), headers)}
+		}
+		return nil
+	}}
+	s := newFakeIMAPServer(t, f)
+
+	res := callTool(t, s, "read_message", map[string]interface{}{"uid": float64(7), "headers": true})
+	if res.IsError {
+		t.Fatalf("read_message: %+v", res.Content)
+	}
+	var detail MessageDetail
+	if err := json.Unmarshal([]byte(res.Content[0].Text), &detail); err != nil {
+		t.Fatal(err)
+	}
+	if detail.UID != 7 || detail.From != "alice@example.com" || detail.Subject != "Café" || detail.TextBody != "" {
+		t.Errorf("detail = %+v", detail)
+	}
+
+	sent := f.sent()
+	if len(sent) != 2 || !strings.Contains(sent[1], "BODY.PEEK[HEADER.FIELDS (FROM TO SUBJECT DATE)]") {
+		t.Errorf("commands = %q, want a header-only peek", sent)
+	}
+}
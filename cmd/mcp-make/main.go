@@ -10,7 +10,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sync"
 
+	"github.com/soyeahso/hunter3/internal/logfile"
 )
 
 // MCP Protocol Types
@@ -88,24 +90,13 @@ type ListToolsResult struct {
 var logger *log.Logger
 var stdout *bufio.Writer
 
-func initLogger() {
-	// Create logs directory if it doesn't exist
-	logsDir := filepath.Join(os.Getenv("HOME"), ".hunter3", "logs")
-	if err := os.MkdirAll(logsDir, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create logs directory: %v\n", err)
-		return
-	}
-
-	// Open log file
-	logFile := filepath.Join(logsDir, "mcp-make.log")
-	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to open log file: %v\n", err)
-		return
-	}
+// stdoutMu guards stdout so that concurrent responses can never interleave
+// JSON-RPC lines.
+var stdoutMu sync.Mutex
 
-	// Create logger that writes to both file and stderr
-	logger = log.New(io.MultiWriter(f, os.Stderr), "[mcp-make] ", log.LstdFlags)
+func initLogger() {
+	// Log to stderr and to a file rotated by size and readable only by the owner
+	logger = logfile.NewLogger("mcp-make")
 	logger.Println("MCP Make server starting...")
 }
 
@@ -274,7 +265,9 @@ func (s *MCPServer) executeMake(id interface{}, rule string) {
 
 	// Flush all output to the client before running make, since make all
 	// rebuilds this binary and triggers autorestart.
+	stdoutMu.Lock()
 	stdout.Flush()
+	stdoutMu.Unlock()
 
 	ctx := context.Background()
 
@@ -335,6 +328,15 @@ func (s *MCPServer) executeMake(id interface{}, rule string) {
 	s.sendResponse(id, result)
 }
 
+// writeMessage writes a single newline-terminated JSON-RPC message to stdout
+// and flushes it to the client.
+func writeMessage(data []byte) {
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+	stdout.Write(append(data, '\n'))
+	stdout.Flush()
+}
+
 func (s *MCPServer) sendResponse(id interface{}, result interface{}) {
 	resp := JSONRPCResponse{
 		JSONRPC: "2.0",
@@ -349,8 +351,7 @@ func (s *MCPServer) sendResponse(id interface{}, result interface{}) {
 		return
 	}
 
-	fmt.Fprintln(stdout, string(data))
-	stdout.Flush()
+	writeMessage(data)
 	logger.Printf("Sent response for request ID: %v\n", id)
 
 }
@@ -375,7 +376,6 @@ func (s *MCPServer) sendError(id interface{}, code int, message string, data int
 		return
 	}
 
-	fmt.Fprintln(stdout, string(jsonData))
-	stdout.Flush()
+	writeMessage(jsonData)
 
 }
@@ -7,7 +7,9 @@ import (
 	"io"
 	"log"
 	"os"
-	"path/filepath"
+	"sync"
+
+	"github.com/soyeahso/hunter3/internal/logfile"
 )
 
 // MCP Protocol Types
@@ -95,20 +97,8 @@ const (
 var logger *log.Logger
 
 func initLogger() {
-	logsDir := filepath.Join(os.Getenv("HOME"), ".hunter3", "logs")
-	if err := os.MkdirAll(logsDir, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create logs directory: %v\n", err)
-		return
-	}
-
-	logFile := filepath.Join(logsDir, "mcp-ssh.log")
-	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to open log file: %v\n", err)
-		return
-	}
-
-	logger = log.New(io.MultiWriter(f, os.Stderr), "[mcp-ssh] ", log.LstdFlags)
+	// Log to stderr and to a file rotated by size and readable only by the owner
+	logger = logfile.NewLogger("mcp-ssh")
 	logger.Println("MCP SSH server starting...")
 }
 
@@ -309,6 +299,20 @@ func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
 	s.sendResponse(req.ID, result)
 }
 
+// stdoutMu serializes writes to stdoutWriter so that concurrent responses
+// can never interleave JSON-RPC lines on the protocol stream.
+var (
+	stdoutMu     sync.Mutex
+	stdoutWriter io.Writer = os.Stdout
+)
+
+// writeMessage writes a single newline-terminated JSON-RPC message to stdout.
+func writeMessage(data []byte) {
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+	stdoutWriter.Write(append(data, '\n'))
+}
+
 func (s *MCPServer) sendResponse(id interface{}, result interface{}) {
 	resp := JSONRPCResponse{
 		JSONRPC: "2.0",
@@ -323,7 +327,7 @@ func (s *MCPServer) sendResponse(id interface{}, result interface{}) {
 		return
 	}
 
-	fmt.Println(string(data))
+	writeMessage(data)
 	logger.Printf("Sent response for request ID: %v\n", id)
 }
 
@@ -347,5 +351,5 @@ func (s *MCPServer) sendError(id interface{}, code int, message string, data int
 		return
 	}
 
-	fmt.Println(string(jsonData))
+	writeMessage(jsonData)
 }
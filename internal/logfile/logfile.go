@@ -0,0 +1,191 @@
+// Package logfile provides the size-rotated log files the MCP servers write
+// to ~/.hunter3/logs.
+package logfile
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// Defaults for rotation, overridden by HUNTER3_LOG_MAX_BYTES and
+// HUNTER3_LOG_KEEP.
+const (
+	DefaultMaxBytes = 10 << 20
+	DefaultKeep     = 3
+)
+
+// File is an append-only log file that is rotated once it would grow past
+// MaxBytes: name.log is renamed to name.log.1, name.log.1 to name.log.2, and
+// so on, keeping at most Keep old files. It is safe for concurrent use.
+type File struct {
+	path     string
+	maxBytes int64
+	keep     int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// NewLogger returns a logger prefixed with [name] that writes to stderr and
+// to the rotated log file ~/.hunter3/logs/<name>.log. It never returns nil:
+// if the file cannot be opened, it logs why and writes to stderr only.
+// Invalid rotation settings are logged and replaced by the defaults.
+func NewLogger(name string) *log.Logger {
+	maxBytes, keep, warnings := limitsFromEnv()
+	var w io.Writer = os.Stderr
+	if f, err := open(name, maxBytes, keep); err != nil {
+		warnings = append(warnings, fmt.Sprintf("failed to open log file: %v; logging to stderr only", err))
+	} else {
+		w = io.MultiWriter(f, os.Stderr)
+	}
+
+	logger := log.New(w, "["+name+"] ", log.LstdFlags)
+	for _, warning := range warnings {
+		logger.Printf("WARNING: %s\n", warning)
+	}
+	return logger
+}
+
+// Open opens ~/.hunter3/logs/<name>.log, creating the directory if needed,
+// with the rotation limits from the environment. Invalid limits fall back
+// to the defaults.
+func Open(name string) (*File, error) {
+	maxBytes, keep, _ := limitsFromEnv()
+	return open(name, maxBytes, keep)
+}
+
+func open(name string, maxBytes int64, keep int) (*File, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(home, ".hunter3", "logs")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create logs directory: %w", err)
+	}
+	return OpenPath(filepath.Join(dir, name+".log"), maxBytes, keep)
+}
+
+// limitsFromEnv reads HUNTER3_LOG_MAX_BYTES and HUNTER3_LOG_KEEP, keeping
+// the default for each one that is not a non-negative number and
+// describing why in warnings.
+func limitsFromEnv() (maxBytes int64, keep int, warnings []string) {
+	maxBytes, keep = DefaultMaxBytes, DefaultKeep
+	if v := os.Getenv("HUNTER3_LOG_MAX_BYTES"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n >= 0 {
+			maxBytes = n
+		} else {
+			warnings = append(warnings, fmt.Sprintf("invalid HUNTER3_LOG_MAX_BYTES %q: use a number of bytes; using %d", v, maxBytes))
+		}
+	}
+	if v := os.Getenv("HUNTER3_LOG_KEEP"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			keep = n
+		} else {
+			warnings = append(warnings, fmt.Sprintf("invalid HUNTER3_LOG_KEEP %q: use a number of files; using %d", v, keep))
+		}
+	}
+	return maxBytes, keep, warnings
+}
+
+// OpenPath opens the log file at path. A maxBytes of zero disables
+// rotation; a keep of zero discards the old contents when rotating.
+//
+// The file is readable only by its owner, since logs can record command
+// lines and request details. A log created with looser permissions by an
+// older version is tightened on open.
+func OpenPath(path string, maxBytes int64, keep int) (*File, error) {
+	lf := &File{path: path, maxBytes: maxBytes, keep: keep}
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+func (lf *File) open() error {
+	f, err := os.OpenFile(lf.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(0o600); err != nil {
+		f.Close()
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	lf.f, lf.size = f, info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if p would take the file past its limit.
+// A single write larger than the limit still goes to a fresh file whole.
+func (lf *File) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	if lf.f == nil {
+		return 0, os.ErrClosed
+	}
+	if lf.maxBytes > 0 && lf.size > 0 && lf.size+int64(len(p)) > lf.maxBytes {
+		if err := lf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := lf.f.Write(p)
+	lf.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the old files along, dropping the oldest, and starts a new
+// empty file at path.
+func (lf *File) rotate() error {
+	if err := lf.f.Close(); err != nil {
+		return err
+	}
+	lf.f = nil
+
+	if lf.keep == 0 {
+		if err := os.Remove(lf.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return lf.open()
+	}
+
+	os.Remove(fmt.Sprintf("%s.%d", lf.path, lf.keep))
+	for i := lf.keep - 1; i >= 1; i-- {
+		old := fmt.Sprintf("%s.%d", lf.path, i)
+		if err := os.Rename(old, fmt.Sprintf("%s.%d", lf.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(lf.path, lf.path+".1"); err != nil {
+		// Keep logging to the current file rather than not at all.
+		if openErr := lf.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	return lf.open()
+}
+
+// Close closes the file.
+func (lf *File) Close() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	if lf.f == nil {
+		return os.ErrClosed
+	}
+	err := lf.f.Close()
+	lf.f = nil
+	return err
+}
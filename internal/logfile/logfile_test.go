@@ -0,0 +1,146 @@
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestOpenPathCreatesPrivateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcp-test.log")
+	lf, err := OpenPath(path, 0, DefaultKeep)
+	require.NoError(t, err)
+	defer lf.Close()
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestOpenPathTightensExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcp-test.log")
+	require.NoError(t, os.WriteFile(path, []byte("old\n"), 0o644))
+	require.NoError(t, os.Chmod(path, 0o644))
+
+	lf, err := OpenPath(path, 0, DefaultKeep)
+	require.NoError(t, err)
+	_, err = lf.Write([]byte("new\n"))
+	require.NoError(t, err)
+	require.NoError(t, lf.Close())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	assert.Equal(t, "old\nnew\n", readFile(t, path))
+}
+
+func TestWriteRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcp-test.log")
+	lf, err := OpenPath(path, 10, 2)
+	require.NoError(t, err)
+	defer lf.Close()
+
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n", "gggg\n"} {
+		_, err := lf.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, "gggg\n", readFile(t, path))
+	assert.Equal(t, "eeee\nffff\n", readFile(t, path+".1"))
+	assert.Equal(t, "cccc\ndddd\n", readFile(t, path+".2"))
+	assert.NoFileExists(t, path+".3")
+
+	info, err := os.Stat(path + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestWriteRotatesWithoutKeepingOldFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcp-test.log")
+	lf, err := OpenPath(path, 10, 0)
+	require.NoError(t, err)
+	defer lf.Close()
+
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n"} {
+		_, err := lf.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, "cccc\n", readFile(t, path))
+	assert.NoFileExists(t, path+".1")
+}
+
+func TestWriteLargerThanLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcp-test.log")
+	lf, err := OpenPath(path, 4, 1)
+	require.NoError(t, err)
+	defer lf.Close()
+
+	_, err = lf.Write([]byte("a long first line\n"))
+	require.NoError(t, err)
+	_, err = lf.Write([]byte("another long line\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "another long line\n", readFile(t, path))
+	assert.Equal(t, "a long first line\n", readFile(t, path+".1"))
+}
+
+func TestOpenReadsLimitsFromEnv(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("HUNTER3_LOG_MAX_BYTES", "100")
+	t.Setenv("HUNTER3_LOG_KEEP", "5")
+
+	lf, err := Open("mcp-test")
+	require.NoError(t, err)
+	defer lf.Close()
+
+	assert.Equal(t, filepath.Join(home, ".hunter3", "logs", "mcp-test.log"), lf.path)
+	assert.Equal(t, int64(100), lf.maxBytes)
+	assert.Equal(t, 5, lf.keep)
+
+	t.Setenv("HUNTER3_LOG_KEEP", "many")
+	lf, err = Open("mcp-test")
+	require.NoError(t, err)
+	defer lf.Close()
+	assert.Equal(t, DefaultKeep, lf.keep)
+}
+
+func TestNewLoggerFallsBackOnInvalidLimits(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("HUNTER3_LOG_MAX_BYTES", "-1")
+	t.Setenv("HUNTER3_LOG_KEEP", "many")
+
+	logger := NewLogger("mcp-test")
+	require.NotNil(t, logger)
+	logger.Println("started")
+
+	got := readFile(t, filepath.Join(home, ".hunter3", "logs", "mcp-test.log"))
+	assert.Contains(t, got, `[mcp-test] `)
+	assert.Contains(t, got, `WARNING: invalid HUNTER3_LOG_MAX_BYTES "-1"`)
+	assert.Contains(t, got, `WARNING: invalid HUNTER3_LOG_KEEP "many"`)
+	assert.Contains(t, got, "started")
+}
+
+func TestNewLoggerWithoutLogFile(t *testing.T) {
+	// A HOME that is a regular file makes the logs directory impossible
+	// to create.
+	home := filepath.Join(t.TempDir(), "home")
+	require.NoError(t, os.WriteFile(home, nil, 0o600))
+	t.Setenv("HOME", home)
+
+	logger := NewLogger("mcp-test")
+	require.NotNil(t, logger)
+	assert.Equal(t, os.Stderr, logger.Writer())
+}